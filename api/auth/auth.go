@@ -0,0 +1,271 @@
+// Package auth guards the API with a master password. Logging in with the
+// master password opens a session, its token is sent as a bearer token with
+// every request after that. Until a master password is set the API stays
+// open, as it was before there was one.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"passvault/crypt"
+	"passvault/response"
+	"passvault/structs"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MinPasswordLength is the shortest master password that is accepted
+const MinPasswordLength = 8
+
+const (
+	// freeAttempts is how many wrong master passwords a client may try in a
+	// row before it has to wait between attempts
+	freeAttempts = 3
+	// maxBackoff is the longest a client waits between attempts, the wait
+	// doubles with every wrong password until it gets there. A client
+	// trying nothing for that long after its wait is forgotten.
+	maxBackoff = 5 * time.Minute
+	// maxClients is how many clients wrong passwords are counted for one by
+	// one. Beyond that new clients are counted together as overflowClient.
+	maxClients     = 10000
+	overflowClient = "overflow"
+)
+
+// Manager checks the master password and keeps track of sessions. Sessions
+// are kept in memory only, a restart logs every client out.
+type Manager struct {
+	path string
+	ttl  time.Duration
+	hash *crypt.PasswordHash
+	// sessions maps the SHA-256 of every session token onto its expiry, the
+	// tokens themselves are never kept
+	sessions map[[32]byte]time.Time
+	// failures counts the wrong master passwords of every client since its
+	// last successful attempt, until it is forgotten
+	failures map[string]*failures
+	mu       sync.Mutex
+}
+
+// failures are the wrong master passwords of a client in a row
+type failures struct {
+	count int
+	// until is when the client may try again
+	until time.Time
+}
+
+// backoff returns how long a client waits after count wrong passwords
+func backoff(count int) time.Duration {
+	if count < freeAttempts {
+		return 0
+	}
+	return min(time.Second<<min(count-freeAttempts, 16), maxBackoff)
+}
+
+// NewManager returns a manager keeping the hash of the master password in
+// the file at path. Sessions expire after ttl.
+func NewManager(path string, ttl time.Duration) (*Manager, error) {
+	m := &Manager{path: path, ttl: ttl, sessions: map[[32]byte]time.Time{}, failures: map[string]*failures{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.hash, err = crypt.ParsePasswordHash(data); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Enabled reports whether a master password is set
+func (m *Manager) Enabled() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hash != nil
+}
+
+// SetPassword sets the master password. Once one is set, current has to
+// match it, client is throttled like in Login. Every session is ended,
+// clients log in again with the new one.
+func (m *Manager) SetPassword(client, current, password string) error {
+	if len(password) < MinPasswordLength {
+		return response.ErrMasterPasswordShort
+	}
+	checked, err := m.verify(client, current, true)
+	if err != nil {
+		return err
+	}
+	hash, err := crypt.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	data, err := hash.Marshal()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// current was checked against a master password changed since
+	if m.hash != checked {
+		return response.ErrWrongMasterPassword
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0700); err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, m.path); err != nil {
+		return err
+	}
+
+	m.hash = hash
+	clear(m.sessions)
+	return nil
+}
+
+// Login opens a session when password is the master password. After a few
+// wrong passwords in a row client has to wait longer and longer before it
+// may try again, until it gets the password right.
+func (m *Manager) Login(client, password string) (*structs.Session, error) {
+	if _, err := m.verify(client, password, false); err != nil {
+		return nil, err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for key, expires := range m.sessions {
+		if now.After(expires) {
+			delete(m.sessions, key)
+		}
+	}
+	session := &structs.Session{Token: token, ExpiresAt: now.Add(m.ttl).UTC()}
+	m.sessions[sha256.Sum256([]byte(token))] = session.ExpiresAt
+	return session, nil
+}
+
+// verify checks password against the master password for client and
+// returns the hash it was checked against. Without a master password it
+// fails, unless unset is allowed. The hash is checked
+// without holding the lock, so requests carrying a session aren't held up
+// by it. Every attempt counts as wrong until the check is done, which keeps
+// a client from getting around the wait with attempts at the same time.
+func (m *Manager) verify(client, password string, unset bool) (*crypt.PasswordHash, error) {
+	m.mu.Lock()
+	hash := m.hash
+	if hash == nil {
+		m.mu.Unlock()
+		if unset {
+			return nil, nil
+		}
+		return nil, response.ErrNoMasterPassword
+	}
+	now := time.Now()
+	failed := m.failures[client]
+	if failed == nil {
+		maps.DeleteFunc(m.failures, func(_ string, f *failures) bool { return now.After(f.until.Add(maxBackoff)) })
+		if len(m.failures) >= maxClients {
+			client = overflowClient
+			failed = m.failures[client]
+		}
+	}
+	if failed == nil {
+		failed = &failures{}
+		m.failures[client] = failed
+	}
+	if wait := failed.until.Sub(now); wait > 0 {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("%w, try again in %s", response.ErrTooManyAttempts, wait.Round(time.Second))
+	}
+	failed.count++
+	failed.until = now.Add(backoff(failed.count))
+	m.mu.Unlock()
+
+	if !hash.Verify(password) {
+		return nil, response.ErrWrongMasterPassword
+	}
+	m.mu.Lock()
+	delete(m.failures, client)
+	m.mu.Unlock()
+	return hash, nil
+}
+
+// Logout ends the session of token
+func (m *Manager) Logout(token string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, sha256.Sum256([]byte(token)))
+}
+
+// Valid reports whether token belongs to a session that hasn't expired
+func (m *Manager) Valid(token string) bool {
+	_, ok := m.Expiry(token)
+	return ok
+}
+
+// Expiry returns when the session of token expires, false when token
+// belongs to no session or to one that has expired
+func (m *Manager) Expiry(token string) (time.Time, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := sha256.Sum256([]byte(token))
+	expires, ok := m.sessions[key]
+	if ok && time.Now().After(expires) {
+		delete(m.sessions, key)
+		return time.Time{}, false
+	}
+	return expires, ok
+}
+
+// Token returns the bearer token of a request
+func Token(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// Client returns the address a request came from, wrong master passwords
+// are counted by it. Forwarded headers only change it for requests from
+// trusted proxies, others could name any address to get around the count.
+func Client(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Require rejects requests without a valid session once a master password is set
+func (m *Manager) Require(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.Enabled() && !m.Valid(Token(r)) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="passvault"`)
+			response.ErrorResponse(&w, http.StatusUnauthorized, response.ErrUnauthorized.Error())
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,324 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"passvault/response"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestManager(t *testing.T, ttl time.Duration) *Manager {
+	t.Helper()
+	m, err := NewManager(filepath.Join(t.TempDir(), "auth.json"), ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestSetPassword(t *testing.T) {
+	m := newTestManager(t, time.Hour)
+	if m.Enabled() {
+		t.Fatal("a new manager has a master password")
+	}
+	if _, err := m.Login("client", "anything"); !errors.Is(err, response.ErrNoMasterPassword) {
+		t.Fatalf("Login without a master password = %v", err)
+	}
+
+	steps := []struct {
+		name     string
+		current  string
+		password string
+		err      error
+	}{
+		{"too short", "", "short", response.ErrMasterPasswordShort},
+		{"first password", "", "password1", nil},
+		{"wrong current password", "wrong", "password2", response.ErrWrongMasterPassword},
+		{"changed", "password1", "password2", nil},
+	}
+	for _, step := range steps {
+		if err := m.SetPassword("client", step.current, step.password); !errors.Is(err, step.err) {
+			t.Fatalf("%s: SetPassword = %v, want %v", step.name, err, step.err)
+		}
+	}
+
+	session, err := m.Login("client", "password2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Valid(session.Token) {
+		t.Fatal("the new session is not valid")
+	}
+	// Changing the password ends every session
+	if err := m.SetPassword("client", "password2", "password3"); err != nil {
+		t.Fatal(err)
+	}
+	if m.Valid(session.Token) {
+		t.Fatal("the session outlived a password change")
+	}
+
+	reopened, err := NewManager(m.path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Login("client", "password3"); err != nil {
+		t.Fatalf("Login after reopening = %v", err)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	m := newTestManager(t, 50*time.Millisecond)
+	if err := m.SetPassword("client", "", "password1"); err != nil {
+		t.Fatal(err)
+	}
+	first, err := m.Login("client", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := m.Login("client", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Token == second.Token {
+		t.Fatal("two logins share a token")
+	}
+
+	m.Logout(first.Token)
+	if m.Valid(first.Token) || !m.Valid(second.Token) {
+		t.Fatal("Logout ended the wrong session")
+	}
+	if m.Valid("") || m.Valid("unknown") {
+		t.Fatal("a token without a session is valid")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if m.Valid(second.Token) {
+		t.Fatal("an expired session is valid")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		count int
+		want  time.Duration
+	}{
+		{0, 0},
+		{freeAttempts - 1, 0},
+		{freeAttempts, time.Second},
+		{freeAttempts + 1, 2 * time.Second},
+		{freeAttempts + 4, 16 * time.Second},
+		{freeAttempts + 20, maxBackoff},
+		{1000, maxBackoff},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.count); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	m := newTestManager(t, time.Hour)
+	if err := m.SetPassword("", "", "password1"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range freeAttempts {
+		if _, err := m.Login("attacker", "wrong"); !errors.Is(err, response.ErrWrongMasterPassword) {
+			t.Fatalf("attempt %d = %v", i+1, err)
+		}
+	}
+	// Even the right password waits now, and so does changing it
+	if _, err := m.Login("attacker", "password1"); !errors.Is(err, response.ErrTooManyAttempts) {
+		t.Fatalf("Login while throttled = %v", err)
+	}
+	if err := m.SetPassword("attacker", "password1", "password2"); !errors.Is(err, response.ErrTooManyAttempts) {
+		t.Fatalf("SetPassword while throttled = %v", err)
+	}
+	// Other clients aren't held up
+	if _, err := m.Login("user", "password1"); err != nil {
+		t.Fatalf("Login of another client = %v", err)
+	}
+
+	// Once the wait is over the right password clears the count
+	m.mu.Lock()
+	m.failures["attacker"].until = time.Time{}
+	m.mu.Unlock()
+	if _, err := m.Login("attacker", "password1"); err != nil {
+		t.Fatalf("Login after the wait = %v", err)
+	}
+	if _, ok := m.failures["attacker"]; ok {
+		t.Fatal("a successful login kept the failures")
+	}
+}
+
+func TestForgetFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		// until is when the clients counted before may try again, relative
+		// to now
+		until time.Duration
+		// clients is how many were counted before
+		clients int
+		// counted is who the new client is counted as
+		counted   string
+		remaining int
+	}{
+		{"waiting", time.Minute, 10, "new", 11},
+		{"wait over", -time.Second, 10, "new", 11},
+		{"forgotten", -maxBackoff - time.Second, 10, "new", 1},
+		{"too many", time.Minute, maxClients, overflowClient, maxClients + 1},
+		{"too many forgotten", -maxBackoff - time.Second, maxClients, "new", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t, time.Hour)
+			if err := m.SetPassword("", "", "password1"); err != nil {
+				t.Fatal(err)
+			}
+			for i := range tt.clients {
+				m.failures[strconv.Itoa(i)] = &failures{count: freeAttempts, until: time.Now().Add(tt.until)}
+			}
+
+			if _, err := m.Login("new", "wrong"); !errors.Is(err, response.ErrWrongMasterPassword) {
+				t.Fatalf("Login = %v", err)
+			}
+			if f := m.failures[tt.counted]; f == nil || f.count != 1 {
+				t.Fatalf("failures of %s = %+v, want 1", tt.counted, f)
+			}
+			if len(m.failures) != tt.remaining {
+				t.Fatalf("%d clients counted, want %d", len(m.failures), tt.remaining)
+			}
+		})
+	}
+}
+
+func TestLoginAtTheSameTime(t *testing.T) {
+	m := newTestManager(t, time.Hour)
+	if err := m.SetPassword("", "", "password1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Attempts running at the same time count before they are checked
+	const attempts = freeAttempts + 3
+	var wg sync.WaitGroup
+	errs := make(chan error, attempts)
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.Login("attacker", "wrong")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	checked := 0
+	for err := range errs {
+		if errors.Is(err, response.ErrWrongMasterPassword) {
+			checked++
+		}
+	}
+	if checked > freeAttempts+1 {
+		t.Fatalf("%d of %d attempts at the same time were checked", checked, attempts)
+	}
+}
+
+func TestRequire(t *testing.T) {
+	m := newTestManager(t, time.Hour)
+	handler := m.Require(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	status := func(header string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/credentials", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if got := status(""); got != http.StatusNoContent {
+		t.Fatalf("without a master password = %d", got)
+	}
+	if err := m.SetPassword("", "", "password1"); err != nil {
+		t.Fatal(err)
+	}
+	session, err := m.Login("client", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"unknown token", "Bearer nope", http.StatusUnauthorized},
+		{"other scheme", "Basic " + session.Token, http.StatusUnauthorized},
+		{"session", "Bearer " + session.Token, http.StatusNoContent},
+		{"lower case scheme", "bearer " + session.Token, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := status(tt.header); got != tt.want {
+				t.Fatalf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireDuringLogin(t *testing.T) {
+	m := newTestManager(t, time.Hour)
+	if err := m.SetPassword("", "", "password1"); err != nil {
+		t.Fatal(err)
+	}
+	session, err := m.Login("client", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Time a single check of the password to compare against
+	start := time.Now()
+	m.Login("other", "password1")
+	verify := time.Since(start)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Login("attacker", "wrong")
+	}()
+	time.Sleep(verify / 10)
+	start = time.Now()
+	if !m.Valid(session.Token) {
+		t.Fatal("the session is not valid")
+	}
+	if waited := time.Since(start); waited > verify/2 {
+		t.Fatalf("checking a session waited %v for a login", waited)
+	}
+	<-done
+}
+
+func TestClient(t *testing.T) {
+	tests := []struct {
+		remote string
+		want   string
+	}{
+		{"192.0.2.1:1234", "192.0.2.1"},
+		{"[::1]:8200", "::1"},
+		{"@", "@"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", nil)
+		req.RemoteAddr = tt.remote
+		if got := Client(req); got != tt.want {
+			t.Errorf("Client(%q) = %q, want %q", tt.remote, got, tt.want)
+		}
+	}
+}
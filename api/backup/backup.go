@@ -0,0 +1,399 @@
+// Package backup takes compressed, optionally encrypted snapshots of the
+// SQLite database and keeps them in a backup directory.
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"passvault/crypt"
+	"passvault/db"
+	"passvault/response"
+	"passvault/structs"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// validName matches the names of the backups the manager writes, anything
+// else is never read or removed. Names have no dots, the URLFormat
+// middleware would take them for a file extension.
+var validName = regexp.MustCompile(`^passvault-\d{8}-\d{6}-\d{3}$`)
+
+// Manager creates, lists, verifies and prunes the backups in a directory
+type Manager struct {
+	conn      func() *sql.DB
+	dir       string
+	key       string
+	retention Retention
+	// mu keeps backups and pruning from running at the same time
+	mu sync.Mutex
+}
+
+// NewManager returns a manager backing up the database conn returns into
+// dir. Backups are encrypted when key is not empty.
+func NewManager(conn func() *sql.DB, dir, key string, retention Retention) *Manager {
+	return &Manager{conn: conn, dir: dir, key: key, retention: retention}
+}
+
+// FileName is the name of the file a backup is stored in
+func FileName(backup *structs.Backup) string {
+	if backup.Encrypted {
+		return backup.Name + ".sqlite.gz.enc"
+	}
+	return backup.Name + ".sqlite.gz"
+}
+
+// filePath returns the location of a backup file
+func (m *Manager) filePath(backup *structs.Backup) string {
+	return filepath.Join(m.dir, FileName(backup))
+}
+
+// manifestPath returns the location of the manifest of a backup
+func (m *Manager) manifestPath(name string) string {
+	return filepath.Join(m.dir, name+".json")
+}
+
+// Create takes a snapshot of the database while it keeps serving, stores it
+// compressed and encrypted next to a manifest and prunes old backups
+func (m *Manager) Create() (*structs.Backup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := os.MkdirAll(m.dir, 0700); err != nil {
+		return nil, err
+	}
+	tmpDir, err := os.MkdirTemp(m.dir, ".snapshot-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	snapshot := filepath.Join(tmpDir, "snapshot.sqlite")
+	if err := db.Snapshot(m.conn(), snapshot); err != nil {
+		return nil, fmt.Errorf("snapshot failed: %w", err)
+	}
+	version, err := db.IntegrityCheck(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot failed: %w", err)
+	}
+
+	data, err := compress(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if m.key != "" {
+		sealer, err := crypt.NewSealer(m.key)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = sealer.Seal(data); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now().UTC()
+	sum := sha256.Sum256(data)
+	backup := structs.Backup{
+		Name:          "passvault-" + strings.Replace(now.Format("20060102-150405.000"), ".", "-", 1),
+		CreatedAt:     now,
+		Size:          int64(len(data)),
+		SHA256:        hex.EncodeToString(sum[:]),
+		Encrypted:     m.key != "",
+		SchemaVersion: version,
+	}
+	manifest, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	// The manifest goes last, a backup without one is never listed
+	if err := writePrivate(m.filePath(&backup), data); err != nil {
+		return nil, err
+	}
+	if err := writePrivate(m.manifestPath(backup.Name), manifest); err != nil {
+		os.Remove(m.filePath(&backup))
+		return nil, err
+	}
+
+	if _, err := m.prune(); err != nil {
+		log.Printf("Failed to prune backups: %v", err)
+	}
+
+	return &backup, nil
+}
+
+// compress gzips a file into memory
+func compress(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.Copy(zw, file); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writePrivate writes a file only its owner can read, through a temporary
+// file so readers never see it half written
+func writePrivate(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".backup-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// List returns every backup in the backup directory, newest first
+func (m *Manager) List() ([]structs.Backup, error) {
+	entries, err := os.ReadDir(m.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []structs.Backup{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []structs.Backup{}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || !validName.MatchString(name) {
+			continue
+		}
+		backup, err := m.manifest(name)
+		if err != nil {
+			log.Printf("Skipping backup %s: %v", name, err)
+			continue
+		}
+		backups = append(backups, *backup)
+	}
+
+	slices.SortFunc(backups, func(a, b structs.Backup) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return backups, nil
+}
+
+// manifest reads the manifest of a backup
+func (m *Manager) manifest(name string) (*structs.Backup, error) {
+	if !validName.MatchString(name) {
+		return nil, response.ErrBackupNotFound
+	}
+	data, err := os.ReadFile(m.manifestPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, response.ErrBackupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var backup structs.Backup
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if backup.Name != name {
+		return nil, fmt.Errorf("manifest belongs to %s", backup.Name)
+	}
+	return &backup, nil
+}
+
+// Open opens a backup file for download
+func (m *Manager) Open(name string) (*os.File, *structs.Backup, error) {
+	backup, err := m.manifest(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := os.Open(m.filePath(backup))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, response.ErrBackupNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, backup, nil
+}
+
+// Verify checks a backup end to end: its checksum, that it can be decrypted
+// and decompressed, that the database passes SQLite's integrity check and
+// that its schema version matches the manifest. Problems with the backup
+// itself are reported in the result rather than as an error.
+func (m *Manager) Verify(name string) (*structs.BackupVerification, error) {
+	backup, err := m.manifest(name)
+	if err != nil {
+		return nil, err
+	}
+	if backup.Encrypted && m.key == "" {
+		return nil, response.ErrBackupKeyRequired
+	}
+
+	tmpDir, err := os.MkdirTemp(m.dir, ".verify-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	result := &structs.BackupVerification{Name: name, SchemaVersion: backup.SchemaVersion}
+	if err := m.check(backup, filepath.Join(tmpDir, "backup.sqlite")); err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	result.Valid = true
+	return result, nil
+}
+
+// check extracts a backup to dest and verifies the database in it
+func (m *Manager) check(backup *structs.Backup, dest string) error {
+	if err := m.extract(backup, dest); err != nil {
+		return err
+	}
+	version, err := db.IntegrityCheck(dest)
+	if err != nil {
+		return err
+	}
+	if version != backup.SchemaVersion {
+		return fmt.Errorf("schema version %d doesn't match the manifest (%d)", version, backup.SchemaVersion)
+	}
+	return nil
+}
+
+// Restore replaces the live database with a backup after verifying it like
+// Verify does. Backups made by a newer version, with a schema this version
+// doesn't know, are refused. The replaced database is kept as a rollback
+// point.
+func (m *Manager) Restore(name string) (*structs.RestoreResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	backup, err := m.manifest(name)
+	if err != nil {
+		return nil, err
+	}
+	if backup.Encrypted && m.key == "" {
+		return nil, response.ErrBackupKeyRequired
+	}
+
+	latest, err := db.LatestSchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if backup.SchemaVersion > latest {
+		return nil, response.WrapError(
+			fmt.Errorf("schema version %d is newer than this version of the vault supports (%d)", backup.SchemaVersion, latest),
+			response.ErrBackupInvalid,
+		)
+	}
+
+	tmpDir, err := os.MkdirTemp(m.dir, ".restore-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	restored := filepath.Join(tmpDir, "backup.sqlite")
+	if err := m.check(backup, restored); err != nil {
+		return nil, response.WrapError(err, response.ErrBackupInvalid)
+	}
+
+	rollbackPath, err := db.RestoreGlobalDB(restored)
+	if err != nil {
+		return nil, err
+	}
+	version, err := db.SchemaVersion(m.conn())
+	if err != nil {
+		return nil, err
+	}
+
+	return &structs.RestoreResult{
+		Name:          backup.Name,
+		SchemaVersion: version,
+		RollbackPath:  rollbackPath,
+	}, nil
+}
+
+// extract checks the checksum of a backup and writes the database inside it,
+// decrypted and decompressed, to dest
+func (m *Manager) extract(backup *structs.Backup, dest string) error {
+	data, err := os.ReadFile(m.filePath(backup))
+	if errors.Is(err, fs.ErrNotExist) {
+		return response.ErrBackupNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	if int64(len(data)) != backup.Size || hex.EncodeToString(sum[:]) != backup.SHA256 {
+		return errors.New("checksum doesn't match the manifest")
+	}
+
+	if backup.Encrypted {
+		if data, _, err = crypt.Open(m.key, data); err != nil {
+			return fmt.Errorf("can't decrypt backup: %w", err)
+		}
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("can't decompress backup: %w", err)
+	}
+	file, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, zr); err != nil {
+		file.Close()
+		return fmt.Errorf("can't decompress backup: %w", err)
+	}
+	return file.Close()
+}
+
+// Run takes a backup every interval until ctx is cancelled. Failures are
+// logged and retried at the next interval.
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			backup, err := m.Create()
+			if err != nil {
+				log.Printf("Scheduled backup failed: %v", err)
+				continue
+			}
+			log.Printf("Created backup %s", backup.Name)
+		}
+	}
+}
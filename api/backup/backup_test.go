@@ -0,0 +1,230 @@
+package backup
+
+import (
+	"database/sql"
+	"os"
+	"passvault/db"
+	"passvault/structs"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestManager returns a manager backing up a fresh vault holding one
+// credential into a temporary directory
+func newTestManager(t *testing.T, key string, retention Retention) *Manager {
+	t.Helper()
+	conn, err := db.Init(filepath.Join(t.TempDir(), "vault.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if _, err := db.MigrateUp(conn, db.MigrateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.InsertCredential(conn, structs.Credential{Name: "mail", Username: "user", Password: "password"}); err != nil {
+		t.Fatal(err)
+	}
+	return NewManager(func() *sql.DB { return conn }, filepath.Join(t.TempDir(), "backups"), key, retention)
+}
+
+func TestCreateVerify(t *testing.T) {
+	tests := []struct {
+		name, key string
+	}{
+		{"plain", ""},
+		{"encrypted", "backup key"},
+	}
+	for _, tt := range tests {
+		key := tt.key
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t, key, Retention{})
+			backup, err := m.Create()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if backup.Encrypted != (key != "") || !validName.MatchString(backup.Name) {
+				t.Fatalf("backup = %+v", backup)
+			}
+			latest, err := db.LatestSchemaVersion()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if backup.SchemaVersion != latest {
+				t.Errorf("SchemaVersion = %d, want %d", backup.SchemaVersion, latest)
+			}
+
+			info, err := os.Stat(m.filePath(backup))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0600 || info.Size() != backup.Size {
+				t.Errorf("backup file mode %v size %d", info.Mode().Perm(), info.Size())
+			}
+
+			backups, err := m.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(backups) != 1 || backups[0].Name != backup.Name {
+				t.Fatalf("List = %+v", backups)
+			}
+
+			result, err := m.Verify(backup.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Valid {
+				t.Fatalf("Verify = %+v", result)
+			}
+		})
+	}
+}
+
+func TestVerifyDamagedBackups(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage func(m *Manager, backup *structs.Backup) error
+	}{
+		{"changed byte", func(m *Manager, backup *structs.Backup) error {
+			data, err := os.ReadFile(m.filePath(backup))
+			if err != nil {
+				return err
+			}
+			data[len(data)/2] ^= 1
+			return os.WriteFile(m.filePath(backup), data, 0600)
+		}},
+		{"truncated", func(m *Manager, backup *structs.Backup) error {
+			return os.Truncate(m.filePath(backup), backup.Size/2)
+		}},
+		{"other key", func(m *Manager, backup *structs.Backup) error {
+			m.key = "another key"
+			return nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t, "backup key", Retention{})
+			backup, err := m.Create()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.damage(m, backup); err != nil {
+				t.Fatal(err)
+			}
+			result, err := m.Verify(backup.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Valid || result.Error == "" {
+				t.Fatalf("Verify = %+v, want a failure", result)
+			}
+		})
+	}
+}
+
+func TestManifestNames(t *testing.T) {
+	m := newTestManager(t, "", Retention{})
+	for _, name := range []string{"../vault", "passvault-20250101-000000-000.json", "passvault-2025"} {
+		if _, err := m.Verify(name); err == nil {
+			t.Errorf("Verify(%q) succeeded", name)
+		}
+	}
+}
+
+func TestRetentionKeep(t *testing.T) {
+	// A backup at noon on each of the given days, newest first
+	at := func(days ...string) []structs.Backup {
+		var backups []structs.Backup
+		for _, day := range days {
+			created, err := time.ParseInLocation(time.DateOnly, day, time.Local)
+			if err != nil {
+				t.Fatal(err)
+			}
+			backups = append(backups, structs.Backup{Name: day, CreatedAt: created.Add(12 * time.Hour)})
+		}
+		return backups
+	}
+
+	tests := []struct {
+		name      string
+		retention Retention
+		backups   []structs.Backup
+		want      []string
+	}{
+		{
+			name:      "newest is always kept",
+			retention: Retention{},
+			backups:   at("2025-03-10", "2025-03-09"),
+			want:      []string{"2025-03-10"},
+		},
+		{
+			name:      "daily",
+			retention: Retention{Daily: 2},
+			backups:   at("2025-03-10", "2025-03-09", "2025-03-08"),
+			want:      []string{"2025-03-10", "2025-03-09"},
+		},
+		{
+			// 2025-03-10 is a Monday, the week before ends on the 9th
+			name:      "weekly",
+			retention: Retention{Weekly: 2},
+			backups:   at("2025-03-11", "2025-03-10", "2025-03-09", "2025-03-03", "2025-03-02"),
+			want:      []string{"2025-03-11", "2025-03-09"},
+		},
+		{
+			name:      "monthly",
+			retention: Retention{Monthly: 3},
+			backups:   at("2025-03-10", "2025-02-20", "2025-02-01", "2025-01-31", "2024-12-31"),
+			want:      []string{"2025-03-10", "2025-02-20", "2025-01-31"},
+		},
+		{
+			name:      "tiers combine",
+			retention: Retention{Daily: 1, Weekly: 1, Monthly: 2},
+			backups:   at("2025-03-10", "2025-03-09", "2025-02-28", "2025-02-27"),
+			want:      []string{"2025-03-10", "2025-02-28"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keep := tt.retention.keep(tt.backups)
+			if len(keep) != len(tt.want) {
+				t.Fatalf("keep = %v, want %v", keep, tt.want)
+			}
+			for _, name := range tt.want {
+				if !keep[name] {
+					t.Fatalf("keep = %v, want %v", keep, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	m := newTestManager(t, "", Retention{Daily: 1})
+	var last *structs.Backup
+	for range 3 {
+		backup, err := m.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = backup
+		// Names have millisecond precision
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	// Every backup was taken today, only the newest one is left
+	backups, err := m.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 || backups[0].Name != last.Name {
+		t.Fatalf("List = %+v, want only %s", backups, last.Name)
+	}
+	files, err := os.ReadDir(m.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("backup directory holds %d files, want a backup and its manifest", len(files))
+	}
+}
@@ -0,0 +1,99 @@
+package backup
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"os"
+	"passvault/db"
+	"passvault/response"
+	"passvault/structs"
+	"path/filepath"
+	"testing"
+)
+
+// TestRestore runs against the global database, which can be initialized
+// only once per test binary
+func TestRestore(t *testing.T) {
+	dir := t.TempDir()
+	var noTemplate embed.FS
+	if err := db.InitializeGlobalDB(filepath.Join(dir, "credentials.sqlite"), noTemplate); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.CloseDB() })
+
+	m := NewManager(db.GetDB, filepath.Join(dir, "backups"), "backup key", Retention{})
+	kept, err := db.InsertCredential(db.GetDB(), structs.Credential{Name: "kept", Username: "user", Password: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup, err := m.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	later, err := db.InsertCredential(db.GetDB(), structs.Credential{Name: "later", Username: "user", Password: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rewriteManifest changes the manifest of the backup
+	rewriteManifest := func(change func(b *structs.Backup)) {
+		t.Helper()
+		changed := *backup
+		change(&changed)
+		data, err := json.Marshal(changed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(m.manifestPath(backup.Name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	refusals := []struct {
+		name   string
+		backup string
+		change func(b *structs.Backup)
+		want   error
+	}{
+		{"newer schema", backup.Name, func(b *structs.Backup) { b.SchemaVersion = 999 }, response.ErrBackupInvalid},
+		{"wrong checksum", backup.Name, func(b *structs.Backup) { b.SHA256 = "00" }, response.ErrBackupInvalid},
+		{"unknown", "passvault-20000101-000000-000", func(b *structs.Backup) {}, response.ErrBackupNotFound},
+		{"not a backup name", "../credentials", func(b *structs.Backup) {}, response.ErrBackupNotFound},
+	}
+	for _, tt := range refusals {
+		t.Run(tt.name, func(t *testing.T) {
+			rewriteManifest(tt.change)
+			defer rewriteManifest(func(b *structs.Backup) {})
+
+			if _, err := m.Restore(tt.backup); !errors.Is(err, tt.want) {
+				t.Fatalf("Restore = %v, want %v", err, tt.want)
+			}
+			// The live database is left alone
+			if _, err := db.GetCredential(db.GetDB(), later); err != nil {
+				t.Fatalf("GetCredential after a refused restore: %v", err)
+			}
+		})
+	}
+
+	result, err := m.Restore(backup.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetCredential(db.GetDB(), kept); err != nil {
+		t.Fatalf("GetCredential of the backed up credential: %v", err)
+	}
+	if _, err := db.GetCredential(db.GetDB(), later); !errors.Is(err, response.ErrCredentialNotFound) {
+		t.Fatalf("GetCredential of the later credential = %v, want ErrCredentialNotFound", err)
+	}
+
+	// The replaced database still holds both
+	rollback, err := db.Init(result.RollbackPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rollback.Close()
+	if _, err := db.GetCredential(rollback, later); err != nil {
+		t.Fatalf("GetCredential from the rollback point: %v", err)
+	}
+}
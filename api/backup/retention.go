@@ -0,0 +1,90 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"passvault/structs"
+	"time"
+)
+
+// Retention is a grandfather-father-son policy: the newest backup of each of
+// the last Daily days, Weekly weeks and Monthly months is kept. The newest
+// backup is always kept. A policy of all zeros keeps everything.
+type Retention struct {
+	Daily   int
+	Weekly  int
+	Monthly int
+}
+
+// keep returns the names of the backups the policy keeps. Backups must be
+// sorted newest first.
+func (r Retention) keep(backups []structs.Backup) map[string]bool {
+	keep := map[string]bool{}
+	if len(backups) == 0 {
+		return keep
+	}
+	keep[backups[0].Name] = true
+
+	tiers := []struct {
+		count  int
+		period func(t time.Time) string
+	}{
+		{r.Daily, func(t time.Time) string { return t.Format(time.DateOnly) }},
+		{r.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{r.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	for _, tier := range tiers {
+		periods := map[string]bool{}
+		for _, backup := range backups {
+			if len(periods) == tier.count {
+				break
+			}
+			// Periods follow the local calendar of the server
+			period := tier.period(backup.CreatedAt.Local())
+			if !periods[period] {
+				periods[period] = true
+				keep[backup.Name] = true
+			}
+		}
+	}
+	return keep
+}
+
+// Prune removes the backups the retention policy no longer keeps and
+// returns their names
+func (m *Manager) Prune() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.prune()
+}
+
+func (m *Manager) prune() ([]string, error) {
+	if m.retention == (Retention{}) {
+		return nil, nil
+	}
+
+	backups, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+
+	keep := m.retention.keep(backups)
+	var removed []string
+	for _, backup := range backups {
+		if keep[backup.Name] {
+			continue
+		}
+		// Remove the manifest first so a half removed backup is no longer listed
+		if err := os.Remove(m.manifestPath(backup.Name)); err != nil {
+			return removed, err
+		}
+		if err := os.Remove(m.filePath(&backup)); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed = append(removed, backup.Name)
+	}
+	return removed, nil
+}
@@ -0,0 +1,292 @@
+// Package client talks to a running PassVault server over its REST API, and
+// keeps the session the command line client logs in with.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"passvault/response"
+	"passvault/structs"
+	"passvault/urlmatch"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultServer is the server the client talks to when none is configured
+const DefaultServer = "http://localhost:8200"
+
+// Client sends requests to a single server, with the token of a session
+// when there is one
+type Client struct {
+	server string
+	token  string
+	http   *http.Client
+}
+
+// New returns a client for the server at the given base URL
+func New(server, token string) *Client {
+	return &Client{
+		server: strings.TrimRight(server, "/"),
+		token:  token,
+		http:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Token returns the session token the client sends, empty without a session
+func (c *Client) Token() string {
+	return c.token
+}
+
+// Error is an error response of the server
+type Error struct {
+	Status  int
+	Message string
+	Details []response.FieldError
+}
+
+func (e *Error) Error() string {
+	message := e.Message
+	for _, detail := range e.Details {
+		message += fmt.Sprintf("\n  %s: %s", detail.Field, detail.Message)
+	}
+	return message
+}
+
+// Unauthorized reports whether the server wants a session the request didn't have
+func (e *Error) Unauthorized() bool {
+	return e.Status == http.StatusUnauthorized
+}
+
+// Is matches response.ErrUnauthorized when the server wanted a session
+func (e *Error) Is(target error) bool {
+	return target == response.ErrUnauthorized && e.Unauthorized()
+}
+
+// do sends a request with body encoded as JSON and decodes the response into out
+func (c *Client) do(method, path string, query url.Values, body, out any) error {
+	target := c.server + "/api/v1" + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("can't reach the server at %s: %w", c.server, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		// Most handlers answer with a JSON error, some with plain text
+		apiErr := &Error{Status: resp.StatusCode}
+		var decoded struct {
+			Error   string                `json:"error"`
+			Details []response.FieldError `json:"details"`
+		}
+		if json.Unmarshal(data, &decoded) == nil && decoded.Error != "" {
+			apiErr.Message, apiErr.Details = decoded.Error, decoded.Details
+		} else {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		if apiErr.Message == "" {
+			apiErr.Message = resp.Status
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// Login opens a session with the master password. The client uses its
+// token from then on.
+func (c *Client) Login(password string) (*structs.Session, error) {
+	var session structs.Session
+	if err := c.do(http.MethodPost, "/auth/login", nil, map[string]string{"password": password}, &session); err != nil {
+		return nil, err
+	}
+	c.token = session.Token
+	return &session, nil
+}
+
+// Logout ends the session of the client
+func (c *Client) Logout() error {
+	return c.do(http.MethodPost, "/auth/logout", nil, nil, nil)
+}
+
+// ListCredentials returns a single page of the credential list, query takes
+// the parameters of GET /credentials
+func (c *Client) ListCredentials(query url.Values) (*structs.CredentialPage, error) {
+	var page structs.CredentialPage
+	if err := c.do(http.MethodGet, "/credentials", query, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// AllCredentials returns every credential matching query, following the
+// cursor from page to page
+func (c *Client) AllCredentials(query url.Values) ([]structs.Credential, error) {
+	query = cloneValues(query)
+	var credentials []structs.Credential
+	for {
+		page, err := c.ListCredentials(query)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, page.Credentials...)
+		if page.NextCursor == "" {
+			return credentials, nil
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+}
+
+// SearchCredentials finds credentials whose name, username, description or
+// tags contain q, best matches first. A limit of 0 uses the server's maximum.
+func (c *Client) SearchCredentials(q string, limit int) ([]structs.Credential, error) {
+	query := url.Values{"q": {q}}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var credentials []structs.Credential
+	if err := c.do(http.MethodGet, "/credentials/search", query, nil, &credentials); err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// MatchCredentials returns the credentials of an item type to fill in on
+// the page at pageURL, best matches first. An empty item type matches every
+// type.
+func (c *Client) MatchCredentials(pageURL, itemType string) ([]urlmatch.Match, error) {
+	query := url.Values{"url": {pageURL}}
+	if itemType != "" {
+		query.Set("type", itemType)
+	}
+	var matches []urlmatch.Match
+	if err := c.do(http.MethodGet, "/credentials/match", query, nil, &matches); err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// GetCredential returns a single credential
+func (c *Client) GetCredential(id int) (*structs.Credential, error) {
+	var cred structs.Credential
+	if err := c.do(http.MethodGet, "/credentials/"+strconv.Itoa(id), nil, nil, &cred); err != nil {
+		return nil, err
+	}
+	return &cred, nil
+}
+
+// CreateCredential stores a new credential and returns its ID
+func (c *Client) CreateCredential(cred structs.Credential) (int, error) {
+	var created struct {
+		ID int `json:"id"`
+	}
+	if err := c.do(http.MethodPost, "/credentials", nil, cred, &created); err != nil {
+		return 0, err
+	}
+	return created.ID, nil
+}
+
+// UpdateCredential replaces a credential
+func (c *Client) UpdateCredential(id int, cred structs.Credential) error {
+	return c.do(http.MethodPut, "/credentials/"+strconv.Itoa(id), nil, cred, nil)
+}
+
+// DeleteCredential deletes a credential
+func (c *Client) DeleteCredential(id int) error {
+	return c.do(http.MethodDelete, "/credentials/"+strconv.Itoa(id), nil, nil, nil)
+}
+
+// GetFolders returns every live folder
+func (c *Client) GetFolders() ([]structs.Folder, error) {
+	var folders []structs.Folder
+	if err := c.do(http.MethodGet, "/folders", nil, nil, &folders); err != nil {
+		return nil, err
+	}
+	return folders, nil
+}
+
+// CreateFolder creates a folder and returns its ID
+func (c *Client) CreateFolder(folder structs.Folder) (int, error) {
+	var created struct {
+		ID int `json:"id"`
+	}
+	if err := c.do(http.MethodPost, "/folders", nil, folder, &created); err != nil {
+		return 0, err
+	}
+	return created.ID, nil
+}
+
+// UpdateFolder renames or moves a folder
+func (c *Client) UpdateFolder(id int, folder structs.Folder) error {
+	return c.do(http.MethodPut, "/folders/"+strconv.Itoa(id), nil, folder, nil)
+}
+
+// DeleteFolder moves a folder and everything in it to the trash
+func (c *Client) DeleteFolder(id int) error {
+	return c.do(http.MethodDelete, "/folders/"+strconv.Itoa(id), nil, nil, nil)
+}
+
+// GetTags returns every tag with the number of credentials using it
+func (c *Client) GetTags() ([]structs.Tag, error) {
+	var tags []structs.Tag
+	if err := c.do(http.MethodGet, "/tags", nil, nil, &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// Render expands the secret references in a template. name is the name
+// errors give the template.
+func (c *Client) Render(name, template string) (string, error) {
+	body := map[string]string{"name": name, "template": template}
+	var rendered struct {
+		Output string `json:"output"`
+	}
+	if err := c.do(http.MethodPost, "/render", nil, body, &rendered); err != nil {
+		return "", err
+	}
+	return rendered.Output, nil
+}
+
+// cloneValues copies query parameters, so following cursors leaves the
+// caller's untouched
+func cloneValues(values url.Values) url.Values {
+	clone := url.Values{}
+	for key, value := range values {
+		clone[key] = append([]string(nil), value...)
+	}
+	return clone
+}
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"passvault/auth"
+	"passvault/internal/sessions"
+	"passvault/response"
+	"passvault/structs"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTestServer serves the login endpoints and a credential list of three
+// pages behind a master password
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	m, err := auth.NewManager(filepath.Join(t.TempDir(), "auth.json"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetPassword("", "", "password1"); err != nil {
+		t.Fatal(err)
+	}
+	h := sessions.NewHandler(m)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/auth/login", h.Login)
+	mux.HandleFunc("POST /api/v1/auth/logout", h.Logout)
+	mux.Handle("GET /api/v1/credentials", m.Require(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+		result := structs.CredentialPage{
+			Credentials: []structs.Credential{{ID: page + 1, Name: r.URL.Query().Get("q")}},
+			TotalCount:  3,
+		}
+		if page < 2 {
+			result.NextCursor = strconv.Itoa(page + 1)
+		}
+		response.SuccessResponse(&w, result)
+	})))
+	mux.HandleFunc("POST /api/v1/credentials", func(w http.ResponseWriter, r *http.Request) {
+		response.ValidationErrorResponse(&w, "Validation failed", []response.FieldError{{Field: "password", Message: "too short"}})
+	})
+	mux.HandleFunc("GET /api/v1/tags", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "tags are down", http.StatusBadGateway)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestLogin(t *testing.T) {
+	server := newTestServer(t)
+	c := New(server.URL+"/", "")
+
+	if _, err := c.ListCredentials(nil); !errors.Is(err, response.ErrUnauthorized) {
+		t.Fatalf("ListCredentials without a session = %v", err)
+	}
+	var apiErr *Error
+	if _, err := c.Login("wrong"); !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized {
+		t.Fatalf("Login with the wrong password = %v", err)
+	}
+	session, err := c.Login("password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Token() != session.Token || session.Token == "" {
+		t.Fatalf("Token = %q, want %q", c.Token(), session.Token)
+	}
+	if _, err := c.ListCredentials(nil); err != nil {
+		t.Fatalf("ListCredentials with a session = %v", err)
+	}
+
+	if err := c.Logout(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ListCredentials(nil); !errors.Is(err, response.ErrUnauthorized) {
+		t.Fatalf("ListCredentials after logging out = %v", err)
+	}
+}
+
+func TestAllCredentials(t *testing.T) {
+	server := newTestServer(t)
+	c := New(server.URL, "")
+	if _, err := c.Login("password1"); err != nil {
+		t.Fatal(err)
+	}
+
+	query := url.Values{"q": {"mail"}}
+	creds, err := c.AllCredentials(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(creds) != 3 || creds[0].ID != 1 || creds[2].ID != 3 || creds[2].Name != "mail" {
+		t.Fatalf("AllCredentials = %+v", creds)
+	}
+	if query.Has("cursor") {
+		t.Fatal("AllCredentials changed the query it was given")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	server := newTestServer(t)
+	c := New(server.URL, "")
+
+	tests := []struct {
+		name    string
+		call    func() error
+		status  int
+		message string
+	}{
+		{
+			name:    "validation details",
+			call:    func() error { _, err := c.CreateCredential(structs.Credential{}); return err },
+			status:  http.StatusBadRequest,
+			message: "Validation failed\n  password: too short",
+		},
+		{
+			name:    "plain text",
+			call:    func() error { _, err := c.GetTags(); return err },
+			status:  http.StatusBadGateway,
+			message: "tags are down",
+		},
+		{
+			name:    "no body",
+			call:    func() error { _, err := c.GetFolders(); return err },
+			status:  http.StatusNotFound,
+			message: "404 page not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var apiErr *Error
+			if err := tt.call(); !errors.As(err, &apiErr) {
+				t.Fatalf("error = %v, want an API error", err)
+			}
+			if apiErr.Status != tt.status || apiErr.Error() != tt.message {
+				t.Fatalf("error = %d %q, want %d %q", apiErr.Status, apiErr.Error(), tt.status, tt.message)
+			}
+			if errors.Is(apiErr, response.ErrUnauthorized) {
+				t.Fatal("the error matches ErrUnauthorized")
+			}
+		})
+	}
+
+	if _, err := New("http://127.0.0.1:1", "").GetTags(); err == nil {
+		t.Fatal("a server that isn't there answered")
+	}
+}
+
+func TestSession(t *testing.T) {
+	t.Setenv("PASSVAULT_CONFIG", filepath.Join(t.TempDir(), "passvault", "cli.json"))
+	t.Setenv("PASSVAULT_NO_KEYRING", "1")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Server != "" || config.Token != "" {
+		t.Fatalf("a missing config = %+v", config)
+	}
+
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := SaveSession("http://vault.example", "token", expires); err != nil {
+		t.Fatal(err)
+	}
+	if config, err = LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if config.Server != "http://vault.example" || config.Token != "token" || !config.ExpiresAt.Equal(expires) || config.Keyring {
+		t.Fatalf("saved config = %+v", config)
+	}
+
+	if err := ClearSession(); err != nil {
+		t.Fatal(err)
+	}
+	if config, err = LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if config.Server != "http://vault.example" || config.Token != "" || !config.ExpiresAt.IsZero() {
+		t.Fatalf("cleared config = %+v", config)
+	}
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+// keyringService is the service session tokens are filed under in the OS
+// keyring, the server URL is the user
+const keyringService = "passvault"
+
+// Config is what the command line client remembers between runs: the server
+// it talks to and the session it logged in with
+type Config struct {
+	Server    string    `json:"server"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	// Token is only kept here when the OS keyring can't be used
+	Token string `json:"token,omitempty"`
+	// Keyring is set when the token is kept in the OS keyring
+	Keyring bool `json:"keyring,omitempty"`
+}
+
+// ConfigPath returns the file the client config is kept in,
+// PASSVAULT_CONFIG when it is set
+func ConfigPath() string {
+	if path := os.Getenv("PASSVAULT_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "passvault", "cli.json")
+}
+
+// LoadConfig reads the client config, with the session token from the
+// keyring unless PASSVAULT_NO_KEYRING is set. A missing config is an empty
+// one.
+func LoadConfig() (*Config, error) {
+	config := &Config{}
+	data, err := os.ReadFile(ConfigPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	if config.Keyring && os.Getenv("PASSVAULT_NO_KEYRING") == "" {
+		// A token missing from the keyring is a session that is gone
+		config.Token, _ = keyring.Get(keyringService, config.Server)
+	}
+	return config, nil
+}
+
+// SaveSession remembers a session with server. The token goes into the OS
+// keyring, or into the config file when there is no keyring.
+func SaveSession(server, token string, expiresAt time.Time) error {
+	config := &Config{Server: server, ExpiresAt: expiresAt, Token: token}
+	if os.Getenv("PASSVAULT_NO_KEYRING") == "" && keyring.Set(keyringService, server, token) == nil {
+		config.Token, config.Keyring = "", true
+	}
+	return writeConfig(config)
+}
+
+// ClearSession forgets the session with the configured server, and keeps
+// the server
+func ClearSession() error {
+	config, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	if config.Keyring {
+		if err := keyring.Delete(keyringService, config.Server); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			return err
+		}
+	}
+	return writeConfig(&Config{Server: config.Server})
+}
+
+// writeConfig writes the config file readable by the user only
+func writeConfig(config *Config) error {
+	path := ConfigPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"embed"
+	"flag"
+	"fmt"
+	"os"
+	"passvault/backup"
+	api "passvault/config"
+	"passvault/db"
+	"path/filepath"
+)
+
+const backupUsage = `Usage: passvault backup [command] [flags]
+
+Commands:
+  create         Take a backup now, the default without a command
+  list           List every backup, newest first
+  verify NAME    Check the checksum and integrity of a backup
+  prune          Remove the backups the retention settings no longer keep
+
+Backups are written to BACKUP_DIR and encrypted with BACKUP_KEY when it is
+set. They need the sqlite storage backend, and can be taken while the server
+is running.
+`
+
+// Backup runs the backup command against the vault database
+func Backup(args []string, embeddedFS embed.FS) error {
+	command := "create"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		command, args = args[0], args[1:]
+	}
+
+	flags := flag.NewFlagSet("backup "+command, flag.ContinueOnError)
+	configFlags := api.RegisterFlags(flags, api.BackupFlags...)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, backupUsage+api.FlagUsage(api.BackupFlags...)) }
+	names, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+
+	config := configFlags.Load()
+	if config.StorageBackend != api.StorageSQLite {
+		return fmt.Errorf("backups need the sqlite storage backend, not %s", config.StorageBackend)
+	}
+	if err := db.InitializeGlobalDB(config.DatabasePath, embeddedFS); err != nil {
+		return err
+	}
+	defer db.CloseDB()
+	manager := backup.NewManager(db.GetDB, config.BackupDir, config.BackupKey, backup.Retention{
+		Daily:   config.BackupKeepDaily,
+		Weekly:  config.BackupKeepWeekly,
+		Monthly: config.BackupKeepMonthly,
+	})
+
+	switch command {
+	case "create":
+		b, err := manager.Create()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Backed up the database to %s\n", filepath.Join(config.BackupDir, backup.FileName(b)))
+		if !b.Encrypted {
+			fmt.Println("The backup is not encrypted, set BACKUP_KEY to encrypt backups")
+		}
+		return nil
+	case "list":
+		return listBackups(manager)
+	case "verify":
+		if len(names) != 1 {
+			fmt.Fprint(os.Stderr, backupUsage)
+			return fmt.Errorf("verify takes the name of a backup")
+		}
+		result, err := manager.Verify(names[0])
+		if err != nil {
+			return err
+		}
+		if !result.Valid {
+			return fmt.Errorf("%s failed verification: %s", result.Name, result.Error)
+		}
+		fmt.Printf("%s is valid, schema version %d\n", result.Name, result.SchemaVersion)
+		return nil
+	case "prune":
+		removed, err := manager.Prune()
+		if err != nil {
+			return err
+		}
+		for _, name := range removed {
+			fmt.Printf("Removed %s\n", name)
+		}
+		fmt.Printf("Removed %d backups\n", len(removed))
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, backupUsage)
+		return fmt.Errorf("unknown backup command %q", command)
+	}
+}
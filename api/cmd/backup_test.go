@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"embed"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestBackupRestore is the only test opening the global database, which can
+// be opened once per process
+func TestBackupRestore(t *testing.T) {
+	dir := vaultEnv(t)
+	backupDir := filepath.Join(dir, "backups")
+
+	if _, err := captureStdout(t, func() error { return Backup([]string{"--backend", "memory"}, embed.FS{}) }); err == nil || !strings.Contains(err.Error(), "sqlite") {
+		t.Fatalf("Backup of the memory backend = %v", err)
+	}
+
+	output, err := captureStdout(t, func() error { return Backup(nil, embed.FS{}) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "Backed up the database to "+backupDir) || !strings.Contains(output, "not encrypted") {
+		t.Fatalf("create output = %q", output)
+	}
+	entries, err := os.ReadDir(backupDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	for _, entry := range entries {
+		if base, ok := strings.CutSuffix(entry.Name(), ".sqlite.gz"); ok {
+			name = base
+		}
+	}
+	if name == "" {
+		t.Fatalf("no backup in %v", entries)
+	}
+
+	steps := []struct {
+		name string
+		run  func() error
+		want string
+		err  string
+	}{
+		{"list", func() error { return Backup([]string{"list"}, embed.FS{}) }, name, ""},
+		{"verify", func() error { return Backup([]string{"verify", name}, embed.FS{}) }, name + " is valid", ""},
+		{"verify without a name", func() error { return Backup([]string{"verify"}, embed.FS{}) }, "", "takes the name"},
+		{"verify unknown", func() error { return Backup([]string{"verify", "nope"}, embed.FS{}) }, "", "not found"},
+		{"prune", func() error { return Backup([]string{"prune"}, embed.FS{}) }, "Removed 0 backups", ""},
+		{"unknown", func() error { return Backup([]string{"shred"}, embed.FS{}) }, "", "unknown backup command"},
+		{"restore lists", func() error { return Restore(nil, embed.FS{}) }, name, ""},
+		{"restore", func() error { return Restore([]string{name}, embed.FS{}) }, "Restored " + name, ""},
+		{"restore by path", func() error { return Restore([]string{filepath.Join(backupDir, name+".sqlite.gz")}, embed.FS{}) }, "Restored " + name, ""},
+	}
+	for _, step := range steps {
+		output, err := captureStdout(t, step.run)
+		if step.err != "" {
+			if err == nil || !strings.Contains(err.Error(), step.err) {
+				t.Fatalf("%s = %v, want %q", step.name, err, step.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s = %v", step.name, err)
+		}
+		if !strings.Contains(output, step.want) {
+			t.Fatalf("%s output %q doesn't contain %q", step.name, output, step.want)
+		}
+	}
+}
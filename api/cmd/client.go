@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"passvault/client"
+	"passvault/structs"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Output formats of the client commands
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputRaw   = "raw"
+)
+
+// clientCommands are the commands that talk to a running server
+var clientCommands = map[string]func(args []string) error{
+	"login":  Login,
+	"logout": Logout,
+	"ls":     List,
+	"get":    Get,
+	"add":    Add,
+	"edit":   Edit,
+	"rm":     Remove,
+	"search": Search,
+	"gen":    Generate,
+	"totp":   TOTP,
+	"run":    Run,
+	"inject": Inject,
+
+	"ssh-agent": SSHAgent,
+
+	"native-host":    NativeHost,
+	"secret-service": SecretService,
+
+	"git-credential":    GitCredential,
+	"docker-credential": DockerCredential,
+}
+
+// IsClientCommand reports whether name is a command of the client
+func IsClientCommand(name string) bool {
+	_, ok := clientCommands[name]
+	return ok
+}
+
+// RunClient runs a client command. A request the server turned away for
+// want of a session comes back with a hint to log in.
+func RunClient(name string, args []string) error {
+	err := clientCommands[name](args)
+	if name == "login" {
+		return err
+	}
+	return loginHint(err)
+}
+
+// loginHint adds a hint to log in to an error of a request the server
+// turned away for want of a session
+func loginHint(err error) error {
+	var apiErr *client.Error
+	if errors.As(err, &apiErr) && apiErr.Unauthorized() {
+		return fmt.Errorf("%w, log in with passvault login", err)
+	}
+	return err
+}
+
+// clientOptions are the flags every client command takes
+type clientOptions struct {
+	server string
+	output string
+}
+
+// register adds the common flags to a flag set. output is the format used
+// when --output isn't given.
+func (o *clientOptions) register(flags *flag.FlagSet, output string) {
+	flags.StringVar(&o.server, "server", "", "URL of the PassVault server")
+	flags.StringVar(&o.output, "output", output, "output format: table, json or raw")
+	flags.StringVar(&o.output, "o", output, "shorthand for --output")
+}
+
+// check reports an unknown output format
+func (o *clientOptions) check() error {
+	switch o.output {
+	case outputTable, outputJSON, outputRaw:
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, use table, json or raw", o.output)
+}
+
+// serverURL picks the server from --server, PASSVAULT_SERVER, the server
+// logged in to last and the default, in that order
+func (o *clientOptions) serverURL(config *client.Config) string {
+	for _, server := range []string{o.server, os.Getenv("PASSVAULT_SERVER"), config.Server} {
+		if server != "" {
+			return strings.TrimRight(server, "/")
+		}
+	}
+	return client.DefaultServer
+}
+
+// client returns a client for the chosen server, with the saved session
+// when it belongs to that server and hasn't expired
+func (o *clientOptions) client() (*client.Client, error) {
+	config, err := client.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("can't read %s: %w", client.ConfigPath(), err)
+	}
+	server := o.serverURL(config)
+	token := ""
+	if config.Server == server && (config.ExpiresAt.IsZero() || time.Now().Before(config.ExpiresAt)) {
+		token = config.Token
+	}
+	return client.New(server, token), nil
+}
+
+// parseFlags parses flags wherever they are among the arguments, so they can
+// follow the name of a credential, and returns the other arguments
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// stringList is a flag that can be given more than once
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// printJSON writes v as indented JSON
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// fullName returns the folder path and name of a credential
+func fullName(cred structs.Credential) string {
+	if cred.FolderPath == "" {
+		return cred.Name
+	}
+	return cred.FolderPath + "/" + cred.Name
+}
+
+// printCredentials writes a list of credentials, without their secrets
+// unless the output is JSON
+func printCredentials(credentials []structs.Credential, output string) error {
+	switch output {
+	case outputJSON:
+		if credentials == nil {
+			credentials = []structs.Credential{}
+		}
+		return printJSON(credentials)
+	case outputRaw:
+		for _, cred := range credentials {
+			fmt.Println(fullName(cred))
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tUSERNAME\tFOLDER\tTAGS")
+	for _, cred := range credentials {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", cred.ID, cred.Name, cred.Username, cred.FolderPath, strings.Join(cred.Tags, ", "))
+	}
+	return w.Flush()
+}
+
+// findFolder returns the ID of the folder at a slash separated path, nil
+// for an empty path
+func findFolder(c *client.Client, folderPath string) (*int, error) {
+	folderPath = strings.Trim(folderPath, "/")
+	if folderPath == "" {
+		return nil, nil
+	}
+	folders, err := c.GetFolders()
+	if err != nil {
+		return nil, err
+	}
+	for _, folder := range folders {
+		if strings.EqualFold(folder.Path, folderPath) {
+			return &folder.ID, nil
+		}
+	}
+	return nil, fmt.Errorf("no folder %q", folderPath)
+}
+
+// readSecret reads a secret without echoing it when stdin is a terminal,
+// or the first line of stdin when it is piped in
+func readSecret(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	secret, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return string(secret), err
+}
+
+// confirm asks a yes or no question on the terminal. Without a terminal to
+// ask on the answer is no.
+func confirm(question string) bool {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"net/http/httptest"
+	"os"
+	"passvault/auth"
+	api "passvault/config"
+	"passvault/passstore"
+	"passvault/store"
+	"passvault/structs"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// captureStdout runs fn and returns what it printed
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		output <- buf.String()
+	}()
+	err = fn()
+	w.Close()
+	return <-output, err
+}
+
+// setStdin makes input what the commands read from stdin
+func setStdin(t *testing.T, input string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stdin")
+	if err := os.WriteFile(path, []byte(input), 0600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = file
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		file.Close()
+	})
+}
+
+// vaultEnv points every vault setting into a fresh data directory and
+// returns it
+func vaultEnv(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"DATABASE_PATH", "STORE_FILE_PATH", "BACKUP_DIR", "MASTER_PASSWORD_FILE", "BACKUP_KEY", "STORE_PASSPHRASE", "STORAGE_BACKEND", "PASS_PUBLIC_KEY_FILE", "PASS_SECRET_KEY_FILE", "PASS_MIRROR_DIR"} {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+	t.Setenv("DATA_DIR", dir)
+	t.Setenv("BACKUP_INTERVAL", "24h")
+	// Port 0 is always free, the doctor finds no server on it
+	t.Setenv("PORT", "0")
+	return dir
+}
+
+// newTestAPI serves the API of a memory vault holding creds, without a
+// master password, and points the client commands at it
+func newTestAPI(t *testing.T, creds ...structs.Credential) store.Store {
+	t.Helper()
+	vault := store.NewMemory()
+	for _, cred := range creds {
+		if _, err := vault.CreateCredential(cred); err != nil {
+			t.Fatal(err)
+		}
+	}
+	authManager, err := auth.NewManager(filepath.Join(t.TempDir(), "master.json"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := api.StartServer()
+	api.SetupRoutes(app, vault, authManager, nil, passstore.NewManager(vault, passstore.Options{}))
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+
+	t.Setenv("PASSVAULT_SERVER", server.URL)
+	t.Setenv("PASSVAULT_CONFIG", filepath.Join(t.TempDir(), "cli.json"))
+	t.Setenv("PASSVAULT_NO_KEYRING", "1")
+	return vault
+}
+
+// credentialsByName returns the live credentials of a vault by their names
+func credentialsByName(t *testing.T, vault store.Store) map[string]structs.Credential {
+	t.Helper()
+	page, err := vault.ListCredentials(structs.ListOptions{Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]structs.Credential{}
+	for _, cred := range page.Credentials {
+		byName[cred.Name] = cred
+	}
+	return byName
+}
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		positional []string
+		verbose    bool
+	}{
+		{"none", nil, nil, false},
+		{"flags first", []string{"-v", "a", "b"}, []string{"a", "b"}, true},
+		{"flags between", []string{"a", "-v", "b"}, []string{"a", "b"}, true},
+		{"flags last", []string{"a", "b", "-v"}, []string{"a", "b"}, true},
+		{"after --", []string{"a", "--", "-v"}, []string{"a", "-v"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := newFlagSet(t)
+			verbose := flags.Bool("v", false, "")
+			positional, err := parseFlags(flags, tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(positional, tt.positional) || *verbose != tt.verbose {
+				t.Fatalf("parseFlags = %q, -v %t", positional, *verbose)
+			}
+		})
+	}
+}
+
+// newFlagSet returns a flag set that reports errors without printing them
+func newFlagSet(t *testing.T) *flag.FlagSet {
+	t.Helper()
+	flags := flag.NewFlagSet(t.Name(), flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	return flags
+}
@@ -0,0 +1,521 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"passvault/client"
+	"passvault/passgen"
+	"passvault/secretref"
+	"passvault/structs"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const listUsage = `Usage: passvault ls [flags]
+
+Lists credentials, without their secrets.
+
+Flags:
+  --folder PATH   Only list the credentials in a folder, "none" for those outside any
+  --recursive     Include the subfolders of --folder
+  --tag NAME      Only list credentials with a tag, may be repeated
+  --type TYPE     Only list credentials of an item type
+  --sort FIELD    Sort by name, created, updated or last_used
+  --trashed       List the trash instead
+  -o, --output    table (default), json or raw (one name per line)
+  --server URL    Server to talk to
+`
+
+const getUsage = `Usage: passvault get <name> [flags]
+
+Shows a credential. The name is its ID, its name or its folder path and
+name, like Work/GitHub.
+
+Flags:
+  --field NAME   Print a single value: name, username, password, url, notes,
+                 totp (the current code), folder, tags or a custom field
+  --reveal       Show the password and hidden fields in the table
+  -o, --output   table (default), json or raw (the password, or the field)
+  --server URL   Server to talk to
+`
+
+const addUsage = `Usage: passvault add <name> [flags]
+
+Adds a credential. Without --password or --generate a login asks for its
+password, or reads it from the first line of stdin.
+
+Flags:
+  -u, --username NAME   Username
+  -p, --password VALUE  Password, - reads it from stdin
+  --generate            Generate a password
+  --length N            Length of a generated password (default 24)
+  --no-symbols          Leave symbols out of a generated password
+  --url URL             Address the credential is used on, may be repeated
+  --tag NAME            Tag, may be repeated
+  --folder PATH         Folder, by path
+  --notes TEXT          Notes
+  --totp SECRET         TOTP secret, base32 or an otpauth:// URI
+  --field NAME=VALUE    Custom field, may be repeated
+  --type TYPE           login (default), secure_note, registry, git,
+                        ssh_key or secret
+  -o, --output          table (default), json or raw (the new ID)
+  --server URL          Server to talk to
+`
+
+const editUsage = `Usage: passvault edit <name> [flags]
+
+Changes a credential. Only the values given change, --url and --tag replace
+every URL or tag, --field sets a single custom field and an empty value
+removes it.
+
+Flags:
+  --name NAME           New name
+  -u, --username NAME   Username
+  -p, --password VALUE  Password, - reads it from stdin
+  --generate            Generate a new password
+  --length N            Length of a generated password (default 24)
+  --no-symbols          Leave symbols out of a generated password
+  --url URL             Address the credential is used on, may be repeated
+  --tag NAME            Tag, may be repeated
+  --folder PATH         Folder, by path, empty to take it out of its folder
+  --notes TEXT          Notes
+  --totp SECRET         TOTP secret, empty to remove it
+  --field NAME=VALUE    Custom field, may be repeated
+  --server URL          Server to talk to
+`
+
+const removeUsage = `Usage: passvault rm <name> [flags]
+
+Deletes a credential. On a terminal it asks first.
+
+Flags:
+  -f, --force    Don't ask
+  --server URL   Server to talk to
+`
+
+const searchUsage = `Usage: passvault search <query> [flags]
+
+Finds credentials whose name, username, notes or tags contain the query,
+best matches first.
+
+Flags:
+  --limit N      Return at most N credentials
+  -o, --output   table (default), json or raw (one name per line)
+  --server URL   Server to talk to
+`
+
+// List runs the ls command
+func List(args []string) error {
+	var opts clientOptions
+	var tags stringList
+	flags := flag.NewFlagSet("ls", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, listUsage) }
+	opts.register(flags, outputTable)
+	folder := flags.String("folder", "", "folder path")
+	recursive := flags.Bool("recursive", false, "include subfolders")
+	flags.Var(&tags, "tag", "tag")
+	itemType := flags.String("type", "", "item type")
+	sortBy := flags.String("sort", "", "sort field")
+	trashed := flags.Bool("trashed", false, "list the trash")
+	if _, err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if err := opts.check(); err != nil {
+		return err
+	}
+
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+	query := url.Values{"limit": {"500"}}
+	switch *folder {
+	case "":
+	case "none":
+		query.Set("folder", "none")
+	default:
+		id, err := findFolder(c, *folder)
+		if err != nil {
+			return err
+		}
+		query.Set("folder", strconv.Itoa(*id))
+	}
+	if *recursive {
+		query.Set("recursive", "true")
+	}
+	if *trashed {
+		query.Set("trashed", "true")
+	}
+	if len(tags) > 0 {
+		query.Set("tag", strings.Join(tags, ","))
+	}
+	if *itemType != "" {
+		query.Set("type", *itemType)
+	}
+	if *sortBy != "" {
+		query.Set("sort", *sortBy)
+	}
+
+	credentials, err := c.AllCredentials(query)
+	if err != nil {
+		return err
+	}
+	return printCredentials(credentials, opts.output)
+}
+
+// Get runs the get command
+func Get(args []string) error {
+	var opts clientOptions
+	flags := flag.NewFlagSet("get", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, getUsage) }
+	opts.register(flags, "")
+	field := flags.String("field", "", "single value to print")
+	reveal := flags.Bool("reveal", false, "show secrets in the table")
+	names, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(names) != 1 {
+		flags.Usage()
+		return fmt.Errorf("get takes the name of one credential")
+	}
+	// A single value is meant for piping, a whole credential for reading
+	if opts.output == "" {
+		opts.output = outputTable
+		if *field != "" {
+			opts.output = outputRaw
+		}
+	}
+	if err := opts.check(); err != nil {
+		return err
+	}
+
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+	cred, err := secretref.Find(c, names[0])
+	if err != nil {
+		return err
+	}
+
+	if *field != "" {
+		value, err := secretref.Field(cred, *field)
+		if err != nil {
+			return err
+		}
+		if opts.output == outputJSON {
+			return printJSON(map[string]string{*field: value})
+		}
+		fmt.Println(value)
+		return nil
+	}
+
+	switch opts.output {
+	case outputJSON:
+		return printJSON(cred)
+	case outputRaw:
+		fmt.Println(cred.Password)
+		return nil
+	}
+
+	mask := func(secret string, hidden bool) string {
+		if hidden && !*reveal && secret != "" {
+			return "********"
+		}
+		return secret
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID\t%d\n", cred.ID)
+	fmt.Fprintf(w, "Name\t%s\n", cred.Name)
+	fmt.Fprintf(w, "Type\t%s\n", cred.ItemType)
+	fmt.Fprintf(w, "Username\t%s\n", cred.Username)
+	fmt.Fprintf(w, "Password\t%s\n", mask(cred.Password, true))
+	fmt.Fprintf(w, "Folder\t%s\n", cred.FolderPath)
+	fmt.Fprintf(w, "Tags\t%s\n", strings.Join(cred.Tags, ", "))
+	for _, u := range cred.URLs {
+		fmt.Fprintf(w, "URL\t%s\n", u)
+	}
+	if cred.TOTP != "" {
+		fmt.Fprintf(w, "TOTP\t%s\n", mask(cred.TOTP, true))
+	}
+	for _, f := range cred.Fields {
+		fmt.Fprintf(w, "%s\t%s\n", f.Name, mask(f.Value, f.Hidden))
+	}
+	for _, a := range cred.Attachments {
+		fmt.Fprintf(w, "Attachment\t%s (%d bytes)\n", a.Name, len(a.Data))
+	}
+	fmt.Fprintf(w, "Updated\t%s\n", cred.UpdatedAt.Local().Format(time.DateTime))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if cred.Description != "" {
+		fmt.Printf("\n%s\n", cred.Description)
+	}
+	return nil
+}
+
+// credentialFlags are the flags add and edit share
+type credentialFlags struct {
+	username  string
+	password  string
+	generate  bool
+	length    int
+	noSymbols bool
+	urls      stringList
+	tags      stringList
+	folder    string
+	notes     string
+	totp      string
+	fields    stringList
+}
+
+func (f *credentialFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&f.username, "username", "", "username")
+	flags.StringVar(&f.username, "u", "", "shorthand for --username")
+	flags.StringVar(&f.password, "password", "", "password")
+	flags.StringVar(&f.password, "p", "", "shorthand for --password")
+	flags.BoolVar(&f.generate, "generate", false, "generate a password")
+	flags.IntVar(&f.length, "length", passgen.DefaultLength, "length of a generated password")
+	flags.BoolVar(&f.noSymbols, "no-symbols", false, "no symbols in a generated password")
+	flags.Var(&f.urls, "url", "URL")
+	flags.Var(&f.tags, "tag", "tag")
+	flags.StringVar(&f.folder, "folder", "", "folder path")
+	flags.StringVar(&f.notes, "notes", "", "notes")
+	flags.StringVar(&f.totp, "totp", "", "TOTP secret")
+	flags.Var(&f.fields, "field", "custom field")
+}
+
+// apply sets the values of the flags in set onto cred
+func (f *credentialFlags) apply(c *client.Client, cred *structs.Credential, set map[string]bool) error {
+	if set["username"] || set["u"] {
+		cred.Username = f.username
+	}
+	switch {
+	case f.generate:
+		password, err := passgen.Generate(passgen.Options{Length: f.length, NoSymbols: f.noSymbols})
+		if err != nil {
+			return err
+		}
+		cred.Password = password
+	case f.password == "-":
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		cred.Password = strings.TrimRight(string(data), "\r\n")
+	case set["password"] || set["p"]:
+		cred.Password = f.password
+	}
+	if set["url"] {
+		cred.URLs = f.urls
+	}
+	if set["tag"] {
+		cred.Tags = f.tags
+	}
+	if set["folder"] {
+		id, err := findFolder(c, f.folder)
+		if err != nil {
+			return err
+		}
+		cred.FolderID = id
+	}
+	if set["notes"] {
+		cred.Description = f.notes
+	}
+	if set["totp"] {
+		cred.TOTP = f.totp
+	}
+	for _, field := range f.fields {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("custom fields are given as name=value, not %q", field)
+		}
+		i := slices.IndexFunc(cred.Fields, func(existing structs.CustomField) bool {
+			return strings.EqualFold(existing.Name, name)
+		})
+		switch {
+		case i >= 0 && value == "":
+			cred.Fields = slices.Delete(cred.Fields, i, i+1)
+		case i >= 0:
+			cred.Fields[i].Value = value
+		case value != "":
+			cred.Fields = append(cred.Fields, structs.CustomField{Name: name, Value: value})
+		}
+	}
+	return nil
+}
+
+// setFlags returns the names of the flags given on the command line
+func setFlags(flags *flag.FlagSet) map[string]bool {
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// Add runs the add command
+func Add(args []string) error {
+	var opts clientOptions
+	var values credentialFlags
+	flags := flag.NewFlagSet("add", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, addUsage) }
+	opts.register(flags, outputTable)
+	values.register(flags)
+	itemType := flags.String("type", structs.ItemTypeLogin, "item type")
+	names, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(names) != 1 {
+		flags.Usage()
+		return fmt.Errorf("add takes the name of the new credential")
+	}
+	if err := opts.check(); err != nil {
+		return err
+	}
+
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+	cred := structs.Credential{Name: names[0], ItemType: *itemType, URLs: []string{}}
+	set := setFlags(flags)
+	if err := values.apply(c, &cred, set); err != nil {
+		return err
+	}
+	if cred.ItemType == structs.ItemTypeLogin && cred.Password == "" {
+		password, err := readSecret("Password: ")
+		if err != nil {
+			return err
+		}
+		cred.Password = password
+	}
+
+	id, err := c.CreateCredential(cred)
+	if err != nil {
+		return err
+	}
+	switch opts.output {
+	case outputJSON:
+		return printJSON(map[string]int{"id": id})
+	case outputRaw:
+		fmt.Println(id)
+	default:
+		fmt.Printf("Added %s with ID %d\n", cred.Name, id)
+	}
+	return nil
+}
+
+// Edit runs the edit command
+func Edit(args []string) error {
+	var opts clientOptions
+	var values credentialFlags
+	flags := flag.NewFlagSet("edit", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, editUsage) }
+	opts.register(flags, outputTable)
+	values.register(flags)
+	name := flags.String("name", "", "new name")
+	names, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(names) != 1 {
+		flags.Usage()
+		return fmt.Errorf("edit takes the name of one credential")
+	}
+
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+	cred, err := secretref.Find(c, names[0])
+	if err != nil {
+		return err
+	}
+	set := setFlags(flags)
+	if set["name"] {
+		cred.Name = *name
+	}
+	if err := values.apply(c, cred, set); err != nil {
+		return err
+	}
+
+	if err := c.UpdateCredential(cred.ID, *cred); err != nil {
+		return err
+	}
+	fmt.Printf("Updated %s\n", cred.Name)
+	return nil
+}
+
+// Remove runs the rm command
+func Remove(args []string) error {
+	var opts clientOptions
+	flags := flag.NewFlagSet("rm", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, removeUsage) }
+	opts.register(flags, outputTable)
+	var force bool
+	flags.BoolVar(&force, "force", false, "don't ask")
+	flags.BoolVar(&force, "f", false, "shorthand for --force")
+	names, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(names) != 1 {
+		flags.Usage()
+		return fmt.Errorf("rm takes the name of one credential")
+	}
+
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+	cred, err := secretref.Find(c, names[0])
+	if err != nil {
+		return err
+	}
+	if !force && !confirm(fmt.Sprintf("Delete %s (ID %d)?", fullName(*cred), cred.ID)) {
+		return fmt.Errorf("not deleted, pass --force to delete without asking")
+	}
+
+	if err := c.DeleteCredential(cred.ID); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted %s\n", cred.Name)
+	return nil
+}
+
+// Search runs the search command
+func Search(args []string) error {
+	var opts clientOptions
+	flags := flag.NewFlagSet("search", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, searchUsage) }
+	opts.register(flags, outputTable)
+	limit := flags.Int("limit", 0, "most credentials to return")
+	terms, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(terms) == 0 {
+		flags.Usage()
+		return fmt.Errorf("search takes a query")
+	}
+	if err := opts.check(); err != nil {
+		return err
+	}
+
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+	credentials, err := c.SearchCredentials(strings.Join(terms, " "), *limit)
+	if err != nil {
+		return err
+	}
+	return printCredentials(credentials, opts.output)
+}
@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"passvault/client"
+	"passvault/structs"
+	"strings"
+)
+
+const dockerCredentialUsage = `Usage: passvault docker-credential <get|store|erase|list> [flags]
+
+Speaks the docker credential helper protocol on stdin and stdout, so docker
+login keeps registry logins in the vault instead of ~/.docker/config.json.
+Link the binary as docker-credential-passvault somewhere on the PATH and set
+
+  { "credsStore": "passvault" }
+
+in ~/.docker/config.json, or "credHelpers" for single registries. Logins are
+kept as registry items, with the address of the registry as their URL.
+
+Flags:
+  --server URL   Server to talk to
+`
+
+// dockerNotFound is what docker expects from a helper knowing no login for
+// a registry, it tells it apart from other errors by this message
+const dockerNotFound = "credentials not found in native keychain"
+
+// dockerLogin is a registry login in the docker credential protocol
+type dockerLogin struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+// DockerCredential runs the docker-credential command. Docker reads the
+// errors of helpers from stdout, so they are written there.
+func DockerCredential(args []string) error {
+	var opts clientOptions
+	flags := flag.NewFlagSet("docker-credential", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, dockerCredentialUsage) }
+	flags.StringVar(&opts.server, "server", "", "URL of the PassVault server")
+	operations, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(operations) != 1 {
+		flags.Usage()
+		return fmt.Errorf("docker-credential takes one of get, store, erase or list")
+	}
+
+	if err := dockerOperation(&opts, operations[0]); err != nil {
+		fmt.Println(loginHint(err))
+		return &ExitError{Code: 1}
+	}
+	return nil
+}
+
+// dockerOperation runs a single operation of the docker protocol
+func dockerOperation(opts *clientOptions, operation string) error {
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	switch operation {
+	case "get":
+		server, err := readServerURL(os.Stdin)
+		if err != nil {
+			return err
+		}
+		cred, err := findRegistry(c, server)
+		if err != nil {
+			return err
+		}
+		if cred == nil {
+			return fmt.Errorf(dockerNotFound)
+		}
+		return json.NewEncoder(os.Stdout).Encode(dockerLogin{ServerURL: server, Username: cred.Username, Secret: cred.Password})
+	case "store":
+		var login dockerLogin
+		if err := json.NewDecoder(os.Stdin).Decode(&login); err != nil {
+			return fmt.Errorf("invalid login from docker: %w", err)
+		}
+		return storeRegistry(c, login)
+	case "erase":
+		server, err := readServerURL(os.Stdin)
+		if err != nil {
+			return err
+		}
+		cred, err := findRegistry(c, server)
+		if err != nil || cred == nil {
+			return err
+		}
+		return c.DeleteCredential(cred.ID)
+	case "list":
+		registries, err := c.AllCredentials(url.Values{"type": {structs.ItemTypeRegistry}})
+		if err != nil {
+			return err
+		}
+		logins := map[string]string{}
+		for _, cred := range registries {
+			if len(cred.URLs) > 0 {
+				logins[cred.URLs[0]] = cred.Username
+			}
+		}
+		return json.NewEncoder(os.Stdout).Encode(logins)
+	default:
+		return fmt.Errorf("unknown docker credential operation %q", operation)
+	}
+}
+
+// readServerURL reads the registry address docker sends on its own
+func readServerURL(r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	server := strings.TrimSpace(string(data))
+	if server == "" {
+		return "", fmt.Errorf("docker didn't send a registry address")
+	}
+	return server, nil
+}
+
+// registryKey normalizes a registry address, so https://registry.example.com/
+// and registry.example.com are the same registry
+func registryKey(server string) string {
+	if u, err := url.Parse(server); err == nil && u.Host != "" {
+		server = u.Host + u.Path
+	}
+	return strings.ToLower(strings.TrimRight(server, "/"))
+}
+
+// findRegistry returns the registry item for an address, nil when there is
+// none
+func findRegistry(c *client.Client, server string) (*structs.Credential, error) {
+	registries, err := c.AllCredentials(url.Values{"type": {structs.ItemTypeRegistry}})
+	if err != nil {
+		return nil, err
+	}
+	key := registryKey(server)
+	for i, cred := range registries {
+		if len(cred.URLs) > 0 && registryKey(cred.URLs[0]) == key {
+			return &registries[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// storeRegistry saves the login docker has seen work, updating the registry
+// item of its address or adding one
+func storeRegistry(c *client.Client, login dockerLogin) error {
+	if login.ServerURL == "" {
+		return fmt.Errorf("docker didn't send a registry address")
+	}
+	cred, err := findRegistry(c, login.ServerURL)
+	if err != nil {
+		return err
+	}
+	if cred != nil {
+		if cred.Username == login.Username && cred.Password == login.Secret {
+			return nil
+		}
+		cred.Username, cred.Password = login.Username, login.Secret
+		return c.UpdateCredential(cred.ID, *cred)
+	}
+
+	name := login.ServerURL
+	if u, err := url.Parse(login.ServerURL); err == nil && u.Host != "" {
+		name = u.Host
+	}
+	_, err = c.CreateCredential(structs.Credential{
+		Name:     name,
+		Username: login.Username,
+		Password: login.Secret,
+		ItemType: structs.ItemTypeRegistry,
+		URLs:     []string{login.ServerURL},
+	})
+	return err
+}
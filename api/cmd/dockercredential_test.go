@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"errors"
+	"passvault/structs"
+	"strings"
+	"testing"
+)
+
+func TestRegistryKey(t *testing.T) {
+	tests := []struct {
+		server string
+		want   string
+	}{
+		{"https://registry.example.com/", "registry.example.com"},
+		{"registry.example.com", "registry.example.com"},
+		{"Registry.Example.com:5000", "registry.example.com:5000"},
+		{"https://index.docker.io/v1/", "index.docker.io/v1"},
+		{"ghcr.io/team", "ghcr.io/team"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.server, func(t *testing.T) {
+			if got := registryKey(tt.server); got != tt.want {
+				t.Fatalf("registryKey(%q) = %q, want %q", tt.server, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDockerCredential(t *testing.T) {
+	token := strings.Repeat("t", 300)
+	registry := structs.Credential{Name: "registry.example.com", Username: "ci", Password: "registry-password", ItemType: structs.ItemTypeRegistry, URLs: []string{"https://registry.example.com"}}
+	tests := []struct {
+		name   string
+		creds  []structs.Credential
+		op     string
+		input  string
+		output string
+		failed bool
+		// check looks at the vault afterwards, by name
+		check func(t *testing.T, byName map[string]structs.Credential)
+	}{
+		{
+			name:   "get",
+			creds:  []structs.Credential{registry},
+			op:     "get",
+			input:  "registry.example.com/\n",
+			output: `{"ServerURL":"registry.example.com/","Username":"ci","Secret":"registry-password"}` + "\n",
+		},
+		{
+			name:   "get without a login",
+			creds:  []structs.Credential{{Name: "login", Username: "ci", Password: "registry-password", URLs: []string{"https://registry.example.com"}}},
+			op:     "get",
+			input:  "https://registry.example.com",
+			output: dockerNotFound + "\n",
+			failed: true,
+		},
+		{
+			name:   "get without an address",
+			op:     "get",
+			input:  "\n",
+			output: "docker didn't send a registry address\n",
+			failed: true,
+		},
+		{
+			name:  "store a token",
+			op:    "store",
+			input: `{"ServerURL":"https://ghcr.io","Username":"x","Secret":"` + token + `"}`,
+			check: func(t *testing.T, byName map[string]structs.Credential) {
+				cred, ok := byName["ghcr.io"]
+				if !ok || cred.ItemType != structs.ItemTypeRegistry || cred.Username != "x" || cred.Password != token {
+					t.Fatalf("stored %+v", cred)
+				}
+			},
+		},
+		{
+			name:  "store updates the registry",
+			creds: []structs.Credential{registry},
+			op:    "store",
+			input: `{"ServerURL":"registry.example.com","Username":"deploy","Secret":"new-password"}`,
+			check: func(t *testing.T, byName map[string]structs.Credential) {
+				cred := byName["registry.example.com"]
+				if len(byName) != 1 || cred.Username != "deploy" || cred.Password != "new-password" {
+					t.Fatalf("vault = %+v", byName)
+				}
+			},
+		},
+		{
+			name:   "store garbage",
+			op:     "store",
+			input:  "ci",
+			output: "invalid login from docker: invalid character 'c' looking for beginning of value\n",
+			failed: true,
+		},
+		{
+			name:  "erase",
+			creds: []structs.Credential{registry},
+			op:    "erase",
+			input: "https://registry.example.com/",
+			check: func(t *testing.T, byName map[string]structs.Credential) {
+				if len(byName) != 0 {
+					t.Fatalf("vault = %+v, want it empty", byName)
+				}
+			},
+		},
+		{
+			name:   "list",
+			creds:  []structs.Credential{registry, {Name: "login", Username: "dev", Password: "hunter22"}},
+			op:     "list",
+			output: `{"https://registry.example.com":"ci"}` + "\n",
+		},
+		{
+			name:   "unknown operation",
+			op:     "version",
+			output: "unknown docker credential operation \"version\"\n",
+			failed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vault := newTestAPI(t, tt.creds...)
+			setStdin(t, tt.input)
+			output, err := captureStdout(t, func() error { return DockerCredential([]string{tt.op}) })
+			var exitErr *ExitError
+			if tt.failed != errors.As(err, &exitErr) || (err != nil && !tt.failed) {
+				t.Fatalf("DockerCredential = %v, want failed %v", err, tt.failed)
+			}
+			if output != tt.output {
+				t.Fatalf("output = %q, want %q", output, tt.output)
+			}
+			if tt.check == nil {
+				return
+			}
+			tt.check(t, credentialsByName(t, vault))
+		})
+	}
+}
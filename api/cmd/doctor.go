@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"passvault/backup"
+	api "passvault/config"
+	"passvault/crypt"
+	"passvault/db"
+	"passvault/passstore"
+	"passvault/store"
+	"text/tabwriter"
+	"time"
+)
+
+const doctorUsage = `Usage: passvault doctor [flags]
+
+Checks the configuration and the vault without changing anything: the
+storage backend and its files, their permissions, the schema version, the
+master password, backups, the pass keys and whether the server is running.
+It exits with an error when a check fails.
+`
+
+// Results of a doctor check
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+// checkResult is the outcome of a single doctor check
+type checkResult struct {
+	status string
+	name   string
+	detail string
+}
+
+// doctor collects check results
+type doctor struct {
+	results []checkResult
+}
+
+func (d *doctor) ok(name, format string, args ...any) {
+	d.results = append(d.results, checkResult{checkOK, name, fmt.Sprintf(format, args...)})
+}
+
+func (d *doctor) warn(name, format string, args ...any) {
+	d.results = append(d.results, checkResult{checkWarn, name, fmt.Sprintf(format, args...)})
+}
+
+func (d *doctor) fail(name, format string, args ...any) {
+	d.results = append(d.results, checkResult{checkFail, name, fmt.Sprintf(format, args...)})
+}
+
+// Doctor runs the doctor command
+func Doctor(args []string) error {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	configFlags := api.RegisterFlags(flags, api.AllFlags()...)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, doctorUsage+api.FlagUsage(api.AllFlags()...)) }
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	config := configFlags.Load()
+
+	d := &doctor{}
+	d.private("data directory", config.DataDir, true, "passvault init creates it")
+	switch config.StorageBackend {
+	case api.StorageSQLite:
+		d.checkDatabase(config)
+		d.checkBackups(config)
+	case api.StorageFile:
+		d.checkVaultFile(config)
+	case api.StorageMemory:
+		d.warn("storage", "the memory backend keeps nothing once the server stops")
+	default:
+		d.fail("storage", "unknown storage backend %q, use sqlite, memory or file", config.StorageBackend)
+	}
+	d.checkMasterPassword(config)
+	d.checkPassStore(config)
+	d.checkServer(config)
+
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tCHECK\tDETAIL")
+	for _, r := range d.results {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.status, r.name, r.detail)
+		if r.status == checkFail {
+			failed++
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	return nil
+}
+
+// private checks a file or directory exists and only its owner can read it.
+// missing is what to tell when it doesn't exist.
+func (d *doctor) private(name, path string, dir bool, missing string) bool {
+	kind, mode := "file", fs.FileMode(0600)
+	if dir {
+		kind, mode = "directory", 0700
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		d.warn(name, "%s doesn't exist yet, %s", path, missing)
+		return false
+	}
+	if err != nil {
+		d.fail(name, "%v", err)
+		return false
+	}
+	if info.IsDir() != dir {
+		d.fail(name, "%s is not a %s", path, kind)
+		return false
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		d.warn(name, "%s has mode %v, others can read it, chmod it to %v", path, info.Mode().Perm(), mode)
+		return true
+	}
+	d.ok(name, "%s", path)
+	return true
+}
+
+// checkDatabase checks the SQLite database is intact and up to date
+func (d *doctor) checkDatabase(config *api.Config) {
+	if !d.private("database", config.DatabasePath, false, "passvault init creates it") {
+		return
+	}
+	version, err := db.IntegrityCheck(config.DatabasePath)
+	if err != nil {
+		d.fail("integrity", "%v", err)
+		return
+	}
+	d.ok("integrity", "the integrity check passed")
+
+	latest, err := db.LatestSchemaVersion()
+	switch {
+	case err != nil:
+		d.fail("schema", "%v", err)
+	case version < latest:
+		d.warn("schema", "version %d, migrations up to %d are pending, passvault migrate up applies them", version, latest)
+	case version > latest:
+		d.fail("schema", "version %d is newer than this binary knows (%d), upgrade passvault", version, latest)
+	default:
+		d.ok("schema", "version %d", version)
+	}
+}
+
+// checkBackups checks backups are taken, encrypted and recent
+func (d *doctor) checkBackups(config *api.Config) {
+	if config.BackupInterval <= 0 {
+		d.warn("backups", "scheduled backups are disabled, BACKUP_INTERVAL is 0")
+	}
+	if config.BackupKey == "" {
+		d.warn("backup key", "BACKUP_KEY is not set, backups aren't encrypted")
+	} else {
+		d.ok("backup key", "backups are encrypted")
+	}
+	if !d.private("backup directory", config.BackupDir, true, "the first backup creates it") {
+		return
+	}
+
+	backups, err := backup.NewManager(nil, config.BackupDir, config.BackupKey, backup.Retention{}).List()
+	if err != nil {
+		d.fail("last backup", "%v", err)
+		return
+	}
+	if len(backups) == 0 {
+		d.warn("last backup", "there are no backups, passvault backup takes one")
+		return
+	}
+	latest := backups[0]
+	age := time.Since(latest.CreatedAt).Round(time.Minute)
+	if config.BackupInterval > 0 && age > 2*config.BackupInterval {
+		d.warn("last backup", "%s is %s old, more than twice BACKUP_INTERVAL", latest.Name, age)
+		return
+	}
+	d.ok("last backup", "%s, %s old", latest.Name, age)
+}
+
+// checkVaultFile checks the vault file opens with the passphrase
+func (d *doctor) checkVaultFile(config *api.Config) {
+	if !d.private("vault file", config.StoreFilePath, false, "passvault init creates it") {
+		return
+	}
+	if config.StorePassphrase == "" {
+		d.fail("passphrase", "STORE_PASSPHRASE is not set")
+		return
+	}
+	// Opening an existing file never writes to it
+	file, err := store.OpenFile(config.StoreFilePath, config.StorePassphrase)
+	if err != nil {
+		d.fail("passphrase", "%v", err)
+		return
+	}
+	file.Close()
+	d.ok("passphrase", "STORE_PASSPHRASE opens the vault file")
+}
+
+// checkMasterPassword checks a master password is set
+func (d *doctor) checkMasterPassword(config *api.Config) {
+	data, err := os.ReadFile(config.AuthFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		d.warn("master password", "none is set, the API is open to every client, passvault init sets one")
+		return
+	}
+	if err != nil {
+		d.fail("master password", "%v", err)
+		return
+	}
+	if _, err := crypt.ParsePasswordHash(data); err != nil {
+		d.fail("master password", "%s: %v", config.AuthFile, err)
+		return
+	}
+	d.private("master password", config.AuthFile, false, "")
+}
+
+// checkPassStore checks the configured pass keys can be read
+func (d *doctor) checkPassStore(config *api.Config) {
+	if config.PassPublicKey != "" {
+		if keys, err := passstore.ReadPublicKeys(config.PassPublicKey); err != nil {
+			d.fail("pass public key", "%v", err)
+		} else {
+			d.ok("pass public key", "%d keys in %s", len(keys), config.PassPublicKey)
+		}
+	}
+	if config.PassSecretKey != "" {
+		d.private("pass secret key", config.PassSecretKey, false, "check PASS_SECRET_KEY_FILE")
+	}
+	if config.PassMirrorDir != "" && config.PassPublicKey == "" {
+		d.fail("pass mirror", "PASS_MIRROR_DIR is set without PASS_PUBLIC_KEY_FILE")
+	}
+}
+
+// checkServer checks whether a server is listening on the port
+func (d *doctor) checkServer(config *api.Config) {
+	listener, err := net.Listen("tcp", ":"+config.Port)
+	if err == nil {
+		listener.Close()
+		d.ok("server", "not running, port %s is free", config.Port)
+		return
+	}
+
+	client := &http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Get("http://localhost:" + config.Port + "/health")
+	if err != nil {
+		d.fail("server", "port %s is taken by something else: %v", config.Port, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		d.fail("server", "port %s is taken by something else, /health answered %s", config.Port, resp.Status)
+		return
+	}
+	d.ok("server", "running on port %s", config.Port)
+}
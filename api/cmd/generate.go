@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"passvault/passgen"
+	"passvault/secretref"
+	"passvault/totp"
+	"time"
+)
+
+const generateUsage = `Usage: passvault gen [flags]
+
+Generates a random password. It doesn't need a server.
+
+Flags:
+  -l, --length N   Length (default 24)
+  --no-upper       Leave upper case letters out
+  --no-digits      Leave digits out
+  --no-symbols     Leave symbols out
+  -o, --output     raw (default), json or table
+`
+
+const totpUsage = `Usage: passvault totp <name> [flags]
+
+Prints the current TOTP code of a credential.
+
+Flags:
+  -o, --output   raw (default, the code), json or table (with the seconds it stays valid)
+  --server URL   Server to talk to
+`
+
+// Generate runs the gen command
+func Generate(args []string) error {
+	var opts clientOptions
+	var gen passgen.Options
+	flags := flag.NewFlagSet("gen", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, generateUsage) }
+	opts.register(flags, outputRaw)
+	flags.IntVar(&gen.Length, "length", passgen.DefaultLength, "length")
+	flags.IntVar(&gen.Length, "l", passgen.DefaultLength, "shorthand for --length")
+	flags.BoolVar(&gen.NoUpper, "no-upper", false, "no upper case letters")
+	flags.BoolVar(&gen.NoDigits, "no-digits", false, "no digits")
+	flags.BoolVar(&gen.NoSymbols, "no-symbols", false, "no symbols")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := opts.check(); err != nil {
+		return err
+	}
+
+	password, err := passgen.Generate(gen)
+	if err != nil {
+		return err
+	}
+	switch opts.output {
+	case outputJSON:
+		return printJSON(map[string]string{"password": password})
+	case outputTable:
+		fmt.Printf("PASSWORD  %s\n", password)
+	default:
+		fmt.Println(password)
+	}
+	return nil
+}
+
+// TOTP runs the totp command
+func TOTP(args []string) error {
+	var opts clientOptions
+	flags := flag.NewFlagSet("totp", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, totpUsage) }
+	opts.register(flags, outputRaw)
+	names, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(names) != 1 {
+		flags.Usage()
+		return fmt.Errorf("totp takes the name of one credential")
+	}
+	if err := opts.check(); err != nil {
+		return err
+	}
+
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+	cred, err := secretref.Find(c, names[0])
+	if err != nil {
+		return err
+	}
+	if cred.TOTP == "" {
+		return fmt.Errorf("%s has no TOTP secret", cred.Name)
+	}
+	key, err := totp.Parse(cred.TOTP)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	code, remaining := key.Code(now), int(key.Remaining(now).Seconds())
+	switch opts.output {
+	case outputJSON:
+		return printJSON(map[string]any{"code": code, "expires_in": remaining})
+	case outputTable:
+		fmt.Printf("CODE    %s\nEXPIRES %ds\n", code, remaining)
+	default:
+		fmt.Println(code)
+	}
+	return nil
+}
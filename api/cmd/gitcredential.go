@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"passvault/client"
+	"passvault/structs"
+	"slices"
+	"strings"
+)
+
+const gitCredentialUsage = `Usage: passvault git-credential <get|store|erase> [flags]
+
+Speaks the git credential helper protocol on stdin and stdout, so git takes
+the passwords of remotes from the vault. Set it up with
+
+  git config --global credential.helper "!passvault git-credential"
+
+or link the binary as git-credential-passvault somewhere on the PATH and use
+credential.helper passvault.
+
+Credentials are matched on their URLs: the protocol and host have to be the
+same, and a URL with a path only matches repositories below it. get prints
+the username and password of the best login or git item. store adds a git
+item named after the host, or updates the password of the matching one.
+erase deletes the matching git item, but only while it still holds the
+password git rejected. Logins are only read.
+
+Flags:
+  --server URL   Server to talk to
+`
+
+// gitRequest is a credential description in the git credential protocol
+type gitRequest struct {
+	protocol string
+	host     string
+	path     string
+	username string
+	password string
+}
+
+// GitCredential runs the git-credential command
+func GitCredential(args []string) error {
+	var opts clientOptions
+	flags := flag.NewFlagSet("git-credential", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, gitCredentialUsage) }
+	flags.StringVar(&opts.server, "server", "", "URL of the PassVault server")
+	operations, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(operations) != 1 {
+		flags.Usage()
+		return fmt.Errorf("git-credential takes one of get, store or erase")
+	}
+
+	req, err := readGitRequest(os.Stdin)
+	if err != nil {
+		return err
+	}
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	switch operations[0] {
+	case "get":
+		cred, err := findGitCredential(c, req, structs.ItemTypeLogin, structs.ItemTypeGit)
+		if err != nil || cred == nil {
+			return err
+		}
+		// A line break would end the value and start lines of its own
+		if strings.ContainsAny(cred.Username+cred.Password, "\n\x00") {
+			return fmt.Errorf("the username or password of %s holds a line break or NUL, git can't be handed it", cred.Name)
+		}
+		fmt.Printf("username=%s\npassword=%s\n", cred.Username, cred.Password)
+		return nil
+	case "store":
+		return storeGitCredential(c, req)
+	case "erase":
+		cred, err := findGitCredential(c, req, structs.ItemTypeGit)
+		if err != nil || cred == nil || cred.Password != req.password {
+			return err
+		}
+		return c.DeleteCredential(cred.ID)
+	default:
+		// Git asks helpers for operations added later, unknown ones are skipped
+		return nil
+	}
+}
+
+// readGitRequest reads key=value lines up to a blank line or the end of
+// input. Attributes the vault has no use for are skipped.
+func readGitRequest(r io.Reader) (*gitRequest, error) {
+	req := &gitRequest{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid line %q from git, expected key=value", line)
+		}
+		switch key {
+		case "protocol":
+			req.protocol = value
+		case "host":
+			req.host = value
+		case "path":
+			req.path = value
+		case "username":
+			req.username = value
+		case "password":
+			req.password = value
+		case "url":
+			// Helpers may be handed a whole URL in place of its parts
+			u, err := url.Parse(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid url from git: %w", err)
+			}
+			req.protocol, req.host, req.path = u.Scheme, u.Host, u.Path
+			if u.User != nil {
+				req.username = u.User.Username()
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if req.protocol == "" || req.host == "" {
+		return nil, fmt.Errorf("git didn't send a protocol and host")
+	}
+	return req, nil
+}
+
+// gitPath normalizes a repository path, so example/repo.git/ and
+// example/repo are the same
+func gitPath(p string) string {
+	return strings.TrimSuffix(strings.Trim(p, "/"), ".git")
+}
+
+// matchGitURL reports how well a URL of a credential matches a request, -1
+// when it doesn't. Longer paths match better.
+func matchGitURL(raw string, req *gitRequest) int {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return -1
+	}
+	if !strings.EqualFold(u.Scheme, req.protocol) || !strings.EqualFold(u.Host, req.host) {
+		return -1
+	}
+	prefix := gitPath(u.Path)
+	if prefix == "" {
+		return 0
+	}
+	// Without credential.useHttpPath git leaves the path out, a URL naming
+	// one repository still does for the whole host then
+	if req.path == "" {
+		return 1
+	}
+	if path := gitPath(req.path); path != prefix && !strings.HasPrefix(path, prefix+"/") {
+		return -1
+	}
+	return 1 + len(prefix)
+}
+
+// findGitCredential returns the credential of one of the item types whose
+// URLs match a request best, nil when none does. On a tie git items win
+// over logins.
+func findGitCredential(c *client.Client, req *gitRequest, itemTypes ...string) (*structs.Credential, error) {
+	credentials, err := c.AllCredentials(nil)
+	if err != nil {
+		return nil, err
+	}
+	var best *structs.Credential
+	bestScore := -1
+	for i, cred := range credentials {
+		if !slices.Contains(itemTypes, cred.ItemType) {
+			continue
+		}
+		if req.username != "" && cred.Username != req.username {
+			continue
+		}
+		for _, raw := range cred.URLs {
+			score := matchGitURL(raw, req)
+			if score > bestScore || score == bestScore && score >= 0 && cred.ItemType == structs.ItemTypeGit && best.ItemType != structs.ItemTypeGit {
+				best, bestScore = &credentials[i], score
+			}
+		}
+	}
+	return best, nil
+}
+
+// storeGitCredential saves a password git has seen work, updating the
+// matching git item or adding one, which takes tokens longer than the
+// passwords of logins. Logins are left to the user, a website sharing its
+// login with the remote keeps its password.
+func storeGitCredential(c *client.Client, req *gitRequest) error {
+	if req.username == "" || req.password == "" {
+		return nil
+	}
+	cred, err := findGitCredential(c, req, structs.ItemTypeGit)
+	if err != nil {
+		return err
+	}
+	if cred != nil {
+		if cred.Password == req.password {
+			return nil
+		}
+		cred.Password = req.password
+		return c.UpdateCredential(cred.ID, *cred)
+	}
+
+	remote := url.URL{Scheme: req.protocol, Host: req.host, Path: "/" + strings.TrimPrefix(req.path, "/")}
+	_, err = c.CreateCredential(structs.Credential{
+		Name:     req.host,
+		Username: req.username,
+		Password: req.password,
+		ItemType: structs.ItemTypeGit,
+		URLs:     []string{strings.TrimSuffix(remote.String(), "/")},
+	})
+	return err
+}
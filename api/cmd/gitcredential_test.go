@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"passvault/structs"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadGitRequest(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  gitRequest
+		err   string
+	}{
+		{
+			name:  "parts",
+			input: "protocol=https\nhost=git.example.com\npath=team/app.git\nusername=dev\npassword=secret\n\nprotocol=ignored\n",
+			want:  gitRequest{protocol: "https", host: "git.example.com", path: "team/app.git", username: "dev", password: "secret"},
+		},
+		{
+			name:  "url",
+			input: "url=https://dev@git.example.com:8443/team/app\nwwwauth[]=Basic\n",
+			want:  gitRequest{protocol: "https", host: "git.example.com:8443", path: "/team/app", username: "dev"},
+		},
+		{
+			name:  "no host",
+			input: "protocol=https\n",
+			err:   "didn't send a protocol and host",
+		},
+		{
+			name:  "not key value",
+			input: "protocol https\n",
+			err:   "expected key=value",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := readGitRequest(strings.NewReader(tt.input))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("readGitRequest = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *req != tt.want {
+				t.Fatalf("readGitRequest = %+v, want %+v", *req, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchGitURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		req  gitRequest
+		want int
+	}{
+		{"host", "https://git.example.com", gitRequest{protocol: "https", host: "git.example.com", path: "team/app.git"}, 0},
+		{"host case", "HTTPS://Git.Example.com/", gitRequest{protocol: "https", host: "git.example.com"}, 0},
+		{"repository", "https://git.example.com/team/app", gitRequest{protocol: "https", host: "git.example.com", path: "team/app.git"}, 1 + len("team/app")},
+		{"below the path", "https://git.example.com/team", gitRequest{protocol: "https", host: "git.example.com", path: "team/app.git"}, 1 + len("team")},
+		{"path without useHttpPath", "https://git.example.com/team/app", gitRequest{protocol: "https", host: "git.example.com"}, 1},
+		{"other repository", "https://git.example.com/team/app", gitRequest{protocol: "https", host: "git.example.com", path: "team/application"}, -1},
+		{"other scheme", "http://git.example.com", gitRequest{protocol: "https", host: "git.example.com"}, -1},
+		{"other host", "https://example.com", gitRequest{protocol: "https", host: "git.example.com"}, -1},
+		{"other port", "https://git.example.com:8443", gitRequest{protocol: "https", host: "git.example.com"}, -1},
+		{"not a URL", "git.example.com", gitRequest{protocol: "https", host: "git.example.com"}, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchGitURL(tt.url, &tt.req); got != tt.want {
+				t.Fatalf("matchGitURL(%q) = %d, want %d", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitCredential(t *testing.T) {
+	token := strings.Repeat("t", 93)
+	tests := []struct {
+		name   string
+		creds  []structs.Credential
+		op     string
+		input  string
+		output string
+		err    string
+		// check looks at the vault afterwards, by name
+		check func(t *testing.T, byName map[string]structs.Credential)
+	}{
+		{
+			name: "get the longest path",
+			creds: []structs.Credential{
+				{Name: "host", Username: "dev", Password: "host-password", URLs: []string{"https://git.example.com"}},
+				{Name: "repo", Username: "dev", Password: "repo-password", URLs: []string{"https://git.example.com/team/app"}},
+			},
+			op:     "get",
+			input:  "protocol=https\nhost=git.example.com\npath=team/app.git\n",
+			output: "username=dev\npassword=repo-password\n",
+		},
+		{
+			name:   "get a git item",
+			creds:  []structs.Credential{{Name: "git.example.com", Username: "x", Password: token, ItemType: structs.ItemTypeGit, URLs: []string{"https://git.example.com"}}},
+			op:     "get",
+			input:  "protocol=https\nhost=git.example.com\n",
+			output: "username=x\npassword=" + token + "\n",
+		},
+		{
+			name: "get prefers a git item",
+			creds: []structs.Credential{
+				{Name: "website", Username: "dev", Password: "site-password", URLs: []string{"https://git.example.com"}},
+				{Name: "git.example.com", Username: "dev", Password: token, ItemType: structs.ItemTypeGit, URLs: []string{"https://git.example.com"}},
+			},
+			op:     "get",
+			input:  "protocol=https\nhost=git.example.com\n",
+			output: "username=dev\npassword=" + token + "\n",
+		},
+		{
+			name:  "get refuses a line break",
+			creds: []structs.Credential{{Name: "host", Username: "dev", Password: "pass\nhost=evil.test", URLs: []string{"https://git.example.com"}}},
+			op:    "get",
+			input: "protocol=https\nhost=git.example.com\n",
+			err:   "line break",
+		},
+		{
+			name:  "get by username",
+			creds: []structs.Credential{{Name: "host", Username: "dev", Password: "host-password", URLs: []string{"https://git.example.com"}}},
+			op:    "get",
+			input: "protocol=https\nhost=git.example.com\nusername=ops\n",
+		},
+		{
+			name:  "get skips other types",
+			creds: []structs.Credential{{Name: "registry", Username: "dev", Password: "host-password", ItemType: structs.ItemTypeRegistry, URLs: []string{"https://git.example.com"}}},
+			op:    "get",
+			input: "protocol=https\nhost=git.example.com\n",
+		},
+		{
+			name:  "store a token",
+			op:    "store",
+			input: "protocol=https\nhost=git.example.com\npath=team/app.git\nusername=x\npassword=" + token + "\n",
+			check: func(t *testing.T, byName map[string]structs.Credential) {
+				cred, ok := byName["git.example.com"]
+				if !ok || cred.ItemType != structs.ItemTypeGit || cred.Username != "x" || cred.Password != token {
+					t.Fatalf("stored %+v", cred)
+				}
+				if !slices.Equal(cred.URLs, []string{"https://git.example.com/team/app.git"}) {
+					t.Fatalf("URLs = %q", cred.URLs)
+				}
+			},
+		},
+		{
+			name:  "store updates the git item",
+			creds: []structs.Credential{{Name: "remote", Username: "dev", Password: "old-password", ItemType: structs.ItemTypeGit, URLs: []string{"https://git.example.com"}}},
+			op:    "store",
+			input: "protocol=https\nhost=git.example.com\nusername=dev\npassword=new-password\n",
+			check: func(t *testing.T, byName map[string]structs.Credential) {
+				if len(byName) != 1 || byName["remote"].Password != "new-password" {
+					t.Fatalf("vault = %+v", byName)
+				}
+			},
+		},
+		{
+			name:  "store keeps a login",
+			creds: []structs.Credential{{Name: "website", Username: "dev", Password: "site-password", URLs: []string{"https://git.example.com"}}},
+			op:    "store",
+			input: "protocol=https\nhost=git.example.com\nusername=dev\npassword=" + token + "\n",
+			check: func(t *testing.T, byName map[string]structs.Credential) {
+				if len(byName) != 2 || byName["website"].Password != "site-password" || byName["git.example.com"].Password != token {
+					t.Fatalf("vault = %+v, want the login kept and a git item added", byName)
+				}
+			},
+		},
+		{
+			name:  "erase the rejected password",
+			creds: []structs.Credential{{Name: "remote", Username: "dev", Password: "old-password", ItemType: structs.ItemTypeGit, URLs: []string{"https://git.example.com"}}},
+			op:    "erase",
+			input: "protocol=https\nhost=git.example.com\nusername=dev\npassword=old-password\n",
+			check: func(t *testing.T, byName map[string]structs.Credential) {
+				if len(byName) != 0 {
+					t.Fatalf("vault = %+v, want it empty", byName)
+				}
+			},
+		},
+		{
+			name:  "erase keeps a login",
+			creds: []structs.Credential{{Name: "website", Username: "dev", Password: "old-password", URLs: []string{"https://git.example.com"}}},
+			op:    "erase",
+			input: "protocol=https\nhost=git.example.com\nusername=dev\npassword=old-password\n",
+			check: func(t *testing.T, byName map[string]structs.Credential) {
+				if len(byName) != 1 {
+					t.Fatalf("vault = %+v, want the login kept", byName)
+				}
+			},
+		},
+		{
+			name:  "erase keeps a changed password",
+			creds: []structs.Credential{{Name: "remote", Username: "dev", Password: "new-password", ItemType: structs.ItemTypeGit, URLs: []string{"https://git.example.com"}}},
+			op:    "erase",
+			input: "protocol=https\nhost=git.example.com\nusername=dev\npassword=old-password\n",
+			check: func(t *testing.T, byName map[string]structs.Credential) {
+				if len(byName) != 1 {
+					t.Fatalf("vault = %+v, want the credential kept", byName)
+				}
+			},
+		},
+		{
+			name:  "unknown operation",
+			op:    "capability",
+			input: "protocol=https\nhost=git.example.com\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vault := newTestAPI(t, tt.creds...)
+			setStdin(t, tt.input)
+			output, err := captureStdout(t, func() error { return GitCredential([]string{tt.op}) })
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("GitCredential = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GitCredential = %v", err)
+			}
+			if output != tt.output {
+				t.Fatalf("output = %q, want %q", output, tt.output)
+			}
+			if tt.check == nil {
+				return
+			}
+			tt.check(t, credentialsByName(t, vault))
+		})
+	}
+}
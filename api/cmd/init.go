@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"embed"
+	"flag"
+	"fmt"
+	"os"
+	"passvault/auth"
+	api "passvault/config"
+	"passvault/db"
+
+	"golang.org/x/term"
+)
+
+const initUsage = `Usage: passvault init [flags]
+
+Creates the vault of the configured storage backend and sets its master
+password. From then on the API asks every client to log in. The master
+password is read from the terminal, or from the first line of stdin when it
+is piped in. The file backend encrypts the vault file with STORE_PASSPHRASE.
+
+A vault that already has a master password is left alone. Change the master
+password through PUT /api/v1/auth/password instead.
+`
+
+// Init runs the init command
+func Init(args []string, embeddedFS embed.FS) error {
+	flags := flag.NewFlagSet("init", flag.ContinueOnError)
+	configFlags := api.RegisterFlags(flags, api.StorageFlags...)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, initUsage+api.FlagUsage(api.StorageFlags...)) }
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	config := configFlags.Load()
+
+	authManager, err := auth.NewManager(config.AuthFile, config.SessionTTL)
+	if err != nil {
+		return fmt.Errorf("failed to read the master password: %w", err)
+	}
+	if authManager.Enabled() {
+		return fmt.Errorf("the vault already has a master password in %s", config.AuthFile)
+	}
+
+	// Ask before creating anything, so a typo leaves nothing behind
+	password, err := readNewSecret("Master password: ")
+	if err != nil {
+		return err
+	}
+	if len(password) < auth.MinPasswordLength {
+		return fmt.Errorf("the master password must be at least %d characters", auth.MinPasswordLength)
+	}
+
+	vault, err := openStore(config, embeddedFS)
+	if err != nil {
+		return err
+	}
+	vault.Close()
+	if config.StorageBackend == api.StorageSQLite {
+		db.CloseDB()
+	}
+
+	if err := authManager.SetPassword("local", "", password); err != nil {
+		return err
+	}
+	fmt.Printf("Set the master password in %s\n", config.AuthFile)
+	fmt.Println("Start the server with passvault serve and log in with passvault login")
+	return nil
+}
+
+// readNewSecret reads a new secret, twice when it is typed on a terminal so
+// a typo is caught
+func readNewSecret(prompt string) (string, error) {
+	secret, err := readSecret(prompt)
+	if err != nil || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return secret, err
+	}
+	again, err := readSecret("Repeat it: ")
+	if err != nil {
+		return "", err
+	}
+	if again != secret {
+		return "", fmt.Errorf("the passwords don't match")
+	}
+	return secret, nil
+}
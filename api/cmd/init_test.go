@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"embed"
+	"os"
+	"passvault/auth"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInit(t *testing.T) {
+	dir := vaultEnv(t)
+	t.Setenv("STORE_PASSPHRASE", "vault passphrase")
+	args := []string{"--backend", "file"}
+
+	setStdin(t, "short\n")
+	if _, err := captureStdout(t, func() error { return Init(args, embed.FS{}) }); err == nil || !strings.Contains(err.Error(), "at least") {
+		t.Fatalf("Init with a short password = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "vault.json.enc")); !os.IsNotExist(err) {
+		t.Fatalf("a refused init created the vault file: %v", err)
+	}
+
+	setStdin(t, "password1\n")
+	output, err := captureStdout(t, func() error { return Init(args, embed.FS{}) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "Set the master password") {
+		t.Fatalf("output = %q", output)
+	}
+	for _, name := range []string{"vault.json.enc", "master.json"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := auth.NewManager(filepath.Join(dir, "master.json"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Login("test", "password1"); err != nil {
+		t.Fatalf("Login with the password init set = %v", err)
+	}
+
+	setStdin(t, "password2\n")
+	if _, err := captureStdout(t, func() error { return Init(args, embed.FS{}) }); err == nil || !strings.Contains(err.Error(), "already has a master password") {
+		t.Fatalf("a second Init = %v", err)
+	}
+}
+
+func TestDoctor(t *testing.T) {
+	dir := vaultEnv(t)
+	t.Setenv("STORE_PASSPHRASE", "vault passphrase")
+	t.Setenv("STORAGE_BACKEND", "file")
+	setStdin(t, "password1\n")
+	if _, err := captureStdout(t, func() error { return Init(nil, embed.FS{}) }); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		setup func(t *testing.T)
+		args  []string
+		// want are the status and name of checks, in the order they run
+		want []string
+		err  string
+	}{
+		{
+			name: "healthy",
+			want: []string{"ok data directory", "ok vault file", "ok passphrase", "ok master password", "ok server"},
+		},
+		{
+			name:  "wrong passphrase",
+			setup: func(t *testing.T) { t.Setenv("STORE_PASSPHRASE", "wrong") },
+			want:  []string{"fail passphrase"},
+			err:   "1 checks failed",
+		},
+		{
+			name:  "readable by others",
+			setup: func(t *testing.T) { os.Chmod(filepath.Join(dir, "master.json"), 0644) },
+			want:  []string{"warn master password"},
+		},
+		{
+			name: "memory backend",
+			args: []string{"--backend", "memory"},
+			want: []string{"warn storage"},
+		},
+		{
+			name: "unknown backend",
+			args: []string{"--backend", "tape"},
+			want: []string{"fail storage"},
+			err:  "1 checks failed",
+		},
+		{
+			name: "new sqlite vault",
+			args: []string{"--backend", "sqlite"},
+			want: []string{"warn database", "warn backup directory"},
+		},
+		{
+			name:  "mirror without a key",
+			setup: func(t *testing.T) { t.Setenv("PASS_MIRROR_DIR", dir) },
+			want:  []string{"fail pass mirror"},
+			err:   "1 checks failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.setup != nil {
+				tt.setup(t)
+			}
+			output, err := captureStdout(t, func() error { return Doctor(tt.args) })
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || err.Error() != tt.err) {
+				t.Fatalf("Doctor = %v, want %q\n%s", err, tt.err, output)
+			}
+			checks := strings.Join(strings.Fields(output), " ")
+			for _, want := range tt.want {
+				if !strings.Contains(checks, want) {
+					t.Fatalf("no %q check in\n%s", want, output)
+				}
+			}
+		})
+	}
+}
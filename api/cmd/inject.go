@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const injectUsage = `Usage: passvault inject [flags]
+
+Expands the secret references in a text/template file against the vault:
+{{ pv "prod-db" "password" }} calls and pv://folder/name/field URIs are
+replaced with the values they name. Names in URIs are percent-encoded where
+they hold spaces or slashes. A reference naming nothing fails the command and
+writes nothing. The output file is only readable by you.
+
+Flags:
+  -i, --in FILE    Template to read, stdin by default
+  -o, --out FILE   File to write, stdout by default
+  --server URL     Server to talk to
+`
+
+// Inject runs the inject command
+func Inject(args []string) error {
+	var opts clientOptions
+	var in, out string
+	flags := flag.NewFlagSet("inject", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, injectUsage) }
+	flags.StringVar(&opts.server, "server", "", "URL of the PassVault server")
+	flags.StringVar(&in, "in", "", "template to read")
+	flags.StringVar(&in, "i", "", "shorthand for --in")
+	flags.StringVar(&out, "out", "", "file to write")
+	flags.StringVar(&out, "o", "", "shorthand for --out")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return fmt.Errorf("inject takes no arguments, use --in and --out")
+	}
+
+	name, reader := "stdin", io.Reader(os.Stdin)
+	if in != "" {
+		file, err := os.Open(in)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		name, reader = filepath.Base(in), file
+	}
+	template, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+	output, err := c.Render(name, string(template))
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		_, err := os.Stdout.WriteString(output)
+		return err
+	}
+	return writePrivate(out, []byte(output))
+}
+
+// writePrivate replaces a file with data, readable by its owner only. The
+// data is written to a temporary file next to it first, created 0600, so
+// the file is never seen half written or readable by others.
+func writePrivate(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"passvault/client"
+	"time"
+)
+
+const loginUsage = `Usage: passvault login [flags]
+
+Logs in to a PassVault server with the master password and remembers the
+session, so the other commands can use it. The session token is kept in the
+OS keyring, or in the client config file (readable by you only) when there
+is no keyring. The master password is read from the terminal, or from the
+first line of stdin when it is piped in.
+
+Flags:
+  --server URL   Server to log in to, PASSVAULT_SERVER or the last server by default
+`
+
+const logoutUsage = `Usage: passvault logout [flags]
+
+Ends the session with the server and forgets its token.
+
+Flags:
+  --server URL   Server to log out of
+`
+
+// Login runs the login command
+func Login(args []string) error {
+	var opts clientOptions
+	flags := flag.NewFlagSet("login", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, loginUsage) }
+	opts.register(flags, outputTable)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+	password, err := readSecret("Master password: ")
+	if err != nil {
+		return err
+	}
+	session, err := c.Login(password)
+	if err != nil {
+		return err
+	}
+
+	config, err := client.LoadConfig()
+	if err != nil {
+		return err
+	}
+	server := opts.serverURL(config)
+	if err := client.SaveSession(server, session.Token, session.ExpiresAt); err != nil {
+		return fmt.Errorf("logged in, but the session can't be saved: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Logged in to %s until %s\n", server, session.ExpiresAt.Local().Format(time.DateTime))
+	return nil
+}
+
+// Logout runs the logout command
+func Logout(args []string) error {
+	var opts clientOptions
+	flags := flag.NewFlagSet("logout", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, logoutUsage) }
+	opts.register(flags, outputTable)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+	// The session is forgotten even when the server can't be reached
+	logoutErr := c.Logout()
+	if err := client.ClearSession(); err != nil {
+		return err
+	}
+	if logoutErr != nil {
+		return fmt.Errorf("forgot the session, but the server didn't end it: %w", logoutErr)
+	}
+	fmt.Fprintln(os.Stderr, "Logged out")
+	return nil
+}
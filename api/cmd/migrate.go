@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"database/sql"
+	"embed"
+	"flag"
+	"fmt"
+	"os"
+	api "passvault/config"
+	"passvault/db"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = `Usage: passvault migrate <command> [flags]
+
+Commands:
+  status    List every migration and whether it has been applied
+  up        Apply pending migrations
+  down      Roll back applied migrations, one at a time by default
+
+Flags for up and down:
+  --to N        Migrate to schema version N
+  --dry-run     Run the migrations and roll them back without saving anything
+  --no-backup   Skip the backup taken before the database is changed
+`
+
+// migrateFlags are the config flags of the migrate command
+var migrateFlags = []string{"data-dir", "database"}
+
+// Migrate runs the migrate command against the vault database
+func Migrate(args []string, embeddedFS embed.FS) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return fmt.Errorf("missing migrate command")
+	}
+
+	command := args[0]
+	flags := flag.NewFlagSet("migrate "+command, flag.ContinueOnError)
+	configFlags := api.RegisterFlags(flags, migrateFlags...)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, migrateUsage+api.FlagUsage(migrateFlags...)) }
+	target := flags.Int("to", 0, "schema version to migrate to")
+	dryRun := flags.Bool("dry-run", false, "roll back instead of committing")
+	noBackup := flags.Bool("no-backup", false, "skip the pre-migration backup")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	// Open the database without migrating it
+	database, err := db.InitEmbedded(configFlags.Load().DatabasePath, embeddedFS)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	opts := db.MigrateOptions{DryRun: *dryRun, Backup: !*noBackup, Target: *target}
+	switch command {
+	case "status":
+		return migrationStatus(database)
+	case "up":
+		result, err := db.MigrateUp(database, opts)
+		printMigrationResult(result, "Applied")
+		return err
+	case "down":
+		result, err := db.MigrateDown(database, opts)
+		printMigrationResult(result, "Rolled back")
+		return err
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return fmt.Errorf("unknown migrate command %q", command)
+	}
+}
+
+// migrationStatus prints a table of every migration
+func migrationStatus(database *sql.DB) error {
+	states, err := db.MigrationStatus(database)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, state := range states {
+		status, appliedAt := "pending", "-"
+		if state.Applied {
+			status, appliedAt = "applied", state.AppliedAt.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", state.Version, state.Name, status, appliedAt)
+	}
+	return w.Flush()
+}
+
+// printMigrationResult reports the migrations a run applied or rolled back
+func printMigrationResult(result *db.MigrationResult, verb string) {
+	if result == nil {
+		return
+	}
+	if result.BackupPath != "" {
+		fmt.Printf("Backed up the database to %s\n", result.BackupPath)
+	}
+	if len(result.Migrations) == 0 {
+		fmt.Printf("Nothing to do, the schema is at version %d\n", result.From)
+		return
+	}
+	if result.DryRun {
+		verb = "Would have " + strings.ToLower(verb[:1]) + verb[1:]
+	}
+	for _, m := range result.Migrations {
+		fmt.Printf("%s %d_%s\n", verb, m.Version, m.Name)
+	}
+	fmt.Printf("Schema version %d -> %d\n", result.From, result.To)
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"embed"
+	"os"
+	"passvault/db"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	dir := vaultEnv(t)
+	database := filepath.Join(dir, "credentials.sqlite")
+	latest, err := db.LatestSchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name string
+		args []string
+		// want are lines the output has to contain
+		want []string
+		err  string
+	}{
+		{"status of a new vault", []string{"status"}, []string{"1  ", "pending"}, ""},
+		{"dry run", []string{"up", "--dry-run", "--no-backup"}, []string{"Would have applied 1_"}, ""},
+		{"up", []string{"up", "--no-backup"}, []string{"Applied 1_", "-> " + strconv.Itoa(latest)}, ""},
+		{"up again", []string{"up"}, []string{"Nothing to do"}, ""},
+		{"down one", []string{"down", "--database", database}, []string{"Backed up the database", "Rolled back " + strconv.Itoa(latest) + "_"}, ""},
+		{"down to 1", []string{"down", "--to", "1", "--no-backup"}, []string{"-> 1"}, ""},
+		{"status after", []string{"status"}, []string{"applied", "pending"}, ""},
+		{"unknown", []string{"sideways"}, nil, "unknown migrate command"},
+		{"missing", nil, nil, "missing migrate command"},
+		{"bad flag", []string{"up", "--to", "x"}, nil, "invalid value"},
+	}
+	for _, step := range steps {
+		output, err := captureStdout(t, func() error { return Migrate(step.args, embed.FS{}) })
+		if step.err != "" {
+			if err == nil || !strings.Contains(err.Error(), step.err) {
+				t.Fatalf("%s: Migrate = %v, want %q", step.name, err, step.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: Migrate = %v", step.name, err)
+		}
+		for _, want := range step.want {
+			if !strings.Contains(output, want) {
+				t.Fatalf("%s: output %q doesn't contain %q", step.name, output, want)
+			}
+		}
+	}
+	if _, err := os.Stat(database); err != nil {
+		t.Fatal(err)
+	}
+}
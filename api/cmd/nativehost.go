@@ -0,0 +1,385 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"passvault/client"
+	"passvault/nativehost"
+	"passvault/response"
+	"passvault/structs"
+	"passvault/urlmatch"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+const nativeHostUsage = `Usage: passvault native-host [install|pair|clients|unpair ID] [flags]
+
+The native messaging host of the browser extension. Browsers start it and
+speak their native messaging protocol with it on stdin and stdout, so the
+extension can find, fill in and save the logins of the vault. Set it up with
+
+  passvault native-host install --extension-id ID
+  passvault native-host pair
+
+install writes the manifests that let browsers start the host, for every
+browser found or the ones given with --browser, and a launcher next to the
+client config. Chrome, Chromium, Brave and Edge take extension IDs of 32
+letters, Firefox add-on IDs like passvault@example.com. Only the extensions
+named can start the host.
+
+Extensions have to be paired before they can ask for anything. pair prints
+a code to enter in the extension within five minutes. Paired extensions
+exchange keys with the host, and their messages are encrypted with them.
+clients lists the paired extensions, and unpair forgets one.
+
+Logins are read with the session of passvault login, the extension finds
+the vault locked until then.
+
+Flags:
+  --browser NAME       Browser to install for: chrome, chromium, brave, edge
+                       or firefox, can be repeated (default every one found)
+  --extension-id ID    Extension allowed to start the host, can be repeated
+  --server URL         Server to talk to
+`
+
+// nativeHostName is the name browsers know the host by
+const nativeHostName = "passvault"
+
+// chromeExtensionID matches the IDs of Chrome extensions, Firefox add-on
+// IDs look like email addresses or GUIDs
+var chromeExtensionID = regexp.MustCompile(`^[a-p]{32}$`)
+
+// browser is a browser the host is installed for, with its directory in
+// the user config directory on Linux and macOS and its registry key on
+// Windows. The manifests of Firefox go to ~/.mozilla on Linux.
+type browser struct {
+	name, linux, darwin, registry string
+}
+
+var browsers = []browser{
+	{"chrome", "google-chrome", "Google/Chrome", `HKCU\Software\Google\Chrome`},
+	{"chromium", "chromium", "Chromium", `HKCU\Software\Chromium`},
+	{"brave", "BraveSoftware/Brave-Browser", "BraveSoftware/Brave-Browser", `HKCU\Software\BraveSoftware\Brave-Browser`},
+	{"edge", "microsoft-edge", "Microsoft Edge", `HKCU\Software\Microsoft\Edge`},
+	{"firefox", "", "Mozilla", `HKCU\Software\Mozilla`},
+}
+
+// NativeHost runs the native-host command
+func NativeHost(args []string) error {
+	var opts clientOptions
+	var names, extensions stringList
+	var parentWindow int
+	flags := flag.NewFlagSet("native-host", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, nativeHostUsage) }
+	flags.StringVar(&opts.server, "server", "", "URL of the PassVault server")
+	flags.Var(&names, "browser", "browser to install for, can be repeated")
+	flags.Var(&extensions, "extension-id", "extension allowed to start the host, can be repeated")
+	// Chrome hands the host its window on Windows, it has no use for it
+	flags.IntVar(&parentWindow, "parent-window", 0, "window of the browser")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	statePath := filepath.Join(filepath.Dir(client.ConfigPath()), "native-host.json")
+
+	if len(positional) > 0 {
+		switch positional[0] {
+		case "install":
+			return installNativeHost(&opts, statePath, names, extensions)
+		case "pair":
+			return pairNativeHost(statePath)
+		case "clients":
+			return listNativeClients(statePath)
+		case "unpair":
+			if len(positional) != 2 {
+				flags.Usage()
+				return fmt.Errorf("unpair takes the ID of a client")
+			}
+			return unpairNativeClient(statePath, positional[1])
+		}
+	}
+
+	// Chrome starts the host with the origin of the extension, Firefox with
+	// the path of the manifest and the ID of the add-on
+	var extension string
+	switch {
+	case len(positional) > 0 && strings.HasPrefix(positional[0], "chrome-extension://"):
+		extension = strings.Trim(strings.TrimPrefix(positional[0], "chrome-extension://"), "/")
+	case len(positional) == 2:
+		extension = positional[1]
+	default:
+		flags.Usage()
+		return fmt.Errorf("native-host is started by browsers, set it up with passvault native-host install")
+	}
+	state, err := nativehost.LoadState(statePath)
+	if err != nil {
+		return err
+	}
+	if !state.Allowed(extension) {
+		return fmt.Errorf("extension %s isn't allowed to start the host, install it with --extension-id %s", extension, extension)
+	}
+	return nativehost.New(statePath, vaultLogins{&opts}, extension).Serve(os.Stdin, os.Stdout)
+}
+
+// installNativeHost writes the launcher and the manifests of the host, and
+// lets the extensions start it
+func installNativeHost(opts *clientOptions, statePath string, names, extensions []string) error {
+	if len(extensions) == 0 {
+		return fmt.Errorf("install takes the IDs of the extensions with --extension-id")
+	}
+	for _, name := range names {
+		if !slices.ContainsFunc(browsers, func(b browser) bool { return b.name == name }) {
+			return fmt.Errorf("unknown browser %q, use chrome, chromium, brave, edge or firefox", name)
+		}
+	}
+	state, err := nativehost.LoadState(statePath)
+	if err != nil {
+		return err
+	}
+	launcher, err := writeLauncher(opts.server)
+	if err != nil {
+		return err
+	}
+
+	installed := 0
+	for _, b := range browsers {
+		if len(names) > 0 && !slices.Contains(names, b.name) {
+			continue
+		}
+		dir, err := manifestDir(b)
+		if err != nil {
+			return err
+		}
+		// Without --browser only the browsers found are installed for
+		if len(names) == 0 && runtime.GOOS != "windows" {
+			if _, err := os.Stat(filepath.Dir(dir)); err != nil {
+				continue
+			}
+		}
+
+		manifest := map[string]any{
+			"name":        nativeHostName,
+			"description": "PassVault",
+			"path":        launcher,
+			"type":        "stdio",
+		}
+		var allowed []string
+		for _, id := range extensions {
+			if chromeExtensionID.MatchString(id) == (b.name != "firefox") {
+				allowed = append(allowed, id)
+			}
+		}
+		if len(allowed) == 0 {
+			fmt.Printf("Skipped %s, no extension ID for it was given\n", b.name)
+			continue
+		}
+		if b.name == "firefox" {
+			manifest["allowed_extensions"] = allowed
+		} else {
+			var origins []string
+			for _, id := range allowed {
+				origins = append(origins, "chrome-extension://"+id+"/")
+			}
+			manifest["allowed_origins"] = origins
+		}
+		for _, id := range allowed {
+			state.AllowExtension(id)
+		}
+
+		path, err := writeManifest(dir, manifest)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Installed for %s: %s\n", b.name, path)
+		if runtime.GOOS == "windows" {
+			fmt.Printf("  register it with: reg add \"%s\\NativeMessagingHosts\\%s\" /ve /t REG_SZ /d \"%s\" /f\n", b.registry, nativeHostName, path)
+		}
+		installed++
+	}
+	if installed == 0 {
+		return fmt.Errorf("no browser found to install for, name one with --browser")
+	}
+	if err := state.Save(); err != nil {
+		return err
+	}
+	fmt.Println("Pair the extension with passvault native-host pair")
+	return nil
+}
+
+// manifestDir returns the directory browsers look for the manifest of the
+// host in. Windows finds it through the registry, it is kept next to the
+// client config there.
+func manifestDir(b browser) (string, error) {
+	switch runtime.GOOS {
+	case "windows":
+		return filepath.Join(filepath.Dir(client.ConfigPath()), "native-messaging", b.name), nil
+	case "darwin":
+		config, err := os.UserConfigDir()
+		return filepath.Join(config, b.darwin, "NativeMessagingHosts"), err
+	}
+	if b.name == "firefox" {
+		home, err := os.UserHomeDir()
+		return filepath.Join(home, ".mozilla", "native-messaging-hosts"), err
+	}
+	config, err := os.UserConfigDir()
+	return filepath.Join(config, b.linux, "NativeMessagingHosts"), err
+}
+
+// writeManifest writes the manifest of the host into dir, and returns its
+// path
+func writeManifest(dir string, manifest map[string]any) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, nativeHostName+".json")
+	return path, os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// writeLauncher writes the program browsers start, which runs this binary
+// as native-host. Browsers pass no flags and may not pass the environment
+// of the shell, so the client settings of the install go into it.
+func writeLauncher(server string) (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if executable, err = filepath.EvalSymlinks(executable); err != nil {
+		return "", err
+	}
+	env := map[string]string{}
+	for _, name := range []string{"PASSVAULT_CONFIG", "PASSVAULT_SERVER", "PASSVAULT_NO_KEYRING"} {
+		if value := os.Getenv(name); value != "" {
+			env[name] = value
+		}
+	}
+	if server != "" {
+		env["PASSVAULT_SERVER"] = server
+	}
+
+	var b strings.Builder
+	path := filepath.Join(filepath.Dir(client.ConfigPath()), "native-host")
+	if runtime.GOOS == "windows" {
+		path += ".bat"
+		b.WriteString("@echo off\r\n")
+		for _, name := range slices.Sorted(maps.Keys(env)) {
+			fmt.Fprintf(&b, "set \"%s=%s\"\r\n", name, env[name])
+		}
+		fmt.Fprintf(&b, "\"%s\" native-host %%*\r\n", executable)
+	} else {
+		b.WriteString("#!/bin/sh\n")
+		for _, name := range slices.Sorted(maps.Keys(env)) {
+			fmt.Fprintf(&b, "%s=%s; export %s\n", name, shellQuote(env[name]), name)
+		}
+		fmt.Fprintf(&b, "exec %s native-host \"$@\"\n", shellQuote(executable))
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, []byte(b.String()), 0700)
+}
+
+// shellQuote quotes a string for sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// pairNativeHost starts a pairing and prints its code
+func pairNativeHost(statePath string) error {
+	state, err := nativehost.LoadState(statePath)
+	if err != nil {
+		return err
+	}
+	if len(state.Extensions) == 0 {
+		return fmt.Errorf("no extension can start the host yet, run passvault native-host install first")
+	}
+	code, err := state.StartPairing()
+	if err != nil {
+		return err
+	}
+	if err := state.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("Enter %s in the extension within five minutes\n", code)
+	return nil
+}
+
+// listNativeClients prints the paired extensions
+func listNativeClients(statePath string) error {
+	state, err := nativehost.LoadState(statePath)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tEXTENSION\tPAIRED")
+	for _, c := range state.Clients {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.ID, c.Name, c.Extension, c.PairedAt.Format("2006-01-02 15:04"))
+	}
+	return w.Flush()
+}
+
+// unpairNativeClient forgets a paired extension
+func unpairNativeClient(statePath, id string) error {
+	state, err := nativehost.LoadState(statePath)
+	if err != nil {
+		return err
+	}
+	if !state.Unpair(id) {
+		return fmt.Errorf("no client with ID %s", id)
+	}
+	return state.Save()
+}
+
+// vaultLogins reads and saves the logins of the host on the server, with
+// the session saved at the time of every request
+type vaultLogins struct {
+	opts *clientOptions
+}
+
+func (v vaultLogins) Unlocked() (bool, error) {
+	c, err := v.opts.client()
+	if err != nil {
+		return false, err
+	}
+	_, err = c.ListCredentials(url.Values{"limit": {"1"}})
+	if errors.Is(err, response.ErrUnauthorized) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (v vaultLogins) Match(page string) ([]urlmatch.Match, error) {
+	c, err := v.opts.client()
+	if err != nil {
+		return nil, err
+	}
+	return c.MatchCredentials(page, structs.ItemTypeLogin)
+}
+
+func (v vaultLogins) CreateCredential(cred structs.Credential) (int, error) {
+	c, err := v.opts.client()
+	if err != nil {
+		return 0, err
+	}
+	return c.CreateCredential(cred)
+}
+
+func (v vaultLogins) UpdateCredential(id int, cred structs.Credential) error {
+	c, err := v.opts.client()
+	if err != nil {
+		return err
+	}
+	return c.UpdateCredential(id, cred)
+}
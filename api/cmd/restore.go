@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"embed"
+	"flag"
+	"fmt"
+	"os"
+	"passvault/backup"
+	api "passvault/config"
+	"passvault/db"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const restoreUsage = `Usage: passvault restore [backup]
+
+Replaces the vault database with a backup after checking its checksum,
+decrypting it with BACKUP_KEY and running SQLite's integrity check on it.
+The replaced database is kept next to the vault as a rollback point.
+
+The backup is either the name of a backup in BACKUP_DIR or the path to a
+backup file with its manifest next to it. Without a backup the backups in
+BACKUP_DIR are listed.
+
+Stop the server before restoring, or restore through the admin API while
+it is running.
+`
+
+// restoreFlags are the config flags of the restore command
+var restoreFlags = []string{"data-dir", "database", "backup-dir"}
+
+// Restore runs the restore command against the vault database
+func Restore(args []string, embeddedFS embed.FS) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	configFlags := api.RegisterFlags(flags, restoreFlags...)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, restoreUsage+api.FlagUsage(restoreFlags...)) }
+	names, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+
+	config := configFlags.Load()
+	if err := db.InitializeGlobalDB(config.DatabasePath, embeddedFS); err != nil {
+		return err
+	}
+	defer db.CloseDB()
+
+	// A path points at a backup file outside the backup directory
+	var name string
+	if len(names) > 0 {
+		name = names[0]
+	}
+	dir := config.BackupDir
+	if strings.ContainsRune(name, filepath.Separator) || strings.Contains(name, ".sqlite.gz") {
+		dir = filepath.Dir(name)
+		name = strings.TrimSuffix(strings.TrimSuffix(filepath.Base(name), ".enc"), ".sqlite.gz")
+	}
+	manager := backup.NewManager(db.GetDB, dir, config.BackupKey, backup.Retention{})
+
+	if name == "" {
+		return listBackups(manager)
+	}
+
+	result, err := manager.Restore(name)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored %s, the schema is at version %d\n", result.Name, result.SchemaVersion)
+	fmt.Printf("The replaced database was kept as %s\n", result.RollbackPath)
+	return nil
+}
+
+// listBackups prints a table of the backups a manager knows about
+func listBackups(manager *backup.Manager) error {
+	backups, err := manager.List()
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		fmt.Println("No backups found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tCREATED AT\tSIZE\tENCRYPTED\tSCHEMA")
+	for _, b := range backups {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%t\t%d\n", b.Name, b.CreatedAt.Local().Format(time.DateTime), b.Size, b.Encrypted, b.SchemaVersion)
+	}
+	return w.Flush()
+}
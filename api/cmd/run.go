@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"passvault/secretref"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const runUsage = `Usage: passvault run [flags] -- <command> [args...]
+
+Runs a command with secrets from the vault in its environment. A value that
+is a reference like cred:42:password or cred:Work/db:password is replaced
+with the value it names: the credential is its ID, its name or its folder
+path and name, the field is one of name, username, password, url, notes,
+totp or the name of a custom field.
+
+Secrets showing up in the output of the command are masked. Signals are
+passed on to the command, and passvault exits with its exit code.
+
+Flags:
+  --env NAME=VALUE   Set a variable, may be repeated
+  --env-file FILE    Read NAME=VALUE lines from a file, may be repeated.
+                     Blank lines and lines starting with # are skipped.
+  --no-masking       Leave the output of the command alone, it then runs
+                     on the terminal itself
+  --server URL       Server to talk to
+`
+
+// concealed stands in for a secret in the output of a command
+const concealed = "<concealed by passvault>"
+
+// minMaskLength is the length below which secrets aren't masked, masking
+// them would garble the output
+const minMaskLength = 4
+
+// forwardedSignals are passed on to the command
+var forwardedSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT}
+
+// ExitError carries the exit code of a command run by passvault, which exits
+// with the same code
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// Run runs the run command
+func Run(args []string) error {
+	var opts clientOptions
+	var env, envFiles stringList
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, runUsage) }
+	flags.StringVar(&opts.server, "server", "", "URL of the PassVault server")
+	flags.Var(&env, "env", "variable to set")
+	flags.Var(&envFiles, "env-file", "file of variables to set")
+	noMasking := flags.Bool("no-masking", false, "leave the output alone")
+	// Flags after the command belong to the command
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	command := flags.Args()
+	if len(command) == 0 {
+		flags.Usage()
+		return fmt.Errorf("run takes a command to run")
+	}
+
+	var lines []string
+	for _, file := range envFiles {
+		fileLines, err := readEnvFile(file)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, fileLines...)
+	}
+	lines = append(lines, env...)
+
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+	vars, secrets, err := resolveEnv(secretref.NewResolver(c), lines)
+	if err != nil {
+		return err
+	}
+
+	child := exec.Command(command[0], command[1:]...)
+	child.Env = append(os.Environ(), vars...)
+	child.Stdin = os.Stdin
+	child.Stdout, child.Stderr = os.Stdout, os.Stderr
+	if !*noMasking {
+		stdout, stderr := newMaskWriter(os.Stdout, secrets), newMaskWriter(os.Stderr, secrets)
+		defer stdout.Flush()
+		defer stderr.Flush()
+		child.Stdout, child.Stderr = stdout, stderr
+	}
+
+	// Signals are caught before the command starts, so none is lost
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+	if err := child.Start(); err != nil {
+		return err
+	}
+	go func() {
+		for sig := range signals {
+			child.Process.Signal(sig)
+		}
+	}()
+
+	err = child.Wait()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	// A command killed by a signal exits like it would from a shell
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return &ExitError{Code: 128 + int(status.Signal())}
+	}
+	return &ExitError{Code: exitErr.ExitCode()}
+}
+
+// readEnvFile reads the NAME=VALUE lines of a file, leaving out blank lines
+// and comments. Lines may start with export, like in a shell script.
+func readEnvFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		if !strings.Contains(line, "=") {
+			return nil, fmt.Errorf("%s:%d: expected NAME=VALUE", path, n)
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// resolveEnv turns NAME=VALUE pairs into environment variables, resolving
+// the values that are references. It returns the secrets it resolved too.
+func resolveEnv(resolver *secretref.Resolver, lines []string) (vars, secrets []string, err error) {
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, nil, fmt.Errorf("invalid variable %q, use NAME=VALUE", line)
+		}
+		value = unquote(strings.TrimSpace(value))
+		if secretref.IsReference(value) {
+			ref, err := secretref.Parse(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if value, err = resolver.Resolve(ref); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", name, err)
+			}
+			secrets = append(secrets, value)
+		}
+		vars = append(vars, name+"="+value)
+	}
+	return vars, secrets, nil
+}
+
+// unquote strips a pair of matching quotes around a value
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// maskWriter replaces secrets in what is written through it. The end of a
+// write that may be the start of a secret is held back until the next one
+// tells, or until Flush.
+type maskWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	secrets [][]byte
+	pending []byte
+}
+
+func newMaskWriter(w io.Writer, secrets []string) *maskWriter {
+	m := &maskWriter{w: w}
+	for _, secret := range secrets {
+		if len(secret) >= minMaskLength {
+			m.secrets = append(m.secrets, []byte(secret))
+		}
+	}
+	// The longest secret wins where secrets overlap
+	slices.SortFunc(m.secrets, func(a, b []byte) int { return len(b) - len(a) })
+	return m
+}
+
+func (m *maskWriter) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pending = append(m.pending, p...)
+	out, held := m.mask(m.pending, false)
+	m.pending = append(m.pending[:0], held...)
+	if _, err := m.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes out what is held back
+func (m *maskWriter) Flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out, _ := m.mask(m.pending, true)
+	m.pending = nil
+	_, err := m.w.Write(out)
+	return err
+}
+
+// mask returns data with the secrets in it replaced, and the end of data
+// that may be the start of a secret. Where a longer secret could still
+// match, a shorter one that does is held back too. At the end nothing more
+// is coming, so final masks what matches and leaves the rest.
+func (m *maskWriter) mask(data []byte, final bool) (out, held []byte) {
+	var b bytes.Buffer
+	for i := 0; i < len(data); {
+		// The secrets are longest first, so the first that matches or may
+		// still match decides
+		matched, partial := 0, false
+		for _, secret := range m.secrets {
+			if bytes.HasPrefix(data[i:], secret) {
+				matched = len(secret)
+				break
+			}
+			if !final && bytes.HasPrefix(secret, data[i:]) {
+				partial = true
+				break
+			}
+		}
+		switch {
+		case matched > 0:
+			b.WriteString(concealed)
+			i += matched
+		case partial:
+			return b.Bytes(), data[i:]
+		default:
+			b.WriteByte(data[i])
+			i++
+		}
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"passvault/secretref"
+	"passvault/structs"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMaskWriter(t *testing.T) {
+	tests := []struct {
+		name    string
+		secrets []string
+		writes  []string
+		want    string
+	}{
+		{"no secrets", nil, []string{"plain output\n"}, "plain output\n"},
+		{"whole secret", []string{"hunter22"}, []string{"pass=hunter22\n"}, "pass=" + concealed + "\n"},
+		{"secret across writes", []string{"hunter22"}, []string{"pass=hun", "ter", "22 done"}, "pass=" + concealed + " done"},
+		{"false start", []string{"hunter22"}, []string{"hunt", "ing\n"}, "hunting\n"},
+		{"held at the end", []string{"hunter22"}, []string{"ends with hunt"}, "ends with hunt"},
+		{"longest secret wins", []string{"abcd", "abcdefgh"}, []string{"abcdefgh abcd"}, concealed + " " + concealed},
+		{"longer secret across writes", []string{"abcdefgh", "abcd"}, []string{"abcde", "fgh"}, concealed},
+		{"shorter secret across writes", []string{"abcdefgh", "abcd"}, []string{"abcde", "fx"}, concealed + "efx"},
+		{"shorter secret at the end", []string{"abcdefgh", "abcd"}, []string{"x abcdef"}, "x " + concealed + "ef"},
+		{"short secrets stay", []string{"abc"}, []string{"abc"}, "abc"},
+		{"every occurrence", []string{"s3cret"}, []string{"s3crets3cret"}, concealed + concealed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			w := newMaskWriter(&out, tt.secrets)
+			for _, write := range tt.writes {
+				if n, err := w.Write([]byte(write)); err != nil || n != len(write) {
+					t.Fatalf("Write = %d, %v", n, err)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Fatalf("output = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestReadEnvFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		err     string
+	}{
+		{"lines", "# comment\n\nA=1\n  export B = cred:db:password \n", []string{"A=1", "B = cred:db:password"}, ""},
+		{"no value", "A=1\nB\n", nil, ":2: expected NAME=VALUE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ".env")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readEnvFile(path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("readEnvFile = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil || !slices.Equal(got, tt.want) {
+				t.Fatalf("readEnvFile = %q, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestResolveEnv(t *testing.T) {
+	vault := newTestAPI(t, structs.Credential{Name: "db", Username: "admin", Password: "hunter22", Fields: []structs.CustomField{{Name: "host", Value: "db.example"}}})
+	var opts clientOptions
+	c, err := opts.client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := vault.ListCredentials(structs.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := creds.Credentials[0].ID
+
+	tests := []struct {
+		name    string
+		lines   []string
+		vars    []string
+		secrets []string
+		err     string
+	}{
+		{
+			name:    "references",
+			lines:   []string{"USER=cred:db:username", `PASS="cred:db:password"`, "HOST = 'cred:" + strconv.Itoa(id) + ":host'", "PLAIN=value"},
+			vars:    []string{"USER=admin", "PASS=hunter22", "HOST=db.example", "PLAIN=value"},
+			secrets: []string{"admin", "hunter22", "db.example"},
+		},
+		{name: "no name", lines: []string{"=cred:db:password"}, err: "use NAME=VALUE"},
+		{name: "bad reference", lines: []string{"PASS=cred:db"}, err: "PASS: invalid reference"},
+		{name: "unknown credential", lines: []string{"PASS=cred:nope:password"}, err: `PASS: cred:nope:password: no credential named "nope"`},
+		{name: "unknown field", lines: []string{"PASS=cred:db:pin"}, err: `no field "pin"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars, secrets, err := resolveEnv(secretref.NewResolver(c), tt.lines)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("resolveEnv = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil || !slices.Equal(vars, tt.vars) || !slices.Equal(secrets, tt.secrets) {
+				t.Fatalf("resolveEnv = %q, %q, %v", vars, secrets, err)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	newTestAPI(t, structs.Credential{Name: "db", Username: "admin", Password: "hunter22"})
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("DB_USER=cred:db:username\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		output string
+		code   int
+		err    string
+	}{
+		{
+			name:   "masked",
+			args:   []string{"--env", "DB_PASS=cred:db:password", "--env-file", envFile, "--", "sh", "-c", `echo "$DB_USER:$DB_PASS"`},
+			output: concealed + ":" + concealed + "\n",
+		},
+		{
+			name:   "not masked",
+			args:   []string{"--no-masking", "--env", "DB_PASS=cred:db:password", "--", "sh", "-c", `echo "$DB_PASS"`},
+			output: "hunter22\n",
+		},
+		{
+			name: "exit code",
+			args: []string{"--", "sh", "-c", "exit 3"},
+			code: 3,
+		},
+		{
+			name: "killed",
+			args: []string{"--", "sh", "-c", "kill -TERM $$"},
+			code: 128 + 15,
+		},
+		{
+			name: "unresolved",
+			args: []string{"--env", "DB_PASS=cred:nope:password", "--", "sh", "-c", "echo ran"},
+			err:  `no credential named "nope"`,
+		},
+		{
+			name: "no command",
+			args: []string{"--env", "A=1"},
+			err:  "takes a command",
+		},
+		{
+			name: "missing command",
+			args: []string{"--", "passvault-no-such-command"},
+			err:  "executable file not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := captureStdout(t, func() error { return Run(tt.args) })
+			var exitErr *ExitError
+			switch {
+			case tt.err != "":
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Run = %v, want %q", err, tt.err)
+				}
+			case tt.code != 0:
+				if !errors.As(err, &exitErr) || exitErr.Code != tt.code {
+					t.Fatalf("Run = %v, want exit status %d", err, tt.code)
+				}
+			case err != nil:
+				t.Fatalf("Run = %v", err)
+			}
+			if output != tt.output {
+				t.Fatalf("output = %q, want %q", output, tt.output)
+			}
+		})
+	}
+}
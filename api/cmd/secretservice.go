@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"passvault/client"
+	"passvault/secretservice"
+	"passvault/structs"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const secretServiceUsage = `Usage: passvault secret-service [flags]
+
+Makes the vault the Secret Service of the desktop session, the
+org.freedesktop.secrets D-Bus API that libsecret, GNOME tools and
+git-credential-libsecret keep their passwords through. Another provider,
+like gnome-keyring, has to be stopped first.
+
+Collections are folders below the base folder, items are secret items in
+them with their attributes as fields. The service locks together with the
+vault; unlocking it asks for the master password through the program in
+SSH_ASKPASS, and keeps the session like passvault login does.
+
+The session can't be kept in the keyring the vault serves. The service
+keeps it in the client config, other commands should run with
+PASSVAULT_NO_KEYRING=1 to do the same.
+
+Flags:
+  --folder NAME      Base folder of the collections (default Secret Service)
+  --askpass PROGRAM  Program asking for the master password (default
+                     SSH_ASKPASS)
+  --server URL       Server to talk to
+`
+
+// SecretService runs the secret-service command
+func SecretService(args []string) error {
+	var opts clientOptions
+	var folder, askpass string
+	flags := flag.NewFlagSet("secret-service", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, secretServiceUsage) }
+	flags.StringVar(&opts.server, "server", "", "URL of the PassVault server")
+	flags.StringVar(&folder, "folder", "Secret Service", "base folder of the collections")
+	flags.StringVar(&askpass, "askpass", os.Getenv("SSH_ASKPASS"), "program asking for the master password")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return fmt.Errorf("secret-service takes no arguments")
+	}
+	if folder == "" || strings.Contains(folder, "/") {
+		return fmt.Errorf("invalid base folder %q", folder)
+	}
+	// Reading the session from the keyring would call back into the service
+	os.Setenv("PASSVAULT_NO_KEYRING", "1")
+
+	statePath := filepath.Join(filepath.Dir(client.ConfigPath()), "secret-service.json")
+	service, err := secretservice.New(vaultSecrets{&opts}, askpassPassword(askpass), folder, statePath)
+	if err != nil {
+		return fmt.Errorf("can't read %s: %w", statePath, err)
+	}
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return fmt.Errorf("can't connect to the session bus: %w", err)
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		<-signals
+		conn.Close()
+	}()
+	return service.Serve(conn)
+}
+
+// askpassPassword asks for the master password through an askpass program,
+// which prints what was entered. Without one the answer is no.
+func askpassPassword(program string) func(prompt string) (string, bool) {
+	return func(prompt string) (string, bool) {
+		if program == "" {
+			log.Printf("Can't ask for the master password, SSH_ASKPASS is not set")
+			return "", false
+		}
+		out, err := exec.Command(program, prompt).Output()
+		if err != nil {
+			return "", false
+		}
+		return strings.TrimRight(string(out), "\r\n"), true
+	}
+}
+
+// vaultSecrets keeps the collections and items of the service on the
+// server, with the session saved at the time of every request
+type vaultSecrets struct {
+	opts *clientOptions
+}
+
+func (v vaultSecrets) Folders() ([]structs.Folder, error) {
+	c, err := v.opts.client()
+	if err != nil {
+		return nil, err
+	}
+	return c.GetFolders()
+}
+
+func (v vaultSecrets) CreateFolder(folder structs.Folder) (int, error) {
+	c, err := v.opts.client()
+	if err != nil {
+		return 0, err
+	}
+	return c.CreateFolder(folder)
+}
+
+func (v vaultSecrets) UpdateFolder(id int, folder structs.Folder) error {
+	c, err := v.opts.client()
+	if err != nil {
+		return err
+	}
+	return c.UpdateFolder(id, folder)
+}
+
+func (v vaultSecrets) DeleteFolder(id int) error {
+	c, err := v.opts.client()
+	if err != nil {
+		return err
+	}
+	return c.DeleteFolder(id)
+}
+
+func (v vaultSecrets) Secrets() ([]structs.Credential, error) {
+	c, err := v.opts.client()
+	if err != nil {
+		return nil, err
+	}
+	return c.AllCredentials(url.Values{"type": {structs.ItemTypeSecret}})
+}
+
+func (v vaultSecrets) GetCredential(id int) (*structs.Credential, error) {
+	c, err := v.opts.client()
+	if err != nil {
+		return nil, err
+	}
+	return c.GetCredential(id)
+}
+
+func (v vaultSecrets) CreateCredential(cred structs.Credential) (int, error) {
+	c, err := v.opts.client()
+	if err != nil {
+		return 0, err
+	}
+	return c.CreateCredential(cred)
+}
+
+func (v vaultSecrets) UpdateCredential(id int, cred structs.Credential) error {
+	c, err := v.opts.client()
+	if err != nil {
+		return err
+	}
+	return c.UpdateCredential(id, cred)
+}
+
+func (v vaultSecrets) DeleteCredential(id int) error {
+	c, err := v.opts.client()
+	if err != nil {
+		return err
+	}
+	return c.DeleteCredential(id)
+}
+
+// Unlock logs in and saves the session, like passvault login
+func (v vaultSecrets) Unlock(password string) error {
+	c, err := v.opts.client()
+	if err != nil {
+		return err
+	}
+	session, err := c.Login(password)
+	if err != nil {
+		return err
+	}
+	config, err := client.LoadConfig()
+	if err != nil {
+		return err
+	}
+	return client.SaveSession(v.opts.serverURL(config), session.Token, session.ExpiresAt)
+}
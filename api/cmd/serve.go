@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"context"
+	"embed"
+	"flag"
+	"fmt"
+	"os"
+	"passvault/auth"
+	"passvault/backup"
+	api "passvault/config"
+	"passvault/db"
+	"passvault/passstore"
+	"passvault/store"
+	"strings"
+)
+
+const serveUsage = `Usage: passvault serve [flags]
+
+Starts the vault server with the API and the web UI. Running passvault
+without a command does the same.
+`
+
+// Serve runs the serve command, it only returns when the server fails
+func Serve(args []string, embeddedFS embed.FS) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	configFlags := api.RegisterFlags(flags, api.AllFlags()...)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, serveUsage+api.FlagUsage(api.AllFlags()...)) }
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	config := configFlags.Load()
+	fmt.Printf("Starting the vault on port %s...\n", config.Port)
+
+	// Open the store the vault is kept in
+	vault, err := openStore(config, embeddedFS)
+	if err != nil {
+		return err
+	}
+	defer vault.Close()
+
+	var backupManager *backup.Manager
+	if config.StorageBackend == api.StorageSQLite {
+		defer db.CloseDB()
+
+		// Backups use the SQLite backup API, the other backends have none
+		backupManager = backup.NewManager(db.GetDB, config.BackupDir, config.BackupKey, backup.Retention{
+			Daily:   config.BackupKeepDaily,
+			Weekly:  config.BackupKeepWeekly,
+			Monthly: config.BackupKeepMonthly,
+		})
+		if config.BackupInterval > 0 {
+			go backupManager.Run(context.Background(), config.BackupInterval)
+		}
+	}
+
+	// The vault can be kept in sync with a pass store whatever the backend
+	passManager := passstore.NewManager(vault, passstore.Options{
+		Dir:           config.PassStoreDir,
+		PublicKeyFile: config.PassPublicKey,
+		SecretKeyFile: config.PassSecretKey,
+		MirrorDir:     config.PassMirrorDir,
+	})
+	if passManager.MirrorEnabled() && config.PassInterval > 0 {
+		fmt.Printf("Mirroring the vault into %s\n", config.PassMirrorDir)
+		go passManager.Run(context.Background(), config.PassInterval)
+	}
+
+	// The API is locked with the master password once one is set
+	authManager, err := auth.NewManager(config.AuthFile, config.SessionTTL)
+	if err != nil {
+		return fmt.Errorf("failed to read the master password: %w", err)
+	}
+	if !authManager.Enabled() {
+		fmt.Println("No master password is set, the API is open to every client")
+	}
+
+	trustedProxies, err := api.ParseTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		return err
+	}
+
+	app := api.StartServer()
+	api.Middleware(app, trustedProxies)
+	api.SetupRoutes(app, vault, authManager, backupManager, passManager)
+	if config.VaultMount != "" {
+		fmt.Printf("Serving the Vault KV v2 API at /v1/%s\n", strings.Trim(config.VaultMount, "/"))
+		api.SetupVaultRoutes(app, vault, authManager, config.VaultMount)
+	}
+	api.ServeUI(app, embeddedFS) // Pass the embedded files
+	fmt.Println(config.Port)
+	api.StartListening(app, config.Port)
+	return nil
+}
+
+// openStore opens the store of the configured backend. The SQLite backend
+// opens the global database, migrating it, the caller closes it.
+func openStore(config *api.Config, embeddedFS embed.FS) (store.Store, error) {
+	switch config.StorageBackend {
+	case api.StorageMemory:
+		fmt.Println("Using an in-memory vault, nothing is saved")
+		return store.NewMemory(), nil
+	case api.StorageFile:
+		fmt.Printf("Using vault file %s\n", config.StoreFilePath)
+		file, err := store.OpenFile(config.StoreFilePath, config.StorePassphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open vault file: %w", err)
+		}
+		return file, nil
+	case api.StorageSQLite:
+		fmt.Printf("Using database %s\n", config.DatabasePath)
+		if err := db.InitializeGlobalDB(config.DatabasePath, embeddedFS); err != nil {
+			return nil, fmt.Errorf("failed to initialize database: %w", err)
+		}
+		return store.NewSQLite(db.GetDB), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", config.StorageBackend)
+	}
+}
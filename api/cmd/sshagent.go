@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"passvault/client"
+	"passvault/sshagent"
+	"passvault/structs"
+	"path/filepath"
+	"syscall"
+)
+
+const sshAgentUsage = `Usage: passvault ssh-agent [flags]
+
+Serves the SSH keys of the vault to ssh over the OpenSSH agent protocol, on
+a Unix socket. The keys are ssh_key items with the agent's tag:
+
+  passvault add github --type ssh_key --tag ssh-agent -p - < ~/.ssh/id_ed25519
+
+Keys are read from the vault for every request, with the session of
+passvault login. The agent has no keys while the vault is locked, once the
+session ends, and has them again after logging in. ssh-add -x and -X lock
+and unlock the agent on its own.
+
+Fields of a key constrain its use: confirm set to yes asks through the
+program in SSH_ASKPASS before every use, and lifetime, a duration like 1h or
+a number of seconds, takes the key away that long after the session started:
+when the vault was unlocked, or when the agent started if it already was.
+Keys added to the vault later count from the same time. Keys are added and
+removed in the vault, not with ssh-add.
+
+Point ssh at the socket with IdentityAgent in ~/.ssh/config, or with the
+SSH_AUTH_SOCK line printed at startup.
+
+Flags:
+  -a, --socket PATH   Socket to listen on (default ssh-agent.sock next to
+                      the client config)
+  --tag NAME          Tag of the keys to serve (default ssh-agent)
+  --server URL        Server to talk to
+`
+
+// SSHAgent runs the ssh-agent command
+func SSHAgent(args []string) error {
+	var opts clientOptions
+	var socket, tag string
+	flags := flag.NewFlagSet("ssh-agent", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, sshAgentUsage) }
+	flags.StringVar(&opts.server, "server", "", "URL of the PassVault server")
+	flags.StringVar(&socket, "socket", "", "socket to listen on")
+	flags.StringVar(&socket, "a", "", "shorthand for --socket")
+	flags.StringVar(&tag, "tag", "ssh-agent", "tag of the keys to serve")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return fmt.Errorf("ssh-agent takes no arguments")
+	}
+	if socket == "" {
+		socket = filepath.Join(filepath.Dir(client.ConfigPath()), "ssh-agent.sock")
+	}
+
+	listener, err := listenAgent(socket)
+	if err != nil {
+		return err
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		<-signals
+		listener.Close()
+		os.Remove(socket)
+	}()
+
+	fmt.Printf("SSH_AUTH_SOCK=%s; export SSH_AUTH_SOCK;\n", socket)
+	log.Printf("Serving the SSH keys tagged %s on %s", tag, socket)
+	return sshagent.New(vaultKeys{&opts, tag}, askpassConfirm).Serve(listener)
+}
+
+// listenAgent listens on a socket only the user can reach. A socket left
+// behind by an agent that is gone is replaced.
+func listenAgent(socket string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		return nil, err
+	}
+	if conn, err := net.Dial("unix", socket); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("an agent is already listening on %s", socket)
+	}
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	// The socket is made in a directory only we can enter and moved into
+	// place once it is private, so nobody can connect in between
+	private, err := os.MkdirTemp(filepath.Dir(socket), ".passvault-agent-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(private)
+	temporary := filepath.Join(private, "agent.sock")
+	listener, err := net.Listen("unix", temporary)
+	if err != nil {
+		return nil, err
+	}
+	// Closing must not remove the temporary name, the socket lives on
+	// under its final one
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(temporary, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Rename(temporary, socket); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// vaultKeys reads the keys of the agent from the server, with the session
+// saved at the time of every request
+type vaultKeys struct {
+	opts *clientOptions
+	tag  string
+}
+
+func (v vaultKeys) Keys() (string, []structs.Credential, error) {
+	c, err := v.opts.client()
+	if err != nil {
+		return "", nil, err
+	}
+	items, err := c.AllCredentials(url.Values{"type": {structs.ItemTypeSSHKey}, "tag": {v.tag}})
+	return c.Token(), items, err
+}
+
+// askpassConfirm asks through the program in SSH_ASKPASS, the way ssh-agent
+// does for keys added with ssh-add -c. Without one the answer is no.
+func askpassConfirm(prompt string) bool {
+	program := os.Getenv("SSH_ASKPASS")
+	if program == "" {
+		log.Printf("Refused a key asking for confirmation, SSH_ASKPASS is not set")
+		return false
+	}
+	askpass := exec.Command(program, prompt)
+	askpass.Env = append(os.Environ(), "SSH_ASKPASS_PROMPT=confirm")
+	return askpass.Run() == nil
+}
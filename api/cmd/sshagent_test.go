@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenAgent(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "ssh-agent.sock")
+	listener, err := listenAgent(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Fatalf("socket mode = %v, want 0600", mode)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("directory holds %d entries, want only the socket", len(entries))
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	if _, err := listenAgent(socket); err == nil {
+		t.Fatal("listenAgent took over the socket of a running agent")
+	}
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"embed"
+	"flag"
+	"fmt"
+	"os"
+	"passvault/auth"
+	"passvault/client"
+	api "passvault/config"
+	"passvault/db"
+	"passvault/tui"
+)
+
+const tuiUsage = `Usage: passvault tui [flags]
+
+Opens a terminal interface to the vault: a searchable list of credentials
+with a detail pane, a tag filter, a form to add and change credentials and a
+password generator. It works over SSH, where the web UI is out of reach.
+
+It talks to a server with the session of passvault login, or with --local
+opens the vault on this machine directly, asking for the master password
+when one is set. Only use --local with the file backend while the server is
+stopped, the server would overwrite the changes.
+
+Keys:
+  / search   t tags   r reveal   n new   e edit   d delete   g generate   q quit
+
+Flags:
+  --server URL   Server to talk to
+  --local        Open the vault on this machine instead of a server
+`
+
+// TUI runs the tui command
+func TUI(args []string, embeddedFS embed.FS) error {
+	var opts clientOptions
+	flags := flag.NewFlagSet("tui", flag.ContinueOnError)
+	flags.StringVar(&opts.server, "server", "", "URL of the PassVault server")
+	local := flags.Bool("local", false, "open the vault on this machine")
+	configFlags := api.RegisterFlags(flags, api.StorageFlags...)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, tuiUsage+api.FlagUsage(api.StorageFlags...)) }
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if !*local {
+		c, err := opts.client()
+		if err != nil {
+			return err
+		}
+		config, err := client.LoadConfig()
+		if err != nil {
+			return err
+		}
+		return loginHint(tui.Run(tui.RemoteVault(c), opts.serverURL(config)))
+	}
+
+	config := configFlags.Load()
+	if config.StorageBackend == api.StorageMemory {
+		return fmt.Errorf("the memory backend has nothing to open, leave out --local to use the server")
+	}
+	authManager, err := auth.NewManager(config.AuthFile, config.SessionTTL)
+	if err != nil {
+		return fmt.Errorf("failed to read the master password: %w", err)
+	}
+	if authManager.Enabled() {
+		password, err := readSecret("Master password: ")
+		if err != nil {
+			return err
+		}
+		if _, err := authManager.Login("local", password); err != nil {
+			return err
+		}
+	}
+
+	vault, err := openStore(config, embeddedFS)
+	if err != nil {
+		return err
+	}
+	defer vault.Close()
+	if config.StorageBackend == api.StorageSQLite {
+		defer db.CloseDB()
+		return tui.Run(tui.LocalVault(vault), config.DatabasePath)
+	}
+	return tui.Run(tui.LocalVault(vault), config.StoreFilePath)
+}
@@ -0,0 +1,38 @@
+package cmd
+
+// Usage lists every command of the passvault binary
+const Usage = `Usage: passvault <command> [flags]
+
+Vault commands, run on the machine the vault is kept on:
+  serve     Start the server, the default without a command
+  init      Create the vault and set its master password
+  migrate   Show, apply or roll back schema migrations
+  backup    Take, list, verify or prune backups
+  restore   Replace the database with a backup
+  doctor    Check the configuration and the vault
+
+Client commands, talking to a running server:
+  login     Log in with the master password
+  logout    End the session
+  ls        List credentials
+  search    Find credentials
+  get       Show a credential or one of its values
+  add       Add a credential
+  edit      Change a credential
+  rm        Delete a credential
+  gen       Generate a password
+  totp      Print the current TOTP code of a credential
+  run       Run a command with secrets in its environment
+  inject    Fill the secret references of a template in
+  tui       Browse and edit the vault in the terminal, --local without a server
+  ssh-agent Serve the SSH keys of the vault to ssh
+
+Credential helpers, run by other programs:
+  git-credential      The git credential helper, also run as git-credential-passvault
+  docker-credential   The docker credential helper, also run as docker-credential-passvault
+  native-host         The native messaging host of the browser extension
+  secret-service      The Secret Service of the desktop session, for libsecret
+
+Run passvault <command> -h for the flags of a command. Flags override the
+environment variables the server is configured with.
+`
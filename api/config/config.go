@@ -2,41 +2,127 @@ package api
 
 import (
 	"os"
+	"path/filepath"
 	"strconv"
 	"time"
 )
 
+// Storage backends the vault can be kept in
+const (
+	StorageSQLite = "sqlite"
+	StorageMemory = "memory"
+	StorageFile   = "file"
+)
+
 type Config struct {
-	Port            string
-	DatabasePath    string
-	RequestTimeout  time.Duration
-	PasswordMinLen  int
-	PasswordMaxLen  int
-	UsernameMinLen  int
-	UsernameMaxLen  int
+	Port           string
+	DataDir        string
+	DatabasePath   string
+	StorageBackend string
+	// StoreFilePath and StorePassphrase are only used by the file backend
+	StoreFilePath   string
+	StorePassphrase string
+	BackupDir       string
+	// BackupKey encrypts backups when set
+	BackupKey string
+	// BackupInterval is how often backups are taken, 0 disables them
+	BackupInterval    time.Duration
+	BackupKeepDaily   int
+	BackupKeepWeekly  int
+	BackupKeepMonthly int
+	RequestTimeout    time.Duration
+	PasswordMinLen    int
+	PasswordMaxLen    int
+	UsernameMinLen    int
+	UsernameMaxLen    int
+	// PassStoreDir is the pass store imports and exports use by default
+	PassStoreDir string
+	// PassPublicKey and PassSecretKey are files holding the OpenPGP keys pass
+	// entries are encrypted for and decrypted with
+	PassPublicKey string
+	PassSecretKey string
+	// PassMirrorDir is mirrored into every PassInterval, empty disables the mirror
+	PassMirrorDir string
+	PassInterval  time.Duration
+	// AuthFile keeps the hash of the master password, sessions expire after SessionTTL
+	AuthFile   string
+	SessionTTL time.Duration
+	// VaultMount is where the Vault KV v2 compatible API serves the vault
+	// below /v1, empty leaves it off
+	VaultMount string
+	// TrustedProxies are the addresses and networks, separated by commas,
+	// whose X-Forwarded-For and X-Real-IP headers name the client
+	TrustedProxies string
 }
 
+// LoadConfig reads the configuration from the environment
 func LoadConfig() *Config {
+	return loadConfig(os.Getenv)
+}
+
+// loadConfig reads the configuration through env, which returns the value
+// of an environment variable or an empty string
+func loadConfig(env func(key string) string) *Config {
+	dataDir := getEnv(env, "DATA_DIR", defaultDataDir())
 	return &Config{
-		Port:           getEnv("PORT", "8200"),
-		DatabasePath:   getEnv("DATABASE_PATH", "./credentials.sqlite"),
-		RequestTimeout: getDurationEnv("REQUEST_TIMEOUT", 20*time.Second),
-		PasswordMinLen: getIntEnv("PASSWORD_MIN_LENGTH", 8),
-		PasswordMaxLen: getIntEnv("PASSWORD_MAX_LENGTH", 64),
-		UsernameMinLen: getIntEnv("USERNAME_MIN_LENGTH", 3),
-		UsernameMaxLen: getIntEnv("USERNAME_MAX_LENGTH", 32),
+		Port:              getEnv(env, "PORT", "8200"),
+		DataDir:           dataDir,
+		DatabasePath:      getEnv(env, "DATABASE_PATH", filepath.Join(dataDir, "credentials.sqlite")),
+		StorageBackend:    getEnv(env, "STORAGE_BACKEND", StorageSQLite),
+		StoreFilePath:     getEnv(env, "STORE_FILE_PATH", filepath.Join(dataDir, "vault.json.enc")),
+		StorePassphrase:   env("STORE_PASSPHRASE"),
+		BackupDir:         getEnv(env, "BACKUP_DIR", filepath.Join(dataDir, "backups")),
+		BackupKey:         env("BACKUP_KEY"),
+		BackupInterval:    getDurationEnv(env, "BACKUP_INTERVAL", 24*time.Hour),
+		BackupKeepDaily:   getIntEnv(env, "BACKUP_KEEP_DAILY", 7),
+		BackupKeepWeekly:  getIntEnv(env, "BACKUP_KEEP_WEEKLY", 4),
+		BackupKeepMonthly: getIntEnv(env, "BACKUP_KEEP_MONTHLY", 12),
+		PassStoreDir:      getEnv(env, "PASSWORD_STORE_DIR", defaultPassStoreDir()),
+		PassPublicKey:     env("PASS_PUBLIC_KEY_FILE"),
+		PassSecretKey:     env("PASS_SECRET_KEY_FILE"),
+		PassMirrorDir:     env("PASS_MIRROR_DIR"),
+		PassInterval:      getDurationEnv(env, "PASS_MIRROR_INTERVAL", 15*time.Minute),
+		AuthFile:          getEnv(env, "MASTER_PASSWORD_FILE", filepath.Join(dataDir, "master.json")),
+		SessionTTL:        getDurationEnv(env, "SESSION_TTL", 12*time.Hour),
+		RequestTimeout:    getDurationEnv(env, "REQUEST_TIMEOUT", 20*time.Second),
+		PasswordMinLen:    getIntEnv(env, "PASSWORD_MIN_LENGTH", 8),
+		PasswordMaxLen:    getIntEnv(env, "PASSWORD_MAX_LENGTH", 64),
+		UsernameMinLen:    getIntEnv(env, "USERNAME_MIN_LENGTH", 3),
+		UsernameMaxLen:    getIntEnv(env, "USERNAME_MAX_LENGTH", 32),
+		VaultMount:        env("VAULT_KV_MOUNT"),
+		TrustedProxies:    env("TRUSTED_PROXIES"),
+	}
+}
+
+// defaultDataDir returns the per user directory the vault is kept in,
+// falling back to ./data when the system doesn't have one
+func defaultDataDir() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "passvault")
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(dir, "passvault")
+	}
+	return "./data"
+}
+
+// defaultPassStoreDir returns where pass keeps its store by default
+func defaultPassStoreDir() string {
+	if dir, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(dir, ".password-store")
 	}
+	return ""
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
+func getEnv(env func(string) string, key, defaultValue string) string {
+	if value := env(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
 
-func getIntEnv(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
+func getIntEnv(env func(string) string, key string, defaultValue int) int {
+	if value := env(key); value != "" {
 		if intValue, err := strconv.Atoi(value); err == nil {
 			return intValue
 		}
@@ -44,8 +130,8 @@ func getIntEnv(key string, defaultValue int) int {
 	return defaultValue
 }
 
-func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
-	if value := os.Getenv(key); value != "" {
+func getDurationEnv(env func(string) string, key string, defaultValue time.Duration) time.Duration {
+	if value := env(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
 			return duration
 		}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   map[string]string
+		check func(t *testing.T, c *Config)
+	}{
+		{
+			name: "paths follow the data directory",
+			env:  map[string]string{"DATA_DIR": "/srv/vault"},
+			check: func(t *testing.T, c *Config) {
+				want := map[string]string{
+					c.DatabasePath:  filepath.Join("/srv/vault", "credentials.sqlite"),
+					c.StoreFilePath: filepath.Join("/srv/vault", "vault.json.enc"),
+					c.BackupDir:     filepath.Join("/srv/vault", "backups"),
+					c.AuthFile:      filepath.Join("/srv/vault", "master.json"),
+				}
+				for got, want := range want {
+					if got != want {
+						t.Errorf("path = %q, want %q", got, want)
+					}
+				}
+			},
+		},
+		{
+			name: "explicit paths win",
+			env:  map[string]string{"DATA_DIR": "/srv/vault", "DATABASE_PATH": "/tmp/db.sqlite", "BACKUP_DIR": "/backups"},
+			check: func(t *testing.T, c *Config) {
+				if c.DatabasePath != "/tmp/db.sqlite" || c.BackupDir != "/backups" {
+					t.Errorf("DatabasePath = %q, BackupDir = %q", c.DatabasePath, c.BackupDir)
+				}
+			},
+		},
+		{
+			name: "defaults",
+			env:  map[string]string{},
+			check: func(t *testing.T, c *Config) {
+				if c.Port != "8200" || c.StorageBackend != StorageSQLite || c.BackupInterval != 24*time.Hour || c.PasswordMaxLen != 64 {
+					t.Errorf("config = %+v", c)
+				}
+				if c.DatabasePath != filepath.Join(c.DataDir, "credentials.sqlite") {
+					t.Errorf("DatabasePath = %q, want it in %q", c.DatabasePath, c.DataDir)
+				}
+			},
+		},
+		{
+			name: "numbers and durations",
+			env:  map[string]string{"BACKUP_INTERVAL": "0s", "BACKUP_KEEP_DAILY": "2", "SESSION_TTL": "30m"},
+			check: func(t *testing.T, c *Config) {
+				if c.BackupInterval != 0 || c.BackupKeepDaily != 2 || c.SessionTTL != 30*time.Minute {
+					t.Errorf("config = %+v", c)
+				}
+			},
+		},
+		{
+			name: "unreadable values fall back",
+			env:  map[string]string{"BACKUP_INTERVAL": "daily", "BACKUP_KEEP_DAILY": "seven"},
+			check: func(t *testing.T, c *Config) {
+				if c.BackupInterval != 24*time.Hour || c.BackupKeepDaily != 7 {
+					t.Errorf("config = %+v", c)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check(t, loadConfig(func(key string) string { return tt.env[key] }))
+		})
+	}
+}
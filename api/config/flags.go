@@ -0,0 +1,119 @@
+package api
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of values a setting holds, flags are checked against them
+const (
+	kindString = iota
+	kindInt
+	kindDuration
+)
+
+// setting is a command line flag overriding an environment variable
+type setting struct {
+	env   string
+	kind  int
+	usage string
+}
+
+// settings maps flag names onto the environment variables they override.
+// Passphrases and keys have no flag, they would show up in the process list.
+var settings = map[string]setting{
+	"port":                 {"PORT", kindString, "port the server listens on"},
+	"data-dir":             {"DATA_DIR", kindString, "directory the vault is kept in"},
+	"database":             {"DATABASE_PATH", kindString, "SQLite database file"},
+	"backend":              {"STORAGE_BACKEND", kindString, "storage backend: sqlite, memory or file"},
+	"store-file":           {"STORE_FILE_PATH", kindString, "vault file of the file backend"},
+	"backup-dir":           {"BACKUP_DIR", kindString, "directory backups are written to"},
+	"backup-interval":      {"BACKUP_INTERVAL", kindDuration, "time between scheduled backups, 0 disables them"},
+	"backup-keep-daily":    {"BACKUP_KEEP_DAILY", kindInt, "daily backups to keep"},
+	"backup-keep-weekly":   {"BACKUP_KEEP_WEEKLY", kindInt, "weekly backups to keep"},
+	"backup-keep-monthly":  {"BACKUP_KEEP_MONTHLY", kindInt, "monthly backups to keep"},
+	"pass-store":           {"PASSWORD_STORE_DIR", kindString, "pass store imported from and exported to"},
+	"pass-public-key":      {"PASS_PUBLIC_KEY_FILE", kindString, "OpenPGP keys pass entries are encrypted for"},
+	"pass-secret-key":      {"PASS_SECRET_KEY_FILE", kindString, "OpenPGP secret keys pass entries are decrypted with"},
+	"pass-mirror-dir":      {"PASS_MIRROR_DIR", kindString, "pass store the vault is mirrored into"},
+	"pass-mirror-interval": {"PASS_MIRROR_INTERVAL", kindDuration, "time between mirror runs"},
+	"master-password-file": {"MASTER_PASSWORD_FILE", kindString, "file the master password hash is kept in"},
+	"session-ttl":          {"SESSION_TTL", kindDuration, "time until a session expires"},
+	"vault-kv-mount":       {"VAULT_KV_MOUNT", kindString, "mount of the Vault KV v2 compatible API, empty leaves it off"},
+	"trusted-proxies":      {"TRUSTED_PROXIES", kindString, "proxies whose forwarded headers name the client, addresses or networks separated by commas"},
+}
+
+// Flag names of the settings every command touching the vault needs
+var (
+	StorageFlags = []string{"data-dir", "database", "backend", "store-file", "master-password-file"}
+	BackupFlags  = []string{"data-dir", "database", "backend", "backup-dir", "backup-keep-daily", "backup-keep-weekly", "backup-keep-monthly"}
+)
+
+// AllFlags returns the name of every flag, in alphabetical order
+func AllFlags() []string {
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// FlagUsage describes the config flags in names, for a usage text
+func FlagUsage(names ...string) string {
+	var b strings.Builder
+	b.WriteString("\nSettings, each overriding its environment variable:\n")
+	for _, name := range slices.Compact(slices.Sorted(slices.Values(names))) {
+		s := settings[name]
+		fmt.Fprintf(&b, "  --%-22s %s (%s)\n", name, s.usage, s.env)
+	}
+	return b.String()
+}
+
+// Flags holds the values of config flags given on the command line
+type Flags struct {
+	values map[string]string
+}
+
+// RegisterFlags adds the config flags in names to a flag set. Flags given
+// on the command line override the environment in the config Load returns.
+func RegisterFlags(flags *flag.FlagSet, names ...string) *Flags {
+	f := &Flags{values: map[string]string{}}
+	for _, name := range slices.Compact(slices.Sorted(slices.Values(names))) {
+		s, ok := settings[name]
+		if !ok {
+			panic("unknown config flag " + name)
+		}
+		flags.Func(name, fmt.Sprintf("%s (%s)", s.usage, s.env), func(value string) error {
+			switch s.kind {
+			case kindInt:
+				if _, err := strconv.Atoi(value); err != nil {
+					return fmt.Errorf("must be a number")
+				}
+			case kindDuration:
+				if _, err := time.ParseDuration(value); err != nil {
+					return fmt.Errorf("must be a duration like 90s, 15m or 24h")
+				}
+			}
+			f.values[s.env] = value
+			return nil
+		})
+	}
+	return f
+}
+
+// Load reads the configuration from the environment, with the flags given
+// on the command line in place of the variables they override
+func (f *Flags) Load() *Config {
+	return loadConfig(func(key string) string {
+		if value, ok := f.values[key]; ok {
+			return value
+		}
+		return os.Getenv(key)
+	})
+}
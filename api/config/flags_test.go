@@ -0,0 +1,68 @@
+package api
+
+import (
+	"flag"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegisterFlags(t *testing.T) {
+	t.Setenv("DATA_DIR", "/env/vault")
+	t.Setenv("PORT", "9000")
+
+	tests := []struct {
+		name  string
+		args  []string
+		check func(c *Config) bool
+		err   string
+	}{
+		{"environment without flags", nil, func(c *Config) bool { return c.DataDir == "/env/vault" && c.Port == "9000" }, ""},
+		{"flag over the environment", []string{"--data-dir", "/flag/vault"}, func(c *Config) bool {
+			return c.DataDir == "/flag/vault" && c.DatabasePath == "/flag/vault/credentials.sqlite" && c.Port == "9000"
+		}, ""},
+		{"number", []string{"--backup-keep-daily=3"}, func(c *Config) bool { return c.BackupKeepDaily == 3 }, ""},
+		{"duration", []string{"--session-ttl", "90s"}, func(c *Config) bool { return c.SessionTTL == 90*time.Second }, ""},
+		{"bad number", []string{"--backup-keep-daily", "many"}, nil, "must be a number"},
+		{"bad duration", []string{"--session-ttl", "1 day"}, nil, "must be a duration"},
+		{"flag of another command", []string{"--port", "1"}, nil, "not defined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			flags.SetOutput(io.Discard)
+			f := RegisterFlags(flags, append(BackupFlags, "session-ttl")...)
+			err := flags.Parse(tt.args)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Parse = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c := f.Load(); !tt.check(c) {
+				t.Fatalf("unexpected config %+v", c)
+			}
+		})
+	}
+}
+
+func TestFlagUsage(t *testing.T) {
+	usage := FlagUsage("port", "data-dir", "port")
+	if strings.Count(usage, "--port") != 1 || !strings.Contains(usage, "(DATA_DIR)") {
+		t.Fatalf("FlagUsage = %q", usage)
+	}
+	if !slices.IsSorted(AllFlags()) || len(AllFlags()) != len(settings) {
+		t.Fatalf("AllFlags = %q", AllFlags())
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("RegisterFlags accepted an unknown flag")
+		}
+	}()
+	RegisterFlags(flag.NewFlagSet("test", flag.ContinueOnError), "no-such-flag")
+}
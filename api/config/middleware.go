@@ -1,30 +1,123 @@
 package api
 
 import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 )
 
-// Middleware sets up the middleware for the API server.
-func Middleware(app *chi.Mux) {
+// Middleware sets up the middleware for the API server. Only requests from
+// the trusted proxies are taken to come from the client their forwarded
+// headers name.
+func Middleware(app *chi.Mux, trustedProxies []netip.Prefix) {
 	// Set up middleware for the API server
-	app.Use(middleware.Logger)                               // Log every request
-	app.Use(middleware.Recoverer)                            // Recover from panics and log them
-	app.Use(middleware.Timeout(20))                          // Set a timeout for requests
-	app.Use(middleware.CleanPath)                            // Clean the URL path
-	app.Use(middleware.RedirectSlashes)                      // Redirect slashes in URLs
-	app.Use(middleware.AllowContentType("application/json")) // Allow only JSON content type
-	app.Use(middleware.NoCache)                              // Disable caching
-	app.Use(middleware.RequestID)                            // Generate a unique request ID for each request
-	app.Use(middleware.RealIP)                               // Get the real IP address of the client
-	app.Use(middleware.StripSlashes)                         // Strip trailing slashes from URLs
-	app.Use(middleware.URLFormat)                            // Format URLs
+	app.Use(middleware.Logger)                                                                                  // Log every request
+	app.Use(middleware.Recoverer)                                                                               // Recover from panics and log them
+	app.Use(middleware.Timeout(20))                                                                             // Set a timeout for requests
+	app.Use(middleware.CleanPath)                                                                               // Clean the URL path
+	app.Use(skipVault(middleware.RedirectSlashes))                                                              // Redirect slashes in URLs
+	app.Use(skipVault(middleware.AllowContentType("application/json", "text/csv", "application/octet-stream"))) // Allow JSON, and CSV and KeePass files for imports
+	app.Use(middleware.NoCache)                                                                                 // Disable caching
+	app.Use(middleware.RequestID)                                                                               // Generate a unique request ID for each request
+	app.Use(realIP(trustedProxies))                                                                             // Get the real IP address of the client
+	app.Use(middleware.StripSlashes)                                                                            // Strip trailing slashes from URLs
+	app.Use(middleware.URLFormat)                                                                               // Format URLs
 	app.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:5173"},                   // Allow all origins
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}, // Allow these HTTP methods
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},           // Allow these headers
-		AllowCredentials: true,                                                // Allow credentials (cookies, authorization headers, etc.)
-		MaxAge:           300,                                                 // Cache preflight response for 5 minutes
+		AllowedOrigins:   []string{"http://localhost:5173"},                              // Allow all origins
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},            // Allow these HTTP methods
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "X-Export-Password"}, // Allow these headers
+		AllowCredentials: true,                                                           // Allow credentials (cookies, authorization headers, etc.)
+		MaxAge:           300,                                                            // Cache preflight response for 5 minutes
 	}))
 }
+
+// skipVault leaves the Vault KV API out of a middleware. Vault clients send
+// JSON without a content type and list paths ending in a slash, which they
+// expect to be answered rather than redirected.
+func skipVault(next func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		wrapped := next(h)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/v1/") {
+				h.ServeHTTP(w, r)
+				return
+			}
+			wrapped.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ParseTrustedProxies parses addresses and networks separated by commas,
+// like 10.0.0.1, 192.168.0.0/16
+func ParseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(field); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q, expected an address or a network like 10.0.0.0/8", field)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// realIP replaces the remote address of requests coming through a trusted
+// proxy with the address of the client the proxy names. Anybody else could
+// name any address in the headers, their requests keep the address they
+// came from, so wrong master passwords are counted against it.
+func realIP(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	isTrusted := func(addr netip.Addr) bool {
+		for _, prefix := range trusted {
+			if prefix.Contains(addr.Unmap()) {
+				return true
+			}
+		}
+		return false
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer, err := netip.ParseAddrPort(r.RemoteAddr)
+			if err != nil || !isTrusted(peer.Addr()) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Proxies append the address they were reached from, the client is
+			// the last one that isn't a trusted proxy itself
+			var client string
+			forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+			for i := len(forwarded) - 1; i >= 0; i-- {
+				addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+				if err != nil {
+					break
+				}
+				client = addr.String()
+				if !isTrusted(addr) {
+					break
+				}
+			}
+			if client == "" {
+				if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+					client = addr.String()
+				}
+			}
+			if client != "" {
+				r.RemoteAddr = net.JoinHostPort(client, "0")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
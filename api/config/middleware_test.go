@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"passvault/auth"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+		err   bool
+	}{
+		{value: "", want: nil},
+		{value: "10.0.0.1", want: []string{"10.0.0.1/32"}},
+		{value: " 10.0.0.1, 192.168.1.7/16 ,::1,", want: []string{"10.0.0.1/32", "192.168.0.0/16", "::1/128"}},
+		{value: "::ffff:10.0.0.1", want: []string{"10.0.0.1/32"}},
+		{value: "proxy.local", err: true},
+		{value: "10.0.0.0/33", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			prefixes, err := ParseTrustedProxies(tt.value)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("ParseTrustedProxies = %v, want an error", prefixes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(prefixes) != len(tt.want) {
+				t.Fatalf("ParseTrustedProxies = %v, want %v", prefixes, tt.want)
+			}
+			for i, prefix := range prefixes {
+				if prefix.String() != tt.want[i] {
+					t.Fatalf("ParseTrustedProxies = %v, want %v", prefixes, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.1, 172.16.0.0/12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"direct", "192.0.2.1:1234", nil, "192.0.2.1"},
+		{"spoofed forwarded for", "192.0.2.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "192.0.2.1"},
+		{"spoofed real ip", "192.0.2.1:1234", map[string]string{"X-Real-IP": "198.51.100.7"}, "192.0.2.1"},
+		{"trusted proxy", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "198.51.100.7"},
+		{"trusted network", "172.20.0.3:1234", map[string]string{"X-Real-IP": "198.51.100.7"}, "198.51.100.7"},
+		{"chain of proxies", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.9, 198.51.100.7, 172.16.0.2"}, "198.51.100.7"},
+		{"forwarded for before real ip", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.7", "X-Real-IP": "203.0.113.9"}, "198.51.100.7"},
+		{"trusted proxy without headers", "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"not an address", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "unknown"}, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := realIP(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = auth.Client(r)
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", nil)
+			req.RemoteAddr = tt.remote
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Fatalf("client = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
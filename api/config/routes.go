@@ -2,24 +2,107 @@ package api
 
 import (
 	"net/http"
+	"passvault/auth"
+	"passvault/backup"
+	"passvault/internal/backups"
 	"passvault/internal/credentials"
+	"passvault/internal/folders"
+	"passvault/internal/passstores"
+	"passvault/internal/secrets"
+	"passvault/internal/sessions"
+	"passvault/internal/tags"
+	"passvault/internal/templates"
+	"passvault/internal/transfers"
+	"passvault/passstore"
+	"passvault/store"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 )
 
-// SetupRoutes configures all API routes
-func SetupRoutes(app *chi.Mux) {
+// SetupRoutes configures all API routes, served from the given store. The
+// backup routes are only set up when there is a backup manager, the mirror
+// route only when a mirror is configured. Routes outside /auth need a
+// session once a master password is set.
+func SetupRoutes(app *chi.Mux, s store.Store, authManager *auth.Manager, backupManager *backup.Manager, passManager *passstore.Manager) {
+	sessions := sessions.NewHandler(authManager)
+	credentials := credentials.NewHandler(s)
+	folders := folders.NewHandler(s)
+	tags := tags.NewHandler(s)
+	transfers := transfers.NewHandler(s)
+	templates := templates.NewHandler(s)
+
 	// API v1 routes
 	app.Route("/api/v1", func(r chi.Router) {
-		// Credentials routes
-		r.Route("/credentials", func(r chi.Router) {
-			r.Post("/", credentials.StoreCredential)     // Create credential
-			r.Get("/", credentials.GetAllCredentials)    // Get all credentials
-			r.Get("/{id}", credentials.GetCredential)    // Get single credential
-			r.Delete("/{id}", credentials.DeleteCredential) // Delete credential
+		// Login routes, open to every client
+		r.Route("/auth", func(r chi.Router) {
+			r.Post("/login", sessions.Login)         // Log in with the master password
+			r.Post("/logout", sessions.Logout)       // End the session
+			r.Put("/password", sessions.SetPassword) // Set or change the master password
+		})
+
+		// Everything else needs a session once a master password is set
+		r.Group(func(r chi.Router) {
+			r.Use(authManager.Require)
+
+			// Credentials routes
+			r.Route("/credentials", func(r chi.Router) {
+				r.Post("/", credentials.StoreCredential)        // Create credential
+				r.Get("/", credentials.GetAllCredentials)       // Get all credentials
+				r.Get("/search", credentials.SearchCredentials) // Search credentials
+				r.Get("/match", credentials.MatchCredentials)   // Credentials to fill in on a page
+				r.Get("/{id}", credentials.GetCredential)       // Get single credential
+				r.Put("/{id}", credentials.UpdateCredential)    // Update credential
+				r.Delete("/{id}", credentials.DeleteCredential) // Delete credential
+			})
+
+			// Folders routes
+			r.Route("/folders", func(r chi.Router) {
+				r.Post("/", folders.CreateFolder)              // Create folder
+				r.Get("/", folders.GetFolders)                 // Get all folders
+				r.Get("/{id}", folders.GetFolder)              // Get single folder
+				r.Put("/{id}", folders.UpdateFolder)           // Rename or move folder
+				r.Delete("/{id}", folders.DeleteFolder)        // Trash or purge folder
+				r.Post("/{id}/restore", folders.RestoreFolder) // Restore folder from the trash
+			})
+
+			// Tags routes
+			r.Route("/tags", func(r chi.Router) {
+				r.Get("/", tags.GetTags)            // List tags with usage counts
+				r.Post("/merge", tags.MergeTags)    // Merge tags into one
+				r.Put("/{name}", tags.RenameTag)    // Rename tag
+				r.Delete("/{name}", tags.DeleteTag) // Delete tag
+			})
+
+			// Export and import routes
+			r.Get("/export", transfers.ExportVault)  // Download an encrypted export
+			r.Post("/import", transfers.ImportVault) // Import an export file
+
+			// Template routes
+			r.Post("/render", templates.RenderTemplate) // Expand the secret references in a template
+
+			// Admin routes
+			if backupManager != nil {
+				backups := backups.NewHandler(backupManager)
+				r.Route("/admin/backups", func(r chi.Router) {
+					r.Post("/", backups.CreateBackup)                // Take a backup now
+					r.Get("/", backups.GetBackups)                   // List backups
+					r.Get("/{name}", backups.DownloadBackup)         // Download a backup
+					r.Post("/{name}/verify", backups.VerifyBackup)   // Verify a backup
+					r.Post("/{name}/restore", backups.RestoreBackup) // Restore the database from a backup
+				})
+			}
+			passStores := passstores.NewHandler(passManager)
+			r.Route("/admin/pass", func(r chi.Router) {
+				r.Post("/import", passStores.ImportPassStore) // Import a pass store
+				r.Post("/export", passStores.ExportPassStore) // Export into a pass store
+				if passManager.MirrorEnabled() {
+					r.Post("/mirror", passStores.MirrorPassStore) // Update the mirror now
+				}
+			})
 		})
 	})
-	
+
 	// Health check endpoint
 	app.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -27,3 +110,42 @@ func SetupRoutes(app *chi.Mux) {
 		w.Write([]byte(`{"status":"ok","message":"PassVault API is running"}`))
 	})
 }
+
+// SetupVaultRoutes sets up the Vault KV v2 compatible API beside the PassVault
+// API, with the vault as the secrets engine at mount. Vault clients send the
+// token of a PassVault session as their Vault token.
+func SetupVaultRoutes(app *chi.Mux, s store.Store, authManager *auth.Manager, mount string) {
+	mount = strings.Trim(mount, "/")
+	secrets := secrets.NewHandler(s, authManager, mount)
+	// Vault clients list with the LIST method, or a GET with list=true
+	chi.RegisterMethod("LIST")
+
+	app.Route("/v1", func(r chi.Router) {
+		r.Get("/sys/seal-status", secrets.SealStatus) // Report an unsealed Vault, open to every client
+
+		r.Group(func(r chi.Router) {
+			r.Use(secrets.Require)
+			r.Get("/sys/internal/ui/mounts/*", secrets.GetMount)  // Describe the mount of a path
+			r.Get("/auth/token/lookup-self", secrets.LookupToken) // Describe the token of the request
+
+			r.Route("/"+mount, func(r chi.Router) {
+				r.Get("/config", secrets.GetConfig)                      // Get the settings of the mount
+				r.Get("/data/*", secrets.ReadSecret)                     // Read secret
+				r.Post("/data/*", secrets.WriteSecret)                   // Write secret
+				r.Put("/data/*", secrets.WriteSecret)                    // Write secret
+				r.Patch("/data/*", secrets.PatchSecret)                  // Merge into secret
+				r.Delete("/data/*", secrets.DeleteSecret)                // Delete secret to the trash
+				r.Post("/delete/*", secrets.DeleteVersions)              // Delete versions to the trash
+				r.Post("/destroy/*", secrets.DestroyVersions)            // Destroy versions for good
+				r.Post("/undelete/*", secrets.UndeleteVersions)          // Undelete versions from the trash
+				r.Get("/subkeys/*", secrets.ReadSubkeys)                 // Read the keys of a secret
+				r.Get("/metadata", secrets.ReadMetadata)                 // List the root with list=true
+				r.Get("/metadata/*", secrets.ReadMetadata)               // Read metadata, or list with list=true
+				r.MethodFunc("LIST", "/metadata", secrets.ListSecrets)   // List the root
+				r.MethodFunc("LIST", "/metadata/*", secrets.ListSecrets) // List secrets
+				r.Post("/metadata/*", secrets.WriteMetadata)             // Change metadata, refused
+				r.Delete("/metadata/*", secrets.DeleteMetadata)          // Delete secret and its versions for good
+			})
+		})
+	})
+}
@@ -0,0 +1,146 @@
+// Package crypt seals data under a passphrase. The result is a JSON envelope
+// carrying everything needed to open it again except the passphrase.
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"passvault/response"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// envelopeVersion is bumped whenever the layout of the envelope changes
+const envelopeVersion = 1
+
+// KDFParams are the argon2id parameters a key was derived with. They are
+// stored in the envelope so they can be raised without breaking old data.
+type KDFParams struct {
+	Algorithm string `json:"algorithm"`
+	Salt      []byte `json:"salt"`
+	Time      uint32 `json:"time"`
+	Memory    uint32 `json:"memory"`
+	Threads   uint8  `json:"threads"`
+}
+
+// newKDFParams returns the parameters new keys are derived with
+func newKDFParams() (KDFParams, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return KDFParams{}, err
+	}
+	return KDFParams{Algorithm: "argon2id", Salt: salt, Time: 3, Memory: 64 * 1024, Threads: 4}, nil
+}
+
+// Bounds on the parameters read from an envelope, which can come from
+// anywhere, like an import or a restore. They allow a few times the
+// parameters new keys use, so a hostile file costs at most that much.
+const (
+	maxKDFTime   = 8
+	maxKDFMemory = 256 * 1024 // 256 MiB, in KiB
+	minSaltSize  = 8
+)
+
+// check makes sure the parameters are safe to derive a key with, so an
+// envelope can't make opening it panic or exhaust memory and CPU
+func (p KDFParams) check() error {
+	if p.Algorithm != "argon2id" {
+		return fmt.Errorf("unsupported key derivation %q", p.Algorithm)
+	}
+	if p.Time < 1 || p.Time > maxKDFTime || p.Threads < 1 || p.Memory < 8*uint32(p.Threads) || p.Memory > maxKDFMemory || len(p.Salt) < minSaltSize {
+		return fmt.Errorf("key derivation parameters out of bounds: time %d, memory %d KiB, threads %d", p.Time, p.Memory, p.Threads)
+	}
+	return nil
+}
+
+func (p KDFParams) deriveKey(passphrase string) []byte {
+	return argon2.IDKey([]byte(passphrase), p.Salt, p.Time, p.Memory, p.Threads, 32)
+}
+
+// envelope is the sealed form of the data, Data is encrypted with AES-256-GCM
+type envelope struct {
+	Version int       `json:"version"`
+	KDF     KDFParams `json:"kdf"`
+	Nonce   []byte    `json:"nonce"`
+	Data    []byte    `json:"data"`
+}
+
+// Sealer seals data under a key derived once from a passphrase. Deriving the
+// key is deliberately slow, reuse a sealer when sealing repeatedly.
+type Sealer struct {
+	kdf  KDFParams
+	aead cipher.AEAD
+}
+
+// NewSealer derives a key from the passphrase with a fresh salt
+func NewSealer(passphrase string) (*Sealer, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("%w: a passphrase is required", response.ErrInvalidPassphrase)
+	}
+	kdf, err := newKDFParams()
+	if err != nil {
+		return nil, err
+	}
+	return newSealer(kdf, passphrase)
+}
+
+func newSealer(kdf KDFParams, passphrase string) (*Sealer, error) {
+	block, err := aes.NewCipher(kdf.deriveKey(passphrase))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealer{kdf: kdf, aead: aead}, nil
+}
+
+// Seal encrypts plaintext into a new envelope
+func (s *Sealer) Seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelope{
+		Version: envelopeVersion,
+		KDF:     s.kdf,
+		Nonce:   nonce,
+		Data:    s.aead.Seal(nil, nonce, plaintext, nil),
+	})
+}
+
+// Open decrypts an envelope. It also returns a sealer with the same key, so
+// the data can be sealed again without deriving the key a second time. A
+// wrong passphrase is reported as response.ErrInvalidPassphrase.
+func Open(passphrase string, data []byte) ([]byte, *Sealer, error) {
+	var e envelope
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, nil, fmt.Errorf("not an encrypted envelope: %w", err)
+	}
+	if e.Version != envelopeVersion {
+		return nil, nil, fmt.Errorf("unsupported envelope version %d", e.Version)
+	}
+	if err := e.KDF.check(); err != nil {
+		return nil, nil, err
+	}
+	if passphrase == "" {
+		return nil, nil, fmt.Errorf("%w: a passphrase is required", response.ErrInvalidPassphrase)
+	}
+
+	sealer, err := newSealer(e.KDF, passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(e.Nonce) != sealer.aead.NonceSize() {
+		return nil, nil, fmt.Errorf("invalid envelope nonce")
+	}
+	plaintext, err := sealer.aead.Open(nil, e.Nonce, e.Data, nil)
+	if err != nil {
+		return nil, nil, response.ErrInvalidPassphrase
+	}
+	return plaintext, sealer, nil
+}
@@ -0,0 +1,134 @@
+package crypt
+
+import (
+	"encoding/json"
+	"errors"
+	"passvault/response"
+	"strings"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	sealer, err := NewSealer("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := sealer.Seal([]byte("the vault"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, reopened, err := Open("correct horse", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "the vault" {
+		t.Fatalf("Open = %q", plaintext)
+	}
+
+	// The returned sealer seals under the same key
+	again, err := reopened.Seal([]byte("changed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, _, err := Open("correct horse", again); err != nil || string(plaintext) != "changed" {
+		t.Fatalf("Open of the resealed data = %q, %v", plaintext, err)
+	}
+
+	if _, _, err := Open("wrong horse", data); !errors.Is(err, response.ErrInvalidPassphrase) {
+		t.Fatalf("Open with the wrong passphrase = %v", err)
+	}
+	if _, _, err := Open("", data); !errors.Is(err, response.ErrInvalidPassphrase) {
+		t.Fatalf("Open without a passphrase = %v", err)
+	}
+	if _, err := NewSealer(""); !errors.Is(err, response.ErrInvalidPassphrase) {
+		t.Fatalf("NewSealer without a passphrase = %v", err)
+	}
+}
+
+func TestOpenRejectsEnvelopes(t *testing.T) {
+	sealer, err := NewSealer("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := sealer.Seal([]byte("the vault"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(e *envelope)
+		want   string
+	}{
+		{"version", func(e *envelope) { e.Version = 2 }, "unsupported envelope version"},
+		{"algorithm", func(e *envelope) { e.KDF.Algorithm = "scrypt" }, "unsupported key derivation"},
+		{"no threads", func(e *envelope) { e.KDF.Threads = 0 }, "out of bounds"},
+		{"no time", func(e *envelope) { e.KDF.Time = 0 }, "out of bounds"},
+		{"too much time", func(e *envelope) { e.KDF.Time = maxKDFTime + 1 }, "out of bounds"},
+		{"too much memory", func(e *envelope) { e.KDF.Memory = maxKDFMemory + 1 }, "out of bounds"},
+		{"too little memory", func(e *envelope) { e.KDF.Memory = 8*uint32(e.KDF.Threads) - 1 }, "out of bounds"},
+		{"short salt", func(e *envelope) { e.KDF.Salt = e.KDF.Salt[:4] }, "out of bounds"},
+		{"short nonce", func(e *envelope) { e.Nonce = e.Nonce[:4] }, "invalid envelope nonce"},
+		{"changed data", func(e *envelope) { e.Data[0] ^= 1 }, response.ErrInvalidPassphrase.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var e envelope
+			if err := json.Unmarshal(data, &e); err != nil {
+				t.Fatal(err)
+			}
+			tt.change(&e)
+			changed, err := json.Marshal(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _, err = Open("correct horse", changed)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Open = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, _, err := Open("correct horse", []byte("not json")); err == nil {
+		t.Fatal("Open of garbage succeeded")
+	}
+}
+
+func TestPasswordHash(t *testing.T) {
+	hash, err := HashPassword("masterpass1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := hash.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParsePasswordHash(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"masterpass1", true},
+		{"masterpass2", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := parsed.Verify(tt.password); got != tt.want {
+			t.Errorf("Verify(%q) = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+
+	parsed.KDF.Memory = maxKDFMemory * 4
+	data, err = parsed.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParsePasswordHash(data); err == nil {
+		t.Fatal("ParsePasswordHash accepted a hash that needs 1 GiB")
+	}
+}
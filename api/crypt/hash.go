@@ -0,0 +1,49 @@
+package crypt
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+)
+
+// PasswordHash is an argon2id hash of a password, kept to check the password
+// without keeping the password itself
+type PasswordHash struct {
+	Version int       `json:"version"`
+	KDF     KDFParams `json:"kdf"`
+	Hash    []byte    `json:"hash"`
+}
+
+// HashPassword hashes a password with a fresh salt
+func HashPassword(password string) (*PasswordHash, error) {
+	kdf, err := newKDFParams()
+	if err != nil {
+		return nil, err
+	}
+	return &PasswordHash{Version: envelopeVersion, KDF: kdf, Hash: kdf.deriveKey(password)}, nil
+}
+
+// ParsePasswordHash reads a hash written by Marshal
+func ParsePasswordHash(data []byte) (*PasswordHash, error) {
+	var h PasswordHash
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, fmt.Errorf("not a password hash: %w", err)
+	}
+	if h.Version != envelopeVersion || len(h.Hash) == 0 {
+		return nil, fmt.Errorf("unsupported password hash version %d", h.Version)
+	}
+	if err := h.KDF.check(); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// Marshal returns the hash as JSON
+func (h *PasswordHash) Marshal() ([]byte, error) {
+	return json.MarshalIndent(h, "", "  ")
+}
+
+// Verify reports whether password is the one that was hashed
+func (h *PasswordHash) Verify(password string) bool {
+	return subtle.ConstantTimeCompare(h.KDF.deriveKey(password), h.Hash) == 1
+}
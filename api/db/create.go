@@ -2,33 +2,40 @@ package db
 
 import (
 	"database/sql"
+	"os"
 	"passvault/response"
+	"path/filepath"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
-func Init() (*sql.DB, error) {
-	// Create a table in the .sqlite database named credentials
-	db, err := sql.Open("sqlite3", "./credentials.sqlite")
+// Init opens the database at path, creating it if needed. The schema is
+// created by the migrations.
+func Init(path string) (*sql.DB, error) {
+	// The vault holds secrets, keep its directory private
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+
+	db, err := sql.Open("sqlite3", path+dsnOptions)
 	if err != nil {
 		return nil, response.WrapError(err, response.ErrDatabaseConnection)
 	}
 
-	_, err = db.Exec(
-		`CREATE TABLE IF NOT EXISTS credentials (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			username TEXT NOT NULL,
-			password TEXT NOT NULL,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			description TEXT,
-			tags TEXT
-		)`,
-	)
+	// Verify the database works, this also creates the file
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	}
 
-	if err != nil {
+	if err := os.Chmod(path, 0600); err != nil {
+		db.Close()
 		return nil, response.WrapError(err, response.ErrDatabaseConnection)
 	}
 
 	return db, nil
 }
+
+// dsnOptions are appended to every database path, foreign keys are needed
+// for credential_tags to follow deleted credentials and tags
+const dsnOptions = "?_foreign_keys=on"
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"database/sql"
+	"passvault/structs"
+	"path/filepath"
+	"testing"
+)
+
+// newTestDB opens a fresh vault with every migration applied
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	conn, err := Init(filepath.Join(t.TempDir(), "vault.db"))
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if _, err := MigrateUp(conn, MigrateOptions{}); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	return conn
+}
+
+// mustInsert inserts a credential and returns its ID
+func mustInsert(t *testing.T, q Executor, cred structs.Credential) int {
+	t.Helper()
+	id, err := InsertCredential(q, cred)
+	if err != nil {
+		t.Fatalf("InsertCredential(%q): %v", cred.Name, err)
+	}
+	return id
+}
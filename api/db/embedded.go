@@ -3,6 +3,7 @@ package db
 import (
 	"database/sql"
 	"embed"
+	"errors"
 	"io"
 	"io/fs"
 	"os"
@@ -12,60 +13,55 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
-// InitEmbedded initializes the database from an embedded file
-func InitEmbedded(embeddedFS embed.FS) (*sql.DB, error) {
+// InitEmbedded opens the database at path. On first run, when there is no
+// database yet, it is seeded from the credentials.sqlite template embedded
+// in the binary. The embedded copy itself is never opened or written to.
+func InitEmbedded(path string, embeddedFS embed.FS) (*sql.DB, error) {
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		if err := seedFromTemplate(path, embeddedFS); err != nil {
+			return nil, response.WrapError(err, response.ErrDatabaseConnection)
+		}
+	} else if err != nil {
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+
+	return Init(path)
+}
+
+// seedFromTemplate copies the embedded template database to path. Without a
+// template nothing is copied and Init creates an empty database instead.
+func seedFromTemplate(path string, embeddedFS embed.FS) error {
 	// Try to extract the database from embedded files
-	dbFile, err := fs.Sub(embeddedFS, "static")
+	staticFS, err := fs.Sub(embeddedFS, "static")
 	if err != nil {
-		// Fall back to regular init if embedding fails
-		return Init()
+		return nil
 	}
 
 	// Open the embedded database file
-	embeddedDB, err := dbFile.Open("credentials.sqlite")
+	template, err := staticFS.Open("credentials.sqlite")
 	if err != nil {
-		// Fall back to regular init if embedded DB doesn't exist
-		return Init()
+		return nil
 	}
-	defer embeddedDB.Close()
-
-	// Create a temporary database file
-	tempDir := os.TempDir()
-	tempDBPath := filepath.Join(tempDir, "passvault_credentials.sqlite")
+	defer template.Close()
 
-	// Create/overwrite the temp database file
-	tempDB, err := os.Create(tempDBPath)
-	if err != nil {
-		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	// Write to a temporary file next to the database and move it into place,
+	// so an interrupted copy never leaves a half written database behind
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
 	}
-
-	// Copy embedded database to temp file
-	_, err = io.Copy(tempDB, embeddedDB)
-	tempDB.Close()
+	tempDB, err := os.CreateTemp(filepath.Dir(path), ".passvault-seed-*")
 	if err != nil {
-		os.Remove(tempDBPath) // Clean up on error
-		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+		return err
 	}
+	defer os.Remove(tempDB.Name()) // Clean up if the rename didn't happen
 
-	// Open the copied database
-	db, err := sql.Open("sqlite3", tempDBPath)
-	if err != nil {
-		os.Remove(tempDBPath) // Clean up on error
-		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	if _, err := io.Copy(tempDB, template); err != nil {
+		tempDB.Close()
+		return err
 	}
-
-	// Verify the database works
-	if err := db.Ping(); err != nil {
-		db.Close()
-		os.Remove(tempDBPath) // Clean up on error
-		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	if err := tempDB.Close(); err != nil {
+		return err
 	}
 
-	return db, nil
-}
-
-// GetTempDBPath returns the path where the temporary database is stored
-func GetTempDBPath() string {
-	tempDir := os.TempDir()
-	return filepath.Join(tempDir, "passvault_credentials.sqlite")
+	return os.Rename(tempDB.Name(), path)
 }
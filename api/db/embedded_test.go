@@ -0,0 +1,55 @@
+package db
+
+import (
+	"embed"
+	"os"
+	"passvault/structs"
+	"path/filepath"
+	"testing"
+)
+
+func TestInitEmbeddedKeepsWrites(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	path := filepath.Join(dir, "credentials.sqlite")
+
+	// Without a template the vault starts out empty
+	var noTemplate embed.FS
+	conn, err := InitEmbedded(path, noTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MigrateUp(conn, MigrateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	id := mustInsert(t, conn, structs.Credential{Name: "mail", Username: "user", Password: "password"})
+	conn.Close()
+
+	for file, want := range map[string]os.FileMode{dir: 0700, path: 0600} {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("mode of %s = %v, want %v", file, info.Mode().Perm(), want)
+		}
+	}
+
+	// Opening it again keeps what was written instead of seeding it anew
+	conn, err = InitEmbedded(path, noTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cred, err := GetCredential(conn, id)
+	if err != nil {
+		t.Fatalf("GetCredential after reopening: %v", err)
+	}
+	if cred.Name != "mail" {
+		t.Fatalf("Name = %q, want mail", cred.Name)
+	}
+
+	leftovers, err := filepath.Glob(filepath.Join(dir, ".passvault-seed-*"))
+	if err != nil || len(leftovers) != 0 {
+		t.Fatalf("seed files left behind: %v %v", leftovers, err)
+	}
+}
@@ -5,122 +5,179 @@ import (
 	"encoding/json"
 	"passvault/response"
 	"passvault/structs"
+	"strings"
 	"time"
 )
 
-// InsertCredential inserts a new credential into the database
-func InsertCredential(db *sql.DB, cred structs.Credential) error {
-	// Convert tags slice to JSON string
-	tagsJSON, err := json.Marshal(cred.Tags)
-	if err != nil {
-		return response.WrapError(err, response.ErrDatabaseConnection)
-	}
-
-	query := `
-		INSERT INTO credentials (username, password, description, tags, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`
-
-	now := time.Now()
-	_, err = db.Exec(query, cred.Username, cred.Password, cred.Description, string(tagsJSON), now, now)
-	if err != nil {
-		return response.WrapError(err, response.ErrDatabaseConnection)
-	}
+// credentialColumns are the columns scanned by scanCredential, in order
+const credentialColumns = `id, name, username, password, item_type, description, ` + tagsColumn + `, created_at, updated_at, last_used_at, folder_id, deleted_at, fields, attachments, urls, totp, version`
 
-	return nil
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
 }
 
-// GetCredential retrieves a credential by ID
-func GetCredential(db *sql.DB, id int) (*structs.Credential, error) {
-	query := `
-		SELECT id, username, password, description, tags, created_at, updated_at
-		FROM credentials WHERE id = ?
-	`
-
+// scanCredential scans a row selected with credentialColumns into a credential
+func scanCredential(row rowScanner, extra ...any) (*structs.Credential, error) {
 	var cred structs.Credential
-	var tagsJSON string
-	err := db.QueryRow(query, id).Scan(
-		&cred.ID, &cred.Username, &cred.Password,
-		&cred.Description, &tagsJSON, &cred.CreatedAt, &cred.UpdatedAt,
-	)
+	var description, tagsJSON, fieldsJSON, attachmentsJSON, urlsJSON, totp sql.NullString
+	var lastUsedAt, deletedAt sql.NullTime
+	var folderID sql.NullInt64
+	dest := []any{
+		&cred.ID, &cred.Name, &cred.Username, &cred.Password, &cred.ItemType,
+		&description, &tagsJSON, &cred.CreatedAt, &cred.UpdatedAt, &lastUsedAt,
+		&folderID, &deletedAt, &fieldsJSON, &attachmentsJSON, &urlsJSON, &totp,
+		&cred.Version,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
 
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, response.ErrCredentialNotFound
-		}
-		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	cred.Description = description.String
+	if lastUsedAt.Valid {
+		cred.LastUsedAt = &lastUsedAt.Time
+	}
+	if folderID.Valid {
+		id := int(folderID.Int64)
+		cred.FolderID = &id
+	}
+	if deletedAt.Valid {
+		cred.DeletedAt = &deletedAt.Time
 	}
 
 	// Convert JSON string back to slice
-	if tagsJSON != "" {
-		err = json.Unmarshal([]byte(tagsJSON), &cred.Tags)
-		if err != nil {
-			return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	if tagsJSON.String != "" {
+		if err := json.Unmarshal([]byte(tagsJSON.String), &cred.Tags); err != nil {
+			return nil, err
 		}
-	} else {
+	}
+	if cred.Tags == nil {
 		cred.Tags = []string{} // Initialize empty slice if no tags
 	}
 
+	for _, column := range []struct {
+		data sql.NullString
+		dest any
+	}{{fieldsJSON, &cred.Fields}, {attachmentsJSON, &cred.Attachments}, {urlsJSON, &cred.URLs}} {
+		if column.data.String != "" {
+			if err := json.Unmarshal([]byte(column.data.String), column.dest); err != nil {
+				return nil, err
+			}
+		}
+	}
+	cred.TOTP = totp.String
+	NormalizeExtras(&cred)
+
 	return &cred, nil
 }
 
-// GetAllCredentials retrieves all credentials
-func GetAllCredentials(db *sql.DB) ([]structs.Credential, error) {
-	query := `
-		SELECT id, username, password, description, tags, created_at, updated_at
-		FROM credentials ORDER BY created_at DESC
-	`
+// NormalizeExtras puts empty slices in place of missing custom fields,
+// attachments and URLs, and drops blank URLs
+func NormalizeExtras(cred *structs.Credential) {
+	if cred.Fields == nil {
+		cred.Fields = []structs.CustomField{}
+	}
+	if cred.Attachments == nil {
+		cred.Attachments = []structs.Attachment{}
+	}
+	urls := []string{}
+	for _, url := range cred.URLs {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
+	}
+	cred.URLs = urls
+}
+
+// marshalExtras encodes the custom fields, attachments and URLs of a
+// credential for their JSON columns
+func marshalExtras(cred structs.Credential) (fields, attachments, urls string, err error) {
+	NormalizeExtras(&cred)
+	encoded := make([]string, 3)
+	for i, value := range []any{cred.Fields, cred.Attachments, cred.URLs} {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", "", "", err
+		}
+		encoded[i] = string(data)
+	}
+	return encoded[0], encoded[1], encoded[2], nil
+}
+
+// InsertCredential inserts a new credential into the database and returns its ID
+func InsertCredential(db Executor, cred structs.Credential) (int, error) {
+	// Fill in defaults for optional fields
+	if cred.Name == "" {
+		cred.Name = cred.Username
+	}
+	if cred.ItemType == "" {
+		cred.ItemType = structs.ItemTypeLogin
+	}
 
-	rows, err := db.Query(query)
+	fields, attachments, urls, err := marshalExtras(cred)
 	if err != nil {
-		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+		return 0, err
 	}
-	defer rows.Close()
 
-	var credentials []structs.Credential
-	for rows.Next() {
-		var cred structs.Credential
-		var tagsJSON string
-		err := rows.Scan(
-			&cred.ID, &cred.Username, &cred.Password,
-			&cred.Description, &tagsJSON, &cred.CreatedAt, &cred.UpdatedAt,
-		)
+	var id int64
+	err = withTx(db, func(tx Executor) error {
+		if cred.FolderID != nil {
+			if err := checkFolder(tx, *cred.FolderID); err != nil {
+				return err
+			}
+		}
+
+		query := `
+			INSERT INTO credentials (name, username, password, item_type, description, folder_id, fields, attachments, urls, totp, created_at, updated_at, version)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1)
+		`
+
+		now := time.Now()
+		result, err := tx.Exec(query, cred.Name, cred.Username, cred.Password, cred.ItemType, cred.Description, cred.FolderID, fields, attachments, urls, cred.TOTP, now, now)
 		if err != nil {
-			return nil, response.WrapError(err, response.ErrDatabaseConnection)
+			return response.WrapError(err, response.ErrDatabaseConnection)
 		}
 
-		// Convert JSON string back to slice
-		if tagsJSON != "" {
-			err = json.Unmarshal([]byte(tagsJSON), &cred.Tags)
-			if err != nil {
-				return nil, response.WrapError(err, response.ErrDatabaseConnection)
-			}
-		} else {
-			cred.Tags = []string{} // Initialize empty slice if no tags
+		id, err = result.LastInsertId()
+		if err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
 		}
 
-		credentials = append(credentials, cred)
-	}
+		if err := setCredentialTags(tx, id, cred.Tags); err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+
+		return nil
+	})
 
-	return credentials, nil
+	return int(id), err
 }
 
-// UpdateCredential updates an existing credential
-func UpdateCredential(db *sql.DB, id int, cred structs.Credential) error {
-	// Convert tags slice to JSON string
-	tagsJSON, err := json.Marshal(cred.Tags)
+// GetCredential retrieves a credential by ID
+func GetCredential(db Executor, id int) (*structs.Credential, error) {
+	query := `SELECT ` + credentialColumns + ` FROM credentials WHERE id = ?`
+
+	cred, err := scanCredential(db.QueryRow(query, id))
 	if err != nil {
-		return response.WrapError(err, response.ErrDatabaseConnection)
+		if err == sql.ErrNoRows {
+			return nil, response.ErrCredentialNotFound
+		}
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
 	}
 
-	query := `
-		UPDATE credentials 
-		SET username = ?, password = ?, description = ?, tags = ?, updated_at = ?
-		WHERE id = ?
-	`
+	creds := []structs.Credential{*cred}
+	if err := fillFolderPaths(db, creds); err != nil {
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+
+	return &creds[0], nil
+}
+
+// TouchCredential records that a credential has just been used
+func TouchCredential(db Executor, id int) error {
+	query := `UPDATE credentials SET last_used_at = ? WHERE id = ?`
 
-	now := time.Now()
-	result, err := db.Exec(query, cred.Username, cred.Password, cred.Description, string(tagsJSON), now, id)
+	result, err := db.Exec(query, time.Now(), id)
 	if err != nil {
 		return response.WrapError(err, response.ErrDatabaseConnection)
 	}
@@ -137,11 +194,91 @@ func UpdateCredential(db *sql.DB, id int, cred structs.Credential) error {
 	return nil
 }
 
+// UpdateCredential updates an existing credential
+func UpdateCredential(db Executor, id int, cred structs.Credential) error {
+	// Fill in defaults for optional fields
+	if cred.Name == "" {
+		cred.Name = cred.Username
+	}
+	if cred.ItemType == "" {
+		cred.ItemType = structs.ItemTypeLogin
+	}
+
+	fields, attachments, urls, err := marshalExtras(cred)
+	if err != nil {
+		return err
+	}
+
+	return withTx(db, func(tx Executor) error {
+		if cred.FolderID != nil {
+			if err := checkFolder(tx, *cred.FolderID); err != nil {
+				return err
+			}
+		}
+
+		query := `
+			UPDATE credentials 
+			SET name = ?, username = ?, password = ?, item_type = ?, description = ?, folder_id = ?, fields = ?, attachments = ?, urls = ?, totp = ?, updated_at = ?, version = version + 1
+			WHERE id = ?
+		`
+
+		now := time.Now()
+		result, err := tx.Exec(query, cred.Name, cred.Username, cred.Password, cred.ItemType, cred.Description, cred.FolderID, fields, attachments, urls, cred.TOTP, now, id)
+		if err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+
+		if rowsAffected == 0 {
+			return response.ErrCredentialNotFound
+		}
+
+		if err := setCredentialTags(tx, int64(id), cred.Tags); err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+		if err := pruneTags(tx); err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+
+		return nil
+	})
+}
+
 // DeleteCredential deletes a credential by ID
-func DeleteCredential(db *sql.DB, id int) error {
-	query := `DELETE FROM credentials WHERE id = ?`
+func DeleteCredential(db Executor, id int) error {
+	return withTx(db, func(tx Executor) error {
+		query := `DELETE FROM credentials WHERE id = ?`
+
+		result, err := tx.Exec(query, id)
+		if err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+
+		if rowsAffected == 0 {
+			return response.ErrCredentialNotFound
+		}
 
-	result, err := db.Exec(query, id)
+		// Links are removed by the foreign key, drop tags nobody uses anymore
+		if err := pruneTags(tx); err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+
+		return nil
+	})
+}
+
+// TrashCredential moves a credential to the trash
+func TrashCredential(db Executor, id int) error {
+	result, err := db.Exec(`UPDATE credentials SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`, time.Now(), id)
 	if err != nil {
 		return response.WrapError(err, response.ErrDatabaseConnection)
 	}
@@ -157,3 +294,33 @@ func DeleteCredential(db *sql.DB, id int) error {
 
 	return nil
 }
+
+// RestoreCredential brings a trashed credential back. If its folder is in
+// the trash the credential is restored at the top level.
+func RestoreCredential(db Executor, id int) error {
+	return withTx(db, func(tx Executor) error {
+		var folderID sql.NullInt64
+		var deletedAt sql.NullTime
+		err := tx.QueryRow(`SELECT folder_id, deleted_at FROM credentials WHERE id = ?`, id).Scan(&folderID, &deletedAt)
+		if err == sql.ErrNoRows {
+			return response.ErrCredentialNotFound
+		}
+		if err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+		if !deletedAt.Valid {
+			return response.ErrCredentialNotTrashed
+		}
+
+		if folderID.Valid {
+			if err := checkFolder(tx, int(folderID.Int64)); err == response.ErrFolderNotFound {
+				folderID = sql.NullInt64{}
+			} else if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec(`UPDATE credentials SET deleted_at = NULL, folder_id = ? WHERE id = ?`, folderID, id)
+		return response.WrapError(err, response.ErrDatabaseConnection)
+	})
+}
@@ -0,0 +1,364 @@
+package db
+
+import (
+	"database/sql"
+	"passvault/response"
+	"passvault/structs"
+	"strings"
+	"time"
+)
+
+// subtreeCTE selects the IDs of a folder and all of its descendants
+const subtreeCTE = `WITH RECURSIVE subtree(id) AS (
+		SELECT ?
+		UNION ALL
+		SELECT f.id FROM folders f JOIN subtree s ON f.parent_id = s.id
+	)`
+
+// folderColumns are the columns scanned by scanFolder, in order
+const folderColumns = `id, name, parent_id, created_at, updated_at, deleted_at`
+
+// scanFolder scans a row selected with folderColumns into a folder
+func scanFolder(row rowScanner) (*structs.Folder, error) {
+	var folder structs.Folder
+	var parentID sql.NullInt64
+	var deletedAt sql.NullTime
+	err := row.Scan(&folder.ID, &folder.Name, &parentID, &folder.CreatedAt, &folder.UpdatedAt, &deletedAt)
+	if err != nil {
+		return nil, err
+	}
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		folder.ParentID = &id
+	}
+	if deletedAt.Valid {
+		folder.DeletedAt = &deletedAt.Time
+	}
+	return &folder, nil
+}
+
+// loadFolderPaths returns the slash separated path of every folder by ID
+func loadFolderPaths(q Executor) (map[int]string, error) {
+	rows, err := q.Query(`SELECT id, name, parent_id FROM folders`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type node struct {
+		name     string
+		parentID int
+	}
+	nodes := map[int]node{}
+	for rows.Next() {
+		var id int
+		var n node
+		var parentID sql.NullInt64
+		if err := rows.Scan(&id, &n.name, &parentID); err != nil {
+			return nil, err
+		}
+		n.parentID = int(parentID.Int64)
+		nodes[id] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	paths := make(map[int]string, len(nodes))
+	for id := range nodes {
+		var parts []string
+		// Walk up to the root, the depth bound guards against corrupt cycles
+		for current := id; current != 0 && len(parts) <= len(nodes); current = nodes[current].parentID {
+			parts = append([]string{nodes[current].name}, parts...)
+		}
+		paths[id] = strings.Join(parts, "/")
+	}
+	return paths, nil
+}
+
+// fillFolderPaths sets FolderPath on each credential that is in a folder
+func fillFolderPaths(q Executor, creds []structs.Credential) error {
+	paths, err := loadFolderPaths(q)
+	if err != nil {
+		return err
+	}
+	for i := range creds {
+		if creds[i].FolderID != nil {
+			creds[i].FolderPath = paths[*creds[i].FolderID]
+		}
+	}
+	return nil
+}
+
+// checkFolder makes sure a folder exists and is not in the trash
+func checkFolder(q Executor, id int) error {
+	var exists bool
+	err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM folders WHERE id = ? AND deleted_at IS NULL)`, id).Scan(&exists)
+	if err != nil {
+		return response.WrapError(err, response.ErrDatabaseConnection)
+	}
+	if !exists {
+		return response.ErrFolderNotFound
+	}
+	return nil
+}
+
+// checkFolderName validates a folder name and makes sure no live sibling uses it
+func checkFolderName(q Executor, name string, parentID *int, exceptID int) error {
+	// Dot names would step out of the folder in paths like those of pass
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return response.ErrInvalidFolderName
+	}
+
+	var exists bool
+	err := q.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM folders
+		WHERE name = ? AND parent_id IS ? AND deleted_at IS NULL AND id != ?)`,
+		name, parentID, exceptID,
+	).Scan(&exists)
+	if err != nil {
+		return response.WrapError(err, response.ErrDatabaseConnection)
+	}
+	if exists {
+		return response.ErrFolderExists
+	}
+	return nil
+}
+
+// GetFolders retrieves every folder, either the live ones or those in the trash
+func GetFolders(db Executor, trashed bool) ([]structs.Folder, error) {
+	query := `SELECT ` + folderColumns + ` FROM folders WHERE deleted_at IS NULL ORDER BY name, id`
+	if trashed {
+		query = `SELECT ` + folderColumns + ` FROM folders WHERE deleted_at IS NOT NULL ORDER BY name, id`
+	}
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+	defer rows.Close()
+
+	folders := []structs.Folder{}
+	for rows.Next() {
+		folder, err := scanFolder(rows)
+		if err != nil {
+			return nil, response.WrapError(err, response.ErrDatabaseConnection)
+		}
+		folders = append(folders, *folder)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+
+	paths, err := loadFolderPaths(db)
+	if err != nil {
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+	for i := range folders {
+		folders[i].Path = paths[folders[i].ID]
+	}
+
+	return folders, nil
+}
+
+// GetFolder retrieves a folder by ID
+func GetFolder(db Executor, id int) (*structs.Folder, error) {
+	folder, err := scanFolder(db.QueryRow(`SELECT `+folderColumns+` FROM folders WHERE id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, response.ErrFolderNotFound
+		}
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+
+	paths, err := loadFolderPaths(db)
+	if err != nil {
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+	folder.Path = paths[folder.ID]
+
+	return folder, nil
+}
+
+// CreateFolder inserts a new folder and returns its ID
+func CreateFolder(db Executor, folder structs.Folder) (int, error) {
+	folder.Name = strings.TrimSpace(folder.Name)
+
+	var id int64
+	err := withTx(db, func(tx Executor) error {
+		if folder.ParentID != nil {
+			if err := checkFolder(tx, *folder.ParentID); err != nil {
+				return err
+			}
+		}
+		if err := checkFolderName(tx, folder.Name, folder.ParentID, 0); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		result, err := tx.Exec(
+			`INSERT INTO folders (name, parent_id, created_at, updated_at) VALUES (?, ?, ?, ?)`,
+			folder.Name, folder.ParentID, now, now,
+		)
+		if err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+
+		id, err = result.LastInsertId()
+		return response.WrapError(err, response.ErrDatabaseConnection)
+	})
+
+	return int(id), err
+}
+
+// UpdateFolder renames a folder and moves it, together with its subtree,
+// under a new parent. A folder can't be moved into its own subtree.
+func UpdateFolder(db Executor, id int, folder structs.Folder) error {
+	folder.Name = strings.TrimSpace(folder.Name)
+
+	return withTx(db, func(tx Executor) error {
+		if err := checkFolder(tx, id); err != nil {
+			return err
+		}
+
+		if folder.ParentID != nil {
+			if err := checkFolder(tx, *folder.ParentID); err != nil {
+				return err
+			}
+
+			var cycle bool
+			err := tx.QueryRow(subtreeCTE+` SELECT EXISTS (SELECT 1 FROM subtree WHERE id = ?)`, id, *folder.ParentID).Scan(&cycle)
+			if err != nil {
+				return response.WrapError(err, response.ErrDatabaseConnection)
+			}
+			if cycle {
+				return response.ErrFolderCycle
+			}
+		}
+
+		if err := checkFolderName(tx, folder.Name, folder.ParentID, id); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(
+			`UPDATE folders SET name = ?, parent_id = ?, updated_at = ? WHERE id = ?`,
+			folder.Name, folder.ParentID, time.Now(), id,
+		)
+		if err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+
+		return nil
+	})
+}
+
+// TrashFolder moves a folder, its subfolders and every credential in them to the trash
+func TrashFolder(db Executor, id int) error {
+	return withTx(db, func(tx Executor) error {
+		if err := checkFolder(tx, id); err != nil {
+			return err
+		}
+
+		// Everything trashed together shares a timestamp so it can be restored together
+		now := time.Now()
+		_, err := tx.Exec(
+			subtreeCTE+` UPDATE folders SET deleted_at = ? WHERE id IN (SELECT id FROM subtree) AND deleted_at IS NULL`,
+			id, now,
+		)
+		if err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+		_, err = tx.Exec(
+			subtreeCTE+` UPDATE credentials SET deleted_at = ? WHERE folder_id IN (SELECT id FROM subtree) AND deleted_at IS NULL`,
+			id, now,
+		)
+		if err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+
+		return nil
+	})
+}
+
+// RestoreFolder brings a trashed folder back together with everything that
+// was trashed along with it. If its parent is still in the trash the folder
+// is restored at the top level.
+func RestoreFolder(db Executor, id int) error {
+	return withTx(db, func(tx Executor) error {
+		folder, err := scanFolder(tx.QueryRow(`SELECT `+folderColumns+` FROM folders WHERE id = ?`, id))
+		if err == sql.ErrNoRows {
+			return response.ErrFolderNotFound
+		}
+		if err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+		if folder.DeletedAt == nil {
+			return response.ErrFolderNotTrashed
+		}
+
+		if folder.ParentID != nil {
+			if err := checkFolder(tx, *folder.ParentID); err == response.ErrFolderNotFound {
+				folder.ParentID = nil
+			} else if err != nil {
+				return err
+			}
+		}
+		if err := checkFolderName(tx, folder.Name, folder.ParentID, id); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		_, err = tx.Exec(`UPDATE folders SET parent_id = ?, updated_at = ? WHERE id = ?`, folder.ParentID, now, id)
+		if err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+		_, err = tx.Exec(
+			subtreeCTE+` UPDATE folders SET deleted_at = NULL WHERE id IN (SELECT id FROM subtree) AND deleted_at = ?`,
+			id, *folder.DeletedAt,
+		)
+		if err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+		_, err = tx.Exec(
+			subtreeCTE+` UPDATE credentials SET deleted_at = NULL WHERE folder_id IN (SELECT id FROM subtree) AND deleted_at = ?`,
+			id, *folder.DeletedAt,
+		)
+		if err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+
+		return nil
+	})
+}
+
+// PurgeFolder permanently deletes a trashed folder, its subfolders and the
+// credentials in them
+func PurgeFolder(db Executor, id int) error {
+	return withTx(db, func(tx Executor) error {
+		var deletedAt sql.NullTime
+		err := tx.QueryRow(`SELECT deleted_at FROM folders WHERE id = ?`, id).Scan(&deletedAt)
+		if err == sql.ErrNoRows {
+			return response.ErrFolderNotFound
+		}
+		if err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+		if !deletedAt.Valid {
+			return response.ErrFolderNotTrashed
+		}
+
+		_, err = tx.Exec(subtreeCTE+` DELETE FROM credentials WHERE folder_id IN (SELECT id FROM subtree)`, id)
+		if err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+		// Subfolders follow through the parent_id foreign key
+		if _, err := tx.Exec(`DELETE FROM folders WHERE id = ?`, id); err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+		if err := pruneTags(tx); err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+
+		return nil
+	})
+}
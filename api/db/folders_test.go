@@ -0,0 +1,235 @@
+package db
+
+import (
+	"errors"
+	"passvault/response"
+	"passvault/structs"
+	"slices"
+	"testing"
+)
+
+// mustCreateFolder creates a folder and returns its ID
+func mustCreateFolder(t *testing.T, q Executor, name string, parentID *int) int {
+	t.Helper()
+	id, err := CreateFolder(q, structs.Folder{Name: name, ParentID: parentID})
+	if err != nil {
+		t.Fatalf("CreateFolder(%q): %v", name, err)
+	}
+	return id
+}
+
+// folderPaths returns the paths of the live or trashed folders
+func folderPaths(t *testing.T, q Executor, trashed bool) []string {
+	t.Helper()
+	folders, err := GetFolders(q, trashed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, folder := range folders {
+		paths = append(paths, folder.Path)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func TestCreateFolder(t *testing.T) {
+	conn := newTestDB(t)
+	work := mustCreateFolder(t, conn, "Work", nil)
+	mustCreateFolder(t, conn, "Servers", &work)
+	missing := 999
+
+	tests := []struct {
+		name     string
+		folder   string
+		parentID *int
+		err      error
+	}{
+		{"top level", " Home ", nil, nil},
+		{"same name elsewhere", "Servers", nil, nil},
+		{"sibling name", "Servers", &work, response.ErrFolderExists},
+		{"empty name", "  ", nil, response.ErrInvalidFolderName},
+		{"slash in name", "a/b", nil, response.ErrInvalidFolderName},
+		{"dot name", ".", nil, response.ErrInvalidFolderName},
+		{"dot dot name", "..", nil, response.ErrInvalidFolderName},
+		{"missing parent", "Lost", &missing, response.ErrFolderNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CreateFolder(conn, structs.Folder{Name: tt.folder, ParentID: tt.parentID})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("CreateFolder = %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	want := []string{"Home", "Servers", "Work", "Work/Servers"}
+	if got := folderPaths(t, conn, false); !slices.Equal(got, want) {
+		t.Fatalf("paths = %q, want %q", got, want)
+	}
+}
+
+func TestUpdateFolder(t *testing.T) {
+	conn := newTestDB(t)
+	work := mustCreateFolder(t, conn, "Work", nil)
+	servers := mustCreateFolder(t, conn, "Servers", &work)
+	prod := mustCreateFolder(t, conn, "Prod", &servers)
+	home := mustCreateFolder(t, conn, "Home", nil)
+
+	tests := []struct {
+		name     string
+		id       int
+		folder   string
+		parentID *int
+		err      error
+	}{
+		{"into itself", servers, "Servers", &servers, response.ErrFolderCycle},
+		{"into a descendant", work, "Work", &prod, response.ErrFolderCycle},
+		{"onto a sibling name", home, "Work", nil, response.ErrFolderExists},
+		{"missing folder", 999, "Gone", nil, response.ErrFolderNotFound},
+		{"rename and move", servers, "Hosts", &home, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := UpdateFolder(conn, tt.id, structs.Folder{Name: tt.folder, ParentID: tt.parentID})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("UpdateFolder = %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	// The subtree moves along
+	want := []string{"Home", "Home/Hosts", "Home/Hosts/Prod", "Work"}
+	if got := folderPaths(t, conn, false); !slices.Equal(got, want) {
+		t.Fatalf("paths = %q, want %q", got, want)
+	}
+}
+
+func TestFolderTrash(t *testing.T) {
+	conn := newTestDB(t)
+	work := mustCreateFolder(t, conn, "Work", nil)
+	servers := mustCreateFolder(t, conn, "Servers", &work)
+	inWork := mustInsert(t, conn, structs.Credential{Name: "mail", Username: "user", Password: "password", FolderID: &work})
+	inServers := mustInsert(t, conn, structs.Credential{Name: "ssh", Username: "root", Password: "password", FolderID: &servers, Tags: []string{"infra"}})
+	outside := mustInsert(t, conn, structs.Credential{Name: "home", Username: "user", Password: "password"})
+
+	live := func() []int {
+		page, err := GetAllCredentials(conn, structs.ListOptions{SortBy: structs.SortByName, SortOrder: structs.SortAsc})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int
+		for _, cred := range page.Credentials {
+			ids = append(ids, cred.ID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	if err := RestoreFolder(conn, work); !errors.Is(err, response.ErrFolderNotTrashed) {
+		t.Fatalf("RestoreFolder of a live folder = %v", err)
+	}
+	if err := PurgeFolder(conn, work); !errors.Is(err, response.ErrFolderNotTrashed) {
+		t.Fatalf("PurgeFolder of a live folder = %v", err)
+	}
+
+	if err := TrashFolder(conn, work); err != nil {
+		t.Fatal(err)
+	}
+	if got := live(); !slices.Equal(got, []int{outside}) {
+		t.Fatalf("live after trashing = %v", got)
+	}
+	if got := folderPaths(t, conn, true); !slices.Equal(got, []string{"Work", "Work/Servers"}) {
+		t.Fatalf("trashed folders = %q", got)
+	}
+	if _, err := InsertCredential(conn, structs.Credential{Name: "new", Username: "user", Password: "password", FolderID: &servers}); !errors.Is(err, response.ErrFolderNotFound) {
+		t.Fatalf("InsertCredential into the trash = %v", err)
+	}
+
+	if err := RestoreFolder(conn, work); err != nil {
+		t.Fatal(err)
+	}
+	if got := live(); !slices.Equal(got, []int{inWork, inServers, outside}) {
+		t.Fatalf("live after restoring = %v", got)
+	}
+
+	if err := TrashFolder(conn, servers); err != nil {
+		t.Fatal(err)
+	}
+	if err := PurgeFolder(conn, servers); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetCredential(conn, inServers); !errors.Is(err, response.ErrCredentialNotFound) {
+		t.Fatalf("GetCredential after purging = %v", err)
+	}
+	tags, err := GetTags(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 0 {
+		t.Fatalf("tags after purging = %v", tags)
+	}
+}
+
+func TestRestoreFolderUnderTrashedParent(t *testing.T) {
+	conn := newTestDB(t)
+	work := mustCreateFolder(t, conn, "Work", nil)
+	servers := mustCreateFolder(t, conn, "Servers", &work)
+
+	if err := TrashFolder(conn, servers); err != nil {
+		t.Fatal(err)
+	}
+	if err := TrashFolder(conn, work); err != nil {
+		t.Fatal(err)
+	}
+	// The parent stays in the trash, so the folder comes back at the top
+	if err := RestoreFolder(conn, servers); err != nil {
+		t.Fatal(err)
+	}
+	if got := folderPaths(t, conn, false); !slices.Equal(got, []string{"Servers"}) {
+		t.Fatalf("paths = %q", got)
+	}
+}
+
+func TestListFolderScope(t *testing.T) {
+	conn := newTestDB(t)
+	work := mustCreateFolder(t, conn, "Work", nil)
+	servers := mustCreateFolder(t, conn, "Servers", &work)
+	mustInsert(t, conn, structs.Credential{Name: "mail", Username: "user", Password: "password", FolderID: &work})
+	mustInsert(t, conn, structs.Credential{Name: "ssh", Username: "root", Password: "password", FolderID: &servers})
+	mustInsert(t, conn, structs.Credential{Name: "home", Username: "user", Password: "password"})
+
+	none := 0
+	tests := []struct {
+		name      string
+		folderID  *int
+		recursive bool
+		want      []string
+	}{
+		{"everywhere", nil, false, []string{"home", "mail", "ssh"}},
+		{"outside folders", &none, false, []string{"home"}},
+		{"one folder", &work, false, []string{"mail"}},
+		{"with subfolders", &work, true, []string{"mail", "ssh"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := GetAllCredentials(conn, structs.ListOptions{
+				SortBy: structs.SortByName, SortOrder: structs.SortAsc,
+				FolderID: tt.folderID, IncludeSubfolders: tt.recursive,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, cred := range page.Credentials {
+				got = append(got, cred.Name)
+				if cred.Name == "ssh" && cred.FolderPath != "Work/Servers" {
+					t.Errorf("FolderPath = %q", cred.FolderPath)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"passvault/response"
+	"passvault/structs"
+	"strings"
+)
+
+const (
+	// DefaultListLimit is the page size used when none is requested
+	DefaultListLimit = 50
+	// MaxListLimit is the largest page size a client may request
+	MaxListLimit = 500
+)
+
+// sortExpressions maps each sort field onto the SQL expression it orders by.
+// Timestamps are normalised through julianday so rows written with different
+// timezone offsets still compare correctly.
+var sortExpressions = map[string]string{
+	structs.SortByName:     `lower(name)`,
+	structs.SortByCreated:  `COALESCE(julianday(created_at), 0)`,
+	structs.SortByUpdated:  `COALESCE(julianday(updated_at), 0)`,
+	structs.SortByLastUsed: `COALESCE(julianday(last_used_at), 0)`,
+}
+
+// ListCursor is the decoded form of the opaque pagination cursor. It records
+// the sort it was issued for and the position of the last row on the page.
+// Other storage backends use the same format with their own sort keys.
+type ListCursor struct {
+	SortBy    string `json:"s"`
+	SortOrder string `json:"o"`
+	Key       any    `json:"k"`
+	ID        int    `json:"i"`
+}
+
+// EncodeCursor turns a cursor into an opaque URL safe string
+func EncodeCursor(c ListCursor) (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCursor parses an opaque cursor and checks it belongs to the requested sort
+func DecodeCursor(raw string, opts structs.ListOptions) (*ListCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, response.ErrInvalidCursor
+	}
+
+	var c ListCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, response.ErrInvalidCursor
+	}
+	if c.SortBy != opts.SortBy || c.SortOrder != opts.SortOrder {
+		return nil, response.ErrInvalidCursor
+	}
+
+	// Names sort as text, everything else as a julian day number
+	switch c.Key.(type) {
+	case string:
+		if c.SortBy != structs.SortByName {
+			return nil, response.ErrInvalidCursor
+		}
+	case float64:
+		if c.SortBy == structs.SortByName {
+			return nil, response.ErrInvalidCursor
+		}
+	default:
+		return nil, response.ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// NormalizeListOptions fills in defaults for any options left empty
+func NormalizeListOptions(opts structs.ListOptions) structs.ListOptions {
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultListLimit
+	}
+	if opts.Limit > MaxListLimit {
+		opts.Limit = MaxListLimit
+	}
+	if _, ok := sortExpressions[opts.SortBy]; !ok {
+		opts.SortBy = structs.SortByCreated
+	}
+	if opts.SortOrder != structs.SortAsc {
+		opts.SortOrder = structs.SortDesc
+	}
+	if opts.TagMatch != structs.TagMatchAll {
+		opts.TagMatch = structs.TagMatchAny
+	}
+	return opts
+}
+
+// buildListFilters returns the WHERE conditions and arguments for the filters in opts
+func buildListFilters(opts structs.ListOptions) ([]string, []any) {
+	var conditions []string
+	var args []any
+
+	if len(opts.Tags) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(opts.Tags)), ",")
+		matching := `FROM credential_tags ct JOIN tags t ON t.id = ct.tag_id
+			WHERE ct.credential_id = credentials.id AND t.name IN (` + placeholders + `)`
+		if opts.TagMatch == structs.TagMatchAll {
+			conditions = append(conditions, `(SELECT COUNT(*) `+matching+`) = ?`)
+		} else {
+			conditions = append(conditions, `EXISTS (SELECT 1 `+matching+`)`)
+		}
+		for _, tag := range opts.Tags {
+			args = append(args, tag)
+		}
+		if opts.TagMatch == structs.TagMatchAll {
+			args = append(args, len(opts.Tags))
+		}
+	}
+
+	// Trashed credentials are only listed when asked for
+	if opts.Trashed {
+		conditions = append(conditions, `deleted_at IS NOT NULL`)
+	} else {
+		conditions = append(conditions, `deleted_at IS NULL`)
+	}
+
+	switch {
+	case opts.FolderID == nil:
+	case *opts.FolderID == 0:
+		conditions = append(conditions, `folder_id IS NULL`)
+	case opts.IncludeSubfolders:
+		conditions = append(conditions, `folder_id IN (`+subtreeCTE+` SELECT id FROM subtree)`)
+		args = append(args, *opts.FolderID)
+	default:
+		conditions = append(conditions, `folder_id = ?`)
+		args = append(args, *opts.FolderID)
+	}
+
+	if opts.ItemType != "" {
+		conditions = append(conditions, `item_type = ?`)
+		args = append(args, opts.ItemType)
+	}
+
+	// Lower bounds are inclusive, upper bounds exclusive
+	if opts.CreatedAfter != nil {
+		conditions = append(conditions, `julianday(created_at) >= julianday(?)`)
+		args = append(args, opts.CreatedAfter.UTC())
+	}
+	if opts.CreatedBefore != nil {
+		conditions = append(conditions, `julianday(created_at) < julianday(?)`)
+		args = append(args, opts.CreatedBefore.UTC())
+	}
+	if opts.UpdatedAfter != nil {
+		conditions = append(conditions, `julianday(updated_at) >= julianday(?)`)
+		args = append(args, opts.UpdatedAfter.UTC())
+	}
+	if opts.UpdatedBefore != nil {
+		conditions = append(conditions, `julianday(updated_at) < julianday(?)`)
+		args = append(args, opts.UpdatedBefore.UTC())
+	}
+
+	return conditions, args
+}
+
+// GetAllCredentials retrieves a single page of credentials matching the list options
+func GetAllCredentials(db Executor, opts structs.ListOptions) (*structs.CredentialPage, error) {
+	opts = NormalizeListOptions(opts)
+	sortExpr := sortExpressions[opts.SortBy]
+
+	conditions, args := buildListFilters(opts)
+
+	// Count every matching row, ignoring the cursor
+	countQuery := `SELECT COUNT(*) FROM credentials`
+	if len(conditions) > 0 {
+		countQuery += ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+	var total int
+	if err := db.QueryRow(countQuery, args...).Scan(&total); err != nil {
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+
+	// Continue after the last row of the previous page
+	comparison := `<`
+	direction := `DESC`
+	if opts.SortOrder == structs.SortAsc {
+		comparison = `>`
+		direction = `ASC`
+	}
+	if opts.Cursor != "" {
+		cursor, err := DecodeCursor(opts.Cursor, opts)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, `(`+sortExpr+` `+comparison+` ? OR (`+sortExpr+` = ? AND id `+comparison+` ?))`)
+		args = append(args, cursor.Key, cursor.Key, cursor.ID)
+	}
+
+	query := `SELECT ` + credentialColumns + `, ` + sortExpr + ` AS sort_key FROM credentials`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+	// Fetch one extra row to find out whether there is a next page
+	query += ` ORDER BY sort_key ` + direction + `, id ` + direction + ` LIMIT ?`
+	args = append(args, opts.Limit+1)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+	defer rows.Close()
+
+	page := &structs.CredentialPage{Credentials: []structs.Credential{}, TotalCount: total}
+	var lastKey any
+	for rows.Next() {
+		var sortKey any
+		cred, err := scanCredential(rows, &sortKey)
+		if err != nil {
+			return nil, response.WrapError(err, response.ErrDatabaseConnection)
+		}
+
+		if len(page.Credentials) == opts.Limit {
+			// There is at least one more row, hand out a cursor to it
+			last := page.Credentials[len(page.Credentials)-1]
+			page.NextCursor, err = EncodeCursor(ListCursor{
+				SortBy:    opts.SortBy,
+				SortOrder: opts.SortOrder,
+				Key:       lastKey,
+				ID:        last.ID,
+			})
+			if err != nil {
+				return nil, response.WrapError(err, response.ErrDatabaseConnection)
+			}
+			break
+		}
+
+		// Text keys may come back from the driver as raw bytes
+		if b, ok := sortKey.([]byte); ok {
+			sortKey = string(b)
+		}
+		page.Credentials = append(page.Credentials, *cred)
+		lastKey = sortKey
+	}
+	if err := rows.Err(); err != nil {
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+
+	if err := fillFolderPaths(db, page.Credentials); err != nil {
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+
+	return page, nil
+}
+
+// escapeLike escapes the LIKE wildcards in a search term
+func escapeLike(term string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+}
+
+// SearchCredentials finds live credentials whose name, username, description
+// or tags contain the query, ignoring case. Exact name matches come first,
+// then names starting with the query, then everything else by name.
+func SearchCredentials(db Executor, query string, limit int) ([]structs.Credential, error) {
+	if limit <= 0 || limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+
+	term := escapeLike(query)
+	contains := "%" + term + "%"
+	sqlQuery := `SELECT ` + credentialColumns + ` FROM credentials
+		WHERE deleted_at IS NULL AND (
+			name LIKE ? ESCAPE '\' OR username LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\'
+			OR EXISTS (SELECT 1 FROM credential_tags ct JOIN tags t ON t.id = ct.tag_id
+				WHERE ct.credential_id = credentials.id AND t.name LIKE ? ESCAPE '\')
+		)
+		ORDER BY CASE WHEN lower(name) = lower(?) THEN 0 WHEN name LIKE ? ESCAPE '\' THEN 1 ELSE 2 END,
+			lower(name), id
+		LIMIT ?`
+
+	rows, err := db.Query(sqlQuery, contains, contains, contains, contains, query, term+"%", limit)
+	if err != nil {
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+	defer rows.Close()
+
+	credentials := []structs.Credential{}
+	for rows.Next() {
+		cred, err := scanCredential(rows)
+		if err != nil {
+			return nil, response.WrapError(err, response.ErrDatabaseConnection)
+		}
+		credentials = append(credentials, *cred)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+	rows.Close()
+
+	if err := fillFolderPaths(db, credentials); err != nil {
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+
+	return credentials, nil
+}
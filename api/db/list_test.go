@@ -0,0 +1,183 @@
+package db
+
+import (
+	"errors"
+	"passvault/response"
+	"passvault/structs"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	byName := structs.ListOptions{SortBy: structs.SortByName, SortOrder: structs.SortAsc}
+	byCreated := structs.ListOptions{SortBy: structs.SortByCreated, SortOrder: structs.SortDesc}
+	encode := func(c ListCursor) string {
+		raw, err := EncodeCursor(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+
+	tests := []struct {
+		name  string
+		raw   string
+		opts  structs.ListOptions
+		valid bool
+	}{
+		{"name key", encode(ListCursor{structs.SortByName, structs.SortAsc, "github", 4}), byName, true},
+		{"julian day key", encode(ListCursor{structs.SortByCreated, structs.SortDesc, 2460849.5, 7}), byCreated, true},
+		{"other sort", encode(ListCursor{structs.SortByName, structs.SortAsc, "github", 4}), byCreated, false},
+		{"other order", encode(ListCursor{structs.SortByName, structs.SortDesc, "github", 4}), byName, false},
+		{"number for name", encode(ListCursor{structs.SortByName, structs.SortAsc, 12.0, 4}), byName, false},
+		{"text for date", encode(ListCursor{structs.SortByCreated, structs.SortDesc, "2025", 4}), byCreated, false},
+		{"missing key", encode(ListCursor{SortBy: structs.SortByName, SortOrder: structs.SortAsc, ID: 4}), byName, false},
+		{"not base64", "!!!", byName, false},
+		{"not JSON", "bm90IGpzb24", byName, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeCursor(tt.raw, tt.opts)
+			if tt.valid && err != nil {
+				t.Fatalf("DecodeCursor: %v", err)
+			}
+			if !tt.valid && !errors.Is(err, response.ErrInvalidCursor) {
+				t.Fatalf("DecodeCursor = %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
+
+func TestNormalizeListOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		in   structs.ListOptions
+		want structs.ListOptions
+	}{
+		{
+			"defaults",
+			structs.ListOptions{},
+			structs.ListOptions{Limit: DefaultListLimit, SortBy: structs.SortByCreated, SortOrder: structs.SortDesc, TagMatch: structs.TagMatchAny},
+		},
+		{
+			"capped limit",
+			structs.ListOptions{Limit: MaxListLimit + 1, SortBy: structs.SortByName, SortOrder: structs.SortAsc, TagMatch: structs.TagMatchAll},
+			structs.ListOptions{Limit: MaxListLimit, SortBy: structs.SortByName, SortOrder: structs.SortAsc, TagMatch: structs.TagMatchAll},
+		},
+		{
+			"unknown sort",
+			structs.ListOptions{Limit: 5, SortBy: "password"},
+			structs.ListOptions{Limit: 5, SortBy: structs.SortByCreated, SortOrder: structs.SortDesc, TagMatch: structs.TagMatchAny},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NormalizeListOptions(tt.in)
+			if got.Limit != tt.want.Limit || got.SortBy != tt.want.SortBy || got.SortOrder != tt.want.SortOrder || got.TagMatch != tt.want.TagMatch {
+				t.Fatalf("NormalizeListOptions = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAllCredentialsPages(t *testing.T) {
+	conn := newTestDB(t)
+	names := []string{"delta", "Alpha", "charlie", "echo", "bravo"}
+	for _, name := range names {
+		mustInsert(t, conn, structs.Credential{Name: name, Username: "user", Password: "password"})
+	}
+
+	tests := []struct {
+		sortBy, order string
+		want          []string
+	}{
+		{structs.SortByName, structs.SortAsc, []string{"Alpha", "bravo", "charlie", "delta", "echo"}},
+		{structs.SortByName, structs.SortDesc, []string{"echo", "delta", "charlie", "bravo", "Alpha"}},
+		// Rows created within the same instant are ordered by ID
+		{structs.SortByCreated, structs.SortAsc, names},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sortBy+" "+tt.order, func(t *testing.T) {
+			opts := structs.ListOptions{Limit: 2, SortBy: tt.sortBy, SortOrder: tt.order}
+			var got []string
+			for pages := 0; ; pages++ {
+				if pages > len(names) {
+					t.Fatal("the cursor never ran out")
+				}
+				page, err := GetAllCredentials(conn, opts)
+				if err != nil {
+					t.Fatalf("GetAllCredentials: %v", err)
+				}
+				if page.TotalCount != len(names) {
+					t.Fatalf("TotalCount = %d, want %d", page.TotalCount, len(names))
+				}
+				for _, cred := range page.Credentials {
+					got = append(got, cred.Name)
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				opts.Cursor = page.NextCursor
+			}
+			if tt.sortBy == structs.SortByCreated {
+				// Timestamps may tie, only check every row came exactly once
+				slices.Sort(got)
+				tt.want = slices.Sorted(slices.Values(tt.want))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("pages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAllCredentialsFilters(t *testing.T) {
+	conn := newTestDB(t)
+	mustInsert(t, conn, structs.Credential{Name: "mail", Username: "user", Password: "password", Tags: []string{"personal", "email"}})
+	mustInsert(t, conn, structs.Credential{Name: "bank", Username: "user", Password: "password", Tags: []string{"personal", "finance"}})
+	mustInsert(t, conn, structs.Credential{Name: "wifi", ItemType: structs.ItemTypeSecureNote, Description: "code"})
+
+	future := time.Now().Add(time.Hour)
+	tests := []struct {
+		name string
+		opts structs.ListOptions
+		want []string
+	}{
+		{"everything", structs.ListOptions{}, []string{"bank", "mail", "wifi"}},
+		{"any tag", structs.ListOptions{Tags: []string{"email", "finance"}}, []string{"bank", "mail"}},
+		{"all tags", structs.ListOptions{Tags: []string{"personal", "email"}, TagMatch: structs.TagMatchAll}, []string{"mail"}},
+		{"unknown tag", structs.ListOptions{Tags: []string{"work"}}, nil},
+		{"item type", structs.ListOptions{ItemType: structs.ItemTypeSecureNote}, []string{"wifi"}},
+		{"created after", structs.ListOptions{CreatedAfter: &future}, nil},
+		{"created before", structs.ListOptions{CreatedBefore: &future}, []string{"bank", "mail", "wifi"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.SortBy, tt.opts.SortOrder = structs.SortByName, structs.SortAsc
+			page, err := GetAllCredentials(conn, tt.opts)
+			if err != nil {
+				t.Fatalf("GetAllCredentials: %v", err)
+			}
+			var got []string
+			for _, cred := range page.Credentials {
+				got = append(got, cred.Name)
+			}
+			if !slices.Equal(got, tt.want) || page.TotalCount != len(tt.want) {
+				t.Fatalf("got %v (total %d), want %v", got, page.TotalCount, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAllCredentialsForeignCursor(t *testing.T) {
+	conn := newTestDB(t)
+	raw, err := EncodeCursor(ListCursor{structs.SortByName, structs.SortAsc, "a", 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := structs.ListOptions{Cursor: raw, SortBy: structs.SortByUpdated}
+	if _, err := GetAllCredentials(conn, opts); !errors.Is(err, response.ErrInvalidCursor) {
+		t.Fatalf("GetAllCredentials = %v, want ErrInvalidCursor", err)
+	}
+}
@@ -3,22 +3,48 @@ package db
 import (
 	"database/sql"
 	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"passvault/response"
+	"path/filepath"
 	"sync"
+	"time"
 )
 
 var (
-	globalDB *sql.DB
-	dbMutex  sync.RWMutex
-	dbOnce   sync.Once
+	globalDB   *sql.DB
+	globalPath string
+	dbMutex    sync.RWMutex
+	dbOnce     sync.Once
 )
 
-// InitializeGlobalDB initializes the global database instance
-func InitializeGlobalDB(embeddedFS embed.FS) error {
+// InitializeGlobalDB opens the database at path as the global instance and
+// brings its schema up to date, backing it up first if there is anything to
+// migrate. A new database is seeded from the embedded template.
+func InitializeGlobalDB(path string, embeddedFS embed.FS) error {
 	var err error
 	dbOnce.Do(func() {
 		dbMutex.Lock()
 		defer dbMutex.Unlock()
-		globalDB, err = InitEmbedded(embeddedFS)
+		globalDB, err = InitEmbedded(path, embeddedFS)
+		if err != nil {
+			return
+		}
+		globalPath = path
+
+		var result *MigrationResult
+		result, err = MigrateUp(globalDB, MigrateOptions{Backup: true})
+		if err != nil {
+			globalDB.Close()
+			globalDB = nil
+			return
+		}
+		if result.To != result.From {
+			log.Printf("Migrated database schema from version %d to %d", result.From, result.To)
+		}
 	})
 	return err
 }
@@ -39,3 +65,93 @@ func CloseDB() error {
 	}
 	return nil
 }
+
+// RestoreGlobalDB replaces the global database with a copy of the database
+// file at src without restarting. The swap happens under the write lock, so
+// no query sees a half replaced database. The replaced database is kept next
+// to the new one as a rollback point, its path is returned. A restored
+// database with an older schema is migrated up.
+func RestoreGlobalDB(src string) (string, error) {
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+
+	if globalDB == nil {
+		return "", response.WrapError(errors.New("database not initialized"), response.ErrDatabaseConnection)
+	}
+
+	// Copy the new database next to the live one so the swap is a rename
+	replacement, err := copyToTemp(src, filepath.Dir(globalPath))
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(replacement)
+
+	rollbackPath := fmt.Sprintf("%s.pre-restore-%s.bak", globalPath, time.Now().Format("20060102-150405"))
+	if err := globalDB.Close(); err != nil {
+		return "", reopenGlobalDB(err)
+	}
+	if err := os.Rename(globalPath, rollbackPath); err != nil {
+		return "", reopenGlobalDB(err)
+	}
+	if err := os.Rename(replacement, globalPath); err != nil {
+		return "", rollBackRestore(rollbackPath, err)
+	}
+
+	restored, err := Init(globalPath)
+	if err != nil {
+		return "", rollBackRestore(rollbackPath, err)
+	}
+	// The replaced database is the backup, don't take another one
+	if _, err := MigrateUp(restored, MigrateOptions{}); err != nil {
+		restored.Close()
+		return "", rollBackRestore(rollbackPath, err)
+	}
+
+	globalDB = restored
+	return rollbackPath, nil
+}
+
+// rollBackRestore puts the replaced database back after a failed restore and
+// reopens it. The caller holds the write lock.
+func rollBackRestore(rollbackPath string, cause error) error {
+	if err := os.Rename(rollbackPath, globalPath); err != nil {
+		return fmt.Errorf("restore failed: %v, and the old database could not be put back from %s: %w", cause, rollbackPath, err)
+	}
+	return reopenGlobalDB(cause)
+}
+
+// reopenGlobalDB opens the global database again after a failed restore and
+// returns the error that made the restore fail. The caller holds the write lock.
+func reopenGlobalDB(cause error) error {
+	conn, err := Init(globalPath)
+	if err != nil {
+		globalDB = nil
+		return fmt.Errorf("restore failed: %v, and the database could not be reopened: %w", cause, err)
+	}
+	globalDB = conn
+	return fmt.Errorf("restore failed: %w", cause)
+}
+
+// copyToTemp copies a file into a new private temporary file in dir
+func copyToTemp(src, dir string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	out, err := os.CreateTemp(dir, ".passvault-restore-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
@@ -0,0 +1,383 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"passvault/response"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration is a single versioned schema change. Up and Down run inside the
+// transaction the migration is applied in.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx) error
+	Down    func(tx *sql.Tx) error
+}
+
+// MigrationState reports whether a migration has been applied
+type MigrationState struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// MigrateOptions controls a migration run
+type MigrateOptions struct {
+	// DryRun runs every migration and rolls it back instead of committing
+	DryRun bool
+	// Backup copies the database next to itself before anything is changed
+	Backup bool
+	// Target is the version to migrate to, 0 means the latest version when
+	// migrating up and one version back when migrating down
+	Target int
+}
+
+// MigrationResult describes what a migration run did
+type MigrationResult struct {
+	From       int         `json:"from"`
+	To         int         `json:"to"`
+	Migrations []Migration `json:"-"`
+	BackupPath string      `json:"backup_path,omitempty"`
+	DryRun     bool        `json:"dry_run"`
+}
+
+// Migrations returns every known migration, SQL and Go, ordered by version
+func Migrations() ([]Migration, error) {
+	byVersion := map[int]*Migration{}
+	for _, m := range goMigrations {
+		if _, ok := byVersion[m.Version]; ok {
+			return nil, fmt.Errorf("duplicate migration version %d", m.Version)
+		}
+		byVersion[m.Version] = &m
+	}
+
+	files, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	sqlVersions := map[int]bool{}
+	for _, file := range files {
+		// Files are named <version>_<name>.<up|down>.sql
+		base := path.Base(file)
+		stem, direction, ok := strings.Cut(strings.TrimSuffix(base, ".sql"), ".")
+		versionStr, name, found := strings.Cut(stem, "_")
+		version, err := strconv.Atoi(versionStr)
+		if !ok || !found || err != nil || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %q", base)
+		}
+
+		m, exists := byVersion[version]
+		if exists && !sqlVersions[version] {
+			return nil, fmt.Errorf("duplicate migration version %d", version)
+		}
+		if !exists {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+			sqlVersions[version] = true
+		}
+
+		contents, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		step := sqlStep(string(contents))
+		if direction == "up" {
+			m.Up = step
+		} else {
+			m.Down = step
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == nil {
+			return nil, fmt.Errorf("migration %d has no up step", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// sqlStep turns the contents of a migration file into a migration step
+func sqlStep(statements string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(statements)
+		return err
+	}
+}
+
+// appliedMigrations returns when each applied migration was applied, by version
+func appliedMigrations(q Executor) (map[int]time.Time, error) {
+	var exists bool
+	err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_version')`).Scan(&exists)
+	if err != nil || !exists {
+		return map[int]time.Time{}, err
+	}
+
+	rows, err := q.Query(`SELECT version, applied_at FROM schema_version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// SchemaVersion returns the highest migration version applied to a database
+func SchemaVersion(db *sql.DB) (int, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return 0, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+	version := 0
+	for v := range applied {
+		version = max(version, v)
+	}
+	return version, nil
+}
+
+// LatestSchemaVersion returns the version the newest migration brings a database to
+func LatestSchemaVersion() (int, error) {
+	migrations, err := Migrations()
+	if err != nil || len(migrations) == 0 {
+		return 0, err
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// MigrationStatus lists every known migration and whether it has been applied
+func MigrationStatus(db *sql.DB) ([]MigrationState, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		state := MigrationState{Version: m.Version, Name: m.Name}
+		if appliedAt, ok := applied[m.Version]; ok {
+			state.Applied = true
+			state.AppliedAt = &appliedAt
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// MigrateUp applies every pending migration up to opts.Target
+func MigrateUp(db *sql.DB, opts MigrateOptions) (*MigrationResult, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+
+	var pending []Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok && (opts.Target == 0 || m.Version <= opts.Target) {
+			pending = append(pending, m)
+		}
+	}
+
+	return runMigrations(db, pending, true, opts)
+}
+
+// MigrateDown rolls back applied migrations, newest first, until only the
+// migrations up to opts.Target remain
+func MigrateDown(db *sql.DB, opts MigrateOptions) (*MigrationResult, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+
+	var rollback []Migration
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		// Without a target only the newest migration is rolled back
+		if opts.Target == 0 && len(rollback) == 1 {
+			break
+		}
+		if m.Version <= opts.Target {
+			break
+		}
+		if m.Down == nil {
+			return nil, fmt.Errorf("migration %d (%s) can't be rolled back", m.Version, m.Name)
+		}
+		rollback = append(rollback, m)
+	}
+
+	return runMigrations(db, rollback, false, opts)
+}
+
+// runMigrations applies or rolls back migrations in order, each in its own
+// transaction. Foreign keys are switched off on the connection for the run
+// so tables can be rebuilt without cascading deletes.
+func runMigrations(db *sql.DB, migrations []Migration, up bool, opts MigrateOptions) (*MigrationResult, error) {
+	from, err := SchemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	result := &MigrationResult{From: from, To: from, Migrations: migrations, DryRun: opts.DryRun}
+	if len(migrations) == 0 {
+		return result, nil
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+	defer conn.Close()
+
+	if opts.Backup && !opts.DryRun {
+		result.BackupPath, err = backupBeforeMigration(ctx, conn, from)
+		if err != nil {
+			return nil, fmt.Errorf("pre-migration backup failed: %w", err)
+		}
+	}
+
+	if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+	defer conn.ExecContext(ctx, `PRAGMA foreign_keys = ON`)
+
+	// A dry run applies everything in one transaction that is never
+	// committed, so later migrations see the changes of earlier ones
+	if opts.DryRun {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, response.WrapError(err, response.ErrDatabaseConnection)
+		}
+		defer tx.Rollback()
+
+		for _, m := range migrations {
+			if err := applyMigration(tx, m, up); err != nil {
+				return result, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+			}
+			result.To = targetVersion(m, up)
+		}
+		return result, nil
+	}
+
+	for _, m := range migrations {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return result, response.WrapError(err, response.ErrDatabaseConnection)
+		}
+		if err := applyMigration(tx, m, up); err != nil {
+			tx.Rollback()
+			return result, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return result, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		result.To = targetVersion(m, up)
+	}
+
+	result.To, err = SchemaVersion(db)
+	return result, err
+}
+
+// targetVersion is the schema version a database is at after running a migration
+func targetVersion(m Migration, up bool) int {
+	if up {
+		return m.Version
+	}
+	return m.Version - 1
+}
+
+// applyMigration runs a single migration step and records it in schema_version
+func applyMigration(tx *sql.Tx, m Migration, up bool) error {
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	if up {
+		if err := m.Up(tx); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)`, m.Version, m.Name, time.Now())
+	} else {
+		if err := m.Down(tx); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM schema_version WHERE version = ?`, m.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Foreign keys are off during the run, make sure nothing was left dangling
+	rows, err := tx.Query(`PRAGMA foreign_key_check`)
+	if err != nil {
+		return err
+	}
+	violation := rows.Next()
+	rows.Close()
+	if violation {
+		return fmt.Errorf("foreign key check failed")
+	}
+	return nil
+}
+
+// backupBeforeMigration copies the database file next to itself, tagged with
+// the schema version it had. In-memory databases are not backed up.
+func backupBeforeMigration(ctx context.Context, conn *sql.Conn, version int) (string, error) {
+	var seq int
+	var name, file string
+	err := conn.QueryRowContext(ctx, `SELECT seq, name, file FROM pragma_database_list WHERE name = 'main'`).Scan(&seq, &name, &file)
+	if err != nil || file == "" {
+		return "", err
+	}
+
+	backupPath := fmt.Sprintf("%s.v%d-%s.bak", file, version, time.Now().Format("20060102-150405"))
+	if _, err := conn.ExecContext(ctx, `VACUUM INTO ?`, backupPath); err != nil {
+		return "", err
+	}
+	return backupPath, os.Chmod(backupPath, 0600)
+}
@@ -0,0 +1,158 @@
+package db
+
+import (
+	"os"
+	"passvault/structs"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %d (%s) has version %d, want %d", i, m.Name, m.Version, i+1)
+		}
+		if m.Name == "" || m.Up == nil || m.Down == nil {
+			t.Errorf("migration %d is missing a name or a step", m.Version)
+		}
+	}
+}
+
+func TestMigrateRoundTrip(t *testing.T) {
+	conn := newTestDB(t)
+	latest, err := LatestSchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		run  func() (*MigrationResult, error)
+		want int
+	}{
+		{"one step back", func() (*MigrationResult, error) { return MigrateDown(conn, MigrateOptions{}) }, latest - 1},
+		{"back to the start", func() (*MigrationResult, error) { return MigrateDown(conn, MigrateOptions{Target: 1}) }, 1},
+		{"dry run", func() (*MigrationResult, error) { return MigrateUp(conn, MigrateOptions{DryRun: true}) }, 1},
+		{"up to a target", func() (*MigrationResult, error) { return MigrateUp(conn, MigrateOptions{Target: 3}) }, 3},
+		{"up to the latest", func() (*MigrationResult, error) { return MigrateUp(conn, MigrateOptions{}) }, latest},
+		{"nothing pending", func() (*MigrationResult, error) { return MigrateUp(conn, MigrateOptions{}) }, latest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			version, err := SchemaVersion(conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != tt.want {
+				t.Fatalf("SchemaVersion = %d, want %d", version, tt.want)
+			}
+			if result.DryRun && result.To <= result.From {
+				t.Fatalf("dry run went from %d to %d", result.From, result.To)
+			}
+		})
+	}
+
+	states, err := MigrationStatus(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range states {
+		if !state.Applied || state.AppliedAt == nil {
+			t.Errorf("migration %d is not applied", state.Version)
+		}
+	}
+
+	// The schema still works after going down and back up
+	id := mustInsert(t, conn, structs.Credential{Name: "mail", Username: "user", Password: "password", Tags: []string{"work"}})
+	if _, err := GetCredential(conn, id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateLegacyTags(t *testing.T) {
+	conn, err := Init(filepath.Join(t.TempDir(), "vault.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := MigrateUp(conn, MigrateOptions{Target: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := []struct {
+		tags string
+		want []string
+	}{
+		{`["work"," mail ","work"]`, []string{"mail", "work"}},
+		{`[]`, []string{}},
+		{`not json`, []string{}},
+		{``, []string{}},
+	}
+	for _, row := range rows {
+		_, err := conn.Exec(`INSERT INTO credentials (username, password, tags) VALUES ('user', 'password', ?)`, row.tags)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := MigrateUp(conn, MigrateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for i, row := range rows {
+		cred, err := GetCredential(conn, i+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(cred.Tags, row.want) {
+			t.Errorf("tags of %q = %q, want %q", row.tags, cred.Tags, row.want)
+		}
+		if cred.Name != "user" {
+			t.Errorf("name = %q, want the username", cred.Name)
+		}
+	}
+}
+
+func TestMigrateBackup(t *testing.T) {
+	dir := t.TempDir()
+	conn, err := Init(filepath.Join(dir, "vault.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := MigrateUp(conn, MigrateOptions{Target: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := MigrateUp(conn, MigrateOptions{Backup: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(result.BackupPath) != dir {
+		t.Fatalf("BackupPath = %q, want it next to the vault", result.BackupPath)
+	}
+	info, err := os.Stat(result.BackupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("backup mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	backup, err := Init(result.BackupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+	if version, err := SchemaVersion(backup); err != nil || version != 2 {
+		t.Fatalf("backup SchemaVersion = %d, %v, want 2", version, err)
+	}
+}
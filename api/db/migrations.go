@@ -0,0 +1,166 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+// goMigrations are the migrations that need more than plain SQL. They are
+// merged with the SQL files in migrations/ by version. Steps that older
+// databases may already have applied by hand check before changing anything.
+var goMigrations = []Migration{
+	{
+		Version: 2,
+		Name:    "add_credential_columns",
+		Up: func(tx *sql.Tx) error {
+			columns := []struct{ name, definition string }{
+				{"name", "TEXT NOT NULL DEFAULT ''"},
+				{"item_type", "TEXT NOT NULL DEFAULT 'login'"},
+				{"last_used_at", "DATETIME"},
+			}
+			for _, column := range columns {
+				if err := addColumnIfMissing(tx, "credentials", column.name, column.definition); err != nil {
+					return err
+				}
+			}
+
+			// Older rows have no name, fall back to the username
+			_, err := tx.Exec(`UPDATE credentials SET name = username WHERE name = ''`)
+			return err
+		},
+		Down: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+				ALTER TABLE credentials DROP COLUMN name;
+				ALTER TABLE credentials DROP COLUMN item_type;
+				ALTER TABLE credentials DROP COLUMN last_used_at;
+			`)
+			return err
+		},
+	},
+	{
+		Version: 4,
+		Name:    "migrate_legacy_tags",
+		Up:      migrateLegacyTags,
+		Down: func(tx *sql.Tx) error {
+			// Put the tags back into the JSON column older versions read
+			_, err := tx.Exec(`
+				UPDATE credentials SET tags = (
+					SELECT json_group_array(t.name ORDER BY t.name)
+					FROM credential_tags ct JOIN tags t ON t.id = ct.tag_id
+					WHERE ct.credential_id = credentials.id
+				);
+				DELETE FROM credential_tags;
+				DELETE FROM tags;
+			`)
+			return err
+		},
+	},
+	{
+		Version: 5,
+		Name:    "create_folders",
+		Up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+				CREATE TABLE IF NOT EXISTS folders (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					name TEXT NOT NULL,
+					parent_id INTEGER REFERENCES folders(id) ON DELETE CASCADE,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					deleted_at DATETIME
+				);
+				CREATE INDEX IF NOT EXISTS idx_folders_parent_id ON folders(parent_id);
+			`)
+			if err != nil {
+				return err
+			}
+
+			if err := addColumnIfMissing(tx, "credentials", "folder_id", "INTEGER REFERENCES folders(id) ON DELETE SET NULL"); err != nil {
+				return err
+			}
+			if err := addColumnIfMissing(tx, "credentials", "deleted_at", "DATETIME"); err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_credentials_folder_id ON credentials(folder_id)`)
+			return err
+		},
+		Down: func(tx *sql.Tx) error {
+			// SQLite can't drop a column with a foreign key, rebuild the table
+			// instead. Older versions have no trash, trashed credentials come back.
+			_, err := tx.Exec(`
+				DROP INDEX IF EXISTS idx_credentials_folder_id;
+				CREATE TABLE credentials_old (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					username TEXT NOT NULL,
+					password TEXT NOT NULL,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					description TEXT,
+					tags TEXT,
+					name TEXT NOT NULL DEFAULT '',
+					item_type TEXT NOT NULL DEFAULT 'login',
+					last_used_at DATETIME
+				);
+				INSERT INTO credentials_old (id, username, password, created_at, updated_at, description, tags, name, item_type, last_used_at)
+					SELECT id, username, password, created_at, updated_at, description, tags, name, item_type, last_used_at
+					FROM credentials;
+				DROP TABLE credentials;
+				ALTER TABLE credentials_old RENAME TO credentials;
+				DROP INDEX IF EXISTS idx_folders_parent_id;
+				DROP TABLE folders;
+			`)
+			return err
+		},
+	},
+}
+
+// addColumnIfMissing adds a column to a table unless it already exists
+func addColumnIfMissing(tx *sql.Tx, table, column, definition string) error {
+	var exists bool
+	err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM pragma_table_info(?) WHERE name = ?)`, table, column).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + definition)
+	return err
+}
+
+// migrateLegacyTags moves tags stored as JSON in the credentials.tags column
+// into the tags and credential_tags tables. Migrated rows have the column
+// cleared, so only rows written by older versions are picked up.
+func migrateLegacyTags(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id, tags FROM credentials WHERE tags IS NOT NULL`)
+	if err != nil {
+		return err
+	}
+
+	legacy := map[int64][]string{}
+	for rows.Next() {
+		var id int64
+		var tagsJSON string
+		if err := rows.Scan(&id, &tagsJSON); err != nil {
+			rows.Close()
+			return err
+		}
+		var tags []string
+		if tagsJSON != "" {
+			// Unreadable tags can't be recovered, drop them rather than fail the migration
+			_ = json.Unmarshal([]byte(tagsJSON), &tags)
+		}
+		legacy[id] = tags
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, tags := range legacy {
+		if err := setCredentialTags(tx, id, tags); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE credentials SET tags = NULL WHERE tags IS NOT NULL`)
+	return err
+}
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS credentials (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT NOT NULL,
+	password TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	description TEXT,
+	tags TEXT
+);
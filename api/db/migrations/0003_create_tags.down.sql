@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_credential_tags_tag_id;
+DROP TABLE IF EXISTS credential_tags;
+DROP TABLE IF EXISTS tags;
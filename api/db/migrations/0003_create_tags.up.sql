@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS tags (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS credential_tags (
+	credential_id INTEGER NOT NULL REFERENCES credentials(id) ON DELETE CASCADE,
+	tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+	PRIMARY KEY (credential_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_credential_tags_tag_id ON credential_tags(tag_id);
@@ -0,0 +1,2 @@
+ALTER TABLE credentials DROP COLUMN attachments;
+ALTER TABLE credentials DROP COLUMN fields;
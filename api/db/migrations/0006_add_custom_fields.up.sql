@@ -0,0 +1,2 @@
+ALTER TABLE credentials ADD COLUMN fields TEXT;
+ALTER TABLE credentials ADD COLUMN attachments TEXT;
@@ -0,0 +1,2 @@
+ALTER TABLE credentials DROP COLUMN totp;
+ALTER TABLE credentials DROP COLUMN urls;
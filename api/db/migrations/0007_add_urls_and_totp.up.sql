@@ -0,0 +1,2 @@
+ALTER TABLE credentials ADD COLUMN urls TEXT;
+ALTER TABLE credentials ADD COLUMN totp TEXT;
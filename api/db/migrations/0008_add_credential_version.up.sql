@@ -0,0 +1 @@
+ALTER TABLE credentials ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"passvault/response"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	// snapshotPagesPerStep is how many pages are copied before writers get a turn
+	snapshotPagesPerStep = 256
+	// snapshotPause is how long a snapshot waits between steps
+	snapshotPause = 5 * time.Millisecond
+)
+
+// Snapshot copies the database into a new SQLite file at path through the
+// SQLite online backup API. The copy is consistent even while the database
+// is being written to, pages are copied in small steps so writers are only
+// held up briefly.
+func Snapshot(src *sql.DB, path string) error {
+	if src == nil {
+		return response.WrapError(errors.New("database not initialized"), response.ErrDatabaseConnection)
+	}
+
+	// The copy holds secrets too, create it private before SQLite opens it
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	file.Close()
+
+	dest, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	ctx := context.Background()
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return response.WrapError(err, response.ErrDatabaseConnection)
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destDriver any) error {
+		return srcConn.Raw(func(srcDriver any) error {
+			destSQLite, destOK := destDriver.(*sqlite3.SQLiteConn)
+			srcSQLite, srcOK := srcDriver.(*sqlite3.SQLiteConn)
+			if !destOK || !srcOK {
+				return errors.New("snapshots need a go-sqlite3 connection")
+			}
+
+			backup, err := destSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return err
+			}
+			for {
+				done, err := backup.Step(snapshotPagesPerStep)
+				if err != nil {
+					backup.Finish()
+					return err
+				}
+				if done {
+					break
+				}
+				time.Sleep(snapshotPause)
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+// IntegrityCheck runs SQLite's integrity check on the database file at path
+// and returns its schema version. The file is opened read only.
+func IntegrityCheck(path string) (int, error) {
+	conn, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	var result string
+	if err := conn.QueryRow(`PRAGMA integrity_check`).Scan(&result); err != nil {
+		return 0, err
+	}
+	if result != "ok" {
+		return 0, errors.New("integrity check failed: " + result)
+	}
+	return SchemaVersion(conn)
+}
@@ -0,0 +1,208 @@
+package db
+
+import (
+	"database/sql"
+	"passvault/response"
+	"passvault/structs"
+	"slices"
+	"strings"
+	"time"
+)
+
+// tagsColumn selects the tags of a credential as a JSON array, sorted by name
+const tagsColumn = `(SELECT json_group_array(t.name ORDER BY t.name)
+		FROM credential_tags ct JOIN tags t ON t.id = ct.tag_id
+		WHERE ct.credential_id = credentials.id) AS tags`
+
+// NormalizeTags trims tags, drops empty ones and removes duplicates
+func NormalizeTags(tags []string) []string {
+	normalized := []string{}
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// setCredentialTags replaces the tags of a credential, creating missing tags
+func setCredentialTags(tx Executor, credentialID int64, tags []string) error {
+	if _, err := tx.Exec(`DELETE FROM credential_tags WHERE credential_id = ?`, credentialID); err != nil {
+		return err
+	}
+
+	for _, tag := range NormalizeTags(tags) {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO tags (name) VALUES (?)`, tag); err != nil {
+			return err
+		}
+		_, err := tx.Exec(
+			`INSERT OR IGNORE INTO credential_tags (credential_id, tag_id)
+			SELECT ?, id FROM tags WHERE name = ?`,
+			credentialID, tag,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pruneTags removes tags that are no longer attached to any credential
+func pruneTags(tx Executor) error {
+	_, err := tx.Exec(`DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM credential_tags)`)
+	return err
+}
+
+// touchTaggedCredentials bumps updated_at on every credential carrying a tag
+func touchTaggedCredentials(tx Executor, tagID int64) error {
+	_, err := tx.Exec(
+		`UPDATE credentials SET updated_at = ?
+		WHERE id IN (SELECT credential_id FROM credential_tags WHERE tag_id = ?)`,
+		time.Now(), tagID,
+	)
+	return err
+}
+
+// lookupTag returns the ID of a tag by name
+func lookupTag(tx Executor, name string) (int64, error) {
+	var id int64
+	err := tx.QueryRow(`SELECT id FROM tags WHERE name = ?`, name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, response.ErrTagNotFound
+	}
+	if err != nil {
+		return 0, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+	return id, nil
+}
+
+// GetTags retrieves every tag together with the number of credentials using it
+func GetTags(db Executor) ([]structs.Tag, error) {
+	query := `
+		SELECT t.name, COUNT(ct.credential_id)
+		FROM tags t LEFT JOIN credential_tags ct ON ct.tag_id = t.id
+		GROUP BY t.id ORDER BY t.name
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+	defer rows.Close()
+
+	tags := []structs.Tag{}
+	for rows.Next() {
+		var tag structs.Tag
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, response.WrapError(err, response.ErrDatabaseConnection)
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, response.WrapError(err, response.ErrDatabaseConnection)
+	}
+
+	return tags, nil
+}
+
+// RenameTag renames a tag on every credential using it
+func RenameTag(db Executor, oldName, newName string) error {
+	newName = strings.TrimSpace(newName)
+	if newName == "" {
+		return response.ErrInvalidTag
+	}
+
+	return withTx(db, func(tx Executor) error {
+		id, err := lookupTag(tx, oldName)
+		if err != nil {
+			return err
+		}
+		if oldName == newName {
+			return nil
+		}
+
+		// Renaming onto an existing tag is a merge, make the caller ask for it
+		if _, err := lookupTag(tx, newName); err == nil {
+			return response.ErrTagExists
+		} else if err != response.ErrTagNotFound {
+			return err
+		}
+
+		if _, err := tx.Exec(`UPDATE tags SET name = ? WHERE id = ?`, newName, id); err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+		if err := touchTaggedCredentials(tx, id); err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+
+		return nil
+	})
+}
+
+// MergeTags moves every credential tagged with one of the sources onto the
+// target tag and removes the sources. The target is created if needed.
+func MergeTags(db Executor, sources []string, target string) error {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return response.ErrInvalidTag
+	}
+
+	return withTx(db, func(tx Executor) error {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO tags (name) VALUES (?)`, target); err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+		targetID, err := lookupTag(tx, target)
+		if err != nil {
+			return err
+		}
+
+		for _, source := range NormalizeTags(sources) {
+			if source == target {
+				continue
+			}
+			sourceID, err := lookupTag(tx, source)
+			if err != nil {
+				return err
+			}
+			if err := touchTaggedCredentials(tx, sourceID); err != nil {
+				return response.WrapError(err, response.ErrDatabaseConnection)
+			}
+			_, err = tx.Exec(
+				`INSERT OR IGNORE INTO credential_tags (credential_id, tag_id)
+				SELECT credential_id, ? FROM credential_tags WHERE tag_id = ?`,
+				targetID, sourceID,
+			)
+			if err != nil {
+				return response.WrapError(err, response.ErrDatabaseConnection)
+			}
+			if _, err := tx.Exec(`DELETE FROM tags WHERE id = ?`, sourceID); err != nil {
+				return response.WrapError(err, response.ErrDatabaseConnection)
+			}
+		}
+
+		if err := pruneTags(tx); err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+
+		return nil
+	})
+}
+
+// DeleteTag removes a tag from every credential using it
+func DeleteTag(db Executor, name string) error {
+	return withTx(db, func(tx Executor) error {
+		id, err := lookupTag(tx, name)
+		if err != nil {
+			return err
+		}
+		if err := touchTaggedCredentials(tx, id); err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+		if _, err := tx.Exec(`DELETE FROM tags WHERE id = ?`, id); err != nil {
+			return response.WrapError(err, response.ErrDatabaseConnection)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"errors"
+	"passvault/response"
+	"passvault/structs"
+	"slices"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		in, want []string
+	}{
+		{nil, []string{}},
+		{[]string{" work ", "", "  "}, []string{"work"}},
+		{[]string{"b", "a", "b", " a"}, []string{"b", "a"}},
+		{[]string{"Work", "work"}, []string{"Work", "work"}},
+	}
+	for _, tt := range tests {
+		if got := NormalizeTags(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("NormalizeTags(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// tagsOf returns the tags of a credential
+func tagsOf(t *testing.T, q Executor, id int) []string {
+	t.Helper()
+	cred, err := GetCredential(q, id)
+	if err != nil {
+		t.Fatalf("GetCredential(%d): %v", id, err)
+	}
+	return cred.Tags
+}
+
+func TestTagManagement(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(q Executor) error
+		err     error
+		mail    []string
+		bank    []string
+		counted []structs.Tag
+	}{
+		{
+			name:    "unchanged",
+			change:  func(q Executor) error { return nil },
+			mail:    []string{"email", "personal"},
+			bank:    []string{"finance", "personal"},
+			counted: []structs.Tag{{Name: "email", Count: 1}, {Name: "finance", Count: 1}, {Name: "personal", Count: 2}},
+		},
+		{
+			name:    "rename",
+			change:  func(q Executor) error { return RenameTag(q, "personal", " private ") },
+			mail:    []string{"email", "private"},
+			bank:    []string{"finance", "private"},
+			counted: []structs.Tag{{Name: "email", Count: 1}, {Name: "finance", Count: 1}, {Name: "private", Count: 2}},
+		},
+		{
+			name:   "rename onto an existing tag",
+			change: func(q Executor) error { return RenameTag(q, "email", "finance") },
+			err:    response.ErrTagExists,
+		},
+		{
+			name:   "rename a missing tag",
+			change: func(q Executor) error { return RenameTag(q, "work", "job") },
+			err:    response.ErrTagNotFound,
+		},
+		{
+			name:   "rename to nothing",
+			change: func(q Executor) error { return RenameTag(q, "email", " ") },
+			err:    response.ErrInvalidTag,
+		},
+		{
+			name:    "merge into a new tag",
+			change:  func(q Executor) error { return MergeTags(q, []string{"email", "finance"}, "accounts") },
+			mail:    []string{"accounts", "personal"},
+			bank:    []string{"accounts", "personal"},
+			counted: []structs.Tag{{Name: "accounts", Count: 2}, {Name: "personal", Count: 2}},
+		},
+		{
+			name:    "merge into a source",
+			change:  func(q Executor) error { return MergeTags(q, []string{"email", "personal"}, "personal") },
+			mail:    []string{"personal"},
+			bank:    []string{"finance", "personal"},
+			counted: []structs.Tag{{Name: "finance", Count: 1}, {Name: "personal", Count: 2}},
+		},
+		{
+			name:   "merge a missing tag",
+			change: func(q Executor) error { return MergeTags(q, []string{"email", "work"}, "personal") },
+			err:    response.ErrTagNotFound,
+		},
+		{
+			name:    "delete",
+			change:  func(q Executor) error { return DeleteTag(q, "personal") },
+			mail:    []string{"email"},
+			bank:    []string{"finance"},
+			counted: []structs.Tag{{Name: "email", Count: 1}, {Name: "finance", Count: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newTestDB(t)
+			mail := mustInsert(t, conn, structs.Credential{Name: "mail", Username: "user", Password: "password", Tags: []string{"personal", "email"}})
+			bank := mustInsert(t, conn, structs.Credential{Name: "bank", Username: "user", Password: "password", Tags: []string{"finance", "personal"}})
+
+			err := tt.change(conn)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("err = %v, want %v", err, tt.err)
+				}
+				// Failed changes leave the tags alone
+				tt.mail, tt.bank = []string{"email", "personal"}, []string{"finance", "personal"}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := tagsOf(t, conn, mail); !slices.Equal(got, tt.mail) {
+				t.Errorf("mail tags = %q, want %q", got, tt.mail)
+			}
+			if got := tagsOf(t, conn, bank); !slices.Equal(got, tt.bank) {
+				t.Errorf("bank tags = %q, want %q", got, tt.bank)
+			}
+			if tt.counted != nil {
+				tags, err := GetTags(conn)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !slices.Equal(tags, tt.counted) {
+					t.Errorf("GetTags = %v, want %v", tags, tt.counted)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateCredentialPrunesTags(t *testing.T) {
+	conn := newTestDB(t)
+	id := mustInsert(t, conn, structs.Credential{Name: "mail", Username: "user", Password: "password", Tags: []string{"old"}})
+	cred, err := GetCredential(conn, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred.Tags = []string{"new", "new "}
+	if err := UpdateCredential(conn, id, *cred); err != nil {
+		t.Fatal(err)
+	}
+	tags, err := GetTags(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []structs.Tag{{Name: "new", Count: 1}}; !slices.Equal(tags, want) {
+		t.Fatalf("GetTags = %v, want %v", tags, want)
+	}
+}
@@ -0,0 +1,35 @@
+package db
+
+import (
+	"database/sql"
+	"passvault/response"
+)
+
+// Executor is implemented by both *sql.DB and *sql.Tx, so every query
+// function can run on its own or as part of a larger transaction
+type Executor interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// withTx runs fn in a transaction. When db is already a transaction fn joins
+// it and the caller decides whether to commit.
+func withTx(db Executor, fn func(tx Executor) error) error {
+	conn, ok := db.(*sql.DB)
+	if !ok {
+		return fn(db)
+	}
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return response.WrapError(err, response.ErrDatabaseConnection)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return response.WrapError(tx.Commit(), response.ErrDatabaseConnection)
+}
@@ -0,0 +1,87 @@
+package backups
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"passvault/backup"
+	"passvault/response"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// backupErrorResponse maps backup errors onto their HTTP status
+func backupErrorResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, response.ErrBackupNotFound):
+		response.NotFoundResponse(&w, err.Error())
+	case errors.Is(err, response.ErrBackupKeyRequired):
+		response.ErrorResponse(&w, http.StatusConflict, err.Error())
+	case errors.Is(err, response.ErrBackupInvalid):
+		response.ErrorResponse(&w, http.StatusUnprocessableEntity, err.Error())
+	default:
+		response.ErrorResponse(&w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// CreateBackup takes a backup of the database right away
+func (h *Handler) CreateBackup(w http.ResponseWriter, r *http.Request) {
+	backup, err := h.backups.Create()
+	if err != nil {
+		backupErrorResponse(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(backup)
+}
+
+// GetBackups lists every backup, newest first
+func (h *Handler) GetBackups(w http.ResponseWriter, r *http.Request) {
+	backups, err := h.backups.List()
+	if err != nil {
+		backupErrorResponse(w, err)
+		return
+	}
+
+	response.SuccessResponse(&w, backups)
+}
+
+// DownloadBackup streams a backup file as it is stored on disk
+func (h *Handler) DownloadBackup(w http.ResponseWriter, r *http.Request) {
+	file, info, err := h.backups.Open(chi.URLParam(r, "name"))
+	if err != nil {
+		backupErrorResponse(w, err)
+		return
+	}
+	defer file.Close()
+
+	fileName := backup.FileName(info)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+fileName+`"`)
+	http.ServeContent(w, r, fileName, info.CreatedAt, file)
+}
+
+// VerifyBackup checks the checksum, encryption, compression and database
+// integrity of a backup
+func (h *Handler) VerifyBackup(w http.ResponseWriter, r *http.Request) {
+	result, err := h.backups.Verify(chi.URLParam(r, "name"))
+	if err != nil {
+		backupErrorResponse(w, err)
+		return
+	}
+
+	response.SuccessResponse(&w, result)
+}
+
+// RestoreBackup verifies a backup and swaps it in for the live database
+func (h *Handler) RestoreBackup(w http.ResponseWriter, r *http.Request) {
+	result, err := h.backups.Restore(chi.URLParam(r, "name"))
+	if err != nil {
+		backupErrorResponse(w, err)
+		return
+	}
+
+	response.SuccessResponse(&w, result)
+}
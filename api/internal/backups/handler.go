@@ -0,0 +1,15 @@
+package backups
+
+import (
+	"passvault/backup"
+)
+
+// Handler serves the backup endpoints
+type Handler struct {
+	backups *backup.Manager
+}
+
+// NewHandler returns a handler backed by the given backup manager
+func NewHandler(m *backup.Manager) *Handler {
+	return &Handler{backups: m}
+}
@@ -2,15 +2,21 @@ package credentials
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"passvault/db"
+	"passvault/response"
+	"passvault/structs"
+	"passvault/urlmatch"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 )
 
 // GetCredential retrieves a single credential by ID
-func GetCredential(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetCredential(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -18,17 +24,20 @@ func GetCredential(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get the global database connection
-	database := db.GetDB()
-	if database == nil {
-		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+	// Get credential from the store
+	credential, err := h.store.GetCredential(id)
+	if errors.Is(err, response.ErrCredentialNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
-
-	// Get credential from database
-	credential, err := db.GetCredential(database, id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Record the access for the last used sort order
+	if err := h.store.TouchCredential(id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -37,29 +46,107 @@ func GetCredential(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(credential)
 }
 
-// GetAllCredentials retrieves all credentials
-func GetAllCredentials(w http.ResponseWriter, r *http.Request) {
-	// Get the global database connection
-	database := db.GetDB()
-	if database == nil {
-		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+// GetAllCredentials retrieves a page of credentials, sorted and filtered by the query parameters
+func (h *Handler) GetAllCredentials(w http.ResponseWriter, r *http.Request) {
+	opts, fieldErrors := parseListOptions(r.URL.Query())
+	if len(fieldErrors) > 0 {
+		response.ValidationErrorResponse(&w, "Invalid query parameters", fieldErrors)
 		return
 	}
 
-	// Get all credentials from database
-	credentials, err := db.GetAllCredentials(database)
+	// Get the requested page from the store
+	page, err := h.store.ListCredentials(opts)
+	if errors.Is(err, response.ErrInvalidCursor) {
+		response.ValidationErrorResponse(&w, "Invalid query parameters", []response.FieldError{
+			{Field: "cursor", Message: err.Error()},
+		})
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.ErrorResponse(&w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	// Return credentials
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(credentials)
+	response.SuccessResponse(&w, page)
+}
+
+// SearchCredentials finds credentials whose name, username, description or
+// tags contain the q query parameter, best matches first
+func (h *Handler) SearchCredentials(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var fieldErrors []response.FieldError
+	if query.Get("q") == "" {
+		fieldErrors = append(fieldErrors, response.FieldError{Field: "q", Message: "is required"})
+	}
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > db.MaxListLimit {
+			fieldErrors = append(fieldErrors, response.FieldError{
+				Field:   "limit",
+				Message: "must be a number between 1 and " + strconv.Itoa(db.MaxListLimit),
+			})
+		}
+		limit = n
+	}
+	if len(fieldErrors) > 0 {
+		response.ValidationErrorResponse(&w, "Invalid query parameters", fieldErrors)
+		return
+	}
+
+	credentials, err := h.store.SearchCredentials(query.Get("q"), limit)
+	if err != nil {
+		response.ErrorResponse(&w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SuccessResponse(&w, credentials)
+}
+
+// MatchCredentials finds the live credentials to fill in on the page at the
+// url query parameter, best matches first. Every credential matches with the
+// strategy of its match field.
+func (h *Handler) MatchCredentials(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var fieldErrors []response.FieldError
+	page, err := urlmatch.ParsePage(query.Get("url"))
+	if err != nil {
+		fieldErrors = append(fieldErrors, response.FieldError{Field: "url", Message: err.Error()})
+	}
+	itemType := query.Get("type")
+	if itemType != "" && !slices.Contains(structs.ItemTypes, itemType) {
+		fieldErrors = append(fieldErrors, response.FieldError{
+			Field:   "type",
+			Message: "must be one of " + strings.Join(structs.ItemTypes, ", "),
+		})
+	}
+	if len(fieldErrors) > 0 {
+		response.ValidationErrorResponse(&w, "Invalid query parameters", fieldErrors)
+		return
+	}
+
+	// Every live credential is a candidate, read a page at a time
+	var credentials []structs.Credential
+	opts := structs.ListOptions{Limit: db.MaxListLimit, ItemType: itemType}
+	for {
+		list, err := h.store.ListCredentials(opts)
+		if err != nil {
+			response.ErrorResponse(&w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		credentials = append(credentials, list.Credentials...)
+		if list.NextCursor == "" {
+			break
+		}
+		opts.Cursor = list.NextCursor
+	}
+
+	response.SuccessResponse(&w, urlmatch.Find(credentials, page))
 }
 
 // DeleteCredential deletes a credential by ID
-func DeleteCredential(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeleteCredential(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -67,16 +154,14 @@ func DeleteCredential(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get the global database connection
-	database := db.GetDB()
-	if database == nil {
-		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+	// Delete credential from the store
+	err = h.store.DeleteCredential(id)
+	if errors.Is(err, response.ErrCredentialNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
-
-	// Delete credential from database
-	if err := db.DeleteCredential(database, id); err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -0,0 +1,15 @@
+package credentials
+
+import (
+	"passvault/store"
+)
+
+// Handler serves the credential endpoints
+type Handler struct {
+	store store.CredentialStore
+}
+
+// NewHandler returns a handler backed by the given store
+func NewHandler(s store.CredentialStore) *Handler {
+	return &Handler{store: s}
+}
@@ -0,0 +1,143 @@
+package credentials
+
+import (
+	"net/url"
+	"passvault/db"
+	"passvault/response"
+	"passvault/structs"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseListOptions reads the pagination, sorting and filtering query
+// parameters of the credential list. Every invalid parameter is reported.
+func parseListOptions(query url.Values) (structs.ListOptions, []response.FieldError) {
+	var opts structs.ListOptions
+	var fieldErrors []response.FieldError
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > db.MaxListLimit {
+			fieldErrors = append(fieldErrors, response.FieldError{
+				Field:   "limit",
+				Message: "must be a number between 1 and " + strconv.Itoa(db.MaxListLimit),
+			})
+		}
+		opts.Limit = limit
+	}
+
+	opts.Cursor = query.Get("cursor")
+
+	opts.SortBy = query.Get("sort")
+	sortFields := []string{structs.SortByName, structs.SortByCreated, structs.SortByUpdated, structs.SortByLastUsed}
+	if opts.SortBy != "" && !slices.Contains(sortFields, opts.SortBy) {
+		fieldErrors = append(fieldErrors, response.FieldError{
+			Field:   "sort",
+			Message: "must be one of " + strings.Join(sortFields, ", "),
+		})
+	}
+
+	opts.SortOrder = strings.ToLower(query.Get("order"))
+	if opts.SortOrder != "" && opts.SortOrder != structs.SortAsc && opts.SortOrder != structs.SortDesc {
+		fieldErrors = append(fieldErrors, response.FieldError{Field: "order", Message: "must be asc or desc"})
+	}
+
+	// Tags may be repeated or comma separated
+	for _, value := range query["tag"] {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" && !slices.Contains(opts.Tags, tag) {
+				opts.Tags = append(opts.Tags, tag)
+			}
+		}
+	}
+
+	opts.TagMatch = strings.ToLower(query.Get("tag_match"))
+	if opts.TagMatch != "" && opts.TagMatch != structs.TagMatchAny && opts.TagMatch != structs.TagMatchAll {
+		fieldErrors = append(fieldErrors, response.FieldError{Field: "tag_match", Message: "must be any or all"})
+	}
+
+	opts.ItemType = query.Get("type")
+	if opts.ItemType != "" && !slices.Contains(structs.ItemTypes, opts.ItemType) {
+		fieldErrors = append(fieldErrors, response.FieldError{
+			Field:   "type",
+			Message: "must be one of " + strings.Join(structs.ItemTypes, ", "),
+		})
+	}
+
+	// Folder scoping, "none" selects credentials outside any folder
+	if value := query.Get("folder"); value != "" {
+		folderID := 0
+		if value != "none" {
+			id, err := strconv.Atoi(value)
+			if err != nil || id < 1 {
+				fieldErrors = append(fieldErrors, response.FieldError{Field: "folder", Message: "must be a folder ID or none"})
+			}
+			folderID = id
+		}
+		opts.FolderID = &folderID
+	}
+
+	flags := []struct {
+		field string
+		dest  *bool
+	}{
+		{"recursive", &opts.IncludeSubfolders},
+		{"trashed", &opts.Trashed},
+	}
+	for _, f := range flags {
+		value := query.Get(f.field)
+		if value == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			fieldErrors = append(fieldErrors, response.FieldError{Field: f.field, Message: "must be true or false"})
+			continue
+		}
+		*f.dest = b
+	}
+
+	ranges := []struct {
+		field string
+		dest  **time.Time
+	}{
+		{"created_after", &opts.CreatedAfter},
+		{"created_before", &opts.CreatedBefore},
+		{"updated_after", &opts.UpdatedAfter},
+		{"updated_before", &opts.UpdatedBefore},
+	}
+	for _, r := range ranges {
+		value := query.Get(r.field)
+		if value == "" {
+			continue
+		}
+		t, err := parseTime(value)
+		if err != nil {
+			fieldErrors = append(fieldErrors, response.FieldError{
+				Field:   r.field,
+				Message: "must be an RFC 3339 timestamp or a YYYY-MM-DD date",
+			})
+			continue
+		}
+		*r.dest = &t
+	}
+
+	if opts.CreatedAfter != nil && opts.CreatedBefore != nil && !opts.CreatedAfter.Before(*opts.CreatedBefore) {
+		fieldErrors = append(fieldErrors, response.FieldError{Field: "created_before", Message: "must be after created_after"})
+	}
+	if opts.UpdatedAfter != nil && opts.UpdatedBefore != nil && !opts.UpdatedAfter.Before(*opts.UpdatedBefore) {
+		fieldErrors = append(fieldErrors, response.FieldError{Field: "updated_before", Message: "must be after updated_after"})
+	}
+
+	return opts, fieldErrors
+}
+
+// parseTime accepts either a full RFC 3339 timestamp or a plain date
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
@@ -0,0 +1,101 @@
+package credentials
+
+import (
+	"net/url"
+	"passvault/structs"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseListOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		check  func(t *testing.T, opts structs.ListOptions)
+		errors []string
+	}{
+		{
+			name:  "empty",
+			query: "",
+			check: func(t *testing.T, opts structs.ListOptions) {
+				if opts.Limit != 0 || opts.SortBy != "" || opts.FolderID != nil {
+					t.Errorf("opts = %+v, want zero", opts)
+				}
+			},
+		},
+		{
+			name:  "paging and sorting",
+			query: "limit=20&cursor=abc&sort=name&order=ASC",
+			check: func(t *testing.T, opts structs.ListOptions) {
+				if opts.Limit != 20 || opts.Cursor != "abc" || opts.SortBy != structs.SortByName || opts.SortOrder != structs.SortAsc {
+					t.Errorf("opts = %+v", opts)
+				}
+			},
+		},
+		{
+			name:  "repeated and comma separated tags",
+			query: "tag=work,%20mail&tag=work&tag=&tag_match=all",
+			check: func(t *testing.T, opts structs.ListOptions) {
+				if !slices.Equal(opts.Tags, []string{"work", "mail"}) || opts.TagMatch != structs.TagMatchAll {
+					t.Errorf("tags = %q match %q", opts.Tags, opts.TagMatch)
+				}
+			},
+		},
+		{
+			name:  "folder outside any folder",
+			query: "folder=none&recursive=true",
+			check: func(t *testing.T, opts structs.ListOptions) {
+				if opts.FolderID == nil || *opts.FolderID != 0 || !opts.IncludeSubfolders {
+					t.Errorf("opts = %+v", opts)
+				}
+			},
+		},
+		{
+			name:  "date and timestamp",
+			query: "created_after=2025-01-02&created_before=2025-02-01T10:00:00%2B02:00",
+			check: func(t *testing.T, opts structs.ListOptions) {
+				if !opts.CreatedAfter.Equal(time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)) {
+					t.Errorf("created_after = %v", opts.CreatedAfter)
+				}
+				if !opts.CreatedBefore.Equal(time.Date(2025, 2, 1, 8, 0, 0, 0, time.UTC)) {
+					t.Errorf("created_before = %v", opts.CreatedBefore)
+				}
+			},
+		},
+		{
+			name:   "every invalid parameter",
+			query:  "limit=0&sort=password&order=up&tag_match=some&type=car&folder=-1&trashed=maybe&updated_after=yesterday",
+			errors: []string{"limit", "sort", "order", "tag_match", "type", "folder", "trashed", "updated_after"},
+		},
+		{
+			name:   "limit too large",
+			query:  "limit=501",
+			errors: []string{"limit"},
+		},
+		{
+			name:   "empty range",
+			query:  "created_after=2025-01-02&created_before=2025-01-02&updated_after=2025-03-01&updated_before=2025-02-01",
+			errors: []string{"created_before", "updated_before"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts, fieldErrors := parseListOptions(query)
+			var fields []string
+			for _, e := range fieldErrors {
+				fields = append(fields, e.Field)
+			}
+			if !slices.Equal(fields, tt.errors) {
+				t.Fatalf("errors on %q, want %q", fields, tt.errors)
+			}
+			if tt.check != nil {
+				tt.check(t, opts)
+			}
+		})
+	}
+}
@@ -2,13 +2,14 @@ package credentials
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
-	"passvault/db"
+	"passvault/response"
 	"passvault/structs"
 	"passvault/validate"
 )
 
-func StoreCredential(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) StoreCredential(w http.ResponseWriter, r *http.Request) {
 	// Parse the request body into a Credential struct
 	var credential structs.Credential
 	if err := json.NewDecoder(r.Body).Decode(&credential); err != nil {
@@ -22,15 +23,13 @@ func StoreCredential(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get the global database connection
-	database := db.GetDB()
-	if database == nil {
-		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+	// Insert data into the store
+	id, err := h.store.CreateCredential(credential)
+	if errors.Is(err, response.ErrFolderNotFound) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	// Insert data into the database
-	if err := db.InsertCredential(database, credential); err != nil {
+	if err != nil {
 		http.Error(w, "Failed to store credential: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -38,7 +37,8 @@ func StoreCredential(w http.ResponseWriter, r *http.Request) {
 	// Return success response
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{
+	json.NewEncoder(w).Encode(map[string]any{
 		"message": "Credential stored successfully",
+		"id":      id,
 	})
 }
@@ -0,0 +1,57 @@
+package credentials
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"passvault/response"
+	"passvault/structs"
+	"passvault/validate"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// UpdateCredential replaces a credential, including its tags and folder
+func (h *Handler) UpdateCredential(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid credential ID", http.StatusBadRequest)
+		return
+	}
+
+	// Parse the request body into a Credential struct
+	var credential structs.Credential
+	if err := json.NewDecoder(r.Body).Decode(&credential); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request body with the validator package
+	if err := validate.NewValidateCredential().Validate(credential); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Update the credential in the store
+	err = h.store.UpdateCredential(id, credential)
+	switch {
+	case errors.Is(err, response.ErrCredentialNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, response.ErrFolderNotFound):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, "Failed to update credential: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Credential updated successfully",
+	})
+}
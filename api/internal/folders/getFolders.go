@@ -0,0 +1,65 @@
+package folders
+
+import (
+	"errors"
+	"net/http"
+	"passvault/response"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetFolders lists every folder with its full path, ?trashed=true lists the trash instead
+func (h *Handler) GetFolders(w http.ResponseWriter, r *http.Request) {
+	trashed := false
+	if value := r.URL.Query().Get("trashed"); value != "" {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			response.ValidationErrorResponse(&w, "Invalid query parameters", []response.FieldError{
+				{Field: "trashed", Message: "must be true or false"},
+			})
+			return
+		}
+		trashed = b
+	}
+
+	folders, err := h.store.GetFolders(trashed)
+	if err != nil {
+		response.ErrorResponse(&w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SuccessResponse(&w, folders)
+}
+
+// GetFolder retrieves a single folder by ID
+func (h *Handler) GetFolder(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		response.BadRequestResponse(&w, "Invalid folder ID")
+		return
+	}
+
+	folder, err := h.store.GetFolder(id)
+	if err != nil {
+		folderErrorResponse(w, err)
+		return
+	}
+
+	response.SuccessResponse(&w, folder)
+}
+
+// folderErrorResponse maps folder errors onto their HTTP status
+func folderErrorResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, response.ErrFolderNotFound):
+		response.NotFoundResponse(&w, err.Error())
+	case errors.Is(err, response.ErrFolderExists), errors.Is(err, response.ErrFolderCycle),
+		errors.Is(err, response.ErrFolderNotTrashed):
+		response.ErrorResponse(&w, http.StatusConflict, err.Error())
+	case errors.Is(err, response.ErrInvalidFolderName):
+		response.BadRequestResponse(&w, err.Error())
+	default:
+		response.ErrorResponse(&w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,15 @@
+package folders
+
+import (
+	"passvault/store"
+)
+
+// Handler serves the folder endpoints
+type Handler struct {
+	store store.FolderStore
+}
+
+// NewHandler returns a handler backed by the given store
+func NewHandler(s store.FolderStore) *Handler {
+	return &Handler{store: s}
+}
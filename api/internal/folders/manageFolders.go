@@ -0,0 +1,105 @@
+package folders
+
+import (
+	"encoding/json"
+	"net/http"
+	"passvault/response"
+	"passvault/structs"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// CreateFolder creates a folder, optionally inside a parent folder
+func (h *Handler) CreateFolder(w http.ResponseWriter, r *http.Request) {
+	var folder structs.Folder
+	if err := json.NewDecoder(r.Body).Decode(&folder); err != nil {
+		response.BadRequestResponse(&w, "Invalid request body: "+err.Error())
+		return
+	}
+
+	id, err := h.store.CreateFolder(folder)
+	if err != nil {
+		folderErrorResponse(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"message": "Folder created successfully",
+		"id":      id,
+	})
+}
+
+// UpdateFolder renames a folder or moves it with its subtree under another parent
+func (h *Handler) UpdateFolder(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		response.BadRequestResponse(&w, "Invalid folder ID")
+		return
+	}
+
+	var folder structs.Folder
+	if err := json.NewDecoder(r.Body).Decode(&folder); err != nil {
+		response.BadRequestResponse(&w, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := h.store.UpdateFolder(id, folder); err != nil {
+		folderErrorResponse(w, err)
+		return
+	}
+
+	response.SuccessResponse(&w, map[string]string{
+		"message": "Folder updated successfully",
+	})
+}
+
+// DeleteFolder moves a folder and everything in it to the trash. Folders
+// already in the trash are deleted for good with ?permanent=true.
+func (h *Handler) DeleteFolder(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		response.BadRequestResponse(&w, "Invalid folder ID")
+		return
+	}
+
+	permanent, _ := strconv.ParseBool(r.URL.Query().Get("permanent"))
+
+	if permanent {
+		err = h.store.PurgeFolder(id)
+	} else {
+		err = h.store.TrashFolder(id)
+	}
+	if err != nil {
+		folderErrorResponse(w, err)
+		return
+	}
+
+	message := "Folder moved to the trash"
+	if permanent {
+		message = "Folder deleted permanently"
+	}
+	response.SuccessResponse(&w, map[string]string{
+		"message": message,
+	})
+}
+
+// RestoreFolder restores a trashed folder and everything trashed with it
+func (h *Handler) RestoreFolder(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		response.BadRequestResponse(&w, "Invalid folder ID")
+		return
+	}
+
+	if err := h.store.RestoreFolder(id); err != nil {
+		folderErrorResponse(w, err)
+		return
+	}
+
+	response.SuccessResponse(&w, map[string]string{
+		"message": "Folder restored successfully",
+	})
+}
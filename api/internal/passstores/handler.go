@@ -0,0 +1,15 @@
+package passstores
+
+import (
+	"passvault/passstore"
+)
+
+// Handler serves the password store endpoints
+type Handler struct {
+	passStore *passstore.Manager
+}
+
+// NewHandler returns a handler backed by the given password store manager
+func NewHandler(m *passstore.Manager) *Handler {
+	return &Handler{passStore: m}
+}
@@ -0,0 +1,75 @@
+package passstores
+
+import (
+	"errors"
+	"net/http"
+	"passvault/internal/transfers"
+	"passvault/response"
+	"passvault/transfer"
+	"strconv"
+)
+
+// passErrorResponse maps password store errors onto their HTTP status
+func passErrorResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, response.ErrPassStoreNotFound):
+		response.NotFoundResponse(&w, err.Error())
+	case errors.Is(err, response.ErrPassKeyRequired):
+		response.ErrorResponse(&w, http.StatusConflict, err.Error())
+	case errors.Is(err, response.ErrInvalidPassphrase),
+		errors.Is(err, response.ErrInvalidImportMode):
+		response.BadRequestResponse(&w, err.Error())
+	default:
+		response.ErrorResponse(&w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// ImportPassStore imports every entry of the pass store in the dir query
+// parameter, the configured store by default. The passphrase of the secret
+// key goes in the X-Export-Password header, mode and dry_run work like they
+// do for any other import.
+func (h *Handler) ImportPassStore(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	opts := transfer.ImportOptions{Mode: query.Get("mode")}
+	if value := query.Get("dry_run"); value != "" {
+		dryRun, err := strconv.ParseBool(value)
+		if err != nil {
+			response.ValidationErrorResponse(&w, "Invalid query parameters", []response.FieldError{
+				{Field: "dry_run", Message: "must be true or false"},
+			})
+			return
+		}
+		opts.DryRun = dryRun
+	}
+
+	result, err := h.passStore.Import(query.Get("dir"), r.Header.Get(transfers.PasswordHeader), opts)
+	if err != nil {
+		passErrorResponse(w, err)
+		return
+	}
+
+	response.SuccessResponse(&w, result)
+}
+
+// ExportPassStore writes every credential into the pass store in the dir
+// query parameter, the configured store by default
+func (h *Handler) ExportPassStore(w http.ResponseWriter, r *http.Request) {
+	result, err := h.passStore.Export(r.URL.Query().Get("dir"))
+	if err != nil {
+		passErrorResponse(w, err)
+		return
+	}
+
+	response.SuccessResponse(&w, result)
+}
+
+// MirrorPassStore brings the mirror up to date right away
+func (h *Handler) MirrorPassStore(w http.ResponseWriter, r *http.Request) {
+	result, err := h.passStore.Mirror()
+	if err != nil {
+		passErrorResponse(w, err)
+		return
+	}
+
+	response.SuccessResponse(&w, result)
+}
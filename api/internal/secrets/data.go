@@ -0,0 +1,269 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"passvault/response"
+	"passvault/store"
+	"passvault/structs"
+	"passvault/validate"
+	"slices"
+	"strconv"
+)
+
+// maxValueLength is how long the username and password of a secret may be.
+// Applications keep tokens, keys and certificates in them, far longer than
+// the passwords of logins.
+const maxValueLength = 64 << 10
+
+// kvValidator checks the credentials written through the API. The username
+// and password of a secret take what the data of any other key does, short
+// service account names included.
+func kvValidator() *validate.ValidateCredential {
+	v := validate.NewValidateCredential()
+	v.PasswordMinLength, v.PasswordMaxLength = 0, maxValueLength
+	v.UsernameMinLength, v.UsernameMaxLength = 0, maxValueLength
+	return v
+}
+
+// writeOptions are the options of a write, cas makes it conditional on the
+// current version, 0 meaning that the secret doesn't exist yet
+type writeOptions struct {
+	CAS *int64 `json:"cas"`
+}
+
+// ReadSecret returns the data of a secret. A version other than the
+// current one is not found, PassVault keeps no others, and neither is a
+// deleted secret.
+func (h *Handler) ReadSecret(w http.ResponseWriter, r *http.Request) {
+	cred, err := lookup(h.store, h.secretPath(r, "data"))
+	if err != nil {
+		secretErrorResponse(w, err)
+		return
+	}
+	if cred == nil {
+		vaultError(w, http.StatusNotFound)
+		return
+	}
+	if v := r.URL.Query().Get("version"); v != "" && v != "0" && v != strconv.FormatInt(version(cred), 10) {
+		vaultError(w, http.StatusNotFound)
+		return
+	}
+
+	vaultResponse(w, r, map[string]any{
+		"data":     secretData(cred),
+		"metadata": versionMetadata(cred),
+	})
+}
+
+// WriteSecret replaces the data of a secret, adding a credential and the
+// folders of its path when there is none yet
+func (h *Handler) WriteSecret(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Data    map[string]any `json:"data"`
+		Options writeOptions   `json:"options"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSecretSize)).Decode(&body); err != nil {
+		vaultError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	data, err := textData(body.Data)
+	if err != nil {
+		secretErrorResponse(w, err)
+		return
+	}
+
+	h.write(w, r, body.Options, func(cred *structs.Credential) error {
+		applyData(cred, data)
+		return nil
+	})
+}
+
+// PatchSecret merges data into the data of a secret, a key set to null is
+// removed. The secret has to exist and not be deleted.
+func (h *Handler) PatchSecret(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Data    map[string]any `json:"data"`
+		Options writeOptions   `json:"options"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSecretSize)).Decode(&body); err != nil {
+		vaultError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	removed := map[string]bool{}
+	for key, value := range body.Data {
+		if value == nil {
+			removed[key] = true
+			delete(body.Data, key)
+		}
+	}
+	patch, err := textData(body.Data)
+	if err != nil {
+		secretErrorResponse(w, err)
+		return
+	}
+
+	h.write(w, r, body.Options, func(cred *structs.Credential) error {
+		if cred.ID == 0 || cred.DeletedAt != nil {
+			return response.ErrCredentialNotFound
+		}
+		data := secretData(cred)
+		maps.Copy(data, patch)
+		maps.DeleteFunc(data, func(key, _ string) bool { return removed[key] })
+		applyData(cred, data)
+		return nil
+	})
+}
+
+// write changes the secret of a request in a transaction. change is handed
+// the credential at the path, or a new one with only a name when there is
+// none. Writing a deleted secret brings its credential back from the trash
+// as the next version.
+func (h *Handler) write(w http.ResponseWriter, r *http.Request, opts writeOptions, change func(cred *structs.Credential) error) {
+	p := h.secretPath(r, "data")
+	folderPath, name := splitPath(p)
+	if name == "" {
+		vaultError(w, http.StatusBadRequest, "missing secret path")
+		return
+	}
+
+	var written *structs.Credential
+	err := h.store.WithTx(func(tx store.Store) error {
+		cred, err := lookupAny(tx, p)
+		if err != nil {
+			return err
+		}
+		if opts.CAS != nil && ((cred == nil && *opts.CAS != 0) || (cred != nil && *opts.CAS != version(cred))) {
+			return errCheckAndSet
+		}
+
+		if cred == nil {
+			cred = &structs.Credential{Name: name}
+		}
+		if err := change(cred); err != nil {
+			return err
+		}
+		if cred.ItemType == "" {
+			// Secrets without a login are kept as secure notes
+			cred.ItemType = structs.ItemTypeSecureNote
+			if cred.Username != "" && cred.Password != "" {
+				cred.ItemType = structs.ItemTypeLogin
+			}
+		}
+		if err := kvValidator().Validate(*cred); err != nil {
+			return fmt.Errorf("%w: %w", errInvalid, err)
+		}
+
+		id := cred.ID
+		if cred.DeletedAt != nil {
+			if err := tx.RestoreCredential(id); err != nil {
+				return err
+			}
+		}
+		if id == 0 {
+			if cred.FolderID, err = ensureFolder(tx, folderPath); err != nil {
+				return err
+			}
+			if id, err = tx.CreateCredential(*cred); err != nil {
+				return err
+			}
+		} else if err := tx.UpdateCredential(id, *cred); err != nil {
+			return err
+		}
+		written, err = tx.GetCredential(id)
+		return err
+	})
+	if err != nil {
+		secretErrorResponse(w, err)
+		return
+	}
+
+	vaultResponse(w, r, versionMetadata(written))
+}
+
+// DeleteSecret deletes the current version of a secret. Its credential
+// goes to the trash, undelete brings it back.
+func (h *Handler) DeleteSecret(w http.ResponseWriter, r *http.Request) {
+	h.apply(w, h.secretPath(r, "data"), nil, trash)
+}
+
+// DeleteVersions deletes the listed versions of a secret, which moves the
+// credential to the trash when its version is among them
+func (h *Handler) DeleteVersions(w http.ResponseWriter, r *http.Request) {
+	h.applyVersions(w, r, "delete", trash)
+}
+
+// UndeleteVersions undeletes the listed versions of a secret, which brings
+// the credential back from the trash when its version is among them
+func (h *Handler) UndeleteVersions(w http.ResponseWriter, r *http.Request) {
+	h.applyVersions(w, r, "undelete", undelete)
+}
+
+// DestroyVersions destroys the listed versions of a secret. PassVault keeps
+// one version, destroying it deletes the credential for good, deleted or
+// not.
+func (h *Handler) DestroyVersions(w http.ResponseWriter, r *http.Request) {
+	h.applyVersions(w, r, "destroy", destroy)
+}
+
+// trash moves the credential of a secret to the trash, unless it is there
+// already
+func trash(tx store.Store, cred *structs.Credential) error {
+	if cred.DeletedAt != nil {
+		return nil
+	}
+	return tx.TrashCredential(cred.ID)
+}
+
+// undelete brings the credential of a deleted secret back from the trash
+func undelete(tx store.Store, cred *structs.Credential) error {
+	if cred.DeletedAt == nil {
+		return nil
+	}
+	return tx.RestoreCredential(cred.ID)
+}
+
+// destroy deletes the credential of a secret for good
+func destroy(tx store.Store, cred *structs.Credential) error {
+	return tx.DeleteCredential(cred.ID)
+}
+
+// applyVersions applies action to the versions listed in the body of a
+// request to the given part of the mount
+func (h *Handler) applyVersions(w http.ResponseWriter, r *http.Request, part string, action func(tx store.Store, cred *structs.Credential) error) {
+	var body struct {
+		Versions []int64 `json:"versions"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSecretSize)).Decode(&body); err != nil {
+		vaultError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if len(body.Versions) == 0 {
+		vaultError(w, http.StatusBadRequest, "no versions provided")
+		return
+	}
+	h.apply(w, h.secretPath(r, part), body.Versions, action)
+}
+
+// apply applies action to the credential at a path, live or deleted, when
+// its version is among versions or versions is nil. Vault answers changing
+// nothing with success.
+func (h *Handler) apply(w http.ResponseWriter, p string, versions []int64, action func(tx store.Store, cred *structs.Credential) error) {
+	err := h.store.WithTx(func(tx store.Store) error {
+		cred, err := lookupAny(tx, p)
+		if err != nil || cred == nil {
+			return err
+		}
+		if versions != nil && !slices.Contains(versions, version(cred)) {
+			return nil
+		}
+		return action(tx, cred)
+	})
+	if err != nil {
+		secretErrorResponse(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
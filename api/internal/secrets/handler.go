@@ -0,0 +1,45 @@
+package secrets
+
+import (
+	"net/http"
+	"passvault/auth"
+	"passvault/store"
+)
+
+// Handler serves a Vault KV v2 compatible API on top of the credentials and
+// folders of a store
+type Handler struct {
+	store store.Store
+	auth  *auth.Manager
+	// mount is the path of the secrets engine, secret for clients left at
+	// the Vault defaults
+	mount string
+}
+
+// NewHandler returns a handler backed by the given store and auth manager,
+// serving the secrets engine at mount
+func NewHandler(s store.Store, m *auth.Manager, mount string) *Handler {
+	return &Handler{store: s, auth: m, mount: mount}
+}
+
+// Require rejects requests without a valid session once a master password
+// is set. Vault clients send the session token as X-Vault-Token, and are
+// answered with 403 like Vault does for a bad token.
+func (h *Handler) Require(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.auth.Enabled() && !h.auth.Valid(vaultToken(r)) {
+			vaultError(w, http.StatusForbidden, "permission denied")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// vaultToken returns the token of a request, the X-Vault-Token header or a
+// bearer token
+func vaultToken(r *http.Request) string {
+	if token := r.Header.Get("X-Vault-Token"); token != "" {
+		return token
+	}
+	return auth.Token(r)
+}
@@ -0,0 +1,113 @@
+package secrets
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// ReadMetadata describes a secret and its versions, deleted ones included.
+// Vault clients list a path with a GET carrying list=true, that lists.
+func (h *Handler) ReadMetadata(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("list") == "true" {
+		h.ListSecrets(w, r)
+		return
+	}
+	cred, err := lookupAny(h.store, h.secretPath(r, "metadata"))
+	if err != nil {
+		secretErrorResponse(w, err)
+		return
+	}
+	if cred == nil {
+		vaultError(w, http.StatusNotFound)
+		return
+	}
+	vaultResponse(w, r, secretMetadata(cred))
+}
+
+// ListSecrets lists the secrets below a path: the credentials of its folder,
+// deleted ones included like Vault does, and its subfolders, which end in a
+// slash
+func (h *Handler) ListSecrets(w http.ResponseWriter, r *http.Request) {
+	p := h.secretPath(r, "metadata")
+	folderID, err := findFolder(h.store, p)
+	if err != nil {
+		secretErrorResponse(w, err)
+		return
+	}
+	if folderID == nil {
+		vaultError(w, http.StatusNotFound)
+		return
+	}
+
+	var keys []string
+	folders, err := h.store.GetFolders(false)
+	if err != nil {
+		secretErrorResponse(w, err)
+		return
+	}
+	for _, folder := range folders {
+		if (p == "" && folder.ParentID == nil) || (folder.ParentID != nil && *folder.ParentID == *folderID) {
+			keys = append(keys, folder.Name+"/")
+		}
+	}
+	for _, trashed := range []bool{false, true} {
+		credentials, err := credentialsIn(h.store, *folderID, trashed)
+		if err != nil {
+			secretErrorResponse(w, err)
+			return
+		}
+		for _, cred := range credentials {
+			keys = append(keys, cred.Name)
+		}
+	}
+	// Vault has nothing to list below a path without secrets
+	if len(keys) == 0 {
+		vaultError(w, http.StatusNotFound)
+		return
+	}
+
+	slices.Sort(keys)
+	vaultResponse(w, r, map[string]any{"keys": slices.Compact(keys)})
+}
+
+// WriteMetadata is refused, PassVault keeps one version of every secret
+// and has no settings for them
+func (h *Handler) WriteMetadata(w http.ResponseWriter, r *http.Request) {
+	secretErrorResponse(w, fmt.Errorf("%w, the metadata of secrets can't be changed", errNoHistory))
+}
+
+// DeleteMetadata deletes a secret with all of its versions for good
+func (h *Handler) DeleteMetadata(w http.ResponseWriter, r *http.Request) {
+	h.apply(w, h.secretPath(r, "metadata"), nil, destroy)
+}
+
+// ReadSubkeys returns the keys of the data of a secret without their values
+func (h *Handler) ReadSubkeys(w http.ResponseWriter, r *http.Request) {
+	cred, err := lookup(h.store, h.secretPath(r, "subkeys"))
+	if err != nil {
+		secretErrorResponse(w, err)
+		return
+	}
+	if cred == nil {
+		vaultError(w, http.StatusNotFound)
+		return
+	}
+	subkeys := map[string]any{}
+	for key := range secretData(cred) {
+		subkeys[key] = nil
+	}
+	vaultResponse(w, r, map[string]any{
+		"subkeys":  subkeys,
+		"metadata": versionMetadata(cred),
+	})
+}
+
+// GetConfig returns the settings of the mount, fixed for PassVault
+func (h *Handler) GetConfig(w http.ResponseWriter, r *http.Request) {
+	vaultResponse(w, r, map[string]any{
+		"cas_required":         false,
+		"delete_version_after": "0s",
+		"max_versions":         1,
+	})
+}
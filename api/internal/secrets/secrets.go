@@ -0,0 +1,323 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"passvault/db"
+	"passvault/response"
+	"passvault/store"
+	"passvault/structs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// maxSecretSize is the largest request body accepted
+const maxSecretSize = 1 << 20
+
+// Keys of the secret data holding the values every credential has, other
+// keys are its custom fields
+const (
+	keyUsername = "username"
+	keyPassword = "password"
+	keyURL      = "url"
+	keyNotes    = "notes"
+	keyTOTP     = "totp"
+)
+
+var (
+	errInvalid     = errors.New("invalid secret")
+	errAmbiguous   = errors.New("the path names more than one credential")
+	errCheckAndSet = errors.New("check-and-set parameter did not match the current version")
+	errNoHistory   = errors.New("PassVault keeps only the current version of a secret")
+)
+
+// vaultResponse writes a response the way Vault does, data wrapped in the
+// envelope of a secret
+func vaultResponse(w http.ResponseWriter, r *http.Request, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"request_id":     middleware.GetReqID(r.Context()),
+		"lease_id":       "",
+		"renewable":      false,
+		"lease_duration": 0,
+		"data":           data,
+		"wrap_info":      nil,
+		"warnings":       nil,
+		"auth":           nil,
+	})
+}
+
+// vaultError writes an error response the way Vault does. Without messages
+// it is the empty 404 Vault answers for a missing secret.
+func vaultError(w http.ResponseWriter, status int, messages ...string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string][]string{"errors": append([]string{}, messages...)})
+}
+
+// secretErrorResponse maps errors onto their HTTP status
+func secretErrorResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvalid),
+		errors.Is(err, errAmbiguous),
+		errors.Is(err, errCheckAndSet),
+		errors.Is(err, errNoHistory):
+		vaultError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, response.ErrCredentialNotFound):
+		vaultError(w, http.StatusNotFound)
+	default:
+		vaultError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// secretPath returns the path of the secret a request is about, below the
+// given part of the mount like data or metadata. It is read from the URL
+// itself, routing drops what looks like a file extension.
+func (h *Handler) secretPath(r *http.Request, part string) string {
+	p := strings.TrimPrefix(r.URL.Path, "/v1/"+h.mount+"/"+part)
+	return strings.Trim(p, "/")
+}
+
+// version numbers the one version PassVault keeps of a secret. Like the
+// versions of Vault it is 1 after the first write and counts every write
+// after it, it is the version of the credential.
+func version(cred *structs.Credential) int64 {
+	return int64(cred.Version)
+}
+
+// deletionTime formats when a secret was deleted, empty while it isn't
+func deletionTime(cred *structs.Credential) string {
+	if cred.DeletedAt == nil {
+		return ""
+	}
+	return vaultTime(*cred.DeletedAt)
+}
+
+// vaultTime formats a time the way Vault does
+func vaultTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// splitPath splits a secret path into the path of its folder and the name
+// of its credential
+func splitPath(p string) (folder, name string) {
+	folder, name = path.Split(p)
+	return strings.TrimSuffix(folder, "/"), name
+}
+
+// findFolder returns the ID of the folder at a path, 0 for the root and nil
+// when there is no such folder
+func findFolder(s store.Store, folderPath string) (*int, error) {
+	if folderPath == "" {
+		return new(int), nil
+	}
+	folders, err := s.GetFolders(false)
+	if err != nil {
+		return nil, err
+	}
+	for _, folder := range folders {
+		if folder.Path == folderPath {
+			return &folder.ID, nil
+		}
+	}
+	return nil, nil
+}
+
+// credentialsIn returns the live or the trashed credentials of a folder, 0
+// being the root
+func credentialsIn(s store.Store, folderID int, trashed bool) ([]structs.Credential, error) {
+	var credentials []structs.Credential
+	opts := structs.ListOptions{Limit: db.MaxListLimit, FolderID: &folderID, Trashed: trashed}
+	for {
+		page, err := s.ListCredentials(opts)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, page.Credentials...)
+		if page.NextCursor == "" {
+			return credentials, nil
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+// lookup returns the live credential at a secret path, nil when there is
+// none
+func lookup(s store.Store, p string) (*structs.Credential, error) {
+	return find(s, p, false)
+}
+
+// lookupAny returns the credential at a secret path, a deleted one in the
+// trash when there is no live one
+func lookupAny(s store.Store, p string) (*structs.Credential, error) {
+	cred, err := find(s, p, false)
+	if err != nil || cred != nil {
+		return cred, err
+	}
+	return find(s, p, true)
+}
+
+// find returns the live or the trashed credential at a secret path, nil
+// when there is none
+func find(s store.Store, p string, trashed bool) (*structs.Credential, error) {
+	folderPath, name := splitPath(p)
+	if name == "" {
+		return nil, nil
+	}
+	folderID, err := findFolder(s, folderPath)
+	if err != nil || folderID == nil {
+		return nil, err
+	}
+	credentials, err := credentialsIn(s, *folderID, trashed)
+	if err != nil {
+		return nil, err
+	}
+	var found *structs.Credential
+	for i, cred := range credentials {
+		if cred.Name != name {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("%w, %s is ambiguous", errAmbiguous, p)
+		}
+		found = &credentials[i]
+	}
+	return found, nil
+}
+
+// ensureFolder returns the ID of the folder at a path, creating the folders
+// missing on the way. The root has no ID.
+func ensureFolder(s store.Store, folderPath string) (*int, error) {
+	if folderPath == "" {
+		return nil, nil
+	}
+	folders, err := s.GetFolders(false)
+	if err != nil {
+		return nil, err
+	}
+	var parent *int
+	segments := strings.Split(folderPath, "/")
+	for i, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("%w: empty folder name in %s", errInvalid, folderPath)
+		}
+		current := strings.Join(segments[:i+1], "/")
+		j := slices.IndexFunc(folders, func(folder structs.Folder) bool { return folder.Path == current })
+		if j >= 0 {
+			parent = &folders[j].ID
+			continue
+		}
+		id, err := s.CreateFolder(structs.Folder{Name: segment, ParentID: parent})
+		if err != nil {
+			return nil, err
+		}
+		parent = &id
+	}
+	return parent, nil
+}
+
+// secretData returns the data of the secret a credential is. Custom fields
+// come first, so a field named like a standard value doesn't hide it.
+func secretData(cred *structs.Credential) map[string]string {
+	data := map[string]string{}
+	for _, field := range cred.Fields {
+		data[field.Name] = field.Value
+	}
+	for key, value := range map[string]string{
+		keyUsername: cred.Username,
+		keyPassword: cred.Password,
+		keyURL:      strings.Join(cred.URLs, "\n"),
+		keyNotes:    cred.Description,
+		keyTOTP:     cred.TOTP,
+	} {
+		if value != "" {
+			data[key] = value
+		}
+	}
+	return data
+}
+
+// applyData replaces the values of a credential with the data of a secret.
+// Custom fields keep whether they are hidden, new ones are.
+func applyData(cred *structs.Credential, data map[string]string) {
+	cred.Username = data[keyUsername]
+	cred.Password = data[keyPassword]
+	cred.Description = data[keyNotes]
+	cred.TOTP = data[keyTOTP]
+	cred.URLs = []string{}
+	for url := range strings.Lines(data[keyURL]) {
+		if url = strings.TrimSpace(url); url != "" {
+			cred.URLs = append(cred.URLs, url)
+		}
+	}
+
+	hidden := map[string]bool{}
+	for _, field := range cred.Fields {
+		hidden[field.Name] = field.Hidden
+	}
+	cred.Fields = nil
+	for _, key := range slices.Sorted(maps.Keys(data)) {
+		switch key {
+		case keyUsername, keyPassword, keyURL, keyNotes, keyTOTP:
+			continue
+		}
+		wasHidden, ok := hidden[key]
+		cred.Fields = append(cred.Fields, structs.CustomField{Name: key, Value: data[key], Hidden: wasHidden || !ok})
+	}
+}
+
+// textData reads the data of a write. PassVault keeps text, other JSON
+// values are refused rather than changed on the way.
+func textData(data map[string]any) (map[string]string, error) {
+	text := make(map[string]string, len(data))
+	for key, value := range data {
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: the value of %q is not a string", errInvalid, key)
+		}
+		text[key] = s
+	}
+	return text, nil
+}
+
+// versionMetadata describes the version of a secret
+func versionMetadata(cred *structs.Credential) map[string]any {
+	return map[string]any{
+		"created_time":    vaultTime(cred.UpdatedAt),
+		"custom_metadata": nil,
+		"deletion_time":   deletionTime(cred),
+		"destroyed":       false,
+		"version":         version(cred),
+	}
+}
+
+// secretMetadata describes a secret and its one version
+func secretMetadata(cred *structs.Credential) map[string]any {
+	v := version(cred)
+	return map[string]any{
+		"cas_required":         false,
+		"created_time":         vaultTime(cred.CreatedAt),
+		"current_version":      v,
+		"custom_metadata":      nil,
+		"delete_version_after": "0s",
+		"max_versions":         1,
+		"oldest_version":       v,
+		"updated_time":         vaultTime(cred.UpdatedAt),
+		"versions": map[string]any{
+			strconv.FormatInt(v, 10): map[string]any{
+				"created_time":  vaultTime(cred.UpdatedAt),
+				"deletion_time": deletionTime(cred),
+				"destroyed":     false,
+			},
+		},
+	}
+}
@@ -0,0 +1,337 @@
+package secrets
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"passvault/store"
+	"passvault/structs"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// call runs a handler on a request to path and returns the status and the
+// decoded body of its response
+func call(t *testing.T, handler http.HandlerFunc, method, path, body string) (int, map[string]any) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	var decoded map[string]any
+	if w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), &decoded); err != nil {
+			t.Fatalf("response %q: %v", w.Body.String(), err)
+		}
+	}
+	return w.Code, decoded
+}
+
+// currentVersion returns the version of the secret at path
+func currentVersion(t *testing.T, h *Handler, path string) int64 {
+	t.Helper()
+	status, body := call(t, h.ReadMetadata, http.MethodGet, "/v1/secret/metadata/"+path, "")
+	if status != http.StatusOK {
+		t.Fatalf("ReadMetadata = %d", status)
+	}
+	return int64(body["data"].(map[string]any)["current_version"].(float64))
+}
+
+func TestWriteSecret(t *testing.T) {
+	token := strings.Repeat("t", 2000)
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+		// itemType is the type of the credential written, when it is
+		itemType string
+	}{
+		{name: "login", path: "Servers/db", body: `{"data":{"username":"admin","password":"hunter22","port":"5432"}}`, status: http.StatusOK, itemType: structs.ItemTypeLogin},
+		{name: "token", path: "ci/registry", body: `{"data":{"username":"x","password":"` + token + `"}}`, status: http.StatusOK, itemType: structs.ItemTypeLogin},
+		{name: "short password", path: "app", body: `{"data":{"username":"app","password":"1"}}`, status: http.StatusOK, itemType: structs.ItemTypeLogin},
+		{name: "without a login", path: "app/config", body: `{"data":{"api_key":"abc"}}`, status: http.StatusOK, itemType: structs.ItemTypeSecureNote},
+		{name: "password only", path: "app/key", body: `{"data":{"password":"abc"}}`, status: http.StatusOK, itemType: structs.ItemTypeSecureNote},
+		{name: "too long", path: "app/huge", body: `{"data":{"username":"x","password":"` + strings.Repeat("t", maxValueLength+1) + `"}}`, status: http.StatusBadRequest},
+		{name: "not a string", path: "app/port", body: `{"data":{"port":5432}}`, status: http.StatusBadRequest},
+		{name: "no name", path: "", body: `{"data":{"a":"b"}}`, status: http.StatusBadRequest},
+		{name: "cas of a new secret", path: "app/new", body: `{"data":{"a":"b"},"options":{"cas":0}}`, status: http.StatusOK, itemType: structs.ItemTypeSecureNote},
+		{name: "cas of a missing secret", path: "app/missing", body: `{"data":{"a":"b"},"options":{"cas":5}}`, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vault := store.NewMemory()
+			h := NewHandler(vault, nil, "secret")
+			status, body := call(t, h.WriteSecret, http.MethodPost, "/v1/secret/data/"+tt.path, tt.body)
+			if status != tt.status {
+				t.Fatalf("WriteSecret = %d %v, want %d", status, body, tt.status)
+			}
+			if tt.itemType == "" {
+				return
+			}
+			cred, err := lookup(vault, tt.path)
+			if err != nil || cred == nil {
+				t.Fatalf("lookup = %v, %v", cred, err)
+			}
+			if cred.ItemType != tt.itemType {
+				t.Fatalf("ItemType = %q, want %q", cred.ItemType, tt.itemType)
+			}
+		})
+	}
+}
+
+func TestCheckAndSet(t *testing.T) {
+	h := NewHandler(store.NewMemory(), nil, "secret")
+	if status, _ := call(t, h.WriteSecret, http.MethodPost, "/v1/secret/data/app", `{"data":{"a":"1"}}`); status != http.StatusOK {
+		t.Fatalf("WriteSecret = %d", status)
+	}
+	if v := currentVersion(t, h, "app"); v != 1 {
+		t.Fatalf("version after the first write = %d, want 1", v)
+	}
+
+	// Writes right after one another get versions of their own
+	tests := []struct {
+		name    string
+		cas     int64
+		status  int
+		changed bool
+	}{
+		{"future", 5, http.StatusBadRequest, false},
+		{"new secret", 0, http.StatusBadRequest, false},
+		{"current", 1, http.StatusOK, true},
+		{"stale", 1, http.StatusBadRequest, false},
+		{"next", 2, http.StatusOK, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := currentVersion(t, h, "app")
+			status, _ := call(t, h.WriteSecret, http.MethodPost, "/v1/secret/data/app", `{"data":{"a":"2"},"options":{"cas":`+strconv.FormatInt(tt.cas, 10)+`}}`)
+			if status != tt.status {
+				t.Fatalf("WriteSecret = %d, want %d", status, tt.status)
+			}
+			if after := currentVersion(t, h, "app"); (after > before) != tt.changed {
+				t.Fatalf("version %d -> %d, want changed %v", before, after, tt.changed)
+			}
+		})
+	}
+}
+
+func TestReadSecret(t *testing.T) {
+	h := NewHandler(store.NewMemory(), nil, "secret")
+	if status, _ := call(t, h.WriteSecret, http.MethodPut, "/v1/secret/data/Servers/db", `{"data":{"username":"admin","password":"hunter22","url":"https://db.example.com\n","port":"5432"}}`); status != http.StatusOK {
+		t.Fatalf("WriteSecret = %d", status)
+	}
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"current", "Servers/db", http.StatusOK},
+		{"current version", "Servers/db?version=1", http.StatusOK},
+		{"latest version", "Servers/db?version=0", http.StatusOK},
+		{"other version", "Servers/db?version=2", http.StatusNotFound},
+		{"missing", "Servers/web", http.StatusNotFound},
+		{"missing folder", "Other/db", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := call(t, h.ReadSecret, http.MethodGet, "/v1/secret/data/"+tt.path, "")
+			if status != tt.status {
+				t.Fatalf("ReadSecret = %d, want %d", status, tt.status)
+			}
+			if status != http.StatusOK {
+				return
+			}
+			data := body["data"].(map[string]any)["data"].(map[string]any)
+			want := map[string]any{"username": "admin", "password": "hunter22", "url": "https://db.example.com", "port": "5432"}
+			for key, value := range want {
+				if data[key] != value {
+					t.Fatalf("data = %v, want %v", data, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPatchSecret(t *testing.T) {
+	tests := []struct {
+		name   string
+		patch  string
+		status int
+		want   map[string]string
+	}{
+		{"merge", `{"data":{"port":"5433","host":"db"}}`, http.StatusOK, map[string]string{"username": "admin", "password": "hunter22", "port": "5433", "host": "db"}},
+		{"remove", `{"data":{"port":null}}`, http.StatusOK, map[string]string{"username": "admin", "password": "hunter22"}},
+		{"not a string", `{"data":{"port":5433}}`, http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vault := store.NewMemory()
+			h := NewHandler(vault, nil, "secret")
+			if status, _ := call(t, h.WriteSecret, http.MethodPut, "/v1/secret/data/db", `{"data":{"username":"admin","password":"hunter22","port":"5432"}}`); status != http.StatusOK {
+				t.Fatalf("WriteSecret = %d", status)
+			}
+			status, _ := call(t, h.PatchSecret, http.MethodPatch, "/v1/secret/data/db", tt.patch)
+			if status != tt.status {
+				t.Fatalf("PatchSecret = %d, want %d", status, tt.status)
+			}
+			if tt.want == nil {
+				return
+			}
+			cred, err := lookup(vault, "db")
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := secretData(cred)
+			if len(data) != len(tt.want) {
+				t.Fatalf("data = %v, want %v", data, tt.want)
+			}
+			for key, value := range tt.want {
+				if data[key] != value {
+					t.Fatalf("data = %v, want %v", data, tt.want)
+				}
+			}
+		})
+	}
+
+	h := NewHandler(store.NewMemory(), nil, "secret")
+	if status, _ := call(t, h.PatchSecret, http.MethodPatch, "/v1/secret/data/missing", `{"data":{"a":"b"}}`); status != http.StatusNotFound {
+		t.Fatalf("PatchSecret of a missing secret = %d, want 404", status)
+	}
+}
+
+func TestDeleteSecret(t *testing.T) {
+	type request struct {
+		handler      func(h *Handler) http.HandlerFunc
+		method, path string
+		body         string
+	}
+	var (
+		deleteData     = request{func(h *Handler) http.HandlerFunc { return h.DeleteSecret }, http.MethodDelete, "/v1/secret/data/db", ""}
+		deleteVersion  = request{func(h *Handler) http.HandlerFunc { return h.DeleteVersions }, http.MethodPost, "/v1/secret/delete/db", `{"versions":[1]}`}
+		deleteOther    = request{func(h *Handler) http.HandlerFunc { return h.DeleteVersions }, http.MethodPost, "/v1/secret/delete/db", `{"versions":[2]}`}
+		deleteNone     = request{func(h *Handler) http.HandlerFunc { return h.DeleteVersions }, http.MethodPost, "/v1/secret/delete/db", `{"versions":[]}`}
+		undeleteData   = request{func(h *Handler) http.HandlerFunc { return h.UndeleteVersions }, http.MethodPost, "/v1/secret/undelete/db", `{"versions":[1]}`}
+		destroyVersion = request{func(h *Handler) http.HandlerFunc { return h.DestroyVersions }, http.MethodPost, "/v1/secret/destroy/db", `{"versions":[1]}`}
+		deleteMetadata = request{func(h *Handler) http.HandlerFunc { return h.DeleteMetadata }, http.MethodDelete, "/v1/secret/metadata/db", ""}
+		write          = request{func(h *Handler) http.HandlerFunc { return h.WriteSecret }, http.MethodPut, "/v1/secret/data/db", `{"data":{"a":"c"}}`}
+	)
+	tests := []struct {
+		name     string
+		requests []request
+		// status is the status of the last request
+		status int
+		// read is the status of reading the secret afterwards, and
+		// deleted whether its metadata says it is deleted
+		read    int
+		deleted bool
+		// trashed is how many credentials are in the trash afterwards
+		trashed int
+	}{
+		{"delete", []request{deleteData}, http.StatusNoContent, http.StatusNotFound, true, 1},
+		{"delete the current version", []request{deleteVersion}, http.StatusNoContent, http.StatusNotFound, true, 1},
+		{"delete another version", []request{deleteOther}, http.StatusNoContent, http.StatusOK, false, 0},
+		{"delete no versions", []request{deleteNone}, http.StatusBadRequest, http.StatusOK, false, 0},
+		{"delete twice", []request{deleteData, deleteData}, http.StatusNoContent, http.StatusNotFound, true, 1},
+		{"undelete", []request{deleteData, undeleteData}, http.StatusNoContent, http.StatusOK, false, 0},
+		{"undelete a live secret", []request{undeleteData}, http.StatusNoContent, http.StatusOK, false, 0},
+		{"destroy", []request{destroyVersion}, http.StatusNoContent, http.StatusNotFound, false, 0},
+		{"destroy a deleted secret", []request{deleteData, destroyVersion}, http.StatusNoContent, http.StatusNotFound, false, 0},
+		{"delete the metadata of a deleted secret", []request{deleteData, deleteMetadata}, http.StatusNoContent, http.StatusNotFound, false, 0},
+		{"write a deleted secret", []request{deleteData, write}, http.StatusOK, http.StatusOK, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vault := store.NewMemory()
+			h := NewHandler(vault, nil, "secret")
+			if status, _ := call(t, h.WriteSecret, http.MethodPut, "/v1/secret/data/db", `{"data":{"a":"b"}}`); status != http.StatusOK {
+				t.Fatalf("WriteSecret = %d", status)
+			}
+			var status int
+			for _, req := range tt.requests {
+				status, _ = call(t, req.handler(h), req.method, req.path, req.body)
+			}
+			if status != tt.status {
+				t.Fatalf("status = %d, want %d", status, tt.status)
+			}
+
+			if status, _ := call(t, h.ReadSecret, http.MethodGet, "/v1/secret/data/db", ""); status != tt.read {
+				t.Fatalf("ReadSecret = %d, want %d", status, tt.read)
+			}
+			status, body := call(t, h.ReadMetadata, http.MethodGet, "/v1/secret/metadata/db", "")
+			if status == http.StatusOK {
+				metadata := body["data"].(map[string]any)
+				versions := metadata["versions"].(map[string]any)
+				current := versions[strconv.Itoa(int(metadata["current_version"].(float64)))].(map[string]any)
+				if deleted := current["deletion_time"] != ""; deleted != tt.deleted {
+					t.Fatalf("metadata %v, want deleted %v", metadata, tt.deleted)
+				}
+			} else if tt.read == http.StatusOK || tt.deleted {
+				t.Fatalf("ReadMetadata = %d", status)
+			}
+			page, err := vault.ListCredentials(structs.ListOptions{Trashed: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Credentials) != tt.trashed {
+				t.Fatalf("trash holds %d credentials, want %d", len(page.Credentials), tt.trashed)
+			}
+		})
+	}
+
+	// A deleted secret written again is its next version, with the new data
+	h := NewHandler(store.NewMemory(), nil, "secret")
+	for _, req := range []request{write, deleteData, write} {
+		if status, _ := call(t, req.handler(h), req.method, req.path, req.body); status >= 300 {
+			t.Fatalf("%s %s = %d", req.method, req.path, status)
+		}
+	}
+	if v := currentVersion(t, h, "db"); v != 2 {
+		t.Fatalf("version = %d, want 2", v)
+	}
+	status, body := call(t, h.ReadSecret, http.MethodGet, "/v1/secret/data/db", "")
+	if data := body["data"].(map[string]any)["data"].(map[string]any); status != http.StatusOK || data["a"] != "c" {
+		t.Fatalf("ReadSecret = %d %v", status, data)
+	}
+}
+
+func TestListSecrets(t *testing.T) {
+	h := NewHandler(store.NewMemory(), nil, "secret")
+	for _, p := range []string{"Servers/db", "Servers/web", "Servers/Old/ftp", "app"} {
+		if status, _ := call(t, h.WriteSecret, http.MethodPut, "/v1/secret/data/"+p, `{"data":{"a":"b"}}`); status != http.StatusOK {
+			t.Fatalf("WriteSecret(%s) = %d", p, status)
+		}
+	}
+	// Deleted secrets are listed until they are destroyed
+	if status, _ := call(t, h.DeleteSecret, http.MethodDelete, "/v1/secret/data/Servers/web", ""); status != http.StatusNoContent {
+		t.Fatalf("DeleteSecret = %d", status)
+	}
+
+	tests := []struct {
+		path   string
+		status int
+		keys   string
+	}{
+		{"", http.StatusOK, "Servers/ app"},
+		{"Servers", http.StatusOK, "Old/ db web"},
+		{"Servers/Old/", http.StatusOK, "ftp"},
+		{"Missing", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			status, body := call(t, h.ReadMetadata, http.MethodGet, "/v1/secret/metadata/"+tt.path+"?list=true", "")
+			if status != tt.status {
+				t.Fatalf("list = %d, want %d", status, tt.status)
+			}
+			if status != http.StatusOK {
+				return
+			}
+			var keys []string
+			for _, key := range body["data"].(map[string]any)["keys"].([]any) {
+				keys = append(keys, key.(string))
+			}
+			if got := strings.Join(keys, " "); got != tt.keys {
+				t.Fatalf("keys = %q, want %q", got, tt.keys)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package secrets
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// vaultVersion is the Vault release whose API the facade follows, clients
+// check it to know what they can ask for
+const vaultVersion = "1.15.0"
+
+// SealStatus reports an unsealed Vault. Clients ask before anything else,
+// without a token.
+func (h *Handler) SealStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"type":          "shamir",
+		"initialized":   true,
+		"sealed":        false,
+		"t":             1,
+		"n":             1,
+		"progress":      0,
+		"nonce":         "",
+		"version":       vaultVersion,
+		"migration":     false,
+		"recovery_seal": false,
+		"storage_type":  "passvault",
+	})
+}
+
+// GetMount tells Vault clients checking a path before using it that the
+// mount is a KV version 2 secrets engine. Paths outside it are refused.
+func (h *Handler) GetMount(w http.ResponseWriter, r *http.Request) {
+	p := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/sys/internal/ui/mounts"), "/")
+	if p != h.mount && !strings.HasPrefix(p, h.mount+"/") {
+		vaultError(w, http.StatusForbidden, "permission denied")
+		return
+	}
+	vaultResponse(w, r, map[string]any{
+		"path":        h.mount + "/",
+		"type":        "kv",
+		"description": "PassVault credentials",
+		"options":     map[string]string{"version": "2"},
+		"local":       false,
+		"seal_wrap":   false,
+	})
+}
+
+// LookupToken describes the token of the request, the session it belongs
+// to. Without a master password the API is open and the token never
+// expires.
+func (h *Handler) LookupToken(w http.ResponseWriter, r *http.Request) {
+	token := vaultToken(r)
+	data := map[string]any{
+		"id":           token,
+		"display_name": "passvault",
+		"policies":     []string{"default"},
+		"meta":         nil,
+		"num_uses":     0,
+		"orphan":       true,
+		"renewable":    false,
+		"type":         "service",
+		"ttl":          0,
+		"expire_time":  nil,
+	}
+	if expires, ok := h.auth.Expiry(token); ok {
+		data["ttl"] = int(time.Until(expires).Seconds())
+		data["expire_time"] = vaultTime(expires)
+	}
+	vaultResponse(w, r, data)
+}
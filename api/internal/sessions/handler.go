@@ -0,0 +1,15 @@
+package sessions
+
+import (
+	"passvault/auth"
+)
+
+// Handler serves the login and master password endpoints
+type Handler struct {
+	auth *auth.Manager
+}
+
+// NewHandler returns a handler backed by the given auth manager
+func NewHandler(m *auth.Manager) *Handler {
+	return &Handler{auth: m}
+}
@@ -0,0 +1,70 @@
+package sessions
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"passvault/auth"
+	"passvault/response"
+)
+
+// sessionErrorResponse maps login errors onto their HTTP status
+func sessionErrorResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, response.ErrWrongMasterPassword):
+		response.ErrorResponse(&w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, response.ErrTooManyAttempts):
+		response.ErrorResponse(&w, http.StatusTooManyRequests, err.Error())
+	case errors.Is(err, response.ErrNoMasterPassword):
+		response.ErrorResponse(&w, http.StatusConflict, err.Error())
+	case errors.Is(err, response.ErrMasterPasswordShort):
+		response.BadRequestResponse(&w, err.Error())
+	default:
+		response.ErrorResponse(&w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// Login opens a session with the master password
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.BadRequestResponse(&w, "Invalid request body: "+err.Error())
+		return
+	}
+
+	session, err := h.auth.Login(auth.Client(r), body.Password)
+	if err != nil {
+		sessionErrorResponse(w, err)
+		return
+	}
+
+	response.SuccessResponse(&w, session)
+}
+
+// Logout ends the session of the request
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	h.auth.Logout(auth.Token(r))
+	response.SuccessResponse(&w, map[string]string{"message": "Logged out successfully"})
+}
+
+// SetPassword sets the master password, or changes it when the current one
+// is given. Every session ends.
+func (h *Handler) SetPassword(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.BadRequestResponse(&w, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := h.auth.SetPassword(auth.Client(r), body.CurrentPassword, body.NewPassword); err != nil {
+		sessionErrorResponse(w, err)
+		return
+	}
+
+	response.SuccessResponse(&w, map[string]string{"message": "Master password set successfully"})
+}
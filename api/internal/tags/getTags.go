@@ -0,0 +1,17 @@
+package tags
+
+import (
+	"net/http"
+	"passvault/response"
+)
+
+// GetTags lists every tag with the number of credentials using it
+func (h *Handler) GetTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := h.store.GetTags()
+	if err != nil {
+		response.ErrorResponse(&w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SuccessResponse(&w, tags)
+}
@@ -0,0 +1,15 @@
+package tags
+
+import (
+	"passvault/store"
+)
+
+// Handler serves the tag endpoints
+type Handler struct {
+	store store.TagStore
+}
+
+// NewHandler returns a handler backed by the given store
+func NewHandler(s store.TagStore) *Handler {
+	return &Handler{store: s}
+}
@@ -0,0 +1,103 @@
+package tags
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"passvault/response"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type renameRequest struct {
+	Name string `json:"name"`
+}
+
+type mergeRequest struct {
+	Sources []string `json:"sources"`
+	Target  string   `json:"target"`
+}
+
+// tagParam reads the tag name from the URL, tags may contain escaped characters
+func tagParam(r *http.Request) (string, error) {
+	return url.PathUnescape(chi.URLParam(r, "name"))
+}
+
+// tagErrorResponse maps tag errors onto their HTTP status
+func tagErrorResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, response.ErrTagNotFound):
+		response.NotFoundResponse(&w, err.Error())
+	case errors.Is(err, response.ErrTagExists):
+		response.ErrorResponse(&w, http.StatusConflict, err.Error())
+	case errors.Is(err, response.ErrInvalidTag):
+		response.BadRequestResponse(&w, err.Error())
+	default:
+		response.ErrorResponse(&w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// RenameTag renames a tag across all credentials
+func (h *Handler) RenameTag(w http.ResponseWriter, r *http.Request) {
+	name, err := tagParam(r)
+	if err != nil {
+		response.BadRequestResponse(&w, "Invalid tag name")
+		return
+	}
+
+	var req renameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequestResponse(&w, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := h.store.RenameTag(name, req.Name); err != nil {
+		tagErrorResponse(w, err)
+		return
+	}
+
+	response.SuccessResponse(&w, map[string]string{
+		"message": "Tag renamed successfully",
+	})
+}
+
+// MergeTags folds one or more tags into a target tag across all credentials
+func (h *Handler) MergeTags(w http.ResponseWriter, r *http.Request) {
+	var req mergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequestResponse(&w, "Invalid request body: "+err.Error())
+		return
+	}
+	if len(req.Sources) == 0 {
+		response.BadRequestResponse(&w, "At least one source tag is required")
+		return
+	}
+
+	if err := h.store.MergeTags(req.Sources, req.Target); err != nil {
+		tagErrorResponse(w, err)
+		return
+	}
+
+	response.SuccessResponse(&w, map[string]string{
+		"message": "Tags merged successfully",
+	})
+}
+
+// DeleteTag removes a tag from all credentials
+func (h *Handler) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	name, err := tagParam(r)
+	if err != nil {
+		response.BadRequestResponse(&w, "Invalid tag name")
+		return
+	}
+
+	if err := h.store.DeleteTag(name); err != nil {
+		tagErrorResponse(w, err)
+		return
+	}
+
+	response.SuccessResponse(&w, map[string]string{
+		"message": "Tag deleted successfully",
+	})
+}
@@ -0,0 +1,15 @@
+package templates
+
+import (
+	"passvault/store"
+)
+
+// Handler serves the template rendering endpoint
+type Handler struct {
+	store store.Store
+}
+
+// NewHandler returns a handler backed by the given store
+func NewHandler(s store.Store) *Handler {
+	return &Handler{store: s}
+}
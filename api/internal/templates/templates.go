@@ -0,0 +1,49 @@
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"passvault/response"
+	"passvault/secretref"
+)
+
+// maxTemplateSize is the largest request body accepted, templates are config files
+const maxTemplateSize = 1 << 20
+
+// templateErrorResponse maps rendering errors onto their HTTP status
+func templateErrorResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, response.ErrInvalidTemplate),
+		errors.Is(err, response.ErrUnresolvedReference),
+		errors.Is(err, response.ErrCredentialNotFound):
+		response.BadRequestResponse(&w, err.Error())
+	default:
+		response.ErrorResponse(&w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// RenderTemplate expands the secret references in a text/template against
+// the vault. A reference naming nothing fails the whole template.
+func (h *Handler) RenderTemplate(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		// Name is the name errors give the template, like its file name
+		Name     string `json:"name"`
+		Template string `json:"template"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxTemplateSize)).Decode(&body); err != nil {
+		response.BadRequestResponse(&w, "Invalid request body: "+err.Error())
+		return
+	}
+	if body.Name == "" {
+		body.Name = "template"
+	}
+
+	output, err := secretref.Render(body.Name, body.Template, secretref.NewResolver(h.store))
+	if err != nil {
+		templateErrorResponse(w, err)
+		return
+	}
+
+	response.SuccessResponse(&w, map[string]string{"output": output})
+}
@@ -0,0 +1,115 @@
+package transfers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"passvault/kdbx"
+	"passvault/response"
+	"passvault/transfer"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// PasswordHeader carries the export password, so it never ends up in a URL
+const PasswordHeader = "X-Export-Password"
+
+// transferErrorResponse maps export and import errors onto their HTTP status
+func transferErrorResponse(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, response.ErrInvalidPassphrase),
+		errors.Is(err, response.ErrInvalidExport),
+		errors.Is(err, response.ErrInvalidImportSource),
+		errors.Is(err, response.ErrInvalidImportMode):
+		response.BadRequestResponse(&w, err.Error())
+	default:
+		response.ErrorResponse(&w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// ExportVault downloads every credential and folder as an export file
+// encrypted with the password in the X-Export-Password header. With
+// format=kdbx it is a KeePass database instead, the cipher and kdf query
+// parameters pick how it is protected.
+func (h *Handler) ExportVault(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	password := r.Header.Get(PasswordHeader)
+	fileName := "passvault-export-" + time.Now().UTC().Format("20060102-150405")
+
+	var data []byte
+	var contentType string
+	var err error
+	switch query.Get("format") {
+	case "", transfer.SourcePassVault:
+		data, err = transfer.Export(h.store, password)
+		fileName, contentType = fileName+".json", "application/json"
+	case transfer.SourceKeePass:
+		opts := kdbx.Options{Cipher: query.Get("cipher"), KDF: query.Get("kdf")}
+		var errors []response.FieldError
+		if !slices.Contains([]string{"", kdbx.CipherAES, kdbx.CipherChaCha20}, opts.Cipher) {
+			errors = append(errors, response.FieldError{Field: "cipher", Message: "must be aes or chacha20"})
+		}
+		if !slices.Contains([]string{"", kdbx.KDFArgon2d, kdbx.KDFArgon2id, kdbx.KDFAES}, opts.KDF) {
+			errors = append(errors, response.FieldError{Field: "kdf", Message: "must be argon2d, argon2id or aes"})
+		}
+		if len(errors) > 0 {
+			response.ValidationErrorResponse(&w, "Invalid query parameters", errors)
+			return
+		}
+		data, err = transfer.ExportKeePass(h.store, password, opts)
+		fileName, contentType = fileName+".kdbx", "application/octet-stream"
+	default:
+		response.ValidationErrorResponse(&w, "Invalid query parameters", []response.FieldError{
+			{Field: "format", Message: "must be passvault or kdbx"},
+		})
+		return
+	}
+	if err != nil {
+		transferErrorResponse(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+fileName+`"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// ImportVault imports an export file sent as the request body. The format
+// query parameter names the password manager it came from, PassVault by
+// default. The mode picks merge, skip_duplicates or replace, dry_run previews
+// the import without changing anything.
+func (h *Handler) ImportVault(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	opts := transfer.ImportOptions{Mode: query.Get("mode")}
+	if value := query.Get("dry_run"); value != "" {
+		dryRun, err := strconv.ParseBool(value)
+		if err != nil {
+			response.ValidationErrorResponse(&w, "Invalid query parameters", []response.FieldError{
+				{Field: "dry_run", Message: "must be true or false"},
+			})
+			return
+		}
+		opts.DryRun = dryRun
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, transfer.MaxFileSize))
+	if err != nil {
+		response.BadRequestResponse(&w, "Invalid request body: "+err.Error())
+		return
+	}
+
+	payload, err := transfer.Parse(query.Get("format"), data, r.Header.Get(PasswordHeader))
+	if err != nil {
+		transferErrorResponse(w, err)
+		return
+	}
+	result, err := transfer.Import(h.store, payload, opts)
+	if err != nil {
+		transferErrorResponse(w, err)
+		return
+	}
+
+	response.SuccessResponse(&w, result)
+}
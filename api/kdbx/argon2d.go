@@ -0,0 +1,244 @@
+package kdbx
+
+import (
+	"encoding/binary"
+	"math/bits"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// golang.org/x/crypto/argon2 only offers Argon2i and Argon2id, while KeePass
+// defaults to Argon2d. This is a plain implementation of Argon2d version 1.3
+// as specified in RFC 9106, without the parallelism.
+
+const (
+	argon2Version   = 0x13
+	argon2TypeD     = 0
+	argon2BlockSize = 128 // in 64 bit words
+	argon2SyncPoint = 4
+)
+
+type argon2Block [argon2BlockSize]uint64
+
+// argon2d derives a key of keyLen bytes. memory is in KiB.
+func argon2d(password, salt, secret, data []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	if threads < 1 {
+		threads = 1
+	}
+	lanes := uint32(threads)
+	// Memory is rounded down to a multiple of 4 blocks per lane, at least 8 blocks per lane
+	if memory < 2*argon2SyncPoint*lanes {
+		memory = 2 * argon2SyncPoint * lanes
+	}
+	segmentLength := memory / (lanes * argon2SyncPoint)
+	laneLength := segmentLength * argon2SyncPoint
+	blocks := make([]argon2Block, laneLength*lanes)
+
+	h0 := argon2InitialHash(password, salt, secret, data, time, memory, lanes, keyLen)
+	var block [1024]byte
+	for lane := uint32(0); lane < lanes; lane++ {
+		for i := uint32(0); i < 2; i++ {
+			binary.LittleEndian.PutUint32(h0[64:], i)
+			binary.LittleEndian.PutUint32(h0[68:], lane)
+			argon2Hash(block[:], h0[:])
+			for j := range blocks[lane*laneLength+i] {
+				blocks[lane*laneLength+i][j] = binary.LittleEndian.Uint64(block[j*8:])
+			}
+		}
+	}
+
+	for pass := uint32(0); pass < time; pass++ {
+		for slice := uint32(0); slice < argon2SyncPoint; slice++ {
+			for lane := uint32(0); lane < lanes; lane++ {
+				argon2FillSegment(blocks, pass, slice, lane, lanes, segmentLength, laneLength)
+			}
+		}
+	}
+
+	// The last block of every lane is folded into the final one
+	final := blocks[laneLength-1]
+	for lane := uint32(1); lane < lanes; lane++ {
+		last := &blocks[lane*laneLength+laneLength-1]
+		for i := range final {
+			final[i] ^= last[i]
+		}
+	}
+	for i, word := range final {
+		binary.LittleEndian.PutUint64(block[i*8:], word)
+	}
+	key := make([]byte, keyLen)
+	argon2Hash(key, block[:])
+	return key
+}
+
+// argon2InitialHash returns H0 with room for the two words appended to it
+// when the first blocks of each lane are derived
+func argon2InitialHash(password, salt, secret, data []byte, time, memory, lanes, keyLen uint32) [72]byte {
+	h, _ := blake2b.New512(nil)
+	var word [4]byte
+	for _, v := range []uint32{lanes, keyLen, memory, time, argon2Version, argon2TypeD} {
+		binary.LittleEndian.PutUint32(word[:], v)
+		h.Write(word[:])
+	}
+	for _, b := range [][]byte{password, salt, secret, data} {
+		binary.LittleEndian.PutUint32(word[:], uint32(len(b)))
+		h.Write(word[:])
+		h.Write(b)
+	}
+
+	var h0 [72]byte
+	h.Sum(h0[:0])
+	return h0
+}
+
+// argon2Hash is the variable length hash H' filling out
+func argon2Hash(out, in []byte) {
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(out)))
+
+	if len(out) <= blake2b.Size {
+		h, _ := blake2b.New(len(out), nil)
+		h.Write(length[:])
+		h.Write(in)
+		h.Sum(out[:0])
+		return
+	}
+
+	h, _ := blake2b.New512(nil)
+	h.Write(length[:])
+	h.Write(in)
+	var v [blake2b.Size]byte
+	h.Sum(v[:0])
+
+	// Every hash contributes its first half, the last one all of it
+	n := copy(out, v[:32])
+	for len(out)-n > blake2b.Size {
+		v = blake2b.Sum512(v[:])
+		n += copy(out[n:], v[:32])
+	}
+	h, _ = blake2b.New(len(out)-n, nil)
+	h.Write(v[:])
+	h.Sum(out[n:n])
+}
+
+// argon2FillSegment computes one segment of a lane, addressing data
+// dependently as Argon2d does
+func argon2FillSegment(blocks []argon2Block, pass, slice, lane, lanes, segmentLength, laneLength uint32) {
+	start := uint32(0)
+	if pass == 0 && slice == 0 {
+		start = 2 // The first two blocks are derived from H0
+	}
+
+	offset := lane*laneLength + slice*segmentLength + start
+	for index := start; index < segmentLength; index, offset = index+1, offset+1 {
+		prev := offset - 1
+		if offset%laneLength == 0 {
+			prev = offset + laneLength - 1
+		}
+
+		random := blocks[prev][0]
+		refLane := uint32(random>>32) % lanes
+		if pass == 0 && slice == 0 {
+			refLane = lane
+		}
+		refIndex := argon2RefIndex(pass, slice, index, uint32(random), refLane == lane, segmentLength, laneLength)
+		ref := &blocks[refLane*laneLength+refIndex]
+
+		argon2Compress(&blocks[offset], &blocks[prev], ref, pass > 0)
+	}
+}
+
+// argon2RefIndex maps the pseudo random value of a block onto the position
+// of the block it references within the reference lane
+func argon2RefIndex(pass, slice, index, random uint32, sameLane bool, segmentLength, laneLength uint32) uint32 {
+	var area uint32
+	switch {
+	case pass == 0 && slice == 0:
+		area = index - 1
+	case pass == 0 && sameLane:
+		area = slice*segmentLength + index - 1
+	case pass == 0:
+		area = slice * segmentLength
+		if index == 0 {
+			area--
+		}
+	case sameLane:
+		area = laneLength - segmentLength + index - 1
+	default:
+		area = laneLength - segmentLength
+		if index == 0 {
+			area--
+		}
+	}
+
+	x := uint64(random) * uint64(random) >> 32
+	y := uint64(area) * x >> 32
+	relative := uint64(area) - 1 - y
+
+	startPosition := uint64(0)
+	if pass != 0 && slice != argon2SyncPoint-1 {
+		startPosition = uint64(slice+1) * uint64(segmentLength)
+	}
+	return uint32((startPosition + relative) % uint64(laneLength))
+}
+
+// argon2Compress sets out to G(prev, ref), XORed into out when overwriting
+// blocks of an earlier pass
+func argon2Compress(out, prev, ref *argon2Block, xor bool) {
+	var r, z argon2Block
+	for i := range r {
+		r[i] = prev[i] ^ ref[i]
+	}
+	z = r
+
+	// Rows of 16 words first, then the columns interleaving pairs of words
+	for i := 0; i < 8; i++ {
+		j := i * 16
+		blamkaRound(&z, j, j+1, j+2, j+3, j+4, j+5, j+6, j+7, j+8, j+9, j+10, j+11, j+12, j+13, j+14, j+15)
+	}
+	for i := 0; i < 8; i++ {
+		j := i * 2
+		blamkaRound(&z, j, j+1, j+16, j+17, j+32, j+33, j+48, j+49, j+64, j+65, j+80, j+81, j+96, j+97, j+112, j+113)
+	}
+
+	for i := range out {
+		if xor {
+			out[i] ^= z[i] ^ r[i]
+		} else {
+			out[i] = z[i] ^ r[i]
+		}
+	}
+}
+
+// blamkaRound is the BLAKE2b round without message, using the BlaMka
+// multiplication, over the 16 words of b at the given positions
+func blamkaRound(b *argon2Block, i0, i1, i2, i3, i4, i5, i6, i7, i8, i9, i10, i11, i12, i13, i14, i15 int) {
+	v := [16]uint64{b[i0], b[i1], b[i2], b[i3], b[i4], b[i5], b[i6], b[i7], b[i8], b[i9], b[i10], b[i11], b[i12], b[i13], b[i14], b[i15]}
+
+	blamkaG(&v, 0, 4, 8, 12)
+	blamkaG(&v, 1, 5, 9, 13)
+	blamkaG(&v, 2, 6, 10, 14)
+	blamkaG(&v, 3, 7, 11, 15)
+	blamkaG(&v, 0, 5, 10, 15)
+	blamkaG(&v, 1, 6, 11, 12)
+	blamkaG(&v, 2, 7, 8, 13)
+	blamkaG(&v, 3, 4, 9, 14)
+
+	b[i0], b[i1], b[i2], b[i3], b[i4], b[i5], b[i6], b[i7] = v[0], v[1], v[2], v[3], v[4], v[5], v[6], v[7]
+	b[i8], b[i9], b[i10], b[i11], b[i12], b[i13], b[i14], b[i15] = v[8], v[9], v[10], v[11], v[12], v[13], v[14], v[15]
+}
+
+func blamkaG(v *[16]uint64, a, b, c, d int) {
+	v[a] = blamka(v[a], v[b])
+	v[d] = bits.RotateLeft64(v[d]^v[a], -32)
+	v[c] = blamka(v[c], v[d])
+	v[b] = bits.RotateLeft64(v[b]^v[c], -24)
+	v[a] = blamka(v[a], v[b])
+	v[d] = bits.RotateLeft64(v[d]^v[a], -16)
+	v[c] = blamka(v[c], v[d])
+	v[b] = bits.RotateLeft64(v[b]^v[c], -63)
+}
+
+func blamka(x, y uint64) uint64 {
+	return x + y + 2*uint64(uint32(x))*uint64(uint32(y))
+}
@@ -0,0 +1,39 @@
+package kdbx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestArgon2d(t *testing.T) {
+	tests := []struct {
+		name           string
+		password, salt []byte
+		secret, data   []byte
+		time, memory   uint32
+		threads        uint8
+		want           string
+	}{
+		{
+			// RFC 9106 section 5.1
+			name:     "RFC 9106",
+			password: bytes.Repeat([]byte{0x01}, 32),
+			salt:     bytes.Repeat([]byte{0x02}, 16),
+			secret:   bytes.Repeat([]byte{0x03}, 8),
+			data:     bytes.Repeat([]byte{0x04}, 12),
+			time:     3,
+			memory:   32,
+			threads:  4,
+			want:     "512b391b6f1162975371d30919734294f868e3be3984f3c1a13a4db9fabe4acb",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := argon2d(tt.password, tt.salt, tt.secret, tt.data, tt.time, tt.memory, tt.threads, 32)
+			if hex.EncodeToString(got) != tt.want {
+				t.Fatalf("argon2d = %x, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,413 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"passvault/response"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	signature1 = 0x9AA2D903
+	signature2 = 0xB54BFB67
+	// version is the format version written, KDBX 4.0
+	version      = 0x00040000
+	versionMajor = 4
+)
+
+// Outer header field IDs
+const (
+	headerEnd         = 0
+	headerCipherID    = 2
+	headerCompression = 3
+	headerMasterSeed  = 4
+	headerIV          = 7
+	headerKDF         = 11
+)
+
+// Inner header field IDs
+const (
+	innerHeaderEnd       = 0
+	innerHeaderStreamID  = 1
+	innerHeaderStreamKey = 2
+	innerHeaderBinary    = 3
+)
+
+// Inner random stream IDs, protecting values inside the XML
+const (
+	streamSalsa20  = 2
+	streamChaCha20 = 3
+)
+
+// Cipher and KDF UUIDs
+var (
+	cipherAES      = uuid("31c1f2e6bf714350be5805216afc5aff")
+	cipherChaCha20 = uuid("d6038a2b8b6f4cb5a524339a31dbb59a")
+	kdfAES         = uuid("c9d9f39a628a4460bf740d08c18a4fea")
+	kdfArgon2d     = uuid("ef636ddf8c29444b91f7a9a403e30a0c")
+	kdfArgon2id    = uuid("9e298b1956db4773b23dfc3ec6f0a1e6")
+)
+
+func uuid(s string) UUID {
+	var u UUID
+	hex.Decode(u[:], []byte(s))
+	return u
+}
+
+// header is the unencrypted outer header of a KDBX 4 file
+type header struct {
+	cipher     UUID
+	compressed bool
+	masterSeed []byte
+	iv         []byte
+	kdf        variantDictionary
+	// raw is the header as stored, it is covered by a checksum and an HMAC
+	raw []byte
+}
+
+// readHeader reads the outer header up to and including its end field
+func readHeader(r *bytes.Reader, data []byte) (*header, error) {
+	var sig1, sig2, ver uint32
+	for _, v := range []*uint32{&sig1, &sig2, &ver} {
+		if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+			return nil, errors.New("not a KeePass database")
+		}
+	}
+	if sig1 != signature1 || sig2 != signature2 {
+		return nil, errors.New("not a KeePass database")
+	}
+	if ver>>16 != versionMajor {
+		return nil, fmt.Errorf("KDBX %d.%d isn't supported, save the database as KDBX 4", ver>>16, ver&0xFFFF)
+	}
+
+	h := &header{}
+	for {
+		id, value, err := readField(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid header: %w", err)
+		}
+		switch id {
+		case headerEnd:
+			h.raw = data[:len(data)-r.Len()]
+			return h, nil
+		case headerCipherID:
+			if len(value) != len(h.cipher) {
+				return nil, errors.New("invalid cipher ID")
+			}
+			copy(h.cipher[:], value)
+		case headerCompression:
+			if len(value) != 4 {
+				return nil, errors.New("invalid compression flags")
+			}
+			h.compressed = binary.LittleEndian.Uint32(value) == 1
+		case headerMasterSeed:
+			h.masterSeed = value
+		case headerIV:
+			h.iv = value
+		case headerKDF:
+			if h.kdf, err = parseVariantDictionary(value); err != nil {
+				return nil, fmt.Errorf("invalid KDF parameters: %w", err)
+			}
+		}
+	}
+}
+
+// readField reads a header field, its ID, a 32 bit length and its value
+func readField(r *bytes.Reader) (byte, []byte, error) {
+	id, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return 0, nil, err
+	}
+	if int64(size) > int64(r.Len()) {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	value := make([]byte, size)
+	_, err = io.ReadFull(r, value)
+	return id, value, err
+}
+
+// writeField writes a header field
+func writeField(w *bytes.Buffer, id byte, value []byte) {
+	w.WriteByte(id)
+	binary.Write(w, binary.LittleEndian, uint32(len(value)))
+	w.Write(value)
+}
+
+// marshal encodes the header, including the signature and version
+func (h *header) marshal() []byte {
+	var buf bytes.Buffer
+	for _, v := range []uint32{signature1, signature2, version} {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	compression := make([]byte, 4)
+	if h.compressed {
+		compression[0] = 1
+	}
+	writeField(&buf, headerCipherID, h.cipher[:])
+	writeField(&buf, headerCompression, compression)
+	writeField(&buf, headerMasterSeed, h.masterSeed)
+	writeField(&buf, headerIV, h.iv)
+	writeField(&buf, headerKDF, h.kdf.marshal())
+	writeField(&buf, headerEnd, []byte("\r\n\r\n"))
+	return buf.Bytes()
+}
+
+// Variant dictionary value types
+const (
+	variantUInt32    = 0x04
+	variantUInt64    = 0x05
+	variantBool      = 0x08
+	variantInt32     = 0x0C
+	variantInt64     = 0x0D
+	variantString    = 0x18
+	variantByteArray = 0x42
+)
+
+// variantDictionary is the typed key value list KDF parameters are stored in
+type variantDictionary []variantItem
+
+type variantItem struct {
+	kind  byte
+	key   string
+	value []byte
+}
+
+func parseVariantDictionary(data []byte) (variantDictionary, error) {
+	r := bytes.NewReader(data)
+	var ver uint16
+	if err := binary.Read(r, binary.LittleEndian, &ver); err != nil {
+		return nil, err
+	}
+	if ver>>8 != 1 {
+		return nil, fmt.Errorf("unsupported version %#x", ver)
+	}
+
+	var dict variantDictionary
+	for {
+		kind, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if kind == 0 {
+			return dict, nil
+		}
+		var parts [2][]byte
+		for i := range parts {
+			var size int32
+			if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+				return nil, err
+			}
+			if size < 0 || int64(size) > int64(r.Len()) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			parts[i] = make([]byte, size)
+			if _, err := io.ReadFull(r, parts[i]); err != nil {
+				return nil, err
+			}
+		}
+		dict = append(dict, variantItem{kind: kind, key: string(parts[0]), value: parts[1]})
+	}
+}
+
+func (d variantDictionary) marshal() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint16(0x0100))
+	for _, item := range d {
+		buf.WriteByte(item.kind)
+		binary.Write(&buf, binary.LittleEndian, int32(len(item.key)))
+		buf.WriteString(item.key)
+		binary.Write(&buf, binary.LittleEndian, int32(len(item.value)))
+		buf.Write(item.value)
+	}
+	buf.WriteByte(0)
+	return buf.Bytes()
+}
+
+func (d variantDictionary) bytes(key string) []byte {
+	for _, item := range d {
+		if item.key == key {
+			return item.value
+		}
+	}
+	return nil
+}
+
+// uint returns an unsigned integer of either width, 0 when it is missing
+func (d variantDictionary) uint(key string) uint64 {
+	value := d.bytes(key)
+	switch len(value) {
+	case 4:
+		return uint64(binary.LittleEndian.Uint32(value))
+	case 8:
+		return binary.LittleEndian.Uint64(value)
+	}
+	return 0
+}
+
+func (d *variantDictionary) setBytes(key string, value []byte) {
+	*d = append(*d, variantItem{kind: variantByteArray, key: key, value: value})
+}
+
+func (d *variantDictionary) setUint32(key string, value uint32) {
+	*d = append(*d, variantItem{kind: variantUInt32, key: key, value: binary.LittleEndian.AppendUint32(nil, value)})
+}
+
+func (d *variantDictionary) setUint64(key string, value uint64) {
+	*d = append(*d, variantItem{kind: variantUInt64, key: key, value: binary.LittleEndian.AppendUint64(nil, value)})
+}
+
+// compositeKey hashes the master password the way KeePass does without a key file
+func compositeKey(password string) []byte {
+	inner := sha256.Sum256([]byte(password))
+	outer := sha256.Sum256(inner[:])
+	return outer[:]
+}
+
+// Bounds on the KDF parameters of a file, which can come from anywhere. They
+// leave room for the slowest settings KeePass and KeePassXC offer, but keep a
+// file from tying up the server for minutes or taking all of its memory.
+const (
+	maxAESRounds      = 100_000_000
+	maxArgon2Time     = 100
+	maxArgon2MemoryKB = 1 << 20 // 1 GiB
+)
+
+// transformKey runs the composite key through the KDF of the header
+func transformKey(kdf variantDictionary, key []byte) ([]byte, error) {
+	var id UUID
+	copy(id[:], kdf.bytes("$UUID"))
+
+	switch id {
+	case kdfAES:
+		seed := kdf.bytes("S")
+		rounds := kdf.uint("R")
+		if len(seed) != 32 {
+			return nil, errors.New("invalid AES-KDF seed")
+		}
+		if rounds > maxAESRounds {
+			return nil, fmt.Errorf("AES-KDF with %d rounds is more than the %d supported", rounds, maxAESRounds)
+		}
+		block, err := aes.NewCipher(seed)
+		if err != nil {
+			return nil, err
+		}
+		transformed := make([]byte, len(key))
+		copy(transformed, key)
+		for i := uint64(0); i < rounds; i++ {
+			block.Encrypt(transformed[:16], transformed[:16])
+			block.Encrypt(transformed[16:], transformed[16:])
+		}
+		sum := sha256.Sum256(transformed)
+		return sum[:], nil
+
+	case kdfArgon2d, kdfArgon2id:
+		salt := kdf.bytes("S")
+		iterations := kdf.uint("I")
+		memory := kdf.uint("M") / 1024
+		parallelism := kdf.uint("P")
+		if len(salt) == 0 || iterations == 0 || memory == 0 || parallelism == 0 || parallelism > math.MaxUint8 {
+			return nil, errors.New("invalid Argon2 parameters")
+		}
+		if iterations > maxArgon2Time || memory > maxArgon2MemoryKB {
+			return nil, fmt.Errorf("Argon2 with %d iterations over %d MiB is more than the %d iterations over %d MiB supported",
+				iterations, memory/1024, maxArgon2Time, maxArgon2MemoryKB/1024)
+		}
+		if v := kdf.uint("V"); v != argon2Version {
+			return nil, fmt.Errorf("unsupported Argon2 version %#x", v)
+		}
+		secret, data := kdf.bytes("K"), kdf.bytes("A")
+		if id == kdfArgon2id {
+			if len(secret) > 0 || len(data) > 0 {
+				return nil, errors.New("Argon2id with a secret or associated data isn't supported")
+			}
+			return argon2.IDKey(key, salt, uint32(iterations), uint32(memory), uint8(parallelism), 32), nil
+		}
+		return argon2d(key, salt, secret, data, uint32(iterations), uint32(memory), uint8(parallelism), 32), nil
+	}
+
+	return nil, errors.New("unsupported key derivation function")
+}
+
+// hmacKey derives the key the HMAC of the header and of every block is keyed with
+func hmacKey(masterSeed, transformedKey []byte) []byte {
+	h := sha512.New()
+	h.Write(masterSeed)
+	h.Write(transformedKey)
+	h.Write([]byte{1})
+	return h.Sum(nil)
+}
+
+// blockHMAC returns the HMAC of a block, the header is block math.MaxUint64
+func blockHMAC(key []byte, index uint64, data []byte) []byte {
+	blockKey := sha512.New()
+	binary.Write(blockKey, binary.LittleEndian, index)
+	blockKey.Write(key)
+
+	mac := hmac.New(sha256.New, blockKey.Sum(nil))
+	if index != math.MaxUint64 {
+		binary.Write(mac, binary.LittleEndian, index)
+		binary.Write(mac, binary.LittleEndian, int32(len(data)))
+	}
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// readBlocks reads the HMAC protected block stream following the header
+func readBlocks(r *bytes.Reader, key []byte) ([]byte, error) {
+	var out bytes.Buffer
+	for index := uint64(0); ; index++ {
+		mac := make([]byte, sha256.Size)
+		var size int32
+		if _, err := io.ReadFull(r, mac); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			return nil, err
+		}
+		if size < 0 || int64(size) > int64(r.Len()) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		block := make([]byte, size)
+		if _, err := io.ReadFull(r, block); err != nil {
+			return nil, err
+		}
+		if !hmac.Equal(mac, blockHMAC(key, index, block)) {
+			return nil, response.WrapError(fmt.Errorf("block %d is corrupt", index), response.ErrInvalidExport)
+		}
+		if size == 0 {
+			return out.Bytes(), nil
+		}
+		out.Write(block)
+	}
+}
+
+// blockSize is the size of the blocks the payload is written in
+const blockSize = 1 << 20
+
+// writeBlocks writes data as an HMAC protected block stream, ending with an empty block
+func writeBlocks(w *bytes.Buffer, key []byte, data []byte) {
+	for index := uint64(0); ; index++ {
+		block := data[:min(len(data), blockSize)]
+		data = data[len(block):]
+		w.Write(blockHMAC(key, index, block))
+		binary.Write(w, binary.LittleEndian, int32(len(block)))
+		w.Write(block)
+		if len(block) == 0 {
+			return
+		}
+	}
+}
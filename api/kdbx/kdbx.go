@@ -0,0 +1,294 @@
+// Package kdbx reads and writes KeePass databases in the KDBX 4 format,
+// protected by a master password. Databases can use the AES-KDF, Argon2d or
+// Argon2id key derivation and AES-256 or ChaCha20 encryption.
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"passvault/response"
+	"time"
+
+	"golang.org/x/crypto/chacha20"
+)
+
+// UUID identifies groups and entries
+type UUID [16]byte
+
+// Database is a decrypted KeePass database
+type Database struct {
+	Name      string
+	Generator string
+	// RecycleBin is the group deleted entries are moved to, if any
+	RecycleBin UUID
+	Root       Group
+}
+
+// Group is a folder of entries and subgroups
+type Group struct {
+	UUID    UUID
+	Name    string
+	Notes   string
+	Times   Times
+	Groups  []Group
+	Entries []Entry
+}
+
+// Entry is a single record. Title, UserName, Password, URL and Notes are
+// stored as strings like any custom field.
+type Entry struct {
+	UUID     UUID
+	Tags     []string
+	Times    Times
+	Strings  []String
+	Binaries []Binary
+	// History holds earlier versions of the entry, oldest first
+	History []Entry
+}
+
+// String is a named value of an entry, protected values are kept encrypted
+// inside the XML
+type String struct {
+	Key       string
+	Value     string
+	Protected bool
+}
+
+// Binary is a file attached to an entry
+type Binary struct {
+	Name string
+	Data []byte
+}
+
+// Times are the timestamps KeePass keeps for groups and entries
+type Times struct {
+	Created  time.Time
+	Modified time.Time
+	Accessed time.Time
+	Expires  *time.Time
+}
+
+// Standard entry string keys
+const (
+	KeyTitle    = "Title"
+	KeyUserName = "UserName"
+	KeyPassword = "Password"
+	KeyURL      = "URL"
+	KeyNotes    = "Notes"
+)
+
+// Get returns the value of an entry string, empty when there is none
+func (e *Entry) Get(key string) string {
+	for _, s := range e.Strings {
+		if s.Key == key {
+			return s.Value
+		}
+	}
+	return ""
+}
+
+// NewUUID returns a random UUID for a new group or entry
+func NewUUID() UUID {
+	var u UUID
+	rand.Read(u[:])
+	return u
+}
+
+// Ciphers the payload can be encrypted with
+const (
+	CipherAES      = "aes"
+	CipherChaCha20 = "chacha20"
+)
+
+// Key derivation functions turning the master password into a key
+const (
+	KDFArgon2d  = "argon2d"
+	KDFArgon2id = "argon2id"
+	KDFAES      = "aes"
+)
+
+// Options controls how a database is written
+type Options struct {
+	// Cipher is CipherAES or CipherChaCha20, AES when empty
+	Cipher string
+	// KDF is one of the KDF constants, Argon2d when empty like KeePass
+	KDF string
+}
+
+// Read decrypts a KDBX 4 database. A wrong password is reported as
+// response.ErrInvalidPassphrase.
+func Read(data []byte, password string) (*Database, error) {
+	r := bytes.NewReader(data)
+	h, err := readHeader(r, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(h.masterSeed) != 32 {
+		return nil, errors.New("invalid master seed")
+	}
+
+	checksum := make([]byte, sha256.Size)
+	mac := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(r, checksum); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, mac); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(h.raw)
+	if subtle.ConstantTimeCompare(checksum, sum[:]) != 1 {
+		return nil, errors.New("header checksum mismatch")
+	}
+
+	transformed, err := transformKey(h.kdf, compositeKey(password))
+	if err != nil {
+		return nil, err
+	}
+	macKey := hmacKey(h.masterSeed, transformed)
+	if subtle.ConstantTimeCompare(mac, blockHMAC(macKey, math.MaxUint64, h.raw)) != 1 {
+		return nil, response.ErrInvalidPassphrase
+	}
+
+	payload, err := readBlocks(r, macKey)
+	if err != nil {
+		return nil, err
+	}
+	if payload, err = crypt(h, transformed, payload, false); err != nil {
+		return nil, err
+	}
+	if h.compressed {
+		zr, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		if payload, err = io.ReadAll(zr); err != nil {
+			return nil, err
+		}
+	}
+
+	return readPayload(payload)
+}
+
+// Write encrypts a database as KDBX 4 under password
+func Write(db *Database, password string, opts Options) ([]byte, error) {
+	h := &header{compressed: true, masterSeed: random(32)}
+	switch opts.Cipher {
+	case "", CipherAES:
+		h.cipher, h.iv = cipherAES, random(16)
+	case CipherChaCha20:
+		h.cipher, h.iv = cipherChaCha20, random(12)
+	default:
+		return nil, fmt.Errorf("unknown cipher %q", opts.Cipher)
+	}
+
+	switch opts.KDF {
+	case "", KDFArgon2d, KDFArgon2id:
+		id := kdfArgon2d
+		if opts.KDF == KDFArgon2id {
+			id = kdfArgon2id
+		}
+		h.kdf.setBytes("$UUID", id[:])
+		h.kdf.setBytes("S", random(32))
+		h.kdf.setUint32("P", 4)
+		h.kdf.setUint64("M", 64<<20)
+		h.kdf.setUint64("I", 3)
+		h.kdf.setUint32("V", argon2Version)
+	case KDFAES:
+		h.kdf.setBytes("$UUID", kdfAES[:])
+		h.kdf.setBytes("S", random(32))
+		h.kdf.setUint64("R", 600000)
+	default:
+		return nil, fmt.Errorf("unknown key derivation function %q", opts.KDF)
+	}
+
+	transformed, err := transformKey(h.kdf, compositeKey(password))
+	if err != nil {
+		return nil, err
+	}
+	payload, err := writePayload(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(payload)
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	encrypted, err := crypt(h, transformed, compressed.Bytes(), true)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	raw := h.marshal()
+	sum := sha256.Sum256(raw)
+	macKey := hmacKey(h.masterSeed, transformed)
+	out.Write(raw)
+	out.Write(sum[:])
+	out.Write(blockHMAC(macKey, math.MaxUint64, raw))
+	writeBlocks(&out, macKey, encrypted)
+	return out.Bytes(), nil
+}
+
+// crypt encrypts or decrypts the payload with the cipher of the header
+func crypt(h *header, transformedKey, data []byte, encrypt bool) ([]byte, error) {
+	key := sha256.Sum256(append(append([]byte{}, h.masterSeed...), transformedKey...))
+
+	switch h.cipher {
+	case cipherAES:
+		block, err := aes.NewCipher(key[:])
+		if err != nil {
+			return nil, err
+		}
+		if len(h.iv) != aes.BlockSize {
+			return nil, errors.New("invalid encryption IV")
+		}
+		if encrypt {
+			// PKCS#7 padding, always at least one byte
+			padding := aes.BlockSize - len(data)%aes.BlockSize
+			data = append(data, bytes.Repeat([]byte{byte(padding)}, padding)...)
+			out := make([]byte, len(data))
+			cipher.NewCBCEncrypter(block, h.iv).CryptBlocks(out, data)
+			return out, nil
+		}
+		if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+			return nil, errors.New("invalid payload length")
+		}
+		out := make([]byte, len(data))
+		cipher.NewCBCDecrypter(block, h.iv).CryptBlocks(out, data)
+		padding := int(out[len(out)-1])
+		if padding == 0 || padding > aes.BlockSize || padding > len(out) {
+			return nil, errors.New("invalid payload padding")
+		}
+		return out[:len(out)-padding], nil
+
+	case cipherChaCha20:
+		stream, err := chacha20.NewUnauthenticatedCipher(key[:], h.iv)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, len(data))
+		stream.XORKeyStream(out, data)
+		return out, nil
+	}
+
+	return nil, errors.New("unsupported cipher, only AES-256 and ChaCha20 are supported")
+}
+
+// random returns n random bytes
+func random(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
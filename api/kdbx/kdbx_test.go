@@ -0,0 +1,171 @@
+package kdbx
+
+import (
+	"errors"
+	"math"
+	"passvault/response"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDatabase returns a database with a nested group, a protected password,
+// a custom field, an attachment and history
+func testDatabase() *Database {
+	created := time.Date(2025, 6, 23, 10, 0, 0, 0, time.UTC)
+	times := Times{Created: created, Modified: created, Accessed: created}
+	entry := Entry{
+		UUID:  NewUUID(),
+		Tags:  []string{"work", "email"},
+		Times: times,
+		Strings: []String{
+			{Key: KeyTitle, Value: "mail"},
+			{Key: KeyUserName, Value: "user"},
+			{Key: KeyPassword, Value: "pässword <&>", Protected: true},
+			{Key: KeyURL, Value: "https://mail.example"},
+			{Key: KeyNotes, Value: "line one\nline two"},
+			{Key: "PIN", Value: "1234", Protected: true},
+		},
+		Binaries: []Binary{{Name: "key.txt", Data: []byte{0, 1, 2, 255}}},
+	}
+	entry.History = []Entry{{UUID: entry.UUID, Times: times, Strings: []String{{Key: KeyTitle, Value: "mail"}, {Key: KeyPassword, Value: "old", Protected: true}}}}
+
+	return &Database{
+		Name:      "Vault",
+		Generator: "PassVault",
+		Root: Group{
+			UUID:  NewUUID(),
+			Name:  "Root",
+			Times: times,
+			Groups: []Group{{
+				UUID:    NewUUID(),
+				Name:    "Work",
+				Times:   times,
+				Entries: []Entry{entry},
+			}},
+		},
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	for _, cipher := range []string{CipherAES, CipherChaCha20} {
+		for _, kdf := range []string{KDFArgon2d, KDFArgon2id, KDFAES} {
+			t.Run(cipher+" "+kdf, func(t *testing.T) {
+				t.Parallel()
+				data, err := Write(testDatabase(), "master password", Options{Cipher: cipher, KDF: kdf})
+				if err != nil {
+					t.Fatal(err)
+				}
+				db, err := Read(data, "master password")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if db.Name != "Vault" || len(db.Root.Groups) != 1 || db.Root.Groups[0].Name != "Work" {
+					t.Fatalf("database = %+v", db)
+				}
+				entries := db.Root.Groups[0].Entries
+				if len(entries) != 1 {
+					t.Fatalf("entries = %+v", entries)
+				}
+				entry := entries[0]
+				for key, want := range map[string]string{
+					KeyTitle:    "mail",
+					KeyPassword: "pässword <&>",
+					KeyNotes:    "line one\nline two",
+					"PIN":       "1234",
+				} {
+					if got := entry.Get(key); got != want {
+						t.Errorf("%s = %q, want %q", key, got, want)
+					}
+				}
+				if !slices.Equal(entry.Tags, []string{"work", "email"}) {
+					t.Errorf("tags = %q", entry.Tags)
+				}
+				if len(entry.Binaries) != 1 || string(entry.Binaries[0].Data) != "\x00\x01\x02\xff" {
+					t.Errorf("binaries = %+v", entry.Binaries)
+				}
+				if len(entry.History) != 1 || entry.History[0].Get(KeyPassword) != "old" {
+					t.Errorf("history = %+v", entry.History)
+				}
+				if !entry.Times.Created.Equal(time.Date(2025, 6, 23, 10, 0, 0, 0, time.UTC)) {
+					t.Errorf("created = %v", entry.Times.Created)
+				}
+
+				if _, err := Read(data, "wrong password"); !errors.Is(err, response.ErrInvalidPassphrase) {
+					t.Errorf("Read with the wrong password = %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestReadDamaged(t *testing.T) {
+	data, err := Write(testDatabase(), "master password", Options{KDF: KDFAES})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(data []byte) []byte
+	}{
+		{"signature", func(data []byte) []byte { data[0] ^= 1; return data }},
+		{"header", func(data []byte) []byte { data[20] ^= 1; return data }},
+		{"payload", func(data []byte) []byte { data[len(data)-40] ^= 1; return data }},
+		{"truncated", func(data []byte) []byte { return data[:len(data)/2] }},
+		{"empty", func(data []byte) []byte { return nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Read(tt.change(slices.Clone(data)), "master password"); err == nil {
+				t.Fatal("Read of a damaged file succeeded")
+			}
+		})
+	}
+}
+
+func TestTransformKeyBounds(t *testing.T) {
+	aes := func(rounds uint64) variantDictionary {
+		var d variantDictionary
+		d.setBytes("$UUID", kdfAES[:])
+		d.setBytes("S", make([]byte, 32))
+		d.setUint64("R", rounds)
+		return d
+	}
+	argon := func(id UUID, iterations, memory uint64, parallelism uint32) variantDictionary {
+		var d variantDictionary
+		d.setBytes("$UUID", id[:])
+		d.setBytes("S", make([]byte, 32))
+		d.setUint64("I", iterations)
+		d.setUint64("M", memory)
+		d.setUint32("P", parallelism)
+		d.setUint32("V", argon2Version)
+		return d
+	}
+
+	tests := []struct {
+		name string
+		kdf  variantDictionary
+		want string
+	}{
+		{"AES rounds", aes(maxAESRounds + 1), "more than"},
+		{"AES rounds overflow", aes(math.MaxUint64), "more than"},
+		{"Argon2d memory", argon(kdfArgon2d, 2, 64<<30, 1), "more than"},
+		{"Argon2id memory", argon(kdfArgon2id, 2, math.MaxUint64, 1), "more than"},
+		{"Argon2 iterations", argon(kdfArgon2d, maxArgon2Time+1, 1<<20, 1), "more than"},
+		{"Argon2 no parallelism", argon(kdfArgon2d, 2, 1<<20, 0), "invalid Argon2 parameters"},
+		{"Argon2 too much parallelism", argon(kdfArgon2d, 2, 1<<20, 256), "invalid Argon2 parameters"},
+		{"Argon2 no memory", argon(kdfArgon2d, 2, 0, 1), "invalid Argon2 parameters"},
+		{"unknown", variantDictionary{}, "unsupported key derivation function"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := transformKey(tt.kdf, compositeKey("master password"))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("transformKey = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,475 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/salsa20/salsa"
+)
+
+// The XML document inside the payload. Field order matters when writing:
+// protected values are encrypted with one stream in document order.
+type xmlFile struct {
+	XMLName xml.Name `xml:"KeePassFile"`
+	Meta    xmlMeta  `xml:"Meta"`
+	Root    xmlRoot  `xml:"Root"`
+}
+
+type xmlMeta struct {
+	Generator         string              `xml:"Generator"`
+	DatabaseName      string              `xml:"DatabaseName"`
+	MemoryProtection  xmlMemoryProtection `xml:"MemoryProtection"`
+	RecycleBinEnabled string              `xml:"RecycleBinEnabled"`
+	RecycleBinUUID    string              `xml:"RecycleBinUUID"`
+}
+
+type xmlMemoryProtection struct {
+	ProtectTitle    string `xml:"ProtectTitle"`
+	ProtectUserName string `xml:"ProtectUserName"`
+	ProtectPassword string `xml:"ProtectPassword"`
+	ProtectURL      string `xml:"ProtectURL"`
+	ProtectNotes    string `xml:"ProtectNotes"`
+}
+
+type xmlRoot struct {
+	Group          xmlGroup `xml:"Group"`
+	DeletedObjects struct{} `xml:"DeletedObjects"`
+}
+
+type xmlGroup struct {
+	UUID       string     `xml:"UUID"`
+	Name       string     `xml:"Name"`
+	Notes      string     `xml:"Notes"`
+	IconID     int        `xml:"IconID"`
+	Times      xmlTimes   `xml:"Times"`
+	IsExpanded string     `xml:"IsExpanded"`
+	Entries    []xmlEntry `xml:"Entry"`
+	Groups     []xmlGroup `xml:"Group"`
+}
+
+type xmlEntry struct {
+	UUID     string      `xml:"UUID"`
+	IconID   int         `xml:"IconID"`
+	Tags     string      `xml:"Tags"`
+	Times    xmlTimes    `xml:"Times"`
+	Strings  []xmlString `xml:"String"`
+	Binaries []xmlBinary `xml:"Binary"`
+	History  *xmlHistory `xml:"History"`
+}
+
+type xmlHistory struct {
+	Entries []xmlEntry `xml:"Entry"`
+}
+
+type xmlString struct {
+	Key   string   `xml:"Key"`
+	Value xmlValue `xml:"Value"`
+}
+
+// xmlValue is a string value. Protected values are encrypted in the file,
+// once decrypted they are marked ProtectInMemory like KeePass's XML export does.
+type xmlValue struct {
+	Protected       string `xml:"Protected,attr,omitempty"`
+	ProtectInMemory string `xml:"ProtectInMemory,attr,omitempty"`
+	Text            string `xml:",chardata"`
+}
+
+type xmlBinary struct {
+	Key   string `xml:"Key"`
+	Value struct {
+		Ref string `xml:"Ref,attr"`
+	} `xml:"Value"`
+}
+
+type xmlTimes struct {
+	LastModificationTime string `xml:"LastModificationTime"`
+	CreationTime         string `xml:"CreationTime"`
+	LastAccessTime       string `xml:"LastAccessTime"`
+	ExpiryTime           string `xml:"ExpiryTime"`
+	Expires              string `xml:"Expires"`
+	UsageCount           int    `xml:"UsageCount"`
+	LocationChanged      string `xml:"LocationChanged"`
+}
+
+// readPayload parses the decrypted payload, the inner header followed by the XML
+func readPayload(payload []byte) (*Database, error) {
+	r := bytes.NewReader(payload)
+	var streamID uint32
+	var streamKey []byte
+	var binaries [][]byte
+
+	for done := false; !done; {
+		id, value, err := readField(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid inner header: %w", err)
+		}
+		switch id {
+		case innerHeaderEnd:
+			done = true
+		case innerHeaderStreamID:
+			if len(value) != 4 {
+				return nil, errors.New("invalid inner stream ID")
+			}
+			streamID = binary.LittleEndian.Uint32(value)
+		case innerHeaderStreamKey:
+			streamKey = value
+		case innerHeaderBinary:
+			// The first byte holds flags, the data follows
+			if len(value) == 0 {
+				return nil, errors.New("invalid binary")
+			}
+			binaries = append(binaries, value[1:])
+		}
+	}
+
+	stream, err := newInnerStream(streamID, streamKey)
+	if err != nil {
+		return nil, err
+	}
+	document, err := unprotect(payload[len(payload)-r.Len():], stream)
+	if err != nil {
+		return nil, fmt.Errorf("invalid XML: %w", err)
+	}
+
+	var file xmlFile
+	if err := xml.Unmarshal(document, &file); err != nil {
+		return nil, fmt.Errorf("invalid XML: %w", err)
+	}
+
+	db := &Database{
+		Name:       file.Meta.DatabaseName,
+		Generator:  file.Meta.Generator,
+		RecycleBin: parseUUID(file.Meta.RecycleBinUUID),
+	}
+	if db.Root, err = file.Root.Group.group(binaries); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// newInnerStream returns the cipher protecting values inside the XML
+func newInnerStream(id uint32, key []byte) (cipher.Stream, error) {
+	switch id {
+	case streamChaCha20:
+		hash := sha512.Sum512(key)
+		return chacha20.NewUnauthenticatedCipher(hash[:32], hash[32:44])
+	case streamSalsa20:
+		return &salsa20Stream{key: sha256.Sum256(key), nonce: [8]byte{0xE8, 0x30, 0x09, 0x4B, 0x97, 0x20, 0x5D, 0x2A}}, nil
+	}
+	return nil, fmt.Errorf("unsupported inner stream %d", id)
+}
+
+// salsa20Stream is Salsa20 as a continuous stream, older databases protect
+// values with it
+type salsa20Stream struct {
+	key     [32]byte
+	nonce   [8]byte
+	counter uint64
+	buf     []byte
+}
+
+func (s *salsa20Stream) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if len(s.buf) == 0 {
+			var counter [16]byte
+			copy(counter[:8], s.nonce[:])
+			binary.LittleEndian.PutUint64(counter[8:], s.counter)
+			s.buf = make([]byte, 64)
+			salsa.XORKeyStream(s.buf, s.buf, &counter, &s.key)
+			s.counter++
+		}
+		dst[i] = src[i] ^ s.buf[0]
+		s.buf = s.buf[1:]
+	}
+}
+
+// unprotect decrypts every protected value of the XML in document order and
+// marks it ProtectInMemory instead
+func unprotect(document []byte, stream cipher.Stream) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(document))
+	var out bytes.Buffer
+	encoder := xml.NewEncoder(&out)
+
+	var protected bool
+	var text []byte
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			for i, attr := range t.Attr {
+				if t.Name.Local == "Value" && attr.Name.Local == "Protected" && strings.EqualFold(attr.Value, "true") {
+					protected, text = true, nil
+					t.Attr[i] = xml.Attr{Name: xml.Name{Local: "ProtectInMemory"}, Value: "True"}
+				}
+			}
+			token = t
+		case xml.CharData:
+			if protected {
+				text = append(text, t...)
+				continue
+			}
+		case xml.EndElement:
+			if protected {
+				data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(text)))
+				if err != nil {
+					return nil, err
+				}
+				stream.XORKeyStream(data, data)
+				if err := encoder.EncodeToken(xml.CharData(data)); err != nil {
+					return nil, err
+				}
+				protected = false
+			}
+		case xml.ProcInst:
+			continue
+		}
+
+		if err := encoder.EncodeToken(xml.CopyToken(token)); err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func (g *xmlGroup) group(binaries [][]byte) (Group, error) {
+	group := Group{UUID: parseUUID(g.UUID), Name: g.Name, Notes: g.Notes, Times: g.Times.times()}
+	for i := range g.Entries {
+		entry, err := g.Entries[i].entry(binaries)
+		if err != nil {
+			return Group{}, err
+		}
+		group.Entries = append(group.Entries, entry)
+	}
+	for i := range g.Groups {
+		child, err := g.Groups[i].group(binaries)
+		if err != nil {
+			return Group{}, err
+		}
+		group.Groups = append(group.Groups, child)
+	}
+	return group, nil
+}
+
+func (e *xmlEntry) entry(binaries [][]byte) (Entry, error) {
+	entry := Entry{UUID: parseUUID(e.UUID), Times: e.Times.times()}
+	for _, tag := range strings.FieldsFunc(e.Tags, func(r rune) bool { return r == ';' || r == ',' }) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			entry.Tags = append(entry.Tags, tag)
+		}
+	}
+	for _, s := range e.Strings {
+		entry.Strings = append(entry.Strings, String{
+			Key:       s.Key,
+			Value:     s.Value.Text,
+			Protected: strings.EqualFold(s.Value.ProtectInMemory, "true"),
+		})
+	}
+	for _, b := range e.Binaries {
+		ref, err := strconv.Atoi(b.Value.Ref)
+		if err != nil || ref < 0 || ref >= len(binaries) {
+			return Entry{}, fmt.Errorf("attachment %q references a missing binary", b.Key)
+		}
+		entry.Binaries = append(entry.Binaries, Binary{Name: b.Key, Data: binaries[ref]})
+	}
+	if e.History != nil {
+		for i := range e.History.Entries {
+			old, err := e.History.Entries[i].entry(binaries)
+			if err != nil {
+				return Entry{}, err
+			}
+			entry.History = append(entry.History, old)
+		}
+	}
+	return entry, nil
+}
+
+// writer builds the XML document, encrypting protected values as it goes and
+// collecting attachments into the binary pool of the inner header
+type writer struct {
+	stream   cipher.Stream
+	binaries [][]byte
+	refs     map[string]int
+}
+
+// writePayload encodes the inner header and the XML of a database
+func writePayload(db *Database) ([]byte, error) {
+	streamKey := random(64)
+	stream, err := newInnerStream(streamChaCha20, streamKey)
+	if err != nil {
+		return nil, err
+	}
+	w := &writer{stream: stream, refs: map[string]int{}}
+
+	file := xmlFile{
+		Meta: xmlMeta{
+			Generator:    "PassVault",
+			DatabaseName: db.Name,
+			MemoryProtection: xmlMemoryProtection{
+				ProtectTitle:    "False",
+				ProtectUserName: "False",
+				ProtectPassword: "True",
+				ProtectURL:      "False",
+				ProtectNotes:    "False",
+			},
+			RecycleBinEnabled: "True",
+			RecycleBinUUID:    formatUUID(db.RecycleBin),
+		},
+		Root: xmlRoot{Group: w.group(&db.Root)},
+	}
+	document, err := xml.MarshalIndent(file, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writeField(&buf, innerHeaderStreamID, binary.LittleEndian.AppendUint32(nil, streamChaCha20))
+	writeField(&buf, innerHeaderStreamKey, streamKey)
+	for _, data := range w.binaries {
+		writeField(&buf, innerHeaderBinary, append([]byte{0}, data...))
+	}
+	writeField(&buf, innerHeaderEnd, nil)
+	buf.WriteString(xml.Header)
+	buf.Write(document)
+	return buf.Bytes(), nil
+}
+
+func (w *writer) group(g *Group) xmlGroup {
+	group := xmlGroup{
+		UUID:       formatUUID(g.UUID),
+		Name:       g.Name,
+		Notes:      g.Notes,
+		IconID:     48,
+		Times:      formatTimes(g.Times),
+		IsExpanded: "True",
+	}
+	// Entries come before subgroups, in the order they are marshalled
+	for i := range g.Entries {
+		group.Entries = append(group.Entries, w.entry(&g.Entries[i]))
+	}
+	for i := range g.Groups {
+		group.Groups = append(group.Groups, w.group(&g.Groups[i]))
+	}
+	return group
+}
+
+func (w *writer) entry(e *Entry) xmlEntry {
+	entry := xmlEntry{
+		UUID:  formatUUID(e.UUID),
+		Tags:  strings.Join(e.Tags, ";"),
+		Times: formatTimes(e.Times),
+	}
+	for _, s := range e.Strings {
+		value := xmlValue{Text: s.Value}
+		if s.Protected {
+			data := []byte(s.Value)
+			w.stream.XORKeyStream(data, data)
+			value = xmlValue{Protected: "True", Text: base64.StdEncoding.EncodeToString(data)}
+		}
+		entry.Strings = append(entry.Strings, xmlString{Key: s.Key, Value: value})
+	}
+	for _, b := range e.Binaries {
+		// Identical attachments share one binary, as they do in KeePass
+		ref, ok := w.refs[string(b.Data)]
+		if !ok {
+			ref = len(w.binaries)
+			w.binaries = append(w.binaries, b.Data)
+			w.refs[string(b.Data)] = ref
+		}
+		binary := xmlBinary{Key: b.Name}
+		binary.Value.Ref = strconv.Itoa(ref)
+		entry.Binaries = append(entry.Binaries, binary)
+	}
+	if len(e.History) > 0 {
+		entry.History = &xmlHistory{}
+		for i := range e.History {
+			entry.History.Entries = append(entry.History.Entries, w.entry(&e.History[i]))
+		}
+	}
+	return entry
+}
+
+// epoch is where KDBX 4 timestamps count seconds from
+var epoch = time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// parseTime reads a KDBX 4 timestamp, base64 encoded seconds since epoch, or
+// an ISO 8601 one as older versions write
+func parseTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if data, err := base64.StdEncoding.DecodeString(s); err == nil && len(data) == 8 {
+		seconds := int64(binary.LittleEndian.Uint64(data))
+		return time.Unix(epoch.Unix()+seconds, 0).UTC()
+	}
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	seconds := t.Unix() - epoch.Unix()
+	return base64.StdEncoding.EncodeToString(binary.LittleEndian.AppendUint64(nil, uint64(seconds)))
+}
+
+func (t xmlTimes) times() Times {
+	times := Times{
+		Created:  parseTime(t.CreationTime),
+		Modified: parseTime(t.LastModificationTime),
+		Accessed: parseTime(t.LastAccessTime),
+	}
+	if strings.EqualFold(t.Expires, "true") {
+		expiry := parseTime(t.ExpiryTime)
+		times.Expires = &expiry
+	}
+	return times
+}
+
+func formatTimes(t Times) xmlTimes {
+	times := xmlTimes{
+		CreationTime:         formatTime(t.Created),
+		LastModificationTime: formatTime(t.Modified),
+		LastAccessTime:       formatTime(t.Accessed),
+		ExpiryTime:           formatTime(t.Modified),
+		Expires:              "False",
+		LocationChanged:      formatTime(t.Modified),
+	}
+	if t.Expires != nil {
+		times.ExpiryTime = formatTime(*t.Expires)
+		times.Expires = "True"
+	}
+	return times
+}
+
+func parseUUID(s string) UUID {
+	var u UUID
+	if data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s)); err == nil && len(data) == len(u) {
+		copy(u[:], data)
+	}
+	return u
+}
+
+func formatUUID(u UUID) string {
+	return base64.StdEncoding.EncodeToString(u[:])
+}
@@ -2,29 +2,68 @@ package main
 
 import (
 	"embed"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
-	api "passvault/config"
-	"passvault/db"
+	"os"
+	"passvault/cmd"
+	"path/filepath"
+	"strings"
 )
 
 //go:embed static
 var staticFiles embed.FS
 
 func main() {
-	config := api.LoadConfig()
-	fmt.Printf("Starting the vault on port %s...\n", config.Port)
+	// Without a command, or with only flags, the server starts as it always has
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	// Linked as a credential helper, the name of the binary is the command
+	switch strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe") {
+	case "git-credential-passvault":
+		command, args = "git-credential", os.Args[1:]
+	case "docker-credential-passvault":
+		command, args = "docker-credential", os.Args[1:]
+	}
 
-	// Initialize the database
-	if err := db.InitializeGlobalDB(staticFiles); err != nil {
-		log.Fatal("Failed to initialize database:", err)
+	var err error
+	switch command {
+	case "serve":
+		err = cmd.Serve(args, staticFiles)
+	case "init":
+		err = cmd.Init(args, staticFiles)
+	case "migrate":
+		err = cmd.Migrate(args, staticFiles)
+	case "backup":
+		err = cmd.Backup(args, staticFiles)
+	case "restore":
+		err = cmd.Restore(args, staticFiles)
+	case "doctor":
+		err = cmd.Doctor(args)
+	case "tui":
+		err = cmd.TUI(args, staticFiles)
+	case "help":
+		fmt.Print(cmd.Usage)
+	default:
+		// Client commands talk to a running server over its API
+		if !cmd.IsClientCommand(command) {
+			fmt.Fprint(os.Stderr, cmd.Usage)
+			err = fmt.Errorf("unknown command %q", command)
+			break
+		}
+		err = cmd.RunClient(command, args)
 	}
-	defer db.CloseDB()
 
-	app := api.StartServer()
-	api.Middleware(app)
-	api.SetupRoutes(app)
-	api.ServeUI(app, staticFiles) // Pass the embedded files
-	fmt.Println(config.Port)
-	api.StartListening(app, config.Port)
+	// A command run by passvault run hands its exit code on, and credential
+	// helpers report their own errors
+	var exitErr *cmd.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.Code)
+	}
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintln(os.Stderr, "passvault:", err)
+		os.Exit(1)
+	}
 }
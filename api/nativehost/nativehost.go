@@ -0,0 +1,402 @@
+// Package nativehost is the native messaging host of the browser extension.
+// It speaks the native messaging protocol of Chrome and Firefox, JSON
+// messages with a length in front on stdin and stdout, and finds, fills in
+// and saves logins of the vault for the extension. Extensions are paired
+// with a code first, after which their requests and the answers are sealed
+// with NaCl boxes under the keys exchanged on pairing.
+package nativehost
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"passvault/response"
+	"passvault/structs"
+	"passvault/totp"
+	"passvault/urlmatch"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+const (
+	// maxMessageSize is the largest message read or written, browsers take
+	// no more than 1 MB from a host
+	maxMessageSize = 1 << 20
+	// maxClockSkew is how far the time of a request may be off, older
+	// requests are taken for replays
+	maxClockSkew = 2 * time.Minute
+)
+
+// Error codes of responses, for the extension to act on
+const (
+	codeInvalidMessage = "invalid_message"
+	codeUnknownClient  = "unknown_client"
+	codePairingFailed  = "pairing_failed"
+	codeLocked         = "locked"
+	codeNoMatch        = "no_match"
+	codeInvalidRequest = "invalid_request"
+	codeServerError    = "server_error"
+)
+
+var (
+	errInvalidRequest = errors.New("invalid request")
+	errNoMatch        = errors.New("the login doesn't match the page")
+)
+
+// Vault is where the host reads and saves logins
+type Vault interface {
+	// Unlocked reports whether there is a session to read the vault with
+	Unlocked() (bool, error)
+	// Match returns the logins to fill in on a page, best first. It fails
+	// with response.ErrUnauthorized while the vault is locked.
+	Match(page string) ([]urlmatch.Match, error)
+	CreateCredential(cred structs.Credential) (int, error)
+	UpdateCredential(id int, cred structs.Credential) error
+}
+
+// envelope is a message as it goes over stdio. Pairing and errors before a
+// client is known travel in the clear, anything else is sealed into
+// Message.
+type envelope struct {
+	// ID is chosen by the extension and repeated in the response
+	ID       string `json:"id,omitempty"`
+	Action   string `json:"action,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	Nonce    []byte `json:"nonce,omitempty"`
+	Message  []byte `json:"message,omitempty"`
+
+	// Code, Name and PublicKey pair a client, HostKey is the answer
+	Code      string `json:"code,omitempty"`
+	Name      string `json:"name,omitempty"`
+	PublicKey []byte `json:"public_key,omitempty"`
+	HostKey   []byte `json:"host_key,omitempty"`
+
+	Error  string `json:"error,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// request is a sealed request of a paired client
+type request struct {
+	Action string `json:"action"`
+	// Time is when the request was sent, in Unix seconds
+	Time       int64  `json:"time"`
+	URL        string `json:"url,omitempty"`
+	Credential int    `json:"credential,omitempty"`
+	Username   string `json:"username,omitempty"`
+	Password   string `json:"password,omitempty"`
+	Name       string `json:"name,omitempty"`
+}
+
+// failure is the sealed answer to a request that failed
+type failure struct {
+	Error  string `json:"error"`
+	Reason string `json:"reason"`
+}
+
+// Host answers the messages of one extension, the one the browser started
+// it for
+type Host struct {
+	statePath string
+	vault     Vault
+	extension string
+	// seen are the nonces of the requests answered, a request seen before
+	// is a replay
+	seen map[[24]byte]bool
+}
+
+// New returns a host for an extension, keeping its state at statePath
+func New(statePath string, vault Vault, extension string) *Host {
+	return &Host{statePath: statePath, vault: vault, extension: extension, seen: map[[24]byte]bool{}}
+}
+
+// Serve answers messages until the browser closes stdin
+func (h *Host) Serve(r io.Reader, w io.Writer) error {
+	for {
+		data, err := readMessage(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var env envelope
+		var reply *envelope
+		if err := json.Unmarshal(data, &env); err != nil {
+			reply = clearError(codeInvalidMessage, err)
+		} else {
+			reply = h.handle(env)
+		}
+		reply.ID = env.ID
+		if err := writeMessage(w, reply); err != nil {
+			return err
+		}
+	}
+}
+
+// handle answers a message. The state is read anew every time, so pairing
+// and unpairing from the command line take effect while the host runs.
+func (h *Host) handle(env envelope) *envelope {
+	state, err := LoadState(h.statePath)
+	if err != nil {
+		return clearError(codeServerError, err)
+	}
+	if env.Action == "pair" {
+		return h.pair(state, env)
+	}
+
+	client := state.client(env.ClientID)
+	if client == nil || client.Extension != h.extension {
+		return clearError(codeUnknownClient, errors.New("the extension isn't paired, pair it with passvault native-host pair"))
+	}
+	if len(env.Nonce) != 24 || len(state.HostKey) != 32 {
+		return clearError(codeInvalidMessage, errors.New("missing nonce"))
+	}
+	nonce := [24]byte(env.Nonce)
+	peer, key := (*[32]byte)(client.PublicKey), (*[32]byte)(state.HostKey)
+	plain, ok := box.Open(nil, env.Message, &nonce, peer, key)
+	if !ok {
+		return clearError(codeInvalidMessage, errors.New("the message can't be opened"))
+	}
+	var req request
+	if err := json.Unmarshal(plain, &req); err != nil {
+		return clearError(codeInvalidMessage, err)
+	}
+	sent := time.Unix(req.Time, 0)
+	if h.seen[nonce] || time.Since(sent).Abs() > maxClockSkew {
+		return clearError(codeInvalidMessage, errors.New("the request is a replay or the clock is off"))
+	}
+	h.seen[nonce] = true
+
+	result, err := h.answer(req)
+	if err != nil {
+		result = requestFailure(err)
+	}
+	sealed, err := seal(result, peer, key)
+	if err != nil {
+		return clearError(codeServerError, err)
+	}
+	return sealed
+}
+
+// pair pairs the extension with the code entered in it, and answers with
+// the ID of the client and the key of the host
+func (h *Host) pair(state *State, env envelope) *envelope {
+	client, err := state.pair(env.Code, h.extension, env.Name, env.PublicKey)
+	// A wrong code still counts against the pairing
+	if saveErr := state.Save(); err == nil {
+		err = saveErr
+	}
+	if errors.Is(err, errPairing) {
+		return clearError(codePairingFailed, err)
+	}
+	if err != nil {
+		return clearError(codeServerError, err)
+	}
+	hostKey, err := state.hostKeys()
+	if err != nil {
+		return clearError(codeServerError, err)
+	}
+	log.Printf("Paired %s (%s) as %s", h.extension, client.Name, client.ID)
+	return &envelope{ClientID: client.ID, HostKey: hostKey}
+}
+
+// answer carries out a request of a paired client
+func (h *Host) answer(req request) (any, error) {
+	switch req.Action {
+	case "status":
+		unlocked, err := h.vault.Unlocked()
+		return map[string]bool{"unlocked": unlocked}, err
+	case "match":
+		return h.match(req)
+	case "fill":
+		return h.fill(req)
+	case "save":
+		return h.save(req)
+	}
+	return nil, fmt.Errorf("%w: unknown action %q", errInvalidRequest, req.Action)
+}
+
+// match lists the logins for a page, best matches first and without their
+// secrets
+func (h *Host) match(req request) (any, error) {
+	page, err := pageURL(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := h.vault.Match(page.String())
+	if err != nil {
+		return nil, err
+	}
+	type entry struct {
+		Credential int    `json:"credential"`
+		Name       string `json:"name"`
+		Username   string `json:"username"`
+		Folder     string `json:"folder,omitempty"`
+		URL        string `json:"url"`
+		TOTP       bool   `json:"totp"`
+	}
+	entries := []entry{}
+	for _, m := range matches {
+		entries = append(entries, entry{
+			Credential: m.ID,
+			Name:       m.Name,
+			Username:   m.Username,
+			Folder:     m.FolderPath,
+			URL:        m.MatchedURL,
+			TOTP:       m.TOTP != "",
+		})
+	}
+	return map[string]any{"credentials": entries}, nil
+}
+
+// fill returns the username, password and current TOTP code of a login,
+// only for a page the login matches
+func (h *Host) fill(req request) (any, error) {
+	page, err := pageURL(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := h.vault.Match(page.String())
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(matches, func(m urlmatch.Match) bool { return m.ID == req.Credential })
+	if i < 0 {
+		return nil, errNoMatch
+	}
+	cred := matches[i].Credential
+	filled := map[string]string{"username": cred.Username, "password": cred.Password}
+	if key, err := totp.Parse(cred.TOTP); cred.TOTP != "" && err == nil {
+		filled["totp"] = key.Code(time.Now())
+	}
+	return filled, nil
+}
+
+// save keeps a login entered on a page. The password of a login with the
+// same username for the same host is updated, otherwise a login is added.
+func (h *Host) save(req request) (any, error) {
+	page, err := pageURL(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	if req.Password == "" {
+		return nil, fmt.Errorf("%w: missing password", errInvalidRequest)
+	}
+	matches, err := h.vault.Match(page.String())
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range matches {
+		if m.Score < urlmatch.ScoreHost || m.Username != req.Username {
+			continue
+		}
+		if m.Password == req.Password {
+			return map[string]any{"credential": m.ID, "result": "unchanged"}, nil
+		}
+		m.Password = req.Password
+		if err := h.vault.UpdateCredential(m.ID, m.Credential); err != nil {
+			return nil, err
+		}
+		return map[string]any{"credential": m.ID, "result": "updated"}, nil
+	}
+
+	name := req.Name
+	if name == "" {
+		name = page.Hostname()
+	}
+	id, err := h.vault.CreateCredential(structs.Credential{
+		Name:     name,
+		Username: req.Username,
+		Password: req.Password,
+		ItemType: structs.ItemTypeLogin,
+		URLs:     []string{page.Scheme + "://" + page.Host},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"credential": id, "result": "created"}, nil
+}
+
+// readMessage reads a message, its length in native byte order followed by
+// that many bytes of JSON
+func readMessage(r io.Reader) ([]byte, error) {
+	var size uint32
+	if err := binary.Read(r, binary.NativeEndian, &size); err != nil {
+		return nil, err
+	}
+	if size > maxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes is too large", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// writeMessage writes a message as readMessage reads it
+func writeMessage(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxMessageSize {
+		return fmt.Errorf("message of %d bytes is too large", len(data))
+	}
+	if err := binary.Write(w, binary.NativeEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// seal seals a result for a client under a fresh nonce
+func seal(v any, peer, key *[32]byte) (*envelope, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var nonce [24]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	return &envelope{Nonce: nonce[:], Message: box.Seal(nil, data, &nonce, peer, key)}, nil
+}
+
+// clearError is an error answered in the clear
+func clearError(code string, err error) *envelope {
+	return &envelope{Error: code, Reason: err.Error()}
+}
+
+// requestFailure maps the error of a request onto its code
+func requestFailure(err error) failure {
+	switch {
+	case errors.Is(err, response.ErrUnauthorized):
+		return failure{codeLocked, "the vault is locked, log in with passvault login"}
+	case errors.Is(err, errNoMatch):
+		return failure{codeNoMatch, err.Error()}
+	case errors.Is(err, errInvalidRequest):
+		return failure{codeInvalidRequest, err.Error()}
+	}
+	log.Printf("Request failed: %v", err)
+	return failure{codeServerError, err.Error()}
+}
+
+// pageURL parses the URL of the page a request is for, which has to be a
+// web page
+func pageURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("%w: %q is not the URL of a web page", errInvalidRequest, raw)
+	}
+	u.Host = strings.ToLower(u.Host)
+	return u, nil
+}
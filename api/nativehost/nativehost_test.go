@@ -0,0 +1,304 @@
+package nativehost
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"passvault/response"
+	"passvault/structs"
+	"passvault/urlmatch"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// fakeVault keeps logins in memory
+type fakeVault struct {
+	creds  []structs.Credential
+	locked bool
+}
+
+func (v *fakeVault) Unlocked() (bool, error) {
+	return !v.locked, nil
+}
+
+func (v *fakeVault) Match(page string) ([]urlmatch.Match, error) {
+	if v.locked {
+		return nil, response.ErrUnauthorized
+	}
+	u, err := urlmatch.ParsePage(page)
+	if err != nil {
+		return nil, err
+	}
+	return urlmatch.Find(v.creds, u), nil
+}
+
+func (v *fakeVault) CreateCredential(cred structs.Credential) (int, error) {
+	cred.ID = len(v.creds) + 1
+	v.creds = append(v.creds, cred)
+	return cred.ID, nil
+}
+
+func (v *fakeVault) UpdateCredential(id int, cred structs.Credential) error {
+	cred.ID = id
+	v.creds[id-1] = cred
+	return nil
+}
+
+// testClient is an extension paired with a host
+type testClient struct {
+	id      string
+	key     *[32]byte
+	hostKey *[32]byte
+}
+
+// exchange sends a message to a host and returns its answer
+func exchange(t *testing.T, h *Host, env envelope) envelope {
+	t.Helper()
+	var in, out bytes.Buffer
+	if err := writeMessage(&in, env); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Serve(&in, &out); err != nil {
+		t.Fatal(err)
+	}
+	data, err := readMessage(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply envelope
+	if err := json.Unmarshal(data, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.ID != env.ID {
+		t.Fatalf("reply ID = %q, want %q", reply.ID, env.ID)
+	}
+	return reply
+}
+
+// pairClient starts a pairing in the state of a host and pairs a new client
+// with its code
+func pairClient(t *testing.T, h *Host) *testClient {
+	t.Helper()
+	state, err := LoadState(h.statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := state.StartPairing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+	publicKey, key, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := exchange(t, h, envelope{ID: "pair", Action: "pair", Code: code, Name: "browser", PublicKey: publicKey[:]})
+	if reply.Error != "" || reply.ClientID == "" || len(reply.HostKey) != 32 {
+		t.Fatalf("pair = %+v", reply)
+	}
+	return &testClient{id: reply.ClientID, key: key, hostKey: (*[32]byte)(reply.HostKey)}
+}
+
+// sealRequest seals a request of a client under a fresh nonce
+func (c *testClient) sealRequest(t *testing.T, req request) envelope {
+	t.Helper()
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nonce [24]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		t.Fatal(err)
+	}
+	return envelope{ID: req.Action, ClientID: c.id, Nonce: nonce[:], Message: box.Seal(nil, data, &nonce, c.hostKey, c.key)}
+}
+
+// open opens the sealed answer of a host into v
+func (c *testClient) open(t *testing.T, reply envelope, v any) {
+	t.Helper()
+	if reply.Error != "" {
+		t.Fatalf("reply = %s: %s", reply.Error, reply.Reason)
+	}
+	plain, ok := box.Open(nil, reply.Message, (*[24]byte)(reply.Nonce), c.hostKey, c.key)
+	if !ok {
+		t.Fatal("the reply can't be opened")
+	}
+	if err := json.Unmarshal(plain, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPairing(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	h := New(statePath, &fakeVault{}, "ext")
+
+	reply := exchange(t, h, envelope{ID: "1", Action: "pair", Code: "AAAA-AAAA", PublicKey: newKey(1)})
+	if reply.Error != codePairingFailed {
+		t.Fatalf("pair without a pairing = %+v", reply)
+	}
+
+	state, err := LoadState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := state.StartPairing(); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+	for attempt := 1; attempt <= maxPairingAttempts; attempt++ {
+		reply := exchange(t, h, envelope{ID: "2", Action: "pair", Code: "AAAA-AAAA", PublicKey: newKey(1)})
+		if reply.Error != codePairingFailed {
+			t.Fatalf("pair with a wrong code = %+v", reply)
+		}
+		// Attempts are kept, so starting the host anew doesn't reset them
+		state, err := LoadState(statePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if attempt < maxPairingAttempts && state.Pairing.Attempts != attempt {
+			t.Fatalf("attempts = %d, want %d", state.Pairing.Attempts, attempt)
+		}
+		if attempt == maxPairingAttempts && state.Pairing != nil {
+			t.Fatal("the pairing is still under way after too many wrong codes")
+		}
+	}
+
+	client := pairClient(t, h)
+	var status map[string]bool
+	client.open(t, exchange(t, h, client.sealRequest(t, request{Action: "status", Time: time.Now().Unix()})), &status)
+	if !status["unlocked"] {
+		t.Fatalf("status = %v", status)
+	}
+
+	// The client is paired with this extension only
+	other := New(statePath, &fakeVault{}, "other")
+	if reply := exchange(t, other, client.sealRequest(t, request{Action: "status", Time: time.Now().Unix()})); reply.Error != codeUnknownClient {
+		t.Fatalf("request to another extension = %+v", reply)
+	}
+}
+
+func TestRequests(t *testing.T) {
+	login := structs.Credential{ID: 1, Name: "example", Username: "dev", Password: "hunter22", ItemType: structs.ItemTypeLogin, URLs: []string{"https://example.com"}, TOTP: "JBSWY3DPEHPK3PXP"}
+	tests := []struct {
+		name   string
+		req    request
+		locked bool
+		want   string
+		// creds are the logins of the vault afterwards
+		creds int
+	}{
+		{name: "status", req: request{Action: "status"}, want: `{"unlocked":true}`, creds: 1},
+		{name: "status locked", req: request{Action: "status"}, locked: true, want: `{"unlocked":false}`, creds: 1},
+		{name: "match", req: request{Action: "match", URL: "https://example.com/login"}, want: `{"credentials":[{"credential":1,"name":"example","username":"dev","url":"https://example.com","totp":true}]}`, creds: 1},
+		{name: "match nothing", req: request{Action: "match", URL: "https://other.example.org"}, want: `{"credentials":[]}`, creds: 1},
+		{name: "match locked", req: request{Action: "match", URL: "https://example.com"}, locked: true, want: `{"error":"locked","reason":"the vault is locked, log in with passvault login"}`, creds: 1},
+		{name: "fill on another page", req: request{Action: "fill", URL: "https://other.example.org", Credential: 1}, want: `{"error":"no_match","reason":"the login doesn't match the page"}`, creds: 1},
+		{name: "fill on a file", req: request{Action: "fill", URL: "file:///etc/passwd", Credential: 1}, want: `{"error":"invalid_request","reason":"invalid request: \"file:///etc/passwd\" is not the URL of a web page"}`, creds: 1},
+		{name: "save unchanged", req: request{Action: "save", URL: "https://example.com/login", Username: "dev", Password: "hunter22"}, want: `{"credential":1,"result":"unchanged"}`, creds: 1},
+		{name: "save updated", req: request{Action: "save", URL: "https://example.com/login", Username: "dev", Password: "hunter23"}, want: `{"credential":1,"result":"updated"}`, creds: 1},
+		{name: "save created", req: request{Action: "save", URL: "https://example.com/login", Username: "ops", Password: "hunter22"}, want: `{"credential":2,"result":"created"}`, creds: 2},
+		{name: "save without a password", req: request{Action: "save", URL: "https://example.com/login", Username: "ops"}, want: `{"error":"invalid_request","reason":"invalid request: missing password"}`, creds: 1},
+		{name: "unknown action", req: request{Action: "export"}, want: `{"error":"invalid_request","reason":"invalid request: unknown action \"export\""}`, creds: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vault := &fakeVault{creds: []structs.Credential{login}, locked: tt.locked}
+			h := New(filepath.Join(t.TempDir(), "state.json"), vault, "ext")
+			client := pairClient(t, h)
+
+			tt.req.Time = time.Now().Unix()
+			var got json.RawMessage
+			client.open(t, exchange(t, h, client.sealRequest(t, tt.req)), &got)
+			if string(got) != tt.want {
+				t.Fatalf("%s = %s, want %s", tt.req.Action, got, tt.want)
+			}
+			if len(vault.creds) != tt.creds {
+				t.Fatalf("vault holds %d logins, want %d", len(vault.creds), tt.creds)
+			}
+		})
+	}
+
+	t.Run("fill", func(t *testing.T) {
+		h := New(filepath.Join(t.TempDir(), "state.json"), &fakeVault{creds: []structs.Credential{login}}, "ext")
+		client := pairClient(t, h)
+		var filled map[string]string
+		client.open(t, exchange(t, h, client.sealRequest(t, request{Action: "fill", URL: "https://example.com/login", Credential: 1, Time: time.Now().Unix()})), &filled)
+		if filled["username"] != "dev" || filled["password"] != "hunter22" || len(filled["totp"]) != 6 {
+			t.Fatalf("fill = %v", filled)
+		}
+	})
+}
+
+func TestRejectedRequests(t *testing.T) {
+	h := New(filepath.Join(t.TempDir(), "state.json"), &fakeVault{}, "ext")
+	client := pairClient(t, h)
+	replayed := client.sealRequest(t, request{Action: "status", Time: time.Now().Unix()})
+	exchange(t, h, replayed)
+
+	tampered := client.sealRequest(t, request{Action: "status", Time: time.Now().Unix()})
+	tampered.Message[0] ^= 1
+	stranger := *client
+	_, stranger.key, _ = box.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name string
+		env  envelope
+		want string
+	}{
+		{"replay", replayed, codeInvalidMessage},
+		{"old", client.sealRequest(t, request{Action: "status", Time: time.Now().Add(-time.Hour).Unix()}), codeInvalidMessage},
+		{"future", client.sealRequest(t, request{Action: "status", Time: time.Now().Add(time.Hour).Unix()}), codeInvalidMessage},
+		{"tampered", tampered, codeInvalidMessage},
+		{"other key", stranger.sealRequest(t, request{Action: "status", Time: time.Now().Unix()}), codeInvalidMessage},
+		{"no nonce", envelope{ClientID: client.id, Message: replayed.Message}, codeInvalidMessage},
+		{"unknown client", envelope{ClientID: "nobody", Nonce: replayed.Nonce, Message: replayed.Message}, codeUnknownClient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if reply := exchange(t, h, tt.env); reply.Error != tt.want {
+				t.Fatalf("reply = %+v, want %s", reply, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessages(t *testing.T) {
+	var large bytes.Buffer
+	binary.Write(&large, binary.NativeEndian, uint32(maxMessageSize+1))
+	tests := []struct {
+		name  string
+		input []byte
+		err   string
+	}{
+		{"too large", large.Bytes(), "too large"},
+		{"cut short", append(binary.NativeEndian.AppendUint32(nil, 10), "{}"...), "unexpected EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readMessage(bytes.NewReader(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("readMessage = %v, want %q", err, tt.err)
+			}
+		})
+	}
+
+	// Messages that aren't JSON are answered, not fatal
+	var in, out bytes.Buffer
+	in.Write(binary.NativeEndian.AppendUint32(nil, 3))
+	in.WriteString("{{{")
+	if err := New(filepath.Join(t.TempDir(), "state.json"), &fakeVault{}, "ext").Serve(&in, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), codeInvalidMessage) {
+		t.Fatalf("answer = %q", out.String())
+	}
+}
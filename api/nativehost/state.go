@@ -0,0 +1,186 @@
+package nativehost
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+const (
+	// pairingTimeout is how long a pairing code can be used
+	pairingTimeout = 5 * time.Minute
+	// maxPairingAttempts is how many wrong codes end a pairing
+	maxPairingAttempts = 3
+	// codeAlphabet are the characters of pairing codes, without the ones
+	// easily taken for others
+	codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+var errPairing = errors.New("wrong or expired pairing code, run passvault native-host pair for a new one")
+
+// State is what the host keeps between runs: its key, the extensions
+// allowed to start it and the clients paired with it. It is written to a
+// file only the user can read.
+type State struct {
+	// HostKey is the private X25519 key messages to clients are sealed with
+	HostKey []byte `json:"host_key,omitempty"`
+	// Extensions are the IDs of the extensions allowed to start the host
+	Extensions []string `json:"extensions"`
+	Clients    []Client `json:"clients"`
+	// Pairing is the pairing started with passvault native-host pair
+	Pairing *Pairing `json:"pairing,omitempty"`
+
+	path string
+}
+
+// Client is an extension paired with the host
+type Client struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Extension string    `json:"extension"`
+	PublicKey []byte    `json:"public_key"`
+	PairedAt  time.Time `json:"paired_at"`
+}
+
+// Pairing is a pairing code waiting to be entered in an extension. Only its
+// hash is kept.
+type Pairing struct {
+	CodeHash  []byte    `json:"code_hash"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Attempts  int       `json:"attempts"`
+}
+
+// LoadState reads the state kept at path. A missing file is an empty state.
+func LoadState(path string) (*State, error) {
+	state := &State{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Save writes the state back to its file, readable by the user only
+func (s *State) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// AllowExtension lets an extension start the host
+func (s *State) AllowExtension(id string) {
+	if !slices.Contains(s.Extensions, id) {
+		s.Extensions = append(s.Extensions, id)
+	}
+}
+
+// Allowed reports whether an extension may start the host
+func (s *State) Allowed(id string) bool {
+	return slices.Contains(s.Extensions, id)
+}
+
+// StartPairing replaces any pairing under way with a new one, and returns
+// its code
+func (s *State) StartPairing() (string, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	code := make([]byte, len(random))
+	for i, b := range random {
+		code[i] = codeAlphabet[int(b)%len(codeAlphabet)]
+	}
+	hash := sha256.Sum256(code)
+	s.Pairing = &Pairing{CodeHash: hash[:], ExpiresAt: time.Now().Add(pairingTimeout)}
+	return string(code[:4]) + "-" + string(code[4:]), nil
+}
+
+// Unpair forgets a client, and reports whether it was paired
+func (s *State) Unpair(id string) bool {
+	n := len(s.Clients)
+	s.Clients = slices.DeleteFunc(s.Clients, func(c Client) bool { return c.ID == id })
+	return len(s.Clients) != n
+}
+
+// client returns the paired client with an ID, nil when there is none
+func (s *State) client(id string) *Client {
+	i := slices.IndexFunc(s.Clients, func(c Client) bool { return c.ID == id })
+	if i < 0 {
+		return nil
+	}
+	return &s.Clients[i]
+}
+
+// pair pairs a client with the code of the pairing under way. A wrong code
+// counts as an attempt, the pairing ends after too many.
+func (s *State) pair(code, extension, name string, publicKey []byte) (*Client, error) {
+	if s.Pairing == nil || time.Now().After(s.Pairing.ExpiresAt) || len(publicKey) != 32 {
+		return nil, errPairing
+	}
+	normalized := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	hash := sha256.Sum256([]byte(normalized))
+	if subtle.ConstantTimeCompare(hash[:], s.Pairing.CodeHash) != 1 {
+		s.Pairing.Attempts++
+		if s.Pairing.Attempts >= maxPairingAttempts {
+			s.Pairing = nil
+		}
+		return nil, errPairing
+	}
+	s.Pairing = nil
+
+	if _, err := s.hostKeys(); err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	// Pairing the same key again replaces the client it was paired as
+	s.Clients = slices.DeleteFunc(s.Clients, func(c Client) bool { return subtle.ConstantTimeCompare(c.PublicKey, publicKey) == 1 })
+	s.Clients = append(s.Clients, Client{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Extension: extension,
+		PublicKey: publicKey,
+		PairedAt:  time.Now(),
+	})
+	return &s.Clients[len(s.Clients)-1], nil
+}
+
+// hostKeys returns the public key of the host, generating its key pair the
+// first time
+func (s *State) hostKeys() (publicKey []byte, err error) {
+	if len(s.HostKey) != curve25519.ScalarSize {
+		s.HostKey = make([]byte, curve25519.ScalarSize)
+		if _, err := rand.Read(s.HostKey); err != nil {
+			return nil, err
+		}
+	}
+	return curve25519.X25519(s.HostKey, curve25519.Basepoint)
+}
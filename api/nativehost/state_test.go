@@ -0,0 +1,188 @@
+package nativehost
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newKey returns a public key of the size clients send
+func newKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func TestStartPairing(t *testing.T) {
+	var state State
+	code, err := state.StartPairing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != 9 || code[4] != '-' {
+		t.Fatalf("code = %q, want XXXX-XXXX", code)
+	}
+	for _, c := range strings.ReplaceAll(code, "-", "") {
+		if !strings.ContainsRune(codeAlphabet, c) {
+			t.Fatalf("code %q holds %q, which isn't in the alphabet", code, c)
+		}
+	}
+	if time.Until(state.Pairing.ExpiresAt) > pairingTimeout || state.Pairing.Attempts != 0 {
+		t.Fatalf("pairing = %+v", state.Pairing)
+	}
+
+	// A new pairing replaces the code of the one under way
+	again, err := state.StartPairing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := state.pair(code, "ext", "browser", newKey(1)); again != code && !errors.Is(err, errPairing) {
+		t.Fatalf("pair with the replaced code = %v, want %v", err, errPairing)
+	}
+}
+
+func TestPair(t *testing.T) {
+	tests := []struct {
+		name string
+		// wrong are the wrong codes entered before code
+		wrong   int
+		code    func(code string) string
+		key     []byte
+		expired bool
+		err     error
+	}{
+		{name: "code", code: func(code string) string { return code }},
+		{name: "lower case without dash", code: func(code string) string { return strings.ToLower(strings.ReplaceAll(code, "-", "")) }},
+		{name: "spaces", code: func(code string) string { return " " + strings.ReplaceAll(code, "-", " ") }},
+		{name: "after a wrong code", wrong: maxPairingAttempts - 1, code: func(code string) string { return code }},
+		{name: "after too many wrong codes", wrong: maxPairingAttempts, code: func(code string) string { return code }, err: errPairing},
+		{name: "wrong code", code: func(string) string { return "AAAA-AAAA" }, err: errPairing},
+		{name: "expired", code: func(code string) string { return code }, expired: true, err: errPairing},
+		{name: "short key", code: func(code string) string { return code }, key: newKey(1)[:16], err: errPairing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var state State
+			code, err := state.StartPairing()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.expired {
+				state.Pairing.ExpiresAt = time.Now().Add(-time.Second)
+			}
+			for range tt.wrong {
+				if _, err := state.pair("AAAA-AAAA", "ext", "browser", newKey(1)); !errors.Is(err, errPairing) {
+					t.Fatalf("pair with a wrong code = %v", err)
+				}
+			}
+			key := tt.key
+			if key == nil {
+				key = newKey(1)
+			}
+
+			client, err := state.pair(tt.code(code), "ext", "browser", key)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("pair = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				if len(state.Clients) != 0 {
+					t.Fatalf("clients = %+v after a failed pairing", state.Clients)
+				}
+				return
+			}
+			if state.Pairing != nil {
+				t.Fatal("the pairing is still under way")
+			}
+			if client.Extension != "ext" || client.Name != "browser" || len(client.ID) != 32 || state.client(client.ID) == nil {
+				t.Fatalf("client = %+v", client)
+			}
+			if len(state.HostKey) != 32 {
+				t.Fatalf("host key of %d bytes", len(state.HostKey))
+			}
+			if _, err := state.pair(tt.code(code), "ext", "browser", key); !errors.Is(err, errPairing) {
+				t.Fatalf("pair with a used code = %v, want %v", err, errPairing)
+			}
+		})
+	}
+}
+
+func TestPairAgain(t *testing.T) {
+	var state State
+	pair := func(key []byte) *Client {
+		t.Helper()
+		code, err := state.StartPairing()
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := state.pair(code, "ext", "browser", key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return client
+	}
+
+	first := pair(newKey(1)).ID
+	hostKey := append([]byte(nil), state.HostKey...)
+	second := pair(newKey(2)).ID
+	third := pair(newKey(1)).ID
+	if len(state.Clients) != 2 || state.client(first) != nil || state.client(second) == nil || state.client(third) == nil {
+		t.Fatalf("clients = %+v, want the first replaced by the third", state.Clients)
+	}
+	if !bytes.Equal(state.HostKey, hostKey) {
+		t.Fatal("the host key changed on pairing")
+	}
+
+	if !state.Unpair(second) || state.Unpair(second) || len(state.Clients) != 1 {
+		t.Fatalf("clients = %+v after unpairing", state.Clients)
+	}
+}
+
+func TestStateSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "host", "state.json")
+	state, err := LoadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Allowed("ext") {
+		t.Fatal("an empty state allows an extension")
+	}
+	state.AllowExtension("ext")
+	state.AllowExtension("ext")
+	code, err := state.StartPairing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := state.pair("AAAA-AAAA", "ext", "browser", newKey(1)); !errors.Is(err, errPairing) {
+		t.Fatal(err)
+	}
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("state file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	loaded, err := LoadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Extensions) != 1 || !loaded.Allowed("ext") || loaded.Pairing == nil || loaded.Pairing.Attempts != 1 {
+		t.Fatalf("loaded %+v", loaded)
+	}
+	if _, err := loaded.pair(code, "ext", "browser", newKey(1)); err != nil {
+		t.Fatalf("pair after loading = %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadState(path); err == nil {
+		t.Fatal("LoadState read a broken file")
+	}
+}
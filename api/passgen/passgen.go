@@ -0,0 +1,85 @@
+// Package passgen generates random passwords
+package passgen
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+// Character sets passwords are drawn from
+const (
+	Lower   = "abcdefghijklmnopqrstuvwxyz"
+	Upper   = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	Digits  = "0123456789"
+	Symbols = "!@#$%^&*()-_=+[]{};:,.?/"
+)
+
+// Options selects the length of a password and the sets it is drawn from
+type Options struct {
+	Length    int
+	NoUpper   bool
+	NoDigits  bool
+	NoSymbols bool
+}
+
+// DefaultLength is the length passwords have when none is asked for
+const DefaultLength = 24
+
+// Generate returns a random password. It holds at least one character of
+// every selected set, so it passes rules asking for each of them.
+func Generate(opts Options) (string, error) {
+	sets := []string{Lower}
+	if !opts.NoUpper {
+		sets = append(sets, Upper)
+	}
+	if !opts.NoDigits {
+		sets = append(sets, Digits)
+	}
+	if !opts.NoSymbols {
+		sets = append(sets, Symbols)
+	}
+	if opts.Length == 0 {
+		opts.Length = DefaultLength
+	}
+	if opts.Length < len(sets) || opts.Length > 1024 {
+		return "", fmt.Errorf("the length must be between %d and 1024", len(sets))
+	}
+
+	var all string
+	password := make([]byte, 0, opts.Length)
+	for _, set := range sets {
+		all += set
+		c, err := pick(set)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+	for len(password) < opts.Length {
+		c, err := pick(all)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+
+	// Shuffle, so the required characters aren't always up front
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j.Int64()] = password[j.Int64()], password[i]
+	}
+	return string(password), nil
+}
+
+// pick returns a random character of set
+func pick(set string) (byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(set))))
+	if err != nil {
+		return 0, err
+	}
+	return set[n.Int64()], nil
+}
@@ -0,0 +1,379 @@
+// Package passstore reads and writes password stores in the layout of pass,
+// the standard unix password manager. Every entry is a file encrypted with
+// OpenPGP, directories are folders. The vault can be imported from a store,
+// exported into one, or mirrored into one at an interval.
+package passstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"passvault/response"
+	"passvault/store"
+	"passvault/structs"
+	"passvault/transfer"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// Options configures a manager
+type Options struct {
+	// Dir is the store imports and exports use when none is given
+	Dir string
+	// PublicKeyFile holds the keys exported and mirrored entries are encrypted for
+	PublicKeyFile string
+	// SecretKeyFile holds the keys imported entries are decrypted with
+	SecretKeyFile string
+	// MirrorDir is the store the vault is mirrored into, empty disables the mirror
+	MirrorDir string
+}
+
+// Manager moves credentials between the vault and password stores
+type Manager struct {
+	store store.Store
+	opts  Options
+	// mirrored holds a hash of every entry the mirror last wrote, so unchanged
+	// entries aren't encrypted anew on every run
+	mirrored map[string][32]byte
+	// mu keeps exports and mirror runs from writing at the same time
+	mu sync.Mutex
+}
+
+// NewManager returns a manager for the vault in s
+func NewManager(s store.Store, opts Options) *Manager {
+	return &Manager{store: s, opts: opts, mirrored: map[string][32]byte{}}
+}
+
+// MirrorEnabled reports whether a mirror directory is configured
+func (m *Manager) MirrorEnabled() bool {
+	return m.opts.MirrorDir != ""
+}
+
+// storeDir returns dir, or the default store when it is empty. The store has
+// to exist when it is read from.
+func (m *Manager) storeDir(dir string, mustExist bool) (string, error) {
+	if dir == "" {
+		dir = m.opts.Dir
+	}
+	if dir == "" {
+		return "", response.ErrPassStoreNotFound
+	}
+	if mustExist {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return "", fmt.Errorf("%w: %s", response.ErrPassStoreNotFound, dir)
+		}
+	}
+	return dir, nil
+}
+
+// Import decrypts every entry of the store at dir with the secret key,
+// unlocked with passphrase, and imports them like any other import. Entries
+// that can't be decrypted are skipped.
+func (m *Manager) Import(dir, passphrase string, opts transfer.ImportOptions) (*structs.ImportResult, error) {
+	dir, err := m.storeDir(dir, true)
+	if err != nil {
+		return nil, err
+	}
+	if m.opts.SecretKeyFile == "" {
+		return nil, response.ErrPassKeyRequired
+	}
+	keys, err := ReadSecretKeys(m.opts.SecretKeyFile, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+	payload := &transfer.Payload{
+		Folders:     []structs.Folder{},
+		Tags:        []string{},
+		Credentials: []structs.Credential{},
+		Rows:        []int{},
+		Skipped:     []structs.ImportItem{},
+		Warnings:    []structs.ImportWarning{},
+	}
+	for i, name := range names {
+		entry, err := ReadEntry(dir, name, keys)
+		if err != nil {
+			payload.Skipped = append(payload.Skipped, structs.ImportItem{Row: i + 1, Name: name, Reason: err.Error()})
+			continue
+		}
+		payload.Credentials = append(payload.Credentials, credentialOf(entry))
+		payload.Rows = append(payload.Rows, i+1)
+	}
+	return transfer.Import(m.store, payload, opts)
+}
+
+// Export encrypts every live credential into the store at dir. Entries
+// already in the store are overwritten, others are left alone. The store is
+// set up for the configured keys when it has no .gpg-id yet.
+func (m *Manager) Export(dir string) (*structs.PassSyncResult, error) {
+	dir, err := m.storeDir(dir, false)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	recipients, entries, result, err := m.prepare(dir)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".gpg-id")); errors.Is(err, fs.ErrNotExist) {
+		if err := WriteGPGID(dir, recipients); err != nil {
+			return nil, err
+		}
+	}
+	for _, entry := range entries {
+		if err := WriteEntry(dir, entry, recipients); err != nil {
+			return nil, err
+		}
+		result.Written++
+	}
+	return result, nil
+}
+
+// Mirror brings the mirror store up to date with the vault. Only entries that
+// changed since the last run are written, entries no longer in the vault are
+// removed.
+func (m *Manager) Mirror() (*structs.PassSyncResult, error) {
+	if !m.MirrorEnabled() {
+		return nil, response.ErrPassStoreNotFound
+	}
+	dir := m.opts.MirrorDir
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	recipients, entries, result, err := m.prepare(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := WriteGPGID(dir, recipients); err != nil {
+		return nil, err
+	}
+	existing, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+	present := map[string]bool{}
+	for _, name := range existing {
+		present[name] = true
+	}
+
+	var fingerprints strings.Builder
+	for _, key := range recipients {
+		fmt.Fprintf(&fingerprints, "%X\n", key.PrimaryKey.Fingerprint)
+	}
+	mirrored := make(map[string][32]byte, len(entries))
+	for _, entry := range entries {
+		hash := sha256.Sum256(append([]byte(fingerprints.String()), entry.Marshal()...))
+		mirrored[entry.Name] = hash
+		if present[entry.Name] && m.mirrored[entry.Name] == hash {
+			result.Unchanged++
+			continue
+		}
+		if err := WriteEntry(dir, entry, recipients); err != nil {
+			return nil, err
+		}
+		result.Written++
+	}
+	for _, name := range existing {
+		if _, ok := mirrored[name]; ok {
+			continue
+		}
+		if err := RemoveEntry(dir, name); err != nil {
+			return nil, err
+		}
+		result.Removed++
+	}
+	m.mirrored = mirrored
+	return result, nil
+}
+
+// prepare reads the recipients and turns every live credential into an entry
+func (m *Manager) prepare(dir string) (openpgp.EntityList, []Entry, *structs.PassSyncResult, error) {
+	if m.opts.PublicKeyFile == "" {
+		return nil, nil, nil, response.ErrPassKeyRequired
+	}
+	recipients, err := ReadPublicKeys(m.opts.PublicKeyFile)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	payload, err := transfer.Collect(m.store)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	result := &structs.PassSyncResult{Dir: dir, Warnings: []structs.ImportWarning{}}
+	used := map[string]bool{}
+	entries := make([]Entry, 0, len(payload.Credentials))
+	for _, cred := range payload.Credentials {
+		entry, warnings := entryOf(cred, used)
+		entries = append(entries, entry)
+		for _, warning := range warnings {
+			result.Warnings = append(result.Warnings, structs.ImportWarning{Name: entry.Name, Message: warning})
+		}
+	}
+	return recipients, entries, result, nil
+}
+
+// Run mirrors the vault every interval until ctx is cancelled. Failures are
+// logged and retried at the next interval.
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			result, err := m.Mirror()
+			if err != nil {
+				log.Printf("Password store mirror failed: %v", err)
+				continue
+			}
+			if result.Written > 0 || result.Removed > 0 {
+				log.Printf("Mirrored %d entries into %s, removed %d", result.Written, result.Dir, result.Removed)
+			}
+		}
+	}
+}
+
+// Keys of entry fields that map onto credential fields
+var (
+	usernameKeys = []string{"login", "username", "user", "email"}
+	urlKeys      = []string{"url", "website"}
+	totpKeys     = []string{"totp", "otp"}
+)
+
+// credentialOf maps an entry onto a credential. The last part of the name is
+// the credential name, the directories above it its folder.
+func credentialOf(entry Entry) structs.Credential {
+	folder, name := path.Split(entry.Name)
+	cred := structs.Credential{
+		Name:        name,
+		Password:    entry.Password,
+		ItemType:    structs.ItemTypeLogin,
+		Description: entry.Notes,
+		FolderPath:  strings.TrimSuffix(folder, "/"),
+		TOTP:        entry.OTP,
+		URLs:        []string{},
+	}
+
+	for _, field := range entry.Fields {
+		key := strings.ToLower(field.Key)
+		switch {
+		case slices.Contains(usernameKeys, key) && cred.Username == "":
+			cred.Username = field.Value
+		case slices.Contains(urlKeys, key):
+			cred.URLs = append(cred.URLs, strings.TrimSpace(field.Value))
+		case slices.Contains(totpKeys, key) && cred.TOTP == "":
+			cred.TOTP = strings.TrimSpace(field.Value)
+		case key == "tags":
+			for _, tag := range strings.Split(field.Value, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					cred.Tags = append(cred.Tags, tag)
+				}
+			}
+		default:
+			cred.Fields = append(cred.Fields, structs.CustomField{Name: field.Key, Value: field.Value})
+		}
+	}
+	switch {
+	case cred.Username == "" && cred.Password == "":
+		cred.ItemType = structs.ItemTypeSecureNote
+	case cred.Username == "":
+		// Without a login field the entry is named after the username, as
+		// browserpass expects
+		cred.Username = name
+	}
+	return cred
+}
+
+// folderPathOf turns a folder path into the directories of an entry. Leading
+// dots are dropped like in names, so that no folder is hidden or steps out of
+// the store, and folders left empty are skipped.
+func folderPathOf(folderPath string) string {
+	var dirs []string
+	for _, folder := range strings.Split(folderPath, "/") {
+		if folder = strings.TrimLeft(strings.TrimSpace(folder), "."); folder != "" {
+			dirs = append(dirs, folder)
+		}
+	}
+	return strings.Join(dirs, "/")
+}
+
+// entryOf maps a credential onto an entry named after its folder and name.
+// used holds the names taken so far, clashing names are numbered. It
+// returns warnings about data the entry can't hold.
+func entryOf(cred structs.Credential, used map[string]bool) (Entry, []string) {
+	var warnings []string
+
+	// Slashes would nest the entry, and hidden files are left out by pass
+	base := strings.TrimLeft(strings.ReplaceAll(strings.TrimSpace(cred.Name), "/", "-"), ".")
+	if base == "" {
+		base = fmt.Sprintf("credential-%d", cred.ID)
+	}
+	if folders := folderPathOf(cred.FolderPath); folders != "" {
+		base = folders + "/" + base
+	}
+	name := base
+	for i := 2; used[name]; i++ {
+		name = fmt.Sprintf("%s (%d)", base, i)
+	}
+	used[name] = true
+
+	entry := Entry{Name: name, Password: strings.SplitN(cred.Password, "\n", 2)[0], Notes: cred.Description}
+	if cred.Username != "" {
+		entry.Fields = append(entry.Fields, Field{Key: "login", Value: cred.Username})
+	}
+	for _, u := range cred.URLs {
+		entry.Fields = append(entry.Fields, Field{Key: "url", Value: u})
+	}
+	if len(cred.Tags) > 0 {
+		entry.Fields = append(entry.Fields, Field{Key: "tags", Value: strings.Join(cred.Tags, ", ")})
+	}
+
+	var notes []string
+	for _, field := range cred.Fields {
+		// Values spanning lines don't fit on a field line, they go with the notes
+		if strings.Contains(field.Value, "\n") {
+			notes = append(notes, field.Name+":", field.Value)
+			warnings = append(warnings, fmt.Sprintf("custom field %q spans lines and is written to the notes", field.Name))
+			continue
+		}
+		entry.Fields = append(entry.Fields, Field{Key: field.Name, Value: field.Value})
+	}
+	if len(notes) > 0 {
+		if entry.Notes != "" {
+			notes = append(notes, entry.Notes)
+		}
+		entry.Notes = strings.Join(notes, "\n")
+	}
+
+	if cred.TOTP != "" {
+		entry.OTP = cred.TOTP
+		if !strings.HasPrefix(strings.ToLower(cred.TOTP), "otpauth://") {
+			// pass-otp only reads otpauth:// URIs
+			entry.OTP = "otpauth://totp/" + url.PathEscape(cred.Name) + "?secret=" + url.QueryEscape(strings.ReplaceAll(cred.TOTP, " ", ""))
+		}
+	}
+	if len(cred.Attachments) > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d attachments can't be written to a password store", len(cred.Attachments)))
+	}
+	return entry, warnings
+}
@@ -0,0 +1,260 @@
+package passstore
+
+import (
+	"os"
+	"passvault/store"
+	"passvault/structs"
+	"passvault/transfer"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func TestEntryOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		cred     structs.Credential
+		entry    Entry
+		warnings int
+	}{
+		{
+			name: "login",
+			cred: structs.Credential{Name: "mail", Username: "user", Password: "secret\nsecond line", FolderPath: "Work/Mail", URLs: []string{"https://mail.example"}, Tags: []string{"a", "b"}, Description: "notes"},
+			entry: Entry{Name: "Work/Mail/mail", Password: "secret", Notes: "notes", Fields: []Field{
+				{Key: "login", Value: "user"}, {Key: "url", Value: "https://mail.example"}, {Key: "tags", Value: "a, b"},
+			}},
+		},
+		{
+			name:  "slashes and dots in the name",
+			cred:  structs.Credential{ID: 7, Name: "../a/b", Password: "x"},
+			entry: Entry{Name: "-a-b", Password: "x"},
+		},
+		{
+			name:  "no name left",
+			cred:  structs.Credential{ID: 7, Name: "...", Password: "x"},
+			entry: Entry{Name: "credential-7", Password: "x"},
+		},
+		{
+			name:  "dot folders",
+			cred:  structs.Credential{Name: "mail", Password: "x", FolderPath: "../../.ssh/./Work"},
+			entry: Entry{Name: "ssh/Work/mail", Password: "x"},
+		},
+		{
+			name:  "folder of only dots",
+			cred:  structs.Credential{Name: "mail", Password: "x", FolderPath: ".."},
+			entry: Entry{Name: "mail", Password: "x"},
+		},
+		{
+			name:  "clashing name",
+			cred:  structs.Credential{Name: "taken", Password: "x"},
+			entry: Entry{Name: "taken (2)", Password: "x"},
+		},
+		{
+			name:  "base32 TOTP",
+			cred:  structs.Credential{Name: "a b", Password: "x", TOTP: "JBSW Y3DP"},
+			entry: Entry{Name: "a b", Password: "x", OTP: "otpauth://totp/a%20b?secret=JBSWY3DP"},
+		},
+		{
+			name: "fields and attachments",
+			cred: structs.Credential{Name: "n", Password: "x", Description: "notes",
+				Fields:      []structs.CustomField{{Name: "PIN", Value: "1234"}, {Name: "key", Value: "line1\nline2"}},
+				Attachments: []structs.Attachment{{Name: "a.txt"}},
+			},
+			entry:    Entry{Name: "n", Password: "x", Fields: []Field{{Key: "PIN", Value: "1234"}}, Notes: "key:\nline1\nline2\nnotes"},
+			warnings: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, warnings := entryOf(tt.cred, map[string]bool{"taken": true})
+			if !reflect.DeepEqual(entry, tt.entry) {
+				t.Fatalf("entryOf = %+v, want %+v", entry, tt.entry)
+			}
+			if len(warnings) != tt.warnings {
+				t.Fatalf("warnings = %q, want %d", warnings, tt.warnings)
+			}
+			if _, err := entryPath(t.TempDir(), entry.Name); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestEntryPath(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"mail", true},
+		{"Work/mail", true},
+		{"Work/../mail", true},
+		{"../mail", false},
+		{"Work/../../mail", false},
+		{"/etc/passwd", true},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := entryPath(dir, tt.name)
+			if (err == nil) != tt.ok {
+				t.Fatalf("entryPath(%q) = %q, %v", tt.name, path, err)
+			}
+			if err == nil && !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+				t.Fatalf("entryPath(%q) = %q, outside of %s", tt.name, path, dir)
+			}
+		})
+	}
+	if err := WriteEntry(dir, Entry{Name: "../escaped", Password: "x"}, nil); err == nil {
+		t.Fatal("WriteEntry wrote outside of the store")
+	}
+}
+
+func TestParseEntry(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Entry
+	}{
+		{"password only", "secret\n", Entry{Name: "e", Password: "secret"}},
+		{
+			"fields, otp and notes",
+			"secret\r\nlogin: user\nurl: https://a.example/x\notpauth://totp/a?secret=A\nfree text\n a: b\n",
+			Entry{Name: "e", Password: "secret", Fields: []Field{{Key: "login", Value: "user"}, {Key: "url", Value: "https://a.example/x"}}, OTP: "otpauth://totp/a?secret=A", Notes: "free text\n a: b"},
+		},
+		{"url as a line", "secret\nhttps://a.example\n", Entry{Name: "e", Password: "secret", Notes: "https://a.example"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseEntry("e", []byte(tt.content))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ParseEntry = %+v, want %+v", got, tt.want)
+			}
+			if again := ParseEntry("e", got.Marshal()); !reflect.DeepEqual(again, got) {
+				t.Fatalf("ParseEntry(Marshal) = %+v, want %+v", again, got)
+			}
+		})
+	}
+}
+
+func TestCredentialOf(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry Entry
+		want  structs.Credential
+	}{
+		{
+			name:  "login",
+			entry: Entry{Name: "Work/mail", Password: "secret", Fields: []Field{{Key: "Email", Value: "user"}, {Key: "website", Value: " https://a.example "}, {Key: "tags", Value: "a, ,b"}, {Key: "PIN", Value: "1"}}},
+			want: structs.Credential{Name: "mail", Username: "user", Password: "secret", ItemType: structs.ItemTypeLogin, FolderPath: "Work",
+				URLs: []string{"https://a.example"}, Tags: []string{"a", "b"}, Fields: []structs.CustomField{{Name: "PIN", Value: "1"}}},
+		},
+		{
+			name:  "named after the username",
+			entry: Entry{Name: "sites/user@example", Password: "secret", OTP: "otpauth://totp/a?secret=A"},
+			want:  structs.Credential{Name: "user@example", Username: "user@example", Password: "secret", ItemType: structs.ItemTypeLogin, FolderPath: "sites", URLs: []string{}, TOTP: "otpauth://totp/a?secret=A"},
+		},
+		{
+			name:  "note",
+			entry: Entry{Name: "note", Notes: "text"},
+			want:  structs.Credential{Name: "note", ItemType: structs.ItemTypeSecureNote, Description: "text", URLs: []string{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := credentialOf(tt.entry); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("credentialOf = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// writeKeys writes a fresh key pair to files and returns their paths
+func writeKeys(t *testing.T) (public, secret string) {
+	t.Helper()
+	entity, err := openpgp.NewEntity("PassVault", "", "test@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	public, secret = filepath.Join(dir, "public.gpg"), filepath.Join(dir, "secret.gpg")
+	for _, file := range []struct {
+		path      string
+		serialize func(*os.File) error
+	}{
+		{public, func(f *os.File) error { return entity.Serialize(f) }},
+		{secret, func(f *os.File) error { return entity.SerializePrivate(f, nil) }},
+	} {
+		f, err := os.Create(file.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := file.serialize(f); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	return public, secret
+}
+
+func TestExportMirrorImport(t *testing.T) {
+	public, secret := writeKeys(t)
+	vault := store.NewMemory()
+	work, err := vault.CreateFolder(structs.Folder{Name: "Work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mailID, err := vault.CreateCredential(structs.Credential{Name: "mail", Username: "user", Password: "password1", FolderID: &work})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.CreateCredential(structs.Credential{Name: "bank", Username: "user", Password: "password2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	storeDir, mirrorDir := t.TempDir(), t.TempDir()
+	m := NewManager(vault, Options{Dir: storeDir, PublicKeyFile: public, SecretKeyFile: secret, MirrorDir: mirrorDir})
+
+	if _, err := m.Export(""); err != nil {
+		t.Fatal(err)
+	}
+	names, err := List(storeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(names)
+	if want := []string{"Work/mail", "bank"}; !slices.Equal(names, want) {
+		t.Fatalf("exported %q, want %q", names, want)
+	}
+
+	// The second run only writes what changed and drops what is gone
+	if result, err := m.Mirror(); err != nil || result.Written != 2 {
+		t.Fatalf("first mirror = %+v, %v", result, err)
+	}
+	if err := vault.DeleteCredential(mailID); err != nil {
+		t.Fatal(err)
+	}
+	result, err := m.Mirror()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Written != 0 || result.Unchanged != 1 || result.Removed != 1 {
+		t.Fatalf("second mirror = %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(mirrorDir, "Work")); !os.IsNotExist(err) {
+		t.Fatalf("the emptied folder is still there: %v", err)
+	}
+
+	target := store.NewMemory()
+	imported, err := NewManager(target, Options{SecretKeyFile: secret}).Import(storeDir, "", transfer.ImportOptions{Mode: structs.ImportModeMerge})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.Created != 2 {
+		t.Fatalf("import = %+v", imported)
+	}
+}
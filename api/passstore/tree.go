@@ -0,0 +1,249 @@
+package passstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"passvault/response"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// Entry is a decrypted entry of a password store. The first line of the file
+// is the password, "key: value" lines after it are fields, an otpauth://
+// line is the one time password and everything else is notes.
+type Entry struct {
+	// Name is the slash separated path of the entry below the store, without .gpg
+	Name     string
+	Password string
+	Fields   []Field
+	OTP      string
+	Notes    string
+}
+
+// Field is a "key: value" line of an entry
+type Field struct {
+	Key   string
+	Value string
+}
+
+// ParseEntry reads the decrypted content of the entry at name
+func ParseEntry(name string, content []byte) Entry {
+	text := strings.TrimRight(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+	lines := strings.Split(text, "\n")
+	entry := Entry{Name: name, Password: lines[0]}
+
+	var notes []string
+	for _, line := range lines[1:] {
+		if strings.HasPrefix(line, "otpauth://") && entry.OTP == "" {
+			entry.OTP = strings.TrimSpace(line)
+			continue
+		}
+		// URLs have a colon too, keys never hold a slash
+		key, value, ok := strings.Cut(line, ": ")
+		if ok && key != "" && key == strings.TrimSpace(key) && !strings.Contains(key, "/") {
+			entry.Fields = append(entry.Fields, Field{Key: key, Value: value})
+			continue
+		}
+		notes = append(notes, line)
+	}
+	entry.Notes = strings.Trim(strings.Join(notes, "\n"), "\n")
+	return entry
+}
+
+// Marshal returns the content of an entry as pass writes it
+func (e Entry) Marshal() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(e.Password + "\n")
+	for _, field := range e.Fields {
+		buf.WriteString(field.Key + ": " + field.Value + "\n")
+	}
+	if e.OTP != "" {
+		buf.WriteString(e.OTP + "\n")
+	}
+	if e.Notes != "" {
+		buf.WriteString(e.Notes + "\n")
+	}
+	return buf.Bytes()
+}
+
+// ReadPublicKeys reads an armored or binary OpenPGP key ring from path, the
+// keys entries are encrypted for
+func ReadPublicKeys(path string) (openpgp.EntityList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys openpgp.EntityList
+	if bytes.Contains(data, []byte("-----BEGIN PGP")) {
+		keys, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	} else {
+		keys, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read OpenPGP keys from %s: %w", path, err)
+	}
+	return keys, nil
+}
+
+// ReadSecretKeys reads a key ring holding secret keys from path and decrypts
+// them with passphrase. A wrong passphrase is reported as
+// response.ErrInvalidPassphrase.
+func ReadSecretKeys(path, passphrase string) (openpgp.EntityList, error) {
+	keys, err := ReadPublicKeys(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if err := key.DecryptPrivateKeys([]byte(passphrase)); err != nil {
+			if passphrase == "" {
+				return nil, fmt.Errorf("%w: the secret key is protected by a passphrase", response.ErrInvalidPassphrase)
+			}
+			return nil, response.ErrInvalidPassphrase
+		}
+	}
+	return keys, nil
+}
+
+// List returns the names of every entry in the store at dir. Hidden
+// directories such as .git are left out.
+func List(dir string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".gpg") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, strings.TrimSuffix(filepath.ToSlash(rel), ".gpg"))
+		return nil
+	})
+	return names, err
+}
+
+// ReadEntry decrypts the entry at name in the store at dir with keys
+func ReadEntry(dir, name string, keys openpgp.EntityList) (Entry, error) {
+	path, err := entryPath(dir, name)
+	if err != nil {
+		return Entry{}, err
+	}
+	content, err := decrypt(path, keys)
+	if err != nil {
+		return Entry{}, err
+	}
+	return ParseEntry(name, content), nil
+}
+
+// decrypt reads an encrypted file, armored or binary
+func decrypt(path string, keys openpgp.EntityList) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if block, err := armor.Decode(file); err == nil {
+		r = block.Body
+	} else if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	message, err := openpgp.ReadMessage(r, keys, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't decrypt: %w", err)
+	}
+	// Reading to the end checks the integrity of the message
+	content, err := io.ReadAll(message.UnverifiedBody)
+	if err != nil {
+		return nil, fmt.Errorf("can't decrypt: %w", err)
+	}
+	return content, nil
+}
+
+// WriteEntry encrypts an entry for recipients into the store at dir,
+// creating the directories along its name
+func WriteEntry(dir string, entry Entry, recipients openpgp.EntityList) error {
+	path, err := entryPath(dir, entry.Name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	w, err := openpgp.Encrypt(&buf, recipients, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(entry.Marshal()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	// Write next to the entry and rename, so it is never half written
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// entryPath returns the file of the entry at name in the store at dir, and
+// fails if the name would lead outside of dir
+func entryPath(dir, name string) (string, error) {
+	path := filepath.Join(dir, filepath.FromSlash(name)+".gpg")
+	if rel, err := filepath.Rel(dir, path); err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("entry %q is outside of the password store", name)
+	}
+	return path, nil
+}
+
+// RemoveEntry deletes an entry from the store at dir, along with the
+// directories it leaves empty
+func RemoveEntry(dir, name string) error {
+	path, err := entryPath(dir, name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for parent := filepath.Dir(path); parent != filepath.Clean(dir); parent = filepath.Dir(parent) {
+		// Fails once a directory isn't empty
+		if os.Remove(parent) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// WriteGPGID writes the fingerprints of recipients to the .gpg-id file at
+// the root of the store, so pass encrypts new entries for them too
+func WriteGPGID(dir string, recipients openpgp.EntityList) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, key := range recipients {
+		fmt.Fprintf(&buf, "%X\n", key.PrimaryKey.Fingerprint)
+	}
+	return os.WriteFile(filepath.Join(dir, ".gpg-id"), buf.Bytes(), 0600)
+}
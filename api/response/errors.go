@@ -6,15 +6,47 @@ import (
 )
 
 var (
-	ErrInvalidPassword = errors.New("invalid password provided")
-	ErrInvalidUsername = errors.New("invalid username provided")
-	ErrCredentialNotFound = errors.New("credential not found")
-	ErrDatabaseConnection = errors.New("failed to connect to the database")
+	ErrInvalidPassword      = errors.New("invalid password provided")
+	ErrInvalidUsername      = errors.New("invalid username provided")
+	ErrInvalidItemType      = errors.New("invalid item type provided")
+	ErrInvalidTOTP          = errors.New("invalid TOTP secret provided")
+	ErrInvalidSSHKey        = errors.New("SSH keys need an unencrypted private key as password")
+	ErrInvalidField         = errors.New("custom fields need a name")
+	ErrInvalidMatch         = errors.New("invalid match field provided")
+	ErrInvalidAttachment    = errors.New("attachments need a name and can be at most 1 MiB")
+	ErrInvalidCursor        = errors.New("invalid pagination cursor")
+	ErrCredentialNotFound   = errors.New("credential not found")
+	ErrCredentialNotTrashed = errors.New("credential is not in the trash")
+	ErrInvalidTag           = errors.New("invalid tag name provided")
+	ErrTagNotFound          = errors.New("tag not found")
+	ErrTagExists            = errors.New("tag already exists")
+	ErrInvalidFolderName    = errors.New("invalid folder name provided")
+	ErrFolderNotFound       = errors.New("folder not found")
+	ErrFolderExists         = errors.New("a folder with this name already exists here")
+	ErrFolderCycle          = errors.New("a folder can't be moved into itself or its subfolders")
+	ErrFolderNotTrashed     = errors.New("folder is not in the trash")
+	ErrInvalidPassphrase    = errors.New("invalid passphrase provided")
+	ErrBackupNotFound       = errors.New("backup not found")
+	ErrBackupKeyRequired    = errors.New("backup is encrypted and no backup key is configured")
+	ErrBackupInvalid        = errors.New("backup failed verification")
+	ErrInvalidExport        = errors.New("invalid export file")
+	ErrInvalidImportSource  = errors.New("invalid import format provided")
+	ErrInvalidImportMode    = errors.New("invalid import mode provided")
+	ErrPassKeyRequired      = errors.New("no OpenPGP key is configured for the password store")
+	ErrPassStoreNotFound    = errors.New("password store not found")
+	ErrDatabaseConnection   = errors.New("failed to connect to the database")
+	ErrWrongMasterPassword  = errors.New("invalid master password provided")
+	ErrNoMasterPassword     = errors.New("no master password is set")
+	ErrTooManyAttempts      = errors.New("too many wrong master passwords")
+	ErrMasterPasswordShort  = errors.New("the master password must be at least 8 characters")
+	ErrUnauthorized         = errors.New("a valid session token is required")
+	ErrUnresolvedReference  = errors.New("secret reference names nothing in the vault")
+	ErrInvalidTemplate      = errors.New("invalid template")
 )
 
 func WrapError(err error, message error) error {
-    if err != nil {
-        return fmt.Errorf("%w: %v", message, err)
-    }
-    return nil
+	if err != nil {
+		return fmt.Errorf("%w: %v", message, err)
+	}
+	return nil
 }
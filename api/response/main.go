@@ -30,4 +30,20 @@ func NotFoundResponse(r *http.ResponseWriter, message string) {
 
 func BadRequestResponse(r *http.ResponseWriter, message string) {
 	ErrorResponse(r, http.StatusBadRequest, message)
-}
\ No newline at end of file
+}
+
+// FieldError describes a single invalid request field or query parameter
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrorResponse writes a 400 response listing every invalid field
+func ValidationErrorResponse(r *http.ResponseWriter, message string, fieldErrors []FieldError) {
+	(*r).Header().Set("Content-Type", "application/json")
+	(*r).WriteHeader(http.StatusBadRequest)
+	errorResponse := map[string]any{"error": message, "details": fieldErrors}
+	if err := json.NewEncoder(*r).Encode(errorResponse); err != nil {
+		http.Error(*r, "Failed to encode error response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,192 @@
+// Package secretref resolves references to values kept in the vault, like
+// cred:42:password, so secrets can be handed to programs without writing
+// them down anywhere.
+package secretref
+
+import (
+	"fmt"
+	"passvault/response"
+	"passvault/structs"
+	"passvault/totp"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prefix starts every reference
+const Prefix = "cred:"
+
+// maxSuggestions is how many credentials a name matching none suggests
+const maxSuggestions = 5
+
+// Reference names a single value of a credential
+type Reference struct {
+	// Credential is the ID, the name or the folder path and name
+	Credential string
+	Field      string
+}
+
+func (r Reference) String() string {
+	return Prefix + r.Credential + ":" + r.Field
+}
+
+// IsReference reports whether s is meant as a reference
+func IsReference(s string) bool {
+	return strings.HasPrefix(s, Prefix)
+}
+
+// Parse reads a reference of the form cred:<credential>:<field>. The field
+// follows the last colon, so credential names may hold colons.
+func Parse(s string) (Reference, error) {
+	rest, ok := strings.CutPrefix(s, Prefix)
+	i := strings.LastIndex(rest, ":")
+	if !ok || i <= 0 || i == len(rest)-1 {
+		return Reference{}, fmt.Errorf("invalid reference %q, use %s<credential>:<field>", s, Prefix)
+	}
+	return Reference{Credential: rest[:i], Field: rest[i+1:]}, nil
+}
+
+// Field returns a single value of a credential by name. Custom fields are
+// matched when no standard value has the name.
+func Field(cred *structs.Credential, name string) (string, error) {
+	switch strings.ToLower(name) {
+	case "name":
+		return cred.Name, nil
+	case "username", "user", "login":
+		return cred.Username, nil
+	case "password", "pass":
+		return cred.Password, nil
+	case "url", "urls":
+		return strings.Join(cred.URLs, "\n"), nil
+	case "notes", "description":
+		return cred.Description, nil
+	case "folder":
+		return cred.FolderPath, nil
+	case "tags":
+		return strings.Join(cred.Tags, ","), nil
+	case "totp", "otp":
+		if cred.TOTP == "" {
+			return "", fmt.Errorf("%s has no TOTP secret", cred.Name)
+		}
+		key, err := totp.Parse(cred.TOTP)
+		if err != nil {
+			return "", err
+		}
+		return key.Code(time.Now()), nil
+	}
+	for _, f := range cred.Fields {
+		if strings.EqualFold(f.Name, name) {
+			return f.Value, nil
+		}
+	}
+	return "", unresolvedf("%s has no field %q", cred.Name, name)
+}
+
+// Source is where references are looked up: a store, or a client of a
+// server
+type Source interface {
+	GetCredential(id int) (*structs.Credential, error)
+	// SearchCredentials finds credentials whose name, username, description
+	// or tags contain the query, best matches first
+	SearchCredentials(query string, limit int) ([]structs.Credential, error)
+}
+
+// unresolved is the error of a reference naming nothing. It reads as what
+// went wrong and matches response.ErrUnresolvedReference.
+type unresolved struct {
+	message string
+}
+
+func (e *unresolved) Error() string {
+	return e.message
+}
+
+func (e *unresolved) Is(target error) bool {
+	return target == response.ErrUnresolvedReference
+}
+
+func unresolvedf(format string, args ...any) error {
+	return &unresolved{fmt.Sprintf(format, args...)}
+}
+
+// Find returns the credential a name refers to: its ID, its name or its
+// folder path and name. Only an exact name counts, a name shared by several
+// credentials has to be told apart by folder or ID.
+func Find(s Source, name string) (*structs.Credential, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return s.GetCredential(id)
+	}
+
+	folder, base := path.Split(name)
+	folder = strings.TrimSuffix(folder, "/")
+	results, err := s.SearchCredentials(base, 0)
+	if err != nil {
+		return nil, err
+	}
+	var matches []structs.Credential
+	for _, cred := range results {
+		if strings.EqualFold(cred.Name, base) && (folder == "" || strings.EqualFold(cred.FolderPath, folder)) {
+			matches = append(matches, cred)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		// The search matches usernames, descriptions and tags too, what it
+		// found only helps to find the name
+		if len(results) == 0 {
+			return nil, unresolvedf("no credential named %q", name)
+		}
+		return nil, unresolvedf("no credential named %q, did you mean one of these?%s", name, listCredentials(results[:min(len(results), maxSuggestions)]))
+	case 1:
+		return s.GetCredential(matches[0].ID)
+	}
+	return nil, unresolvedf("%q names %d credentials, use the ID of one of them:%s", name, len(matches), listCredentials(matches))
+}
+
+// listCredentials lists credentials by ID, full name and username, a line
+// each
+func listCredentials(creds []structs.Credential) string {
+	var list strings.Builder
+	for _, cred := range creds {
+		fmt.Fprintf(&list, "\n  %d\t%s\t%s", cred.ID, fullName(cred), cred.Username)
+	}
+	return list.String()
+}
+
+// fullName returns the folder path and name of a credential
+func fullName(cred structs.Credential) string {
+	if cred.FolderPath == "" {
+		return cred.Name
+	}
+	return cred.FolderPath + "/" + cred.Name
+}
+
+// Resolver resolves references, looking every credential up only once
+type Resolver struct {
+	source Source
+	found  map[string]*structs.Credential
+}
+
+// NewResolver returns a resolver looking credentials up in source
+func NewResolver(source Source) *Resolver {
+	return &Resolver{source: source, found: map[string]*structs.Credential{}}
+}
+
+// Resolve returns the value a reference names
+func (r *Resolver) Resolve(ref Reference) (string, error) {
+	cred, ok := r.found[ref.Credential]
+	if !ok {
+		var err error
+		if cred, err = Find(r.source, ref.Credential); err != nil {
+			return "", fmt.Errorf("%s: %w", ref, err)
+		}
+		r.found[ref.Credential] = cred
+	}
+	value, err := Field(cred, ref.Field)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", ref, err)
+	}
+	return value, nil
+}
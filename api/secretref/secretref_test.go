@@ -0,0 +1,167 @@
+package secretref
+
+import (
+	"errors"
+	"passvault/response"
+	"passvault/store"
+	"passvault/structs"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newVault returns a memory store whose credentials share names and words
+func newVault(t *testing.T) (store.Store, map[string]int) {
+	t.Helper()
+	s := store.NewMemory()
+	work, err := s.CreateFolder(structs.Folder{Name: "Work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	home, err := s.CreateFolder(structs.Folder{Name: "Home"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]int{}
+	for key, cred := range map[string]structs.Credential{
+		"work db":  {Name: "db", Username: "admin", Password: "work-secret", FolderID: &work, Fields: []structs.CustomField{{Name: "Host", Value: "db.work"}}},
+		"home db":  {Name: "db", Username: "admin", Password: "home-secret", FolderID: &home},
+		"mail":     {Name: "mail", Username: "user", Password: "mail-secret", URLs: []string{"https://a.example", "https://b.example"}, Tags: []string{"b", "a"}},
+		"prod":     {Name: "prod-api", Username: "deploy", Password: "prod-secret", Description: "used by the mailer"},
+		"staging":  {Name: "staging-api", Username: "deploy", Password: "staging-secret"},
+		"otp":      {Name: "otp", Username: "user", Password: "otp-secret", TOTP: "JBSWY3DPEHPK3PXP"},
+		"colon":    {Name: "a:b", Username: "user", Password: "colon-secret"},
+		"bad totp": {Name: "broken", Username: "user", Password: "broken-secret", TOTP: "!"},
+		"braces":   {Name: "braces", Username: "user", Password: "{{ .Missing }}-secret"},
+	} {
+		id, err := s.CreateCredential(cred)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[key] = id
+	}
+	return s, ids
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Reference
+		ok   bool
+	}{
+		{"cred:42:password", Reference{"42", "password"}, true},
+		{"cred:Work/db:username", Reference{"Work/db", "username"}, true},
+		{"cred:a:b:password", Reference{"a:b", "password"}, true},
+		{"cred:db", Reference{}, false},
+		{"cred::password", Reference{}, false},
+		{"cred:db:", Reference{}, false},
+		{"db:password", Reference{}, false},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("Parse(%q) = %+v, %v", tt.in, got, err)
+		}
+		if tt.ok && got.String() != tt.in {
+			t.Errorf("String = %q, want %q", got.String(), tt.in)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	s, ids := newVault(t)
+
+	tests := []struct {
+		name string
+		want string
+		err  string
+	}{
+		{name: strconv.Itoa(ids["mail"]), want: "mail"},
+		{name: "MAIL", want: "mail"},
+		{name: "Work/db", want: "work db"},
+		{name: "home/DB", want: "home db"},
+		{name: "a:b", want: "colon"},
+		{name: "db", err: `"db" names 2 credentials`},
+		// A single partial match is not enough, not even one on the name
+		{name: "prod", err: "did you mean one of these?\n  " + strconv.Itoa(ids["prod"]) + "\tprod-api\tdeploy"},
+		// The search finds the mailer in a description, that is no name
+		{name: "mailer", err: `no credential named "mailer", did you mean`},
+		{name: "Work/mail", err: `no credential named "Work/mail"`},
+		{name: "nothing", err: `no credential named "nothing"`},
+		{name: "999", err: response.ErrCredentialNotFound.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cred, err := Find(s, tt.name)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Find = %+v, %v, want %q", cred, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cred.ID != ids[tt.want] {
+				t.Fatalf("Find = %d %s, want %s", cred.ID, fullName(*cred), tt.want)
+			}
+		})
+	}
+
+	if _, err := Find(s, "prod"); !errors.Is(err, response.ErrUnresolvedReference) {
+		t.Fatalf("a name matching nothing is %v, want ErrUnresolvedReference", err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	s, _ := newVault(t)
+	r := NewResolver(s)
+
+	tests := []struct {
+		ref  string
+		want string
+		err  string
+	}{
+		{ref: "cred:Work/db:password", want: "work-secret"},
+		{ref: "cred:Work/db:user", want: "admin"},
+		{ref: "cred:Work/db:folder", want: "Work"},
+		{ref: "cred:Work/db:host", want: "db.work"},
+		{ref: "cred:mail:url", want: "https://a.example\nhttps://b.example"},
+		{ref: "cred:mail:tags", want: "a,b"},
+		{ref: "cred:mail:name", want: "mail"},
+		{ref: "cred:mail:pin", err: `cred:mail:pin: mail has no field "pin"`},
+		{ref: "cred:mail:totp", err: "mail has no TOTP secret"},
+		{ref: "cred:broken:totp", err: "cred:broken:totp: "},
+		{ref: "cred:prod:password", err: `cred:prod:password: no credential named "prod"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			ref, err := Parse(tt.ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := r.Resolve(ref)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Resolve = %q, %v, want %q", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Resolve = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	code, err := r.Resolve(Reference{"otp", "totp"})
+	if err != nil || len(code) != 6 {
+		t.Fatalf("TOTP code = %q, %v", code, err)
+	}
+	// Credentials are looked up once
+	if err := s.DeleteCredential(r.found["Work/db"].ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := r.Resolve(Reference{"Work/db", "password"}); err != nil || got != "work-secret" {
+		t.Fatalf("Resolve after the lookup = %q, %v", got, err)
+	}
+}
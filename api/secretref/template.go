@@ -0,0 +1,86 @@
+package secretref
+
+import (
+	"fmt"
+	"net/url"
+	"passvault/response"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// URIPrefix starts a reference written as a URI, pv://folder/name/field
+const URIPrefix = "pv://"
+
+// uriPattern finds the URI references in a template. Characters that end a
+// URI in YAML, JSON or a shell script are percent-encoded in names.
+var uriPattern = regexp.MustCompile(`pv://[^\s"'` + "`" + `<>{}]+`)
+
+// ParseURI reads a reference of the form pv://<credential>/<field>, where
+// the credential is a name or a folder path and name. Path segments may be
+// percent-encoded.
+func ParseURI(uri string) (Reference, error) {
+	rest, ok := strings.CutPrefix(uri, URIPrefix)
+	i := strings.LastIndex(rest, "/")
+	if !ok || i <= 0 || i == len(rest)-1 {
+		return Reference{}, fmt.Errorf("invalid reference %q, use %s<folder>/<name>/<field>", uri, URIPrefix)
+	}
+	credential, err := url.PathUnescape(rest[:i])
+	if err != nil {
+		return Reference{}, fmt.Errorf("invalid reference %q: %w", uri, err)
+	}
+	field, err := url.PathUnescape(rest[i+1:])
+	if err != nil {
+		return Reference{}, fmt.Errorf("invalid reference %q: %w", uri, err)
+	}
+	return Reference{Credential: credential, Field: field}, nil
+}
+
+// Render expands a text/template against the vault. {{ pv "name" "field" }}
+// and pv://folder/name/field are replaced with the values they name, and a
+// reference that names nothing fails the whole template. name is the name
+// errors give the template.
+func Render(name, text string, resolver *Resolver) (string, error) {
+	// URIs become calls to pv before parsing, so the secrets they are
+	// replaced with are never read as template actions
+	var uriErr error
+	text = uriPattern.ReplaceAllStringFunc(text, func(uri string) string {
+		ref, err := ParseURI(uri)
+		if err != nil {
+			if uriErr == nil {
+				uriErr = err
+			}
+			return uri
+		}
+		return "{{pv " + strconv.Quote(ref.Credential) + " " + strconv.Quote(ref.Field) + "}}"
+	})
+	if uriErr != nil {
+		return "", fmt.Errorf("%w: %w", response.ErrInvalidTemplate, uriErr)
+	}
+
+	var refErr error
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(template.FuncMap{
+		"pv": func(credential, field string) (string, error) {
+			value, err := resolver.Resolve(Reference{Credential: credential, Field: field})
+			if err != nil {
+				refErr = err
+			}
+			return value, err
+		},
+	}).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", response.ErrInvalidTemplate, err)
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, nil); err != nil {
+		// Failed lookups keep their own error, anything else is a mistake in
+		// the template
+		if refErr != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("%w: %w", response.ErrInvalidTemplate, err)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,88 @@
+package secretref
+
+import (
+	"errors"
+	"passvault/response"
+	"strings"
+	"testing"
+)
+
+func TestParseURI(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Reference
+		ok   bool
+	}{
+		{"pv://db/password", Reference{"db", "password"}, true},
+		{"pv://Work/db/password", Reference{"Work/db", "password"}, true},
+		{"pv://My%20Folder/a%2Fb/api%20key", Reference{"My Folder/a/b", "api key"}, true},
+		{"pv://db", Reference{}, false},
+		{"pv://db/", Reference{}, false},
+		{"pv://%zz/password", Reference{}, false},
+		{"cred:db:password", Reference{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseURI(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseURI(%q) = %+v, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	s, _ := newVault(t)
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		err      error
+		message  string
+	}{
+		{
+			name:     "calls and URIs",
+			template: "user: {{ pv \"Work/db\" \"username\" }}\npass: \"pv://Work/db/password\"\nurl: pv://mail/url\n",
+			want:     "user: admin\npass: \"work-secret\"\nurl: https://a.example\nhttps://b.example\n",
+		},
+		{
+			name:     "secrets aren't template actions",
+			template: "pv://braces/password {{ pv \"a:b\" \"password\" }}",
+			want:     "{{ .Missing }}-secret colon-secret",
+		},
+		{
+			name:     "unresolved",
+			template: "pass: pv://prod/password",
+			err:      response.ErrUnresolvedReference,
+			message:  `no credential named "prod"`,
+		},
+		{
+			name:     "bad template",
+			template: "{{ if }}",
+			err:      response.ErrInvalidTemplate,
+		},
+		{
+			name:     "bad URI",
+			template: "pv://%zz/password",
+			err:      response.ErrInvalidTemplate,
+		},
+		{
+			name:     "missing key",
+			template: "{{ .Missing }}",
+			err:      response.ErrInvalidTemplate,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render("config.tmpl", tt.template, NewResolver(s))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) || !strings.Contains(err.Error(), tt.message) {
+					t.Fatalf("Render = %q, %v, want %v", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Render = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package secretservice
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+// Introspection data of the interfaces, as the Secret Service API
+// specification describes them
+const (
+	serviceXML = `
+	<interface name="org.freedesktop.Secret.Service">
+		<method name="OpenSession">
+			<arg name="algorithm" type="s" direction="in"/>
+			<arg name="input" type="v" direction="in"/>
+			<arg name="output" type="v" direction="out"/>
+			<arg name="result" type="o" direction="out"/>
+		</method>
+		<method name="CreateCollection">
+			<arg name="properties" type="a{sv}" direction="in"/>
+			<arg name="alias" type="s" direction="in"/>
+			<arg name="collection" type="o" direction="out"/>
+			<arg name="prompt" type="o" direction="out"/>
+		</method>
+		<method name="SearchItems">
+			<arg name="attributes" type="a{ss}" direction="in"/>
+			<arg name="unlocked" type="ao" direction="out"/>
+			<arg name="locked" type="ao" direction="out"/>
+		</method>
+		<method name="Unlock">
+			<arg name="objects" type="ao" direction="in"/>
+			<arg name="unlocked" type="ao" direction="out"/>
+			<arg name="prompt" type="o" direction="out"/>
+		</method>
+		<method name="Lock">
+			<arg name="objects" type="ao" direction="in"/>
+			<arg name="locked" type="ao" direction="out"/>
+			<arg name="Prompt" type="o" direction="out"/>
+		</method>
+		<method name="GetSecrets">
+			<arg name="items" type="ao" direction="in"/>
+			<arg name="session" type="o" direction="in"/>
+			<arg name="secrets" type="a{o(oayays)}" direction="out"/>
+		</method>
+		<method name="ReadAlias">
+			<arg name="name" type="s" direction="in"/>
+			<arg name="collection" type="o" direction="out"/>
+		</method>
+		<method name="SetAlias">
+			<arg name="name" type="s" direction="in"/>
+			<arg name="collection" type="o" direction="in"/>
+		</method>
+		<signal name="CollectionCreated"><arg name="collection" type="o"/></signal>
+		<signal name="CollectionDeleted"><arg name="collection" type="o"/></signal>
+		<signal name="CollectionChanged"><arg name="collection" type="o"/></signal>
+		<property name="Collections" type="ao" access="read"/>
+	</interface>`
+
+	collectionXML = `
+	<interface name="org.freedesktop.Secret.Collection">
+		<method name="Delete">
+			<arg name="prompt" type="o" direction="out"/>
+		</method>
+		<method name="SearchItems">
+			<arg name="attributes" type="a{ss}" direction="in"/>
+			<arg name="results" type="ao" direction="out"/>
+		</method>
+		<method name="CreateItem">
+			<arg name="properties" type="a{sv}" direction="in"/>
+			<arg name="secret" type="(oayays)" direction="in"/>
+			<arg name="replace" type="b" direction="in"/>
+			<arg name="item" type="o" direction="out"/>
+			<arg name="prompt" type="o" direction="out"/>
+		</method>
+		<signal name="ItemCreated"><arg name="item" type="o"/></signal>
+		<signal name="ItemDeleted"><arg name="item" type="o"/></signal>
+		<signal name="ItemChanged"><arg name="item" type="o"/></signal>
+		<property name="Items" type="ao" access="read"/>
+		<property name="Label" type="s" access="readwrite"/>
+		<property name="Locked" type="b" access="read"/>
+		<property name="Created" type="t" access="read"/>
+		<property name="Modified" type="t" access="read"/>
+	</interface>`
+
+	itemXML = `
+	<interface name="org.freedesktop.Secret.Item">
+		<method name="Delete">
+			<arg name="Prompt" type="o" direction="out"/>
+		</method>
+		<method name="GetSecret">
+			<arg name="session" type="o" direction="in"/>
+			<arg name="secret" type="(oayays)" direction="out"/>
+		</method>
+		<method name="SetSecret">
+			<arg name="secret" type="(oayays)" direction="in"/>
+		</method>
+		<property name="Locked" type="b" access="read"/>
+		<property name="Attributes" type="a{ss}" access="readwrite"/>
+		<property name="Label" type="s" access="readwrite"/>
+		<property name="Created" type="t" access="read"/>
+		<property name="Modified" type="t" access="read"/>
+	</interface>`
+
+	sessionXML = `
+	<interface name="org.freedesktop.Secret.Session">
+		<method name="Close"/>
+	</interface>`
+
+	promptXML = `
+	<interface name="org.freedesktop.Secret.Prompt">
+		<method name="Prompt">
+			<arg name="window-id" type="s" direction="in"/>
+		</method>
+		<method name="Dismiss"/>
+		<signal name="Completed">
+			<arg name="dismissed" type="b"/>
+			<arg name="result" type="v"/>
+		</signal>
+	</interface>`
+)
+
+type introspectObject struct{ s *Service }
+
+// Introspect describes the object at a path, and names its children
+func (o introspectObject) Introspect(msg dbus.Message) (string, *dbus.Error) {
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	v, err := o.s.load()
+	if err != nil {
+		return "", failed(err)
+	}
+
+	path := string(target(msg))
+	var ifaces string
+	var children []string
+	switch {
+	case path == string(servicePath):
+		ifaces, children = serviceXML, []string{"collection", "aliases"}
+	case path+"/" == collectionPrefix:
+		for _, collection := range v.collections {
+			children = append(children, strconv.Itoa(collection.ID))
+		}
+	case path+"/" == aliasPrefix:
+		for name, id := range o.s.aliases {
+			if v.collection(id) != nil {
+				children = append(children, name)
+			}
+		}
+	case strings.HasPrefix(path, collectionPrefix) && strings.Contains(strings.TrimPrefix(path, collectionPrefix), "/"):
+		if _, dbusErr := v.itemAt(dbus.ObjectPath(path)); dbusErr != nil {
+			return "", dbusErr
+		}
+		ifaces = itemXML
+	case strings.HasPrefix(path, collectionPrefix) || strings.HasPrefix(path, aliasPrefix):
+		collection, dbusErr := o.s.collectionAt(v, dbus.ObjectPath(path))
+		if dbusErr != nil {
+			return "", dbusErr
+		}
+		ifaces = collectionXML
+		if strings.HasPrefix(path, collectionPrefix) {
+			for _, item := range v.itemsOf(collection.ID) {
+				children = append(children, strconv.Itoa(item.ID))
+			}
+		}
+	case o.s.sessions[dbus.ObjectPath(path)] != nil:
+		ifaces = sessionXML
+	case o.s.prompts[dbus.ObjectPath(path)] != nil:
+		ifaces = promptXML
+	default:
+		return "", errNoSuchObject
+	}
+
+	var xml strings.Builder
+	xml.WriteString(strings.TrimSpace(introspect.IntrospectDeclarationString) + "\n<node>")
+	xml.WriteString(ifaces + prop.IntrospectDataString + introspect.IntrospectDataString)
+	for _, child := range children {
+		xml.WriteString("\t<node name=\"" + child + "\"/>\n")
+	}
+	xml.WriteString("</node>\n")
+	return xml.String(), nil
+}
@@ -0,0 +1,639 @@
+package secretservice
+
+import (
+	"errors"
+	"maps"
+	"passvault/response"
+	"passvault/structs"
+	"strconv"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// The objects of the service, one type for each interface. Collections,
+// items, sessions and prompts are exported for the whole tree below the
+// service and found by the path a call was made on.
+type (
+	serviceObject    struct{ s *Service }
+	collectionObject struct{ s *Service }
+	itemObject       struct{ s *Service }
+	sessionObject    struct{ s *Service }
+	promptObject     struct{ s *Service }
+	propertiesObject struct{ s *Service }
+)
+
+func (o serviceObject) OpenSession(sender dbus.Sender, algorithm string, input dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	session, output, err := newSession(string(sender), algorithm, input)
+	switch {
+	case errors.Is(err, errAlgorithm):
+		return dbus.Variant{}, none, dbus.NewError("org.freedesktop.DBus.Error.NotSupported", []any{err.Error()})
+	case errors.Is(err, errPublicKey):
+		return dbus.Variant{}, none, invalidArgs(err.Error())
+	case err != nil:
+		return dbus.Variant{}, none, failed(err)
+	}
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	o.s.serial++
+	path := dbus.ObjectPath(sessionPrefix + strconv.Itoa(o.s.serial))
+	o.s.sessions[path] = session
+	return output, path, nil
+}
+
+func (o serviceObject) CreateCollection(sender dbus.Sender, properties map[string]dbus.Variant, alias string) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	label, _ := properties[collectionInterface+".Label"].Value().(string)
+	create := func() (dbus.Variant, error) {
+		path, err := o.s.createCollection(label, alias)
+		return dbus.MakeVariant(path), err
+	}
+
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	v, err := o.s.load()
+	if err != nil {
+		return none, none, failed(err)
+	}
+	if v.locked {
+		return none, o.s.newPrompt(string(sender), create), nil
+	}
+	path, err := o.s.createCollection(label, alias)
+	if err != nil {
+		return none, none, failed(err)
+	}
+	return path, none, nil
+}
+
+func (o serviceObject) SearchItems(attrs map[string]string) ([]dbus.ObjectPath, []dbus.ObjectPath, *dbus.Error) {
+	if ownSession(attrs) {
+		return []dbus.ObjectPath{}, []dbus.ObjectPath{}, nil
+	}
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	v, err := o.s.load()
+	if err != nil {
+		return nil, nil, failed(err)
+	}
+	found := search(v.items, attrs)
+	if v.locked {
+		return []dbus.ObjectPath{}, found, nil
+	}
+	return found, []dbus.ObjectPath{}, nil
+}
+
+func (o serviceObject) Unlock(sender dbus.Sender, objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	if objects == nil {
+		objects = []dbus.ObjectPath{}
+	}
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	v, err := o.s.load()
+	if err != nil {
+		return nil, none, failed(err)
+	}
+	if !v.locked {
+		return objects, none, nil
+	}
+	prompt := o.s.newPrompt(string(sender), func() (dbus.Variant, error) { return dbus.MakeVariant(objects), nil })
+	return []dbus.ObjectPath{}, prompt, nil
+}
+
+// Lock locks the service, not the vault. Unlocking it asks for the master
+// password again.
+func (o serviceObject) Lock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	if objects == nil {
+		objects = []dbus.ObjectPath{}
+	}
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	o.s.locked = true
+	return objects, none, nil
+}
+
+func (o serviceObject) GetSecrets(sender dbus.Sender, items []dbus.ObjectPath, sessionPath dbus.ObjectPath) (map[dbus.ObjectPath]secret, *dbus.Error) {
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	session, dbusErr := o.s.session(sessionPath, string(sender))
+	if dbusErr != nil {
+		return nil, dbusErr
+	}
+	v, err := o.s.load()
+	if err != nil {
+		return nil, failed(err)
+	}
+	secrets := map[dbus.ObjectPath]secret{}
+	if v.locked {
+		return secrets, nil
+	}
+	for _, path := range items {
+		item, dbusErr := v.itemAt(path)
+		if dbusErr != nil {
+			continue
+		}
+		out, err := o.s.secretOf(*item, session, sessionPath)
+		if err != nil {
+			return nil, failed(err)
+		}
+		secrets[path] = out
+	}
+	return secrets, nil
+}
+
+func (o serviceObject) ReadAlias(name string) (dbus.ObjectPath, *dbus.Error) {
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	v, err := o.s.load()
+	if err != nil {
+		return none, failed(err)
+	}
+	if collection := v.collection(o.s.aliases[name]); collection != nil {
+		return collectionPath(collection.ID), nil
+	}
+	return none, nil
+}
+
+func (o serviceObject) SetAlias(name string, collection dbus.ObjectPath) *dbus.Error {
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	if collection == none {
+		delete(o.s.aliases, name)
+	} else {
+		v, err := o.s.load()
+		if err != nil {
+			return failed(err)
+		}
+		target, dbusErr := o.s.collectionAt(v, collection)
+		if dbusErr != nil {
+			return dbusErr
+		}
+		o.s.aliases[name] = target.ID
+	}
+	if err := o.s.saveAliases(); err != nil {
+		return failed(err)
+	}
+	return nil
+}
+
+// Delete moves the folder of the collection, with its items, to the trash
+func (o collectionObject) Delete(msg dbus.Message) (dbus.ObjectPath, *dbus.Error) {
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	v, err := o.s.load()
+	if err != nil {
+		return none, failed(err)
+	}
+	collection, dbusErr := o.s.collectionAt(v, target(msg))
+	if dbusErr != nil {
+		return none, dbusErr
+	}
+	if v.locked {
+		return none, errIsLocked
+	}
+	if err := o.s.vault.DeleteFolder(collection.ID); err != nil {
+		return none, failed(err)
+	}
+	maps.DeleteFunc(o.s.aliases, func(_ string, id int) bool { return id == collection.ID })
+	if err := o.s.saveAliases(); err != nil {
+		return none, failed(err)
+	}
+	o.s.emit(servicePath, serviceInterface+".CollectionDeleted", collectionPath(collection.ID))
+	return none, nil
+}
+
+func (o collectionObject) SearchItems(msg dbus.Message, attrs map[string]string) ([]dbus.ObjectPath, *dbus.Error) {
+	if ownSession(attrs) {
+		return []dbus.ObjectPath{}, nil
+	}
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	v, err := o.s.load()
+	if err != nil {
+		return nil, failed(err)
+	}
+	collection, dbusErr := o.s.collectionAt(v, target(msg))
+	if dbusErr != nil {
+		return nil, dbusErr
+	}
+	return search(v.itemsOf(collection.ID), attrs), nil
+}
+
+func (o collectionObject) CreateItem(msg dbus.Message, properties map[string]dbus.Variant, in secret, replace bool) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	label, _ := properties[itemInterface+".Label"].Value().(string)
+	attrs, _ := properties[itemInterface+".Attributes"].Value().(map[string]string)
+	if ownSession(attrs) {
+		return none, none, errOwnSession
+	}
+
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	session, dbusErr := o.s.session(in.Session, sender(msg))
+	if dbusErr != nil {
+		return none, none, dbusErr
+	}
+	value, err := session.decrypt(in)
+	if err != nil {
+		return none, none, invalidArgs(err.Error())
+	}
+	path := target(msg)
+	create := func() (dbus.Variant, error) {
+		item, err := o.s.createItem(path, label, attrs, value, in.ContentType, replace)
+		return dbus.MakeVariant(item), err
+	}
+
+	v, err := o.s.load()
+	if err != nil {
+		return none, none, failed(err)
+	}
+	if v.locked {
+		return none, o.s.newPrompt(sender(msg), create), nil
+	}
+	item, err := o.s.createItem(path, label, attrs, value, in.ContentType, replace)
+	if err != nil {
+		return none, none, failed(err)
+	}
+	return item, none, nil
+}
+
+// Delete moves the credential of the item to the trash
+func (o itemObject) Delete(msg dbus.Message) (dbus.ObjectPath, *dbus.Error) {
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	item, dbusErr := o.s.unlockedItem(target(msg))
+	if dbusErr != nil {
+		return none, dbusErr
+	}
+	if err := o.s.vault.DeleteCredential(item.ID); err != nil {
+		return none, failed(err)
+	}
+	o.s.emit(collectionPath(*item.FolderID), collectionInterface+".ItemDeleted", itemPath(*item))
+	return none, nil
+}
+
+func (o itemObject) GetSecret(msg dbus.Message, sessionPath dbus.ObjectPath) (secret, *dbus.Error) {
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	session, dbusErr := o.s.session(sessionPath, sender(msg))
+	if dbusErr != nil {
+		return secret{}, dbusErr
+	}
+	item, dbusErr := o.s.unlockedItem(target(msg))
+	if dbusErr != nil {
+		return secret{}, dbusErr
+	}
+	out, err := o.s.secretOf(*item, session, sessionPath)
+	if err != nil {
+		return secret{}, failed(err)
+	}
+	return out, nil
+}
+
+func (o itemObject) SetSecret(msg dbus.Message, in secret) *dbus.Error {
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	session, dbusErr := o.s.session(in.Session, sender(msg))
+	if dbusErr != nil {
+		return dbusErr
+	}
+	value, err := session.decrypt(in)
+	if err != nil {
+		return invalidArgs(err.Error())
+	}
+	return o.s.updateItem(target(msg), func(item *structs.Credential) *dbus.Error {
+		writeSecret(item, value, in.ContentType)
+		return nil
+	})
+}
+
+func (o sessionObject) Close(msg dbus.Message) *dbus.Error {
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	if _, dbusErr := o.s.session(target(msg), sender(msg)); dbusErr != nil {
+		return dbusErr
+	}
+	delete(o.s.sessions, target(msg))
+	return nil
+}
+
+// Prompt asks for the master password. It answers at once, the outcome
+// follows with the Completed signal.
+func (o promptObject) Prompt(msg dbus.Message, windowID string) *dbus.Error {
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	path := target(msg)
+	p, ok := o.s.prompts[path]
+	if !ok || p.owner != sender(msg) {
+		return errNoSuchObject
+	}
+	if !p.started {
+		p.started = true
+		go o.s.runPrompt(path, p)
+	}
+	return nil
+}
+
+func (o promptObject) Dismiss(msg dbus.Message) *dbus.Error {
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	path := target(msg)
+	p, ok := o.s.prompts[path]
+	if !ok || p.owner != sender(msg) {
+		return errNoSuchObject
+	}
+	delete(o.s.prompts, path)
+	o.s.emit(path, promptInterface+".Completed", true, dbus.MakeVariant(""))
+	return nil
+}
+
+func (o propertiesObject) Get(msg dbus.Message, iface, name string) (dbus.Variant, *dbus.Error) {
+	properties, dbusErr := o.s.properties(target(msg), iface)
+	if dbusErr != nil {
+		return dbus.Variant{}, dbusErr
+	}
+	value, ok := properties[name]
+	if !ok {
+		return dbus.Variant{}, invalidArgs("no property " + name + " on " + iface)
+	}
+	return value, nil
+}
+
+func (o propertiesObject) GetAll(msg dbus.Message, iface string) (map[string]dbus.Variant, *dbus.Error) {
+	return o.s.properties(target(msg), iface)
+}
+
+func (o propertiesObject) Set(msg dbus.Message, iface, name string, value dbus.Variant) *dbus.Error {
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	path := target(msg)
+	switch {
+	case iface == itemInterface && name == "Label":
+		label, ok := value.Value().(string)
+		if !ok {
+			return invalidArgs("Label is a string")
+		}
+		return o.s.updateItem(path, func(item *structs.Credential) *dbus.Error {
+			item.Name = label
+			return nil
+		})
+	case iface == itemInterface && name == "Attributes":
+		attrs, ok := value.Value().(map[string]string)
+		if !ok {
+			return invalidArgs("Attributes is a map of strings")
+		}
+		return o.s.updateItem(path, func(item *structs.Credential) *dbus.Error {
+			if ownSession(attrs) {
+				return errOwnSession
+			}
+			item.Fields = fields(attrs)
+			return nil
+		})
+	case iface == collectionInterface && name == "Label":
+		label, ok := value.Value().(string)
+		if !ok {
+			return invalidArgs("Label is a string")
+		}
+		v, err := o.s.load()
+		if err != nil {
+			return failed(err)
+		}
+		collection, dbusErr := o.s.collectionAt(v, path)
+		if dbusErr != nil {
+			return dbusErr
+		}
+		if v.locked {
+			return errIsLocked
+		}
+		if err := o.s.vault.UpdateFolder(collection.ID, structs.Folder{Name: label, ParentID: collection.ParentID}); err != nil {
+			return failed(err)
+		}
+		o.s.emit(servicePath, serviceInterface+".CollectionChanged", collectionPath(collection.ID))
+		return nil
+	}
+	return dbus.NewError("org.freedesktop.DBus.Error.PropertyReadOnly", []any{"property " + name + " can't be set"})
+}
+
+// properties returns the properties of the object at a path
+func (s *Service) properties(path dbus.ObjectPath, iface string) (map[string]dbus.Variant, *dbus.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, err := s.load()
+	if err != nil {
+		return nil, failed(err)
+	}
+	switch iface {
+	case serviceInterface:
+		if path != servicePath {
+			return nil, errNoSuchObject
+		}
+		collections := []dbus.ObjectPath{}
+		for _, collection := range v.collections {
+			collections = append(collections, collectionPath(collection.ID))
+		}
+		return map[string]dbus.Variant{"Collections": dbus.MakeVariant(collections)}, nil
+	case collectionInterface:
+		collection, dbusErr := s.collectionAt(v, path)
+		if dbusErr != nil {
+			return nil, dbusErr
+		}
+		return map[string]dbus.Variant{
+			"Items":    dbus.MakeVariant(search(v.itemsOf(collection.ID), nil)),
+			"Label":    dbus.MakeVariant(collection.Name),
+			"Locked":   dbus.MakeVariant(v.locked),
+			"Created":  dbus.MakeVariant(unix(collection.CreatedAt)),
+			"Modified": dbus.MakeVariant(unix(collection.UpdatedAt)),
+		}, nil
+	case itemInterface:
+		item, dbusErr := v.itemAt(path)
+		if dbusErr != nil {
+			return nil, dbusErr
+		}
+		return map[string]dbus.Variant{
+			"Locked":     dbus.MakeVariant(v.locked),
+			"Attributes": dbus.MakeVariant(attributes(*item)),
+			"Label":      dbus.MakeVariant(item.Name),
+			"Created":    dbus.MakeVariant(unix(item.CreatedAt)),
+			"Modified":   dbus.MakeVariant(unix(item.UpdatedAt)),
+		}, nil
+	}
+	return map[string]dbus.Variant{}, nil
+}
+
+// createCollection creates the folder of a collection below the base
+// folder, or returns the collection with the alias or label
+func (s *Service) createCollection(label, alias string) (dbus.ObjectPath, error) {
+	v, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	if v.locked {
+		return "", response.ErrUnauthorized
+	}
+	if collection := v.collection(s.aliases[alias]); alias != "" && collection != nil {
+		return collectionPath(collection.ID), nil
+	}
+	if label == "" {
+		label = untitled
+	}
+
+	if v.base == 0 {
+		if v.base, err = s.vault.CreateFolder(structs.Folder{Name: s.base}); err != nil {
+			return "", err
+		}
+	}
+	id := 0
+	for _, collection := range v.collections {
+		if collection.Name == label {
+			id = collection.ID
+		}
+	}
+	if id == 0 {
+		if id, err = s.vault.CreateFolder(structs.Folder{Name: label, ParentID: &v.base}); err != nil {
+			return "", err
+		}
+		s.emit(servicePath, serviceInterface+".CollectionCreated", collectionPath(id))
+	}
+	if alias != "" {
+		s.aliases[alias] = id
+		if err := s.saveAliases(); err != nil {
+			return "", err
+		}
+	}
+	return collectionPath(id), nil
+}
+
+// createItem creates an item in the collection at a path. With replace an
+// item with the same attributes gets the label and secret instead.
+func (s *Service) createItem(path dbus.ObjectPath, label string, attrs map[string]string, value []byte, contentType string, replace bool) (dbus.ObjectPath, error) {
+	v, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	if v.locked {
+		return "", response.ErrUnauthorized
+	}
+	collection, dbusErr := s.collectionAt(v, path)
+	if dbusErr != nil {
+		return "", dbusErr
+	}
+	if label == "" {
+		label = untitled
+	}
+
+	if replace {
+		for _, item := range v.itemsOf(collection.ID) {
+			if maps.Equal(attributes(item), attrs) {
+				if dbusErr := s.updateItem(itemPath(item), func(item *structs.Credential) *dbus.Error {
+					item.Name = label
+					writeSecret(item, value, contentType)
+					return nil
+				}); dbusErr != nil {
+					return "", dbusErr
+				}
+				return itemPath(item), nil
+			}
+		}
+	}
+
+	item := structs.Credential{
+		Name:     label,
+		ItemType: structs.ItemTypeSecret,
+		FolderID: &collection.ID,
+		URLs:     []string{},
+		Fields:   fields(attrs),
+	}
+	writeSecret(&item, value, contentType)
+	if item.ID, err = s.vault.CreateCredential(item); err != nil {
+		return "", err
+	}
+	s.emit(collectionPath(collection.ID), collectionInterface+".ItemCreated", itemPath(item))
+	return itemPath(item), nil
+}
+
+// unlockedItem returns the item at a path, while the vault is unlocked
+func (s *Service) unlockedItem(path dbus.ObjectPath) (*structs.Credential, *dbus.Error) {
+	v, err := s.load()
+	if err != nil {
+		return nil, failed(err)
+	}
+	item, dbusErr := v.itemAt(path)
+	if dbusErr != nil {
+		return nil, dbusErr
+	}
+	if v.locked {
+		return nil, errIsLocked
+	}
+	return item, nil
+}
+
+// updateItem changes the credential of the item at a path
+func (s *Service) updateItem(path dbus.ObjectPath, change func(item *structs.Credential) *dbus.Error) *dbus.Error {
+	item, dbusErr := s.unlockedItem(path)
+	if dbusErr != nil {
+		return dbusErr
+	}
+	cred, err := s.vault.GetCredential(item.ID)
+	if err != nil {
+		return failed(err)
+	}
+	if dbusErr := change(cred); dbusErr != nil {
+		return dbusErr
+	}
+	if err := s.vault.UpdateCredential(cred.ID, *cred); err != nil {
+		return failed(err)
+	}
+	s.emit(collectionPath(*item.FolderID), collectionInterface+".ItemChanged", path)
+	return nil
+}
+
+// secretOf reads the secret of an item and encrypts it for a session
+func (s *Service) secretOf(item structs.Credential, session *session, sessionPath dbus.ObjectPath) (secret, error) {
+	cred, err := s.vault.GetCredential(item.ID)
+	if err != nil {
+		return secret{}, err
+	}
+	value, contentType := readSecret(*cred)
+	return session.encrypt(sessionPath, value, contentType)
+}
+
+// session returns a session of a client
+func (s *Service) session(path dbus.ObjectPath, owner string) (*session, *dbus.Error) {
+	session, ok := s.sessions[path]
+	if !ok || session.owner != owner {
+		return nil, errNoSession
+	}
+	return session, nil
+}
+
+// search returns the paths of the items with all the attributes searched for
+func search(items []structs.Credential, attrs map[string]string) []dbus.ObjectPath {
+	found := []dbus.ObjectPath{}
+	for _, item := range items {
+		if matches(item, attrs) {
+			found = append(found, itemPath(item))
+		}
+	}
+	return found
+}
+
+// target returns the path a call was made on
+func target(msg dbus.Message) dbus.ObjectPath {
+	path, _ := msg.Headers[dbus.FieldPath].Value().(dbus.ObjectPath)
+	return path
+}
+
+// sender returns the unique name of the client making a call
+func sender(msg dbus.Message) string {
+	name, _ := msg.Headers[dbus.FieldSender].Value().(string)
+	return name
+}
+
+// unix returns the Unix time of t, 0 when it isn't known
+func unix(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.Unix())
+}
+
+func invalidArgs(message string) *dbus.Error {
+	return dbus.NewError("org.freedesktop.DBus.Error.InvalidArgs", []any{message})
+}
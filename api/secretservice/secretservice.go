@@ -0,0 +1,500 @@
+// Package secretservice makes the vault the Secret Service of a desktop
+// session, the org.freedesktop.secrets D-Bus API that libsecret and the
+// applications built on it keep their passwords through. Collections are
+// folders below a base folder and items are the secret items in them, with
+// the attributes of an item as its fields. Like the vault, the service is
+// locked without a session, and unlocking it asks for the master password.
+package secretservice
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"maps"
+	"os"
+	"passvault/response"
+	"passvault/structs"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// BusName is the well known name of the Secret Service on the session bus
+const BusName = "org.freedesktop.secrets"
+
+// Object paths of the service. Collections are named by the ID of their
+// folder, items by the ID of their credential below their collection.
+const (
+	servicePath      dbus.ObjectPath = "/org/freedesktop/secrets"
+	collectionPrefix                 = "/org/freedesktop/secrets/collection/"
+	aliasPrefix                      = "/org/freedesktop/secrets/aliases/"
+	sessionPrefix                    = "/org/freedesktop/secrets/session/"
+	promptPrefix                     = "/org/freedesktop/secrets/prompt/"
+	// none stands for no object, like the prompt of a call needing none
+	none dbus.ObjectPath = "/"
+)
+
+const (
+	serviceInterface    = "org.freedesktop.Secret.Service"
+	collectionInterface = "org.freedesktop.Secret.Collection"
+	itemInterface       = "org.freedesktop.Secret.Item"
+	sessionInterface    = "org.freedesktop.Secret.Session"
+	promptInterface     = "org.freedesktop.Secret.Prompt"
+)
+
+const (
+	// secretAttachment is the attachment holding secrets that aren't text,
+	// text is kept as the password
+	secretAttachment = "secret"
+	// untitled labels the items and collections created without a label
+	untitled = "Untitled"
+	// maxUnlockAttempts is how many wrong master passwords dismiss a prompt
+	maxUnlockAttempts = 3
+	// keyringService is the service the command line client files its
+	// session under in the OS keyring
+	keyringService = "passvault"
+)
+
+var (
+	errNoSuchObject = dbus.NewError("org.freedesktop.Secret.Error.NoSuchObject", []any{"no such object"})
+	errIsLocked     = dbus.NewError("org.freedesktop.Secret.Error.IsLocked", []any{"the vault is locked"})
+	errNoSession    = dbus.NewError("org.freedesktop.Secret.Error.NoSession", []any{"no such session"})
+	errOwnSession   = dbus.NewError("org.freedesktop.DBus.Error.NotSupported", []any{"PassVault can't keep its own session in the vault"})
+)
+
+// Vault is where the service keeps its collections and items. Calls fail
+// with response.ErrUnauthorized while the vault is locked.
+type Vault interface {
+	Folders() ([]structs.Folder, error)
+	CreateFolder(folder structs.Folder) (int, error)
+	UpdateFolder(id int, folder structs.Folder) error
+	DeleteFolder(id int) error
+	// Secrets returns every secret item, without attachments
+	Secrets() ([]structs.Credential, error)
+	GetCredential(id int) (*structs.Credential, error)
+	CreateCredential(cred structs.Credential) (int, error)
+	UpdateCredential(id int, cred structs.Credential) error
+	DeleteCredential(id int) error
+	// Unlock opens a session with the master password
+	Unlock(password string) error
+}
+
+// Service is a Secret Service keeping its collections in a vault
+type Service struct {
+	vault Vault
+	// ask asks the user for the master password, ok is false when the user
+	// declined
+	ask       func(prompt string) (password string, ok bool)
+	base      string
+	statePath string
+	conn      *dbus.Conn
+
+	mu sync.Mutex
+	// locked is set by Lock, until the service is unlocked through a prompt
+	locked bool
+	// seen is the vault as last read without its secrets, it answers
+	// searches while the vault is locked
+	seen     *view
+	aliases  map[string]int
+	sessions map[dbus.ObjectPath]*session
+	prompts  map[dbus.ObjectPath]*prompt
+	// serial numbers the sessions and prompts
+	serial int
+}
+
+// New returns a service keeping its collections below the top level folder
+// named base, and its aliases at statePath. ask asks for the master
+// password when a client unlocks the service.
+func New(vault Vault, ask func(prompt string) (string, bool), base, statePath string) (*Service, error) {
+	s := &Service{
+		vault:     vault,
+		ask:       ask,
+		base:      base,
+		statePath: statePath,
+		aliases:   map[string]int{},
+		sessions:  map[dbus.ObjectPath]*session{},
+		prompts:   map[dbus.ObjectPath]*prompt{},
+	}
+	data, err := os.ReadFile(statePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state struct {
+		Aliases map[string]int `json:"aliases"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	maps.Copy(s.aliases, state.Aliases)
+	return s, nil
+}
+
+// Serve exports the service on conn and owns the Secret Service name until
+// conn is closed
+func (s *Service) Serve(conn *dbus.Conn) error {
+	s.conn = conn
+	exports := []struct {
+		v       any
+		iface   string
+		subtree bool
+	}{
+		{serviceObject{s}, serviceInterface, false},
+		{collectionObject{s}, collectionInterface, true},
+		{itemObject{s}, itemInterface, true},
+		{sessionObject{s}, sessionInterface, true},
+		{promptObject{s}, promptInterface, true},
+		{propertiesObject{s}, "org.freedesktop.DBus.Properties", true},
+		{introspectObject{s}, "org.freedesktop.DBus.Introspectable", true},
+	}
+	for _, e := range exports {
+		var err error
+		if e.subtree {
+			err = conn.ExportSubtree(e.v, servicePath, e.iface)
+		} else {
+			err = conn.Export(e.v, servicePath, e.iface)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	reply, err := conn.RequestName(BusName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return err
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return errors.New(BusName + " is owned by another Secret Service, like gnome-keyring, stop it first")
+	}
+	log.Printf("Serving the Secret Service from the folder %s", s.base)
+
+	// Sessions and prompts end with the connection of their client
+	if err := conn.AddMatchSignal(dbus.WithMatchInterface("org.freedesktop.DBus"), dbus.WithMatchMember("NameOwnerChanged")); err != nil {
+		return err
+	}
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+	for signal := range signals {
+		var name, oldOwner, newOwner string
+		if dbus.Store(signal.Body, &name, &oldOwner, &newOwner) == nil && strings.HasPrefix(name, ":") && newOwner == "" {
+			s.forget(name)
+		}
+	}
+	return nil
+}
+
+// forget ends the sessions and prompts of a client that left the bus
+func (s *Service) forget(owner string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	maps.DeleteFunc(s.sessions, func(_ dbus.ObjectPath, session *session) bool { return session.owner == owner })
+	maps.DeleteFunc(s.prompts, func(_ dbus.ObjectPath, p *prompt) bool { return p.owner == owner })
+}
+
+// saveAliases writes the aliases back to the state file, readable by the
+// user only
+func (s *Service) saveAliases() error {
+	if err := os.MkdirAll(filepath.Dir(s.statePath), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(map[string]any{"aliases": s.aliases}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.statePath + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.statePath)
+}
+
+// view is the collections and items of the vault at one time
+type view struct {
+	locked bool
+	// base is the ID of the base folder, 0 before the first collection
+	base        int
+	collections []structs.Folder
+	items       []structs.Credential
+}
+
+// load reads the collections and items from the vault. While it is locked
+// they are the ones last read.
+func (s *Service) load() (*view, error) {
+	if s.locked {
+		return s.lockedView(), nil
+	}
+	folders, err := s.vault.Folders()
+	if errors.Is(err, response.ErrUnauthorized) {
+		return s.lockedView(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.vault.Secrets()
+	if errors.Is(err, response.ErrUnauthorized) {
+		return s.lockedView(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	v := &view{}
+	for _, folder := range folders {
+		if folder.ParentID == nil && folder.Name == s.base {
+			v.base = folder.ID
+		}
+	}
+	for _, folder := range folders {
+		if v.base != 0 && folder.ParentID != nil && *folder.ParentID == v.base {
+			v.collections = append(v.collections, folder)
+		}
+	}
+	seen := &view{base: v.base, collections: v.collections}
+	for _, item := range items {
+		if item.FolderID != nil && v.collection(*item.FolderID) != nil {
+			v.items = append(v.items, item)
+			item.Password, item.Attachments = "", nil
+			seen.items = append(seen.items, item)
+		}
+	}
+	s.seen = seen
+	return v, nil
+}
+
+// lockedView is the vault as last seen, locked. Before it was seen at all
+// only the collections with aliases are known, without their labels.
+func (s *Service) lockedView() *view {
+	if s.seen != nil {
+		v := *s.seen
+		v.locked = true
+		return &v
+	}
+	v := &view{locked: true}
+	for _, id := range s.aliases {
+		if v.collection(id) == nil {
+			v.collections = append(v.collections, structs.Folder{ID: id})
+		}
+	}
+	return v
+}
+
+// collection returns the collection with a folder ID, nil when there is none
+func (v *view) collection(id int) *structs.Folder {
+	i := slices.IndexFunc(v.collections, func(f structs.Folder) bool { return f.ID == id })
+	if i < 0 {
+		return nil
+	}
+	return &v.collections[i]
+}
+
+// itemsOf returns the items of a collection
+func (v *view) itemsOf(collection int) []structs.Credential {
+	var items []structs.Credential
+	for _, item := range v.items {
+		if *item.FolderID == collection {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// collectionAt returns the collection at a path, or at the path of one of
+// its aliases
+func (s *Service) collectionAt(v *view, path dbus.ObjectPath) (*structs.Folder, *dbus.Error) {
+	var id int
+	if name, ok := strings.CutPrefix(string(path), aliasPrefix); ok {
+		id = s.aliases[name]
+	} else if rest, ok := strings.CutPrefix(string(path), collectionPrefix); ok {
+		id, _ = strconv.Atoi(rest)
+	}
+	if collection := v.collection(id); collection != nil {
+		return collection, nil
+	}
+	return nil, errNoSuchObject
+}
+
+// itemAt returns the item at a path
+func (v *view) itemAt(path dbus.ObjectPath) (*structs.Credential, *dbus.Error) {
+	rest, ok := strings.CutPrefix(string(path), collectionPrefix)
+	collection, id, found := strings.Cut(rest, "/")
+	if !ok || !found {
+		return nil, errNoSuchObject
+	}
+	for i, item := range v.items {
+		if strconv.Itoa(*item.FolderID) == collection && strconv.Itoa(item.ID) == id {
+			return &v.items[i], nil
+		}
+	}
+	return nil, errNoSuchObject
+}
+
+func collectionPath(id int) dbus.ObjectPath {
+	return dbus.ObjectPath(collectionPrefix + strconv.Itoa(id))
+}
+
+func itemPath(item structs.Credential) dbus.ObjectPath {
+	return dbus.ObjectPath(collectionPrefix + strconv.Itoa(*item.FolderID) + "/" + strconv.Itoa(item.ID))
+}
+
+// attributes returns the attributes of an item, kept as its fields
+func attributes(item structs.Credential) map[string]string {
+	attrs := map[string]string{}
+	for _, field := range item.Fields {
+		attrs[field.Name] = field.Value
+	}
+	return attrs
+}
+
+// fields returns the fields keeping attributes, in the order of their names
+func fields(attrs map[string]string) []structs.CustomField {
+	fields := []structs.CustomField{}
+	for _, name := range slices.Sorted(maps.Keys(attrs)) {
+		if strings.TrimSpace(name) != "" {
+			fields = append(fields, structs.CustomField{Name: name, Value: attrs[name]})
+		}
+	}
+	return fields
+}
+
+// matches reports whether an item has all the attributes searched for
+func matches(item structs.Credential, search map[string]string) bool {
+	attrs := attributes(item)
+	for name, value := range search {
+		if got, ok := attrs[name]; !ok || got != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ownSession reports whether attributes are the ones the command line
+// client files its session under in the OS keyring. The vault can't keep
+// the session it is unlocked with, so the client keeps it in its config.
+func ownSession(attrs map[string]string) bool {
+	return attrs["service"] == keyringService
+}
+
+// readSecret returns the secret of an item and its content type
+func readSecret(item structs.Credential) ([]byte, string) {
+	for _, attachment := range item.Attachments {
+		if attachment.Name == secretAttachment {
+			return attachment.Data, attachment.ContentType
+		}
+	}
+	return []byte(item.Password), "text/plain"
+}
+
+// writeSecret sets the secret of an item. Text is kept as the password,
+// anything else as an attachment.
+func writeSecret(item *structs.Credential, value []byte, contentType string) {
+	item.Attachments = slices.DeleteFunc(item.Attachments, func(a structs.Attachment) bool { return a.Name == secretAttachment })
+	if (contentType == "" || strings.HasPrefix(contentType, "text/plain")) && utf8.Valid(value) {
+		item.Password = string(value)
+		return
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	item.Password = ""
+	item.Attachments = append(item.Attachments, structs.Attachment{Name: secretAttachment, ContentType: contentType, Data: value})
+}
+
+// failed turns an error of the vault into a D-Bus error
+func failed(err error) *dbus.Error {
+	var dbusErr *dbus.Error
+	if errors.As(err, &dbusErr) {
+		return dbusErr
+	}
+	if errors.Is(err, response.ErrUnauthorized) {
+		return errIsLocked
+	}
+	log.Printf("Request failed: %v", err)
+	return dbus.MakeFailedError(err)
+}
+
+// emit sends a signal, clients missing it only miss an update
+func (s *Service) emit(path dbus.ObjectPath, name string, values ...any) {
+	if err := s.conn.Emit(path, name, values...); err != nil {
+		log.Printf("Can't emit %s: %v", name, err)
+	}
+}
+
+// prompt is an operation waiting for the client to unlock the vault
+type prompt struct {
+	owner string
+	// action completes the operation once the vault is unlocked, its result
+	// is sent with the Completed signal
+	action  func() (dbus.Variant, error)
+	started bool
+}
+
+// newPrompt registers a prompt for a client, and returns its path
+func (s *Service) newPrompt(owner string, action func() (dbus.Variant, error)) dbus.ObjectPath {
+	s.serial++
+	path := dbus.ObjectPath(promptPrefix + strconv.Itoa(s.serial))
+	s.prompts[path] = &prompt{owner: owner, action: action}
+	return path
+}
+
+// runPrompt asks for the master password, completes the operation of a
+// prompt and tells the client how it went. A prompt dismissed meanwhile is
+// left alone.
+func (s *Service) runPrompt(path dbus.ObjectPath, p *prompt) {
+	unlocked := s.unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.prompts[path] != p {
+		return
+	}
+	delete(s.prompts, path)
+	dismissed, result := true, dbus.MakeVariant("")
+	if unlocked {
+		if value, err := p.action(); err != nil {
+			log.Printf("Request failed: %v", err)
+		} else {
+			dismissed, result = false, value
+		}
+	}
+	s.emit(path, promptInterface+".Completed", dismissed, result)
+}
+
+// unlock asks for the master password until the vault takes it. It gives
+// up when the user declines or after too many wrong passwords.
+func (s *Service) unlock() bool {
+	// Another prompt may have unlocked the vault already
+	s.mu.Lock()
+	v, err := s.load()
+	s.mu.Unlock()
+	if err == nil && !v.locked {
+		return true
+	}
+
+	message := "Enter the master password to unlock PassVault"
+	for range maxUnlockAttempts {
+		password, ok := s.ask(message)
+		if !ok {
+			return false
+		}
+		err = s.vault.Unlock(password)
+		if err == nil {
+			s.mu.Lock()
+			s.locked = false
+			s.mu.Unlock()
+			return true
+		}
+		if !errors.Is(err, response.ErrUnauthorized) {
+			log.Printf("Can't unlock the vault: %v", err)
+			return false
+		}
+		message = "Wrong master password, try again"
+	}
+	return false
+}
@@ -0,0 +1,436 @@
+package secretservice
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"os/exec"
+	"passvault/response"
+	"passvault/structs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// fakeVault keeps folders and credentials in memory. While it is locked
+// every call fails, no password unlocks it.
+type fakeVault struct {
+	mu          sync.Mutex
+	locked      bool
+	folders     []structs.Folder
+	credentials []structs.Credential
+	// next is the ID of the next folder or credential
+	next int
+}
+
+func (v *fakeVault) Folders() ([]structs.Folder, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.locked {
+		return nil, response.ErrUnauthorized
+	}
+	return slices.Clone(v.folders), nil
+}
+
+func (v *fakeVault) CreateFolder(folder structs.Folder) (int, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.locked {
+		return 0, response.ErrUnauthorized
+	}
+	v.next++
+	folder.ID = v.next
+	v.folders = append(v.folders, folder)
+	return folder.ID, nil
+}
+
+func (v *fakeVault) UpdateFolder(id int, folder structs.Folder) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.locked {
+		return response.ErrUnauthorized
+	}
+	i := slices.IndexFunc(v.folders, func(f structs.Folder) bool { return f.ID == id })
+	if i < 0 {
+		return response.ErrFolderNotFound
+	}
+	folder.ID = id
+	v.folders[i] = folder
+	return nil
+}
+
+func (v *fakeVault) DeleteFolder(id int) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.locked {
+		return response.ErrUnauthorized
+	}
+	v.folders = slices.DeleteFunc(v.folders, func(f structs.Folder) bool { return f.ID == id })
+	v.credentials = slices.DeleteFunc(v.credentials, func(c structs.Credential) bool { return c.FolderID != nil && *c.FolderID == id })
+	return nil
+}
+
+func (v *fakeVault) Secrets() ([]structs.Credential, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.locked {
+		return nil, response.ErrUnauthorized
+	}
+	var secrets []structs.Credential
+	for _, cred := range v.credentials {
+		if cred.ItemType == structs.ItemTypeSecret {
+			cred.Attachments = nil
+			secrets = append(secrets, cred)
+		}
+	}
+	return secrets, nil
+}
+
+func (v *fakeVault) GetCredential(id int) (*structs.Credential, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.locked {
+		return nil, response.ErrUnauthorized
+	}
+	i := slices.IndexFunc(v.credentials, func(c structs.Credential) bool { return c.ID == id })
+	if i < 0 {
+		return nil, response.ErrCredentialNotFound
+	}
+	cred := v.credentials[i]
+	return &cred, nil
+}
+
+func (v *fakeVault) CreateCredential(cred structs.Credential) (int, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.locked {
+		return 0, response.ErrUnauthorized
+	}
+	v.next++
+	cred.ID = v.next
+	v.credentials = append(v.credentials, cred)
+	return cred.ID, nil
+}
+
+func (v *fakeVault) UpdateCredential(id int, cred structs.Credential) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.locked {
+		return response.ErrUnauthorized
+	}
+	i := slices.IndexFunc(v.credentials, func(c structs.Credential) bool { return c.ID == id })
+	if i < 0 {
+		return response.ErrCredentialNotFound
+	}
+	cred.ID = id
+	v.credentials[i] = cred
+	return nil
+}
+
+func (v *fakeVault) DeleteCredential(id int) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.locked {
+		return response.ErrUnauthorized
+	}
+	v.credentials = slices.DeleteFunc(v.credentials, func(c structs.Credential) bool { return c.ID == id })
+	return nil
+}
+
+func (v *fakeVault) Unlock(password string) error {
+	return response.ErrUnauthorized
+}
+
+// lock locks or unlocks the vault
+func (v *fakeVault) lock(locked bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.locked = locked
+}
+
+// sessionBus starts a session bus of its own for a test and points
+// DBUS_SESSION_BUS_ADDRESS at it. The test is skipped without dbus-daemon.
+func sessionBus(t *testing.T) {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+	cmd := exec.Command(daemon, "--session", "--print-address", "--nofork")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading the address of dbus-daemon: %v", err)
+	}
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", strings.TrimSpace(address))
+}
+
+// serve serves a vault as the Secret Service on a session bus of its own,
+// and returns the connection of a client to it
+func serve(t *testing.T, vault Vault) *dbus.Conn {
+	t.Helper()
+	sessionBus(t)
+	service, err := New(vault, func(string) (string, bool) { return "", false }, "Secret Service", filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	served := make(chan error, 1)
+	go func() { served <- service.Serve(conn) }()
+
+	client, err := dbus.ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		var owned bool
+		if err := client.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, BusName).Store(&owned); err != nil {
+			t.Fatal(err)
+		}
+		if owned {
+			return client
+		}
+		select {
+		case err := <-served:
+			t.Fatalf("Serve = %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s wasn't owned in time", BusName)
+		}
+	}
+}
+
+// openSession opens a session with an algorithm, and returns its path and
+// the client's end of it
+func openSession(t *testing.T, service dbus.BusObject, algorithm string) (dbus.ObjectPath, *session) {
+	t.Helper()
+	input := dbus.MakeVariant("")
+	var private *big.Int
+	if algorithm == algorithmDH {
+		var err error
+		if private, err = rand.Int(rand.Reader, new(big.Int).Sub(dhPrime, big.NewInt(3))); err != nil {
+			t.Fatal(err)
+		}
+		private.Add(private, big.NewInt(2))
+		input = dbus.MakeVariant(new(big.Int).Exp(big.NewInt(2), private, dhPrime).Bytes())
+	}
+
+	var output dbus.Variant
+	var path dbus.ObjectPath
+	if err := service.Call(serviceInterface+".OpenSession", 0, algorithm, input).Store(&output, &path); err != nil {
+		t.Fatalf("OpenSession(%s) = %v", algorithm, err)
+	}
+	if private == nil {
+		return path, &session{}
+	}
+	peer, ok := output.Value().([]byte)
+	if !ok {
+		t.Fatalf("OpenSession output = %v, want a public key", output)
+	}
+	shared := new(big.Int).Exp(new(big.Int).SetBytes(peer), private, dhPrime).FillBytes(make([]byte, (dhPrime.BitLen()+7)/8))
+	key, err := hkdf.Key(sha256.New, shared, nil, "", 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, &session{key: key}
+}
+
+func TestOpenSession(t *testing.T) {
+	service := serve(t, &fakeVault{}).Object(BusName, servicePath)
+	tests := []struct {
+		name      string
+		algorithm string
+		input     dbus.Variant
+		// err is the name of the D-Bus error, empty when the session opens
+		err string
+	}{
+		{"plain", algorithmPlain, dbus.MakeVariant(""), ""},
+		{"dh", algorithmDH, dbus.MakeVariant(big.NewInt(2).Bytes()), ""},
+		{"unknown algorithm", "dh-ietf2048-sha256-aes256-cbc-pkcs7", dbus.MakeVariant(""), "org.freedesktop.DBus.Error.NotSupported"},
+		{"dh without a key", algorithmDH, dbus.MakeVariant(""), "org.freedesktop.DBus.Error.InvalidArgs"},
+		{"dh with a weak key", algorithmDH, dbus.MakeVariant([]byte{1}), "org.freedesktop.DBus.Error.InvalidArgs"},
+		{"dh with a key out of the group", algorithmDH, dbus.MakeVariant(dhPrime.Bytes()), "org.freedesktop.DBus.Error.InvalidArgs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output dbus.Variant
+			var path dbus.ObjectPath
+			err := service.Call(serviceInterface+".OpenSession", 0, tt.algorithm, tt.input).Store(&output, &path)
+			if tt.err != "" {
+				var dbusErr dbus.Error
+				if !errors.As(err, &dbusErr) || dbusErr.Name != tt.err {
+					t.Fatalf("OpenSession = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(path), sessionPrefix) {
+				t.Fatalf("session path = %s", path)
+			}
+		})
+	}
+}
+
+func TestItems(t *testing.T) {
+	vault := &fakeVault{}
+	client := serve(t, vault)
+	service := client.Object(BusName, servicePath)
+
+	var collection, prompt dbus.ObjectPath
+	properties := map[string]dbus.Variant{collectionInterface + ".Label": dbus.MakeVariant("Login")}
+	if err := service.Call(serviceInterface+".CreateCollection", 0, properties, "default").Store(&collection, &prompt); err != nil {
+		t.Fatal(err)
+	}
+	if prompt != none {
+		t.Fatalf("CreateCollection prompted with %s on an unlocked vault", prompt)
+	}
+
+	tests := []struct {
+		name        string
+		algorithm   string
+		value       []byte
+		contentType string
+	}{
+		{"plain text", algorithmPlain, []byte("hunter22"), "text/plain"},
+		{"plain binary", algorithmPlain, []byte{0, 1, 2, 0xff}, "application/octet-stream"},
+		{"dh text", algorithmDH, []byte("correct horse battery staple"), "text/plain"},
+		{"dh binary", algorithmDH, []byte{0, 1, 2, 0xff}, "application/octet-stream"},
+		{"dh a block long", algorithmDH, []byte("0123456789abcdef"), "text/plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionPath, session := openSession(t, service, tt.algorithm)
+			in, err := session.encrypt(sessionPath, tt.value, tt.contentType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			attrs := map[string]string{"test": tt.name}
+			properties := map[string]dbus.Variant{
+				itemInterface + ".Label":      dbus.MakeVariant(tt.name),
+				itemInterface + ".Attributes": dbus.MakeVariant(attrs),
+			}
+			var item, prompt dbus.ObjectPath
+			if err := client.Object(BusName, collection).Call(collectionInterface+".CreateItem", 0, properties, in, true).Store(&item, &prompt); err != nil {
+				t.Fatalf("CreateItem = %v", err)
+			}
+			if !strings.HasPrefix(string(item), string(collection)+"/") || prompt != none {
+				t.Fatalf("CreateItem = %s, %s", item, prompt)
+			}
+
+			var unlocked, locked []dbus.ObjectPath
+			if err := service.Call(serviceInterface+".SearchItems", 0, attrs).Store(&unlocked, &locked); err != nil {
+				t.Fatalf("SearchItems = %v", err)
+			}
+			if !slices.Equal(unlocked, []dbus.ObjectPath{item}) || len(locked) != 0 {
+				t.Fatalf("SearchItems = %v, %v, want [%s]", unlocked, locked, item)
+			}
+
+			var secrets map[dbus.ObjectPath]secret
+			if err := service.Call(serviceInterface+".GetSecrets", 0, unlocked, sessionPath).Store(&secrets); err != nil {
+				t.Fatalf("GetSecrets = %v", err)
+			}
+			out, ok := secrets[item]
+			if !ok || len(secrets) != 1 {
+				t.Fatalf("GetSecrets = %v, want the secret of %s", secrets, item)
+			}
+			if tt.algorithm == algorithmDH && bytes.Contains(out.Value, tt.value) {
+				t.Fatal("the secret was sent in the clear in a DH session")
+			}
+			value, err := session.decrypt(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(value, tt.value) || out.ContentType != tt.contentType || out.Session != sessionPath {
+				t.Fatalf("secret = %q (%s) in %s, want %q (%s) in %s", value, out.ContentType, out.Session, tt.value, tt.contentType, sessionPath)
+			}
+		})
+	}
+
+	// The items are secret items in the folder of the collection, below
+	// the base folder
+	secrets, err := vault.Secrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets) != len(tests) {
+		t.Fatalf("vault holds %d secrets, want %d", len(secrets), len(tests))
+	}
+	for _, cred := range secrets {
+		if collectionPath(*cred.FolderID) != collection {
+			t.Fatalf("%s is in folder %d, want the collection %s", cred.Name, *cred.FolderID, collection)
+		}
+	}
+}
+
+func TestLocked(t *testing.T) {
+	vault := &fakeVault{}
+	client := serve(t, vault)
+	service := client.Object(BusName, servicePath)
+	sessionPath, _ := openSession(t, service, algorithmPlain)
+
+	var collection, item, prompt dbus.ObjectPath
+	if err := service.Call(serviceInterface+".CreateCollection", 0, map[string]dbus.Variant{}, "default").Store(&collection, &prompt); err != nil {
+		t.Fatal(err)
+	}
+	attrs := map[string]string{"user": "alice"}
+	properties := map[string]dbus.Variant{itemInterface + ".Attributes": dbus.MakeVariant(attrs)}
+	in := secret{Session: sessionPath, Parameters: []byte{}, Value: []byte("hunter22"), ContentType: "text/plain"}
+	if err := client.Object(BusName, collection).Call(collectionInterface+".CreateItem", 0, properties, in, false).Store(&item, &prompt); err != nil {
+		t.Fatal(err)
+	}
+
+	// Searches are answered from the vault as last seen, secrets aren't
+	var unlocked, locked []dbus.ObjectPath
+	if err := service.Call(serviceInterface+".SearchItems", 0, attrs).Store(&unlocked, &locked); err != nil {
+		t.Fatal(err)
+	}
+	vault.lock(true)
+	if err := service.Call(serviceInterface+".SearchItems", 0, attrs).Store(&unlocked, &locked); err != nil {
+		t.Fatal(err)
+	}
+	if len(unlocked) != 0 || !slices.Equal(locked, []dbus.ObjectPath{item}) {
+		t.Fatalf("SearchItems = %v, %v, want [] [%s]", unlocked, locked, item)
+	}
+	var secrets map[dbus.ObjectPath]secret
+	if err := service.Call(serviceInterface+".GetSecrets", 0, locked, sessionPath).Store(&secrets); err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets) != 0 {
+		t.Fatalf("GetSecrets = %v on a locked vault", secrets)
+	}
+
+	// Creating an item needs a prompt to unlock the vault first
+	if err := client.Object(BusName, collection).Call(collectionInterface+".CreateItem", 0, properties, in, false).Store(&item, &prompt); err != nil {
+		t.Fatal(err)
+	}
+	if item != none || !strings.HasPrefix(string(prompt), promptPrefix) {
+		t.Fatalf("CreateItem = %s, %s, want a prompt", item, prompt)
+	}
+}
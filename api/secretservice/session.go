@@ -0,0 +1,132 @@
+package secretservice
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Algorithms secrets are transferred with
+const (
+	algorithmPlain = "plain"
+	// algorithmDH agrees on a key with Diffie-Hellman over the second
+	// Oakley group of RFC 2409, and encrypts secrets with AES-128-CBC under
+	// the HKDF-SHA256 of the shared secret
+	algorithmDH = "dh-ietf1024-sha256-aes128-cbc-pkcs7"
+)
+
+// dhPrime is the prime of the second Oakley group, its generator is 2
+var dhPrime, _ = new(big.Int).SetString(strings.Join(strings.Fields(`
+	FFFFFFFF FFFFFFFF C90FDAA2 2168C234 C4C6628B 80DC1CD1
+	29024E08 8A67CC74 020BBEA6 3B139B22 514A0879 8E3404DD
+	EF9519B3 CD3A431B 302B0A6D F25F1437 4FE1356D 6D51C245
+	E485B576 625E7EC6 F44C42E9 A637ED6B 0BFF5CB6 F406B7ED
+	EE386BFB 5A899FA5 AE9F2411 7C4B1FE6 49286651 ECE65381
+	FFFFFFFF FFFFFFFF`), ""), 16)
+
+var (
+	errAlgorithm = errors.New("unsupported algorithm")
+	errPublicKey = errors.New("invalid public key")
+	errSecret    = errors.New("secret can't be decrypted")
+)
+
+// secret is a secret as it is transferred, encrypted for its session
+type secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// session is what a client transfers secrets in, only it can use the
+// session
+type session struct {
+	owner string
+	// key encrypts the secrets of DH sessions, plain sessions have none
+	key []byte
+}
+
+// newSession opens a session with the algorithm a client asked for, and
+// returns the output for the client
+func newSession(owner, algorithm string, input dbus.Variant) (*session, dbus.Variant, error) {
+	switch algorithm {
+	case algorithmPlain:
+		return &session{owner: owner}, dbus.MakeVariant(""), nil
+	case algorithmDH:
+		peer, ok := input.Value().([]byte)
+		if !ok {
+			return nil, dbus.Variant{}, errPublicKey
+		}
+		y := new(big.Int).SetBytes(peer)
+		if y.Cmp(big.NewInt(1)) <= 0 || y.Cmp(new(big.Int).Sub(dhPrime, big.NewInt(1))) >= 0 {
+			return nil, dbus.Variant{}, errPublicKey
+		}
+		private, err := rand.Int(rand.Reader, new(big.Int).Sub(dhPrime, big.NewInt(3)))
+		if err != nil {
+			return nil, dbus.Variant{}, err
+		}
+		private.Add(private, big.NewInt(2))
+		public := new(big.Int).Exp(big.NewInt(2), private, dhPrime)
+
+		// The shared secret is padded to the length of the prime, the way
+		// libsecret does
+		shared := new(big.Int).Exp(y, private, dhPrime).FillBytes(make([]byte, (dhPrime.BitLen()+7)/8))
+		key, err := hkdf.Key(sha256.New, shared, nil, "", 16)
+		if err != nil {
+			return nil, dbus.Variant{}, err
+		}
+		return &session{owner: owner, key: key}, dbus.MakeVariant(public.Bytes()), nil
+	}
+	return nil, dbus.Variant{}, fmt.Errorf("%w %s", errAlgorithm, algorithm)
+}
+
+// encrypt encrypts a secret for the session, with a new IV as its
+// parameters
+func (s *session) encrypt(path dbus.ObjectPath, value []byte, contentType string) (secret, error) {
+	out := secret{Session: path, Parameters: []byte{}, Value: value, ContentType: contentType}
+	if s.key == nil {
+		return out, nil
+	}
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return secret{}, err
+	}
+	out.Parameters = make([]byte, aes.BlockSize)
+	if _, err := rand.Read(out.Parameters); err != nil {
+		return secret{}, err
+	}
+	padding := aes.BlockSize - len(value)%aes.BlockSize
+	out.Value = append(bytes.Clone(value), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, out.Parameters).CryptBlocks(out.Value, out.Value)
+	return out, nil
+}
+
+// decrypt decrypts a secret sent in the session
+func (s *session) decrypt(in secret) ([]byte, error) {
+	if s.key == nil {
+		return in.Value, nil
+	}
+	if len(in.Parameters) != aes.BlockSize || len(in.Value) == 0 || len(in.Value)%aes.BlockSize != 0 {
+		return nil, errSecret
+	}
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, err
+	}
+	value := bytes.Clone(in.Value)
+	cipher.NewCBCDecrypter(block, in.Parameters).CryptBlocks(value, value)
+	padding := int(value[len(value)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.Equal(value[len(value)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, errSecret
+	}
+	return value[:len(value)-padding], nil
+}
@@ -0,0 +1,306 @@
+// Package sshagent serves the SSH keys kept in the vault over the OpenSSH
+// agent protocol. Keys are read from the vault for every request and never
+// kept, so the agent has no keys while the vault is locked.
+package sshagent
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"passvault/response"
+	"passvault/structs"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Fields of an SSH key item constraining its use, like ssh-add -c and -t
+const (
+	// ConfirmField set to yes asks before every use of the key
+	ConfirmField = "confirm"
+	// LifetimeField is how long the key is served after the session of the
+	// vault started, a duration like 1h30m or a number of seconds
+	LifetimeField = "lifetime"
+)
+
+var (
+	errLocked   = errors.New("agent is locked")
+	errNoKey    = errors.New("no such key in the vault")
+	errRefused  = errors.New("use of key refused")
+	errReadOnly = errors.New("keys are added and removed in the vault")
+)
+
+// Source is where the agent reads its keys from
+type Source interface {
+	// Keys returns the SSH key items to serve and the session they were
+	// read with. It fails with response.ErrUnauthorized while the vault is
+	// locked.
+	Keys() (session string, items []structs.Credential, err error)
+}
+
+// Agent is an SSH agent serving the keys of a vault
+type Agent struct {
+	source  Source
+	confirm func(prompt string) bool
+
+	mu      sync.Mutex
+	session string
+	// started is when the agent first read keys with the session, the
+	// lifetimes of all keys count from there
+	started time.Time
+	// locked is set by ssh-add -x, until ssh-add -X with the same passphrase
+	locked     bool
+	passphrase []byte
+}
+
+var _ agent.ExtendedAgent = (*Agent)(nil)
+
+// New returns an agent serving the keys of source. confirm asks whether a
+// key may be used, without it keys asking for confirmation are refused.
+func New(source Source, confirm func(prompt string) bool) *Agent {
+	return &Agent{source: source, confirm: confirm}
+}
+
+// Serve answers the agent requests of every connection to l, until l is
+// closed
+func (a *Agent) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			agent.ServeAgent(a, conn)
+		}()
+	}
+}
+
+// key is a key of the vault, ready to sign with
+type key struct {
+	signer   ssh.Signer
+	comment  string
+	confirm  bool
+	lifetime time.Duration
+}
+
+// parseKey reads the private key of an item, and the constraints in its
+// fields
+func parseKey(item structs.Credential) (*key, error) {
+	raw, err := ssh.ParseRawPrivateKey([]byte(item.Password))
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(raw)
+	if err != nil {
+		return nil, err
+	}
+	k := &key{signer: signer, comment: item.Name}
+	for _, field := range item.Fields {
+		value := strings.ToLower(strings.TrimSpace(field.Value))
+		switch strings.ToLower(field.Name) {
+		case ConfirmField:
+			switch value {
+			case "yes", "true", "1":
+				k.confirm = true
+			case "no", "false", "0", "":
+			default:
+				return nil, fmt.Errorf("invalid %s %q, use yes or no", ConfirmField, field.Value)
+			}
+		case LifetimeField:
+			if k.lifetime, err = parseLifetime(value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return k, nil
+}
+
+// parseLifetime reads a lifetime in seconds, as ssh-add -t takes it, or as
+// a duration
+func parseLifetime(value string) (time.Duration, error) {
+	var lifetime time.Duration
+	seconds, err := strconv.Atoi(value)
+	if err == nil {
+		lifetime = time.Duration(seconds) * time.Second
+	} else {
+		lifetime, err = time.ParseDuration(value)
+	}
+	if err != nil || lifetime <= 0 {
+		return 0, fmt.Errorf("invalid %s %q, use a duration like 1h30m", LifetimeField, value)
+	}
+	return lifetime, nil
+}
+
+// keys reads the keys of the vault, leaving out those whose lifetime has
+// run out
+func (a *Agent) keys() ([]*key, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.locked {
+		return nil, errLocked
+	}
+
+	session, items, err := a.source.Keys()
+	if errors.Is(err, response.ErrUnauthorized) {
+		// Lifetimes start over once the vault is unlocked again
+		a.session, a.started = "", time.Time{}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session != a.session || a.started.IsZero() {
+		a.session, a.started = session, time.Now()
+	}
+
+	age := time.Since(a.started)
+	var keys []*key
+	for _, item := range items {
+		k, err := parseKey(item)
+		if err != nil {
+			log.Printf("Skipping SSH key %s: %v", item.Name, err)
+			continue
+		}
+		if k.lifetime > 0 && age >= k.lifetime {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// List returns the keys of the vault, none while it or the agent is locked
+func (a *Agent) List() ([]*agent.Key, error) {
+	keys, err := a.keys()
+	if errors.Is(err, errLocked) || errors.Is(err, response.ErrUnauthorized) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*agent.Key, 0, len(keys))
+	for _, k := range keys {
+		pub := k.signer.PublicKey()
+		list = append(list, &agent.Key{Format: pub.Type(), Blob: pub.Marshal(), Comment: k.comment})
+	}
+	return list, nil
+}
+
+// Sign signs data with a key of the vault
+func (a *Agent) Sign(pub ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	return a.SignWithFlags(pub, data, 0)
+}
+
+// SignWithFlags signs data with a key of the vault, asking first when the
+// key wants confirmation. The flags pick the hash of RSA signatures.
+func (a *Agent) SignWithFlags(pub ssh.PublicKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+	keys, err := a.keys()
+	if err != nil {
+		return nil, err
+	}
+	wanted := pub.Marshal()
+	var k *key
+	for _, candidate := range keys {
+		if subtle.ConstantTimeCompare(candidate.signer.PublicKey().Marshal(), wanted) == 1 {
+			k = candidate
+			break
+		}
+	}
+	if k == nil {
+		return nil, errNoKey
+	}
+
+	if k.confirm {
+		prompt := fmt.Sprintf("Allow use of key %s?\nKey fingerprint %s.", k.comment, ssh.FingerprintSHA256(k.signer.PublicKey()))
+		if a.confirm == nil || !a.confirm(prompt) {
+			return nil, errRefused
+		}
+	}
+
+	var algorithm string
+	switch flags {
+	case 0:
+		return k.signer.Sign(rand.Reader, data)
+	case agent.SignatureFlagRsaSha256:
+		algorithm = ssh.KeyAlgoRSASHA256
+	case agent.SignatureFlagRsaSha512:
+		algorithm = ssh.KeyAlgoRSASHA512
+	default:
+		return nil, fmt.Errorf("unsupported signature flags %d", flags)
+	}
+	signer, ok := k.signer.(ssh.AlgorithmSigner)
+	if !ok {
+		return nil, fmt.Errorf("key %s can't sign with %s", k.comment, algorithm)
+	}
+	return signer.SignWithAlgorithm(rand.Reader, data, algorithm)
+}
+
+// Signers returns the signers of the keys that don't ask for confirmation
+func (a *Agent) Signers() ([]ssh.Signer, error) {
+	keys, err := a.keys()
+	if err != nil {
+		return nil, err
+	}
+	var signers []ssh.Signer
+	for _, k := range keys {
+		if !k.confirm {
+			signers = append(signers, k.signer)
+		}
+	}
+	return signers, nil
+}
+
+// Lock hides the keys until Unlock is called with the same passphrase
+func (a *Agent) Lock(passphrase []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.locked {
+		return errLocked
+	}
+	a.locked, a.passphrase = true, append([]byte(nil), passphrase...)
+	return nil
+}
+
+// Unlock undoes Lock
+func (a *Agent) Unlock(passphrase []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.locked {
+		return errors.New("agent is not locked")
+	}
+	if subtle.ConstantTimeCompare(passphrase, a.passphrase) != 1 {
+		return errors.New("incorrect passphrase")
+	}
+	a.locked, a.passphrase = false, nil
+	return nil
+}
+
+// Add is refused, keys are added to the vault
+func (a *Agent) Add(agent.AddedKey) error {
+	return errReadOnly
+}
+
+// Remove is refused, keys are removed in the vault
+func (a *Agent) Remove(ssh.PublicKey) error {
+	return errReadOnly
+}
+
+// RemoveAll is refused, keys are removed in the vault
+func (a *Agent) RemoveAll() error {
+	return errReadOnly
+}
+
+// Extension reports that the agent has no extensions
+func (a *Agent) Extension(string, []byte) ([]byte, error) {
+	return nil, agent.ErrExtensionUnsupported
+}
@@ -0,0 +1,256 @@
+package sshagent
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"passvault/response"
+	"passvault/structs"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// fakeSource serves fixed items with a session that tests change
+type fakeSource struct {
+	session string
+	items   []structs.Credential
+	err     error
+}
+
+func (s *fakeSource) Keys() (string, []structs.Credential, error) {
+	return s.session, s.items, s.err
+}
+
+// newKeyItem returns an SSH key item holding a fresh ed25519 key
+func newKeyItem(t *testing.T, name string, fields ...structs.CustomField) (structs.Credential, ssh.PublicKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := structs.Credential{Name: name, Password: string(pem.EncodeToMemory(block)), ItemType: structs.ItemTypeSSHKey, Fields: fields}
+	return item, sshPub
+}
+
+// comments returns the comments of the keys the agent lists
+func comments(t *testing.T, a *Agent) []string {
+	t.Helper()
+	keys, err := a.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, k := range keys {
+		names = append(names, k.Comment)
+	}
+	return names
+}
+
+func TestParseLifetime(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		err   bool
+	}{
+		{value: "3600", want: time.Hour},
+		{value: "1h30m", want: 90 * time.Minute},
+		{value: "0", err: true},
+		{value: "-5m", err: true},
+		{value: "soon", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseLifetime(tt.value)
+			if (err != nil) != tt.err || got != tt.want {
+				t.Fatalf("parseLifetime(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		fields   []structs.CustomField
+		confirm  bool
+		lifetime time.Duration
+		err      bool
+	}{
+		{name: "plain"},
+		{name: "constrained", fields: []structs.CustomField{{Name: "Confirm", Value: "Yes"}, {Name: "lifetime", Value: "8h"}}, confirm: true, lifetime: 8 * time.Hour},
+		{name: "not confirmed", fields: []structs.CustomField{{Name: "confirm", Value: "no"}}},
+		{name: "bad confirm", fields: []structs.CustomField{{Name: "confirm", Value: "maybe"}}, err: true},
+		{name: "bad lifetime", fields: []structs.CustomField{{Name: "lifetime", Value: "forever"}}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item, _ := newKeyItem(t, tt.name, tt.fields...)
+			k, err := parseKey(item)
+			if tt.err {
+				if err == nil {
+					t.Fatal("parseKey didn't fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if k.confirm != tt.confirm || k.lifetime != tt.lifetime || k.comment != tt.name {
+				t.Fatalf("parseKey = %+v", k)
+			}
+		})
+	}
+
+	if _, err := parseKey(structs.Credential{Name: "garbage", Password: "not a key"}); err == nil {
+		t.Fatal("parseKey read a key that isn't one")
+	}
+}
+
+func TestLifetime(t *testing.T) {
+	short, _ := newKeyItem(t, "short", structs.CustomField{Name: LifetimeField, Value: "1h"})
+	long, _ := newKeyItem(t, "long", structs.CustomField{Name: LifetimeField, Value: "8h"})
+	forever, _ := newKeyItem(t, "forever")
+	broken := structs.Credential{Name: "broken", Password: "not a key", ItemType: structs.ItemTypeSSHKey}
+
+	tests := []struct {
+		name string
+		// age is how long ago the session started
+		age  time.Duration
+		want []string
+	}{
+		{"fresh", 0, []string{"short", "long", "forever"}},
+		{"short ran out", 2 * time.Hour, []string{"long", "forever"}},
+		{"all ran out", 9 * time.Hour, []string{"forever"}},
+	}
+	for _, tt := range tests {
+		for _, session := range []string{"one", ""} {
+			t.Run(tt.name+" session "+strconv.Quote(session), func(t *testing.T) {
+				source := &fakeSource{session: session, items: []structs.Credential{short, long, forever, broken}}
+				a := New(source, nil)
+				comments(t, a)
+				a.started = a.started.Add(-tt.age)
+				if got := comments(t, a); !slices.Equal(got, tt.want) {
+					t.Fatalf("List = %q, want %q", got, tt.want)
+				}
+			})
+		}
+	}
+
+	t.Run("keys added later count from the session start", func(t *testing.T) {
+		source := &fakeSource{session: "one", items: []structs.Credential{forever}}
+		a := New(source, nil)
+		comments(t, a)
+		a.started = a.started.Add(-2 * time.Hour)
+		source.items = []structs.Credential{forever, short}
+		if got := comments(t, a); !slices.Equal(got, []string{"forever"}) {
+			t.Fatalf("List = %q, want the new key expired", got)
+		}
+	})
+
+	t.Run("a new session starts over", func(t *testing.T) {
+		source := &fakeSource{session: "one", items: []structs.Credential{short}}
+		a := New(source, nil)
+		comments(t, a)
+		a.started = a.started.Add(-2 * time.Hour)
+		source.session = "two"
+		if got := comments(t, a); !slices.Equal(got, []string{"short"}) {
+			t.Fatalf("List = %q, want the key back", got)
+		}
+	})
+
+	t.Run("locking the vault starts over", func(t *testing.T) {
+		source := &fakeSource{session: "one", items: []structs.Credential{short}}
+		a := New(source, nil)
+		comments(t, a)
+		a.started = a.started.Add(-2 * time.Hour)
+		source.err = response.ErrUnauthorized
+		if got := comments(t, a); got != nil {
+			t.Fatalf("List = %q while the vault is locked", got)
+		}
+		source.err = nil
+		if got := comments(t, a); !slices.Equal(got, []string{"short"}) {
+			t.Fatalf("List = %q, want the key back", got)
+		}
+	})
+}
+
+func TestSign(t *testing.T) {
+	plain, plainPub := newKeyItem(t, "plain")
+	confirmed, confirmedPub := newKeyItem(t, "confirmed", structs.CustomField{Name: ConfirmField, Value: "yes"})
+	_, otherPub := newKeyItem(t, "other")
+
+	tests := []struct {
+		name    string
+		key     ssh.PublicKey
+		confirm func(string) bool
+		err     error
+	}{
+		{name: "plain", key: plainPub},
+		{name: "confirmed", key: confirmedPub, confirm: func(string) bool { return true }},
+		{name: "refused", key: confirmedPub, confirm: func(string) bool { return false }, err: errRefused},
+		{name: "no askpass", key: confirmedPub, err: errRefused},
+		{name: "not in the vault", key: otherPub, err: errNoKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := New(&fakeSource{session: "one", items: []structs.Credential{plain, confirmed}}, tt.confirm)
+			data := []byte("challenge")
+			sig, err := a.Sign(tt.key, data)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Sign = %v, want %v", err, tt.err)
+			}
+			if err == nil {
+				if err := tt.key.Verify(data, sig); err != nil {
+					t.Fatalf("signature doesn't verify: %v", err)
+				}
+			}
+		})
+	}
+
+	a := New(&fakeSource{session: "one", items: []structs.Credential{plain, confirmed}}, nil)
+	signers, err := a.Signers()
+	if err != nil || len(signers) != 1 {
+		t.Fatalf("Signers = %d signers, %v, want only the one without confirmation", len(signers), err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	plain, _ := newKeyItem(t, "plain")
+	a := New(&fakeSource{session: "one", items: []structs.Credential{plain}}, nil)
+
+	if err := a.Lock([]byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if got := comments(t, a); got != nil {
+		t.Fatalf("List = %q while locked", got)
+	}
+	if err := a.Lock([]byte("secret")); err == nil {
+		t.Fatal("Lock locked twice")
+	}
+	if err := a.Unlock([]byte("wrong")); err == nil {
+		t.Fatal("Unlock took the wrong passphrase")
+	}
+	if err := a.Unlock([]byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if got := comments(t, a); !slices.Equal(got, []string{"plain"}) {
+		t.Fatalf("List = %q after unlocking", got)
+	}
+	if err := a.Add(agent.AddedKey{}); !errors.Is(err, errReadOnly) {
+		t.Fatalf("Add = %v, want %v", err, errReadOnly)
+	}
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"passvault/crypt"
+	"path/filepath"
+)
+
+// File keeps the vault in memory and writes it to a single encrypted JSON
+// file after every change
+type File struct {
+	*Memory
+	path   string
+	sealer *crypt.Sealer
+}
+
+// OpenFile opens the vault file at path, creating it if it doesn't exist yet.
+// A wrong passphrase is reported as response.ErrInvalidPassphrase.
+func OpenFile(path, passphrase string) (*File, error) {
+	f := &File{Memory: NewMemory(), path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if f.sealer, err = crypt.NewSealer(passphrase); err != nil {
+			return nil, err
+		}
+		if err := f.save(f.state); err != nil {
+			return nil, err
+		}
+		f.persist = f.save
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, sealer, err := crypt.Open(passphrase, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	state := newMemoryState()
+	if err := json.Unmarshal(plaintext, state); err != nil {
+		return nil, fmt.Errorf("%s is corrupt: %w", path, err)
+	}
+	// Files written before credentials were versioned start them at 1, like
+	// the migration of the database
+	for _, cred := range state.Credentials {
+		cred.Version = max(cred.Version, 1)
+	}
+	f.state = state
+	f.sealer = sealer
+	f.persist = f.save
+	return f, nil
+}
+
+// save encrypts the state and atomically replaces the vault file with it
+func (f *File) save(state *memoryState) error {
+	plaintext, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	data, err := f.sealer.Seal(plaintext)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f.path, data)
+}
+
+// writeFileAtomic writes data next to path and renames it over path, so a
+// crash never leaves half a file. The file is only readable by its owner.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,887 @@
+package store
+
+import (
+	"cmp"
+	"maps"
+	"passvault/db"
+	"passvault/response"
+	"passvault/structs"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryState is everything the memory store keeps. The file store
+// persists it as JSON.
+type memoryState struct {
+	Credentials      map[int]*structs.Credential `json:"credentials"`
+	Folders          map[int]*structs.Folder     `json:"folders"`
+	NextCredentialID int                         `json:"next_credential_id"`
+	NextFolderID     int                         `json:"next_folder_id"`
+}
+
+func newMemoryState() *memoryState {
+	return &memoryState{
+		Credentials:      map[int]*structs.Credential{},
+		Folders:          map[int]*structs.Folder{},
+		NextCredentialID: 1,
+		NextFolderID:     1,
+	}
+}
+
+// clone returns a deep copy of the state
+func (s *memoryState) clone() *memoryState {
+	c := &memoryState{
+		Credentials:      make(map[int]*structs.Credential, len(s.Credentials)),
+		Folders:          make(map[int]*structs.Folder, len(s.Folders)),
+		NextCredentialID: s.NextCredentialID,
+		NextFolderID:     s.NextFolderID,
+	}
+	for id, cred := range s.Credentials {
+		c.Credentials[id] = copyCredential(cred)
+	}
+	for id, folder := range s.Folders {
+		c.Folders[id] = copyFolder(folder)
+	}
+	return c
+}
+
+// Memory keeps the vault in memory. It is used by tests and for ephemeral
+// vaults that are gone once the server stops.
+type Memory struct {
+	mu    *sync.Mutex
+	state *memoryState
+	// inTx is set on the view handed to WithTx, which already holds the lock
+	inTx bool
+	// persist is called with the new state after every change
+	persist func(state *memoryState) error
+}
+
+// NewMemory returns an empty memory store
+func NewMemory() *Memory {
+	return &Memory{mu: &sync.Mutex{}, state: newMemoryState()}
+}
+
+// read runs fn with the state locked
+func (m *Memory) read(fn func(s *memoryState) error) error {
+	if !m.inTx {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+	}
+	return fn(m.state)
+}
+
+// write runs fn with the state locked. If fn or persisting the result fails
+// every change fn made is undone.
+func (m *Memory) write(fn func(s *memoryState) error) error {
+	if m.inTx {
+		return fn(m.state)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := m.state.clone()
+	if err := fn(m.state); err != nil {
+		*m.state = *snapshot
+		return err
+	}
+	if m.persist != nil {
+		if err := m.persist(m.state); err != nil {
+			*m.state = *snapshot
+			return err
+		}
+	}
+	return nil
+}
+
+func copyCredential(cred *structs.Credential) *structs.Credential {
+	c := *cred
+	c.Tags = slices.Clone(cred.Tags)
+	c.Fields = slices.Clone(cred.Fields)
+	c.Attachments = slices.Clone(cred.Attachments)
+	c.URLs = slices.Clone(cred.URLs)
+	for i := range c.Attachments {
+		c.Attachments[i].Data = slices.Clone(cred.Attachments[i].Data)
+	}
+	if cred.LastUsedAt != nil {
+		t := *cred.LastUsedAt
+		c.LastUsedAt = &t
+	}
+	if cred.FolderID != nil {
+		id := *cred.FolderID
+		c.FolderID = &id
+	}
+	if cred.DeletedAt != nil {
+		t := *cred.DeletedAt
+		c.DeletedAt = &t
+	}
+	return &c
+}
+
+func copyFolder(folder *structs.Folder) *structs.Folder {
+	f := *folder
+	if folder.ParentID != nil {
+		id := *folder.ParentID
+		f.ParentID = &id
+	}
+	if folder.DeletedAt != nil {
+		t := *folder.DeletedAt
+		f.DeletedAt = &t
+	}
+	return &f
+}
+
+// sortedTags normalizes tags and sorts them by name like the SQLite store does
+func sortedTags(tags []string) []string {
+	tags = db.NormalizeTags(tags)
+	slices.Sort(tags)
+	return tags
+}
+
+// asciiLower lowercases ASCII letters only, matching SQLite's lower() and LIKE
+func asciiLower(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
+
+// julianDay converts a time to the julian day number SQLite sorts by
+func julianDay(t *time.Time) float64 {
+	if t == nil {
+		return 0
+	}
+	return float64(t.UnixNano())/float64(24*time.Hour) + 2440587.5
+}
+
+// output returns a copy of a credential with its folder path filled in
+func (s *memoryState) output(cred *structs.Credential, paths map[int]string) structs.Credential {
+	c := *copyCredential(cred)
+	// Vault files written before custom fields existed have none
+	db.NormalizeExtras(&c)
+	c.FolderPath = ""
+	if c.FolderID != nil {
+		c.FolderPath = paths[*c.FolderID]
+	}
+	return c
+}
+
+// folderPaths returns the slash separated path of every folder by ID
+func (s *memoryState) folderPaths() map[int]string {
+	paths := make(map[int]string, len(s.Folders))
+	for id := range s.Folders {
+		var parts []string
+		for current := s.Folders[id]; current != nil && len(parts) <= len(s.Folders); {
+			parts = append([]string{current.Name}, parts...)
+			if current.ParentID == nil {
+				break
+			}
+			current = s.Folders[*current.ParentID]
+		}
+		paths[id] = strings.Join(parts, "/")
+	}
+	return paths
+}
+
+// subtree returns the IDs of a folder and all of its descendants
+func (s *memoryState) subtree(id int) map[int]bool {
+	ids := map[int]bool{id: true}
+	for changed := true; changed; {
+		changed = false
+		for _, folder := range s.Folders {
+			if folder.ParentID != nil && ids[*folder.ParentID] && !ids[folder.ID] {
+				ids[folder.ID] = true
+				changed = true
+			}
+		}
+	}
+	return ids
+}
+
+// checkFolder makes sure a folder exists and is not in the trash
+func (s *memoryState) checkFolder(id int) error {
+	folder, ok := s.Folders[id]
+	if !ok || folder.DeletedAt != nil {
+		return response.ErrFolderNotFound
+	}
+	return nil
+}
+
+// checkFolderName validates a folder name and makes sure no live sibling uses it
+func (s *memoryState) checkFolderName(name string, parentID *int, exceptID int) error {
+	// Dot names would step out of the folder in paths like those of pass
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return response.ErrInvalidFolderName
+	}
+	for _, folder := range s.Folders {
+		if folder.ID != exceptID && folder.DeletedAt == nil && folder.Name == name && sameParent(folder.ParentID, parentID) {
+			return response.ErrFolderExists
+		}
+	}
+	return nil
+}
+
+func sameParent(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// hasTag reports whether any credential carries a tag
+func (s *memoryState) hasTag(name string) bool {
+	for _, cred := range s.Credentials {
+		if slices.Contains(cred.Tags, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) CreateCredential(cred structs.Credential) (int, error) {
+	// Fill in defaults for optional fields
+	if cred.Name == "" {
+		cred.Name = cred.Username
+	}
+	if cred.ItemType == "" {
+		cred.ItemType = structs.ItemTypeLogin
+	}
+
+	var id int
+	err := m.write(func(s *memoryState) error {
+		if cred.FolderID != nil {
+			if err := s.checkFolder(*cred.FolderID); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		stored := copyCredential(&cred)
+		stored.ID = s.NextCredentialID
+		stored.Tags = sortedTags(cred.Tags)
+		db.NormalizeExtras(stored)
+		stored.CreatedAt = now
+		stored.UpdatedAt = now
+		stored.LastUsedAt = nil
+		stored.FolderPath = ""
+		stored.DeletedAt = nil
+		stored.Version = 1
+
+		s.Credentials[stored.ID] = stored
+		s.NextCredentialID++
+		id = stored.ID
+		return nil
+	})
+	return id, err
+}
+
+func (m *Memory) GetCredential(id int) (*structs.Credential, error) {
+	var cred structs.Credential
+	err := m.read(func(s *memoryState) error {
+		stored, ok := s.Credentials[id]
+		if !ok {
+			return response.ErrCredentialNotFound
+		}
+		cred = s.output(stored, s.folderPaths())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &cred, nil
+}
+
+func (m *Memory) UpdateCredential(id int, cred structs.Credential) error {
+	// Fill in defaults for optional fields
+	if cred.Name == "" {
+		cred.Name = cred.Username
+	}
+	if cred.ItemType == "" {
+		cred.ItemType = structs.ItemTypeLogin
+	}
+
+	return m.write(func(s *memoryState) error {
+		if cred.FolderID != nil {
+			if err := s.checkFolder(*cred.FolderID); err != nil {
+				return err
+			}
+		}
+
+		stored, ok := s.Credentials[id]
+		if !ok {
+			return response.ErrCredentialNotFound
+		}
+
+		updated := copyCredential(&cred)
+		stored.Name = updated.Name
+		stored.Username = updated.Username
+		stored.Password = updated.Password
+		stored.ItemType = updated.ItemType
+		stored.Description = updated.Description
+		stored.FolderID = updated.FolderID
+		stored.Tags = sortedTags(updated.Tags)
+		stored.URLs = updated.URLs
+		stored.TOTP = updated.TOTP
+		stored.Fields = updated.Fields
+		stored.Attachments = updated.Attachments
+		db.NormalizeExtras(stored)
+		stored.UpdatedAt = time.Now()
+		stored.Version++
+		return nil
+	})
+}
+
+func (m *Memory) DeleteCredential(id int) error {
+	return m.write(func(s *memoryState) error {
+		if _, ok := s.Credentials[id]; !ok {
+			return response.ErrCredentialNotFound
+		}
+		delete(s.Credentials, id)
+		return nil
+	})
+}
+
+func (m *Memory) TrashCredential(id int) error {
+	return m.write(func(s *memoryState) error {
+		stored, ok := s.Credentials[id]
+		if !ok || stored.DeletedAt != nil {
+			return response.ErrCredentialNotFound
+		}
+		now := time.Now()
+		stored.DeletedAt = &now
+		return nil
+	})
+}
+
+func (m *Memory) RestoreCredential(id int) error {
+	return m.write(func(s *memoryState) error {
+		stored, ok := s.Credentials[id]
+		if !ok {
+			return response.ErrCredentialNotFound
+		}
+		if stored.DeletedAt == nil {
+			return response.ErrCredentialNotTrashed
+		}
+		if stored.FolderID != nil && s.checkFolder(*stored.FolderID) != nil {
+			stored.FolderID = nil
+		}
+		stored.DeletedAt = nil
+		return nil
+	})
+}
+
+func (m *Memory) TouchCredential(id int) error {
+	return m.write(func(s *memoryState) error {
+		stored, ok := s.Credentials[id]
+		if !ok {
+			return response.ErrCredentialNotFound
+		}
+		now := time.Now()
+		stored.LastUsedAt = &now
+		return nil
+	})
+}
+
+// listEntry is a credential together with the key it sorts by
+type listEntry struct {
+	cred *structs.Credential
+	key  any
+}
+
+// sortKey returns the key a credential sorts by, the same keys the SQLite
+// store puts in its cursors
+func sortKey(cred *structs.Credential, sortBy string) any {
+	switch sortBy {
+	case structs.SortByName:
+		return asciiLower(cred.Name)
+	case structs.SortByUpdated:
+		return julianDay(&cred.UpdatedAt)
+	case structs.SortByLastUsed:
+		return julianDay(cred.LastUsedAt)
+	default:
+		return julianDay(&cred.CreatedAt)
+	}
+}
+
+// compareEntries orders entries by their key, then by ID, ascending
+func compareEntries(aKey any, aID int, bKey any, bID int) int {
+	var c int
+	switch a := aKey.(type) {
+	case string:
+		c = strings.Compare(a, bKey.(string))
+	case float64:
+		c = cmp.Compare(a, bKey.(float64))
+	}
+	if c == 0 {
+		c = cmp.Compare(aID, bID)
+	}
+	return c
+}
+
+// matchesListFilters reports whether a credential passes the filters in opts
+func matchesListFilters(cred *structs.Credential, opts structs.ListOptions, subtree map[int]bool) bool {
+	if len(opts.Tags) > 0 {
+		matched := 0
+		for _, tag := range opts.Tags {
+			if slices.Contains(cred.Tags, tag) {
+				matched++
+			}
+		}
+		if matched == 0 || (opts.TagMatch == structs.TagMatchAll && matched != len(opts.Tags)) {
+			return false
+		}
+	}
+
+	// Trashed credentials are only listed when asked for
+	if (cred.DeletedAt != nil) != opts.Trashed {
+		return false
+	}
+
+	switch {
+	case opts.FolderID == nil:
+	case *opts.FolderID == 0:
+		if cred.FolderID != nil {
+			return false
+		}
+	case opts.IncludeSubfolders:
+		if cred.FolderID == nil || !subtree[*cred.FolderID] {
+			return false
+		}
+	default:
+		if cred.FolderID == nil || *cred.FolderID != *opts.FolderID {
+			return false
+		}
+	}
+
+	if opts.ItemType != "" && cred.ItemType != opts.ItemType {
+		return false
+	}
+
+	// Lower bounds are inclusive, upper bounds exclusive
+	if opts.CreatedAfter != nil && cred.CreatedAt.Before(*opts.CreatedAfter) {
+		return false
+	}
+	if opts.CreatedBefore != nil && !cred.CreatedAt.Before(*opts.CreatedBefore) {
+		return false
+	}
+	if opts.UpdatedAfter != nil && cred.UpdatedAt.Before(*opts.UpdatedAfter) {
+		return false
+	}
+	if opts.UpdatedBefore != nil && !cred.UpdatedAt.Before(*opts.UpdatedBefore) {
+		return false
+	}
+
+	return true
+}
+
+func (m *Memory) ListCredentials(opts structs.ListOptions) (*structs.CredentialPage, error) {
+	opts = db.NormalizeListOptions(opts)
+
+	var cursor *db.ListCursor
+	if opts.Cursor != "" {
+		var err error
+		if cursor, err = db.DecodeCursor(opts.Cursor, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	direction := 1
+	if opts.SortOrder == structs.SortDesc {
+		direction = -1
+	}
+
+	page := &structs.CredentialPage{Credentials: []structs.Credential{}}
+	err := m.read(func(s *memoryState) error {
+		var subtree map[int]bool
+		if opts.FolderID != nil && *opts.FolderID != 0 && opts.IncludeSubfolders {
+			subtree = s.subtree(*opts.FolderID)
+		}
+
+		var entries []listEntry
+		for _, cred := range s.Credentials {
+			if matchesListFilters(cred, opts, subtree) {
+				entries = append(entries, listEntry{cred: cred, key: sortKey(cred, opts.SortBy)})
+			}
+		}
+		page.TotalCount = len(entries)
+
+		// Continue after the last row of the previous page
+		if cursor != nil {
+			entries = slices.DeleteFunc(entries, func(e listEntry) bool {
+				return direction*compareEntries(e.key, e.cred.ID, cursor.Key, cursor.ID) <= 0
+			})
+		}
+		slices.SortFunc(entries, func(a, b listEntry) int {
+			return direction * compareEntries(a.key, a.cred.ID, b.key, b.cred.ID)
+		})
+
+		paths := s.folderPaths()
+		for i, e := range entries {
+			if i == opts.Limit {
+				// There is at least one more row, hand out a cursor to it
+				last := entries[i-1]
+				var err error
+				page.NextCursor, err = db.EncodeCursor(db.ListCursor{
+					SortBy:    opts.SortBy,
+					SortOrder: opts.SortOrder,
+					Key:       last.key,
+					ID:        last.cred.ID,
+				})
+				return err
+			}
+			page.Credentials = append(page.Credentials, s.output(e.cred, paths))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func (m *Memory) SearchCredentials(query string, limit int) ([]structs.Credential, error) {
+	if limit <= 0 || limit > db.MaxListLimit {
+		limit = db.MaxListLimit
+	}
+	term := asciiLower(query)
+
+	// rank puts exact name matches first, then names starting with the query
+	rank := func(cred *structs.Credential) int {
+		name := asciiLower(cred.Name)
+		switch {
+		case name == term:
+			return 0
+		case strings.HasPrefix(name, term):
+			return 1
+		default:
+			return 2
+		}
+	}
+
+	credentials := []structs.Credential{}
+	err := m.read(func(s *memoryState) error {
+		var matches []*structs.Credential
+		for _, cred := range s.Credentials {
+			if cred.DeletedAt != nil {
+				continue
+			}
+			fields := append([]string{cred.Name, cred.Username, cred.Description}, cred.Tags...)
+			if slices.ContainsFunc(fields, func(field string) bool {
+				return strings.Contains(asciiLower(field), term)
+			}) {
+				matches = append(matches, cred)
+			}
+		}
+
+		slices.SortFunc(matches, func(a, b *structs.Credential) int {
+			if c := cmp.Compare(rank(a), rank(b)); c != 0 {
+				return c
+			}
+			return compareEntries(asciiLower(a.Name), a.ID, asciiLower(b.Name), b.ID)
+		})
+
+		paths := s.folderPaths()
+		for _, cred := range matches[:min(limit, len(matches))] {
+			credentials = append(credentials, s.output(cred, paths))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+func (m *Memory) WithTx(fn func(tx Store) error) error {
+	if m.inTx {
+		return fn(m)
+	}
+	return m.write(func(s *memoryState) error {
+		return fn(&Memory{mu: m.mu, state: s, inTx: true})
+	})
+}
+
+func (m *Memory) GetTags() ([]structs.Tag, error) {
+	tags := []structs.Tag{}
+	err := m.read(func(s *memoryState) error {
+		counts := map[string]int{}
+		for _, cred := range s.Credentials {
+			for _, tag := range cred.Tags {
+				counts[tag]++
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(counts)) {
+			tags = append(tags, structs.Tag{Name: name, Count: counts[name]})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+func (m *Memory) RenameTag(oldName, newName string) error {
+	newName = strings.TrimSpace(newName)
+	if newName == "" {
+		return response.ErrInvalidTag
+	}
+
+	return m.write(func(s *memoryState) error {
+		if !s.hasTag(oldName) {
+			return response.ErrTagNotFound
+		}
+		if oldName == newName {
+			return nil
+		}
+
+		// Renaming onto an existing tag is a merge, make the caller ask for it
+		if s.hasTag(newName) {
+			return response.ErrTagExists
+		}
+
+		now := time.Now()
+		for _, cred := range s.Credentials {
+			if i := slices.Index(cred.Tags, oldName); i >= 0 {
+				cred.Tags[i] = newName
+				cred.Tags = sortedTags(cred.Tags)
+				cred.UpdatedAt = now
+			}
+		}
+		return nil
+	})
+}
+
+func (m *Memory) MergeTags(sources []string, target string) error {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return response.ErrInvalidTag
+	}
+
+	return m.write(func(s *memoryState) error {
+		now := time.Now()
+		for _, source := range db.NormalizeTags(sources) {
+			if source == target {
+				continue
+			}
+			if !s.hasTag(source) {
+				return response.ErrTagNotFound
+			}
+			for _, cred := range s.Credentials {
+				if slices.Contains(cred.Tags, source) {
+					tags := slices.DeleteFunc(cred.Tags, func(tag string) bool { return tag == source })
+					cred.Tags = sortedTags(append(tags, target))
+					cred.UpdatedAt = now
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (m *Memory) DeleteTag(name string) error {
+	return m.write(func(s *memoryState) error {
+		if !s.hasTag(name) {
+			return response.ErrTagNotFound
+		}
+
+		now := time.Now()
+		for _, cred := range s.Credentials {
+			if slices.Contains(cred.Tags, name) {
+				cred.Tags = slices.DeleteFunc(cred.Tags, func(tag string) bool { return tag == name })
+				cred.UpdatedAt = now
+			}
+		}
+		return nil
+	})
+}
+
+func (m *Memory) GetFolders(trashed bool) ([]structs.Folder, error) {
+	folders := []structs.Folder{}
+	err := m.read(func(s *memoryState) error {
+		paths := s.folderPaths()
+		for _, folder := range s.Folders {
+			if (folder.DeletedAt != nil) == trashed {
+				f := *copyFolder(folder)
+				f.Path = paths[f.ID]
+				folders = append(folders, f)
+			}
+		}
+		slices.SortFunc(folders, func(a, b structs.Folder) int {
+			return compareEntries(a.Name, a.ID, b.Name, b.ID)
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return folders, nil
+}
+
+func (m *Memory) GetFolder(id int) (*structs.Folder, error) {
+	var folder structs.Folder
+	err := m.read(func(s *memoryState) error {
+		stored, ok := s.Folders[id]
+		if !ok {
+			return response.ErrFolderNotFound
+		}
+		folder = *copyFolder(stored)
+		folder.Path = s.folderPaths()[id]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+func (m *Memory) CreateFolder(folder structs.Folder) (int, error) {
+	folder.Name = strings.TrimSpace(folder.Name)
+
+	var id int
+	err := m.write(func(s *memoryState) error {
+		if folder.ParentID != nil {
+			if err := s.checkFolder(*folder.ParentID); err != nil {
+				return err
+			}
+		}
+		if err := s.checkFolderName(folder.Name, folder.ParentID, 0); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		stored := copyFolder(&folder)
+		stored.ID = s.NextFolderID
+		stored.Path = ""
+		stored.CreatedAt = now
+		stored.UpdatedAt = now
+		stored.DeletedAt = nil
+
+		s.Folders[stored.ID] = stored
+		s.NextFolderID++
+		id = stored.ID
+		return nil
+	})
+	return id, err
+}
+
+func (m *Memory) UpdateFolder(id int, folder structs.Folder) error {
+	folder.Name = strings.TrimSpace(folder.Name)
+
+	return m.write(func(s *memoryState) error {
+		if err := s.checkFolder(id); err != nil {
+			return err
+		}
+
+		if folder.ParentID != nil {
+			if err := s.checkFolder(*folder.ParentID); err != nil {
+				return err
+			}
+			if s.subtree(id)[*folder.ParentID] {
+				return response.ErrFolderCycle
+			}
+		}
+
+		if err := s.checkFolderName(folder.Name, folder.ParentID, id); err != nil {
+			return err
+		}
+
+		stored := s.Folders[id]
+		stored.Name = folder.Name
+		stored.ParentID = copyFolder(&folder).ParentID
+		stored.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+func (m *Memory) TrashFolder(id int) error {
+	return m.write(func(s *memoryState) error {
+		if err := s.checkFolder(id); err != nil {
+			return err
+		}
+
+		// Everything trashed together shares a timestamp so it can be restored together
+		now := time.Now()
+		subtree := s.subtree(id)
+		for folderID := range subtree {
+			if folder := s.Folders[folderID]; folder.DeletedAt == nil {
+				folder.DeletedAt = &now
+			}
+		}
+		for _, cred := range s.Credentials {
+			if cred.FolderID != nil && subtree[*cred.FolderID] && cred.DeletedAt == nil {
+				cred.DeletedAt = &now
+			}
+		}
+		return nil
+	})
+}
+
+func (m *Memory) RestoreFolder(id int) error {
+	return m.write(func(s *memoryState) error {
+		folder, ok := s.Folders[id]
+		if !ok {
+			return response.ErrFolderNotFound
+		}
+		if folder.DeletedAt == nil {
+			return response.ErrFolderNotTrashed
+		}
+
+		parentID := folder.ParentID
+		if parentID != nil && s.checkFolder(*parentID) != nil {
+			parentID = nil
+		}
+		if err := s.checkFolderName(folder.Name, parentID, id); err != nil {
+			return err
+		}
+
+		deletedAt := *folder.DeletedAt
+		folder.ParentID = parentID
+		folder.UpdatedAt = time.Now()
+
+		subtree := s.subtree(id)
+		for folderID := range subtree {
+			if f := s.Folders[folderID]; f.DeletedAt != nil && f.DeletedAt.Equal(deletedAt) {
+				f.DeletedAt = nil
+			}
+		}
+		for _, cred := range s.Credentials {
+			if cred.FolderID != nil && subtree[*cred.FolderID] && cred.DeletedAt != nil && cred.DeletedAt.Equal(deletedAt) {
+				cred.DeletedAt = nil
+			}
+		}
+		return nil
+	})
+}
+
+func (m *Memory) PurgeFolder(id int) error {
+	return m.write(func(s *memoryState) error {
+		folder, ok := s.Folders[id]
+		if !ok {
+			return response.ErrFolderNotFound
+		}
+		if folder.DeletedAt == nil {
+			return response.ErrFolderNotTrashed
+		}
+
+		subtree := s.subtree(id)
+		for credID, cred := range s.Credentials {
+			if cred.FolderID != nil && subtree[*cred.FolderID] {
+				delete(s.Credentials, credID)
+			}
+		}
+		for folderID := range subtree {
+			delete(s.Folders, folderID)
+		}
+		return nil
+	})
+}
+
+// Close does nothing, the vault is gone once the process exits
+func (m *Memory) Close() error {
+	return nil
+}
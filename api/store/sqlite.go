@@ -0,0 +1,220 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"passvault/db"
+	"passvault/response"
+	"passvault/structs"
+)
+
+// SQLite keeps the vault in the SQLite database managed by the db package
+type SQLite struct {
+	conn func() *sql.DB
+	tx   *sql.Tx
+}
+
+// NewSQLite returns a store backed by the database conn returns. The
+// connection is looked up on every call so it can be swapped at runtime.
+func NewSQLite(conn func() *sql.DB) *SQLite {
+	return &SQLite{conn: conn}
+}
+
+// executor returns the running transaction or the database connection
+func (s *SQLite) executor() (db.Executor, error) {
+	if s.tx != nil {
+		return s.tx, nil
+	}
+	if conn := s.conn(); conn != nil {
+		return conn, nil
+	}
+	return nil, response.WrapError(errors.New("database not initialized"), response.ErrDatabaseConnection)
+}
+
+func (s *SQLite) CreateCredential(cred structs.Credential) (int, error) {
+	q, err := s.executor()
+	if err != nil {
+		return 0, err
+	}
+	return db.InsertCredential(q, cred)
+}
+
+func (s *SQLite) GetCredential(id int) (*structs.Credential, error) {
+	q, err := s.executor()
+	if err != nil {
+		return nil, err
+	}
+	return db.GetCredential(q, id)
+}
+
+func (s *SQLite) UpdateCredential(id int, cred structs.Credential) error {
+	q, err := s.executor()
+	if err != nil {
+		return err
+	}
+	return db.UpdateCredential(q, id, cred)
+}
+
+func (s *SQLite) DeleteCredential(id int) error {
+	q, err := s.executor()
+	if err != nil {
+		return err
+	}
+	return db.DeleteCredential(q, id)
+}
+
+func (s *SQLite) TrashCredential(id int) error {
+	q, err := s.executor()
+	if err != nil {
+		return err
+	}
+	return db.TrashCredential(q, id)
+}
+
+func (s *SQLite) RestoreCredential(id int) error {
+	q, err := s.executor()
+	if err != nil {
+		return err
+	}
+	return db.RestoreCredential(q, id)
+}
+
+func (s *SQLite) TouchCredential(id int) error {
+	q, err := s.executor()
+	if err != nil {
+		return err
+	}
+	return db.TouchCredential(q, id)
+}
+
+func (s *SQLite) ListCredentials(opts structs.ListOptions) (*structs.CredentialPage, error) {
+	q, err := s.executor()
+	if err != nil {
+		return nil, err
+	}
+	return db.GetAllCredentials(q, opts)
+}
+
+func (s *SQLite) SearchCredentials(query string, limit int) ([]structs.Credential, error) {
+	q, err := s.executor()
+	if err != nil {
+		return nil, err
+	}
+	return db.SearchCredentials(q, query, limit)
+}
+
+func (s *SQLite) WithTx(fn func(tx Store) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	conn := s.conn()
+	if conn == nil {
+		return response.WrapError(errors.New("database not initialized"), response.ErrDatabaseConnection)
+	}
+	tx, err := conn.Begin()
+	if err != nil {
+		return response.WrapError(err, response.ErrDatabaseConnection)
+	}
+	defer tx.Rollback()
+
+	if err := fn(&SQLite{conn: s.conn, tx: tx}); err != nil {
+		return err
+	}
+
+	return response.WrapError(tx.Commit(), response.ErrDatabaseConnection)
+}
+
+func (s *SQLite) GetTags() ([]structs.Tag, error) {
+	q, err := s.executor()
+	if err != nil {
+		return nil, err
+	}
+	return db.GetTags(q)
+}
+
+func (s *SQLite) RenameTag(oldName, newName string) error {
+	q, err := s.executor()
+	if err != nil {
+		return err
+	}
+	return db.RenameTag(q, oldName, newName)
+}
+
+func (s *SQLite) MergeTags(sources []string, target string) error {
+	q, err := s.executor()
+	if err != nil {
+		return err
+	}
+	return db.MergeTags(q, sources, target)
+}
+
+func (s *SQLite) DeleteTag(name string) error {
+	q, err := s.executor()
+	if err != nil {
+		return err
+	}
+	return db.DeleteTag(q, name)
+}
+
+func (s *SQLite) GetFolders(trashed bool) ([]structs.Folder, error) {
+	q, err := s.executor()
+	if err != nil {
+		return nil, err
+	}
+	return db.GetFolders(q, trashed)
+}
+
+func (s *SQLite) GetFolder(id int) (*structs.Folder, error) {
+	q, err := s.executor()
+	if err != nil {
+		return nil, err
+	}
+	return db.GetFolder(q, id)
+}
+
+func (s *SQLite) CreateFolder(folder structs.Folder) (int, error) {
+	q, err := s.executor()
+	if err != nil {
+		return 0, err
+	}
+	return db.CreateFolder(q, folder)
+}
+
+func (s *SQLite) UpdateFolder(id int, folder structs.Folder) error {
+	q, err := s.executor()
+	if err != nil {
+		return err
+	}
+	return db.UpdateFolder(q, id, folder)
+}
+
+func (s *SQLite) TrashFolder(id int) error {
+	q, err := s.executor()
+	if err != nil {
+		return err
+	}
+	return db.TrashFolder(q, id)
+}
+
+func (s *SQLite) RestoreFolder(id int) error {
+	q, err := s.executor()
+	if err != nil {
+		return err
+	}
+	return db.RestoreFolder(q, id)
+}
+
+func (s *SQLite) PurgeFolder(id int) error {
+	q, err := s.executor()
+	if err != nil {
+		return err
+	}
+	return db.PurgeFolder(q, id)
+}
+
+// Close does nothing, the connection belongs to the db package and is
+// closed with db.CloseDB
+func (s *SQLite) Close() error {
+	return nil
+}
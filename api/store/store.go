@@ -0,0 +1,56 @@
+package store
+
+import (
+	"passvault/structs"
+)
+
+// CredentialStore keeps credentials. Every implementation behaves the same,
+// the storetest package checks them against one another.
+type CredentialStore interface {
+	CreateCredential(cred structs.Credential) (int, error)
+	GetCredential(id int) (*structs.Credential, error)
+	UpdateCredential(id int, cred structs.Credential) error
+	// DeleteCredential deletes a credential for good, trashed or not
+	DeleteCredential(id int) error
+	TrashCredential(id int) error
+	// RestoreCredential brings a trashed credential back, at the top level
+	// when its folder is still in the trash
+	RestoreCredential(id int) error
+	// TouchCredential records that a credential has just been used
+	TouchCredential(id int) error
+	ListCredentials(opts structs.ListOptions) (*structs.CredentialPage, error)
+	// SearchCredentials finds live credentials whose name, username,
+	// description or tags contain the query, best matches first
+	SearchCredentials(query string, limit int) ([]structs.Credential, error)
+	// WithTx runs fn against a view of the store whose changes are kept when
+	// fn returns nil and discarded otherwise. Calling WithTx on that view
+	// joins the running transaction.
+	WithTx(fn func(tx Store) error) error
+}
+
+// TagStore manages the tags attached to credentials
+type TagStore interface {
+	GetTags() ([]structs.Tag, error)
+	RenameTag(oldName, newName string) error
+	MergeTags(sources []string, target string) error
+	DeleteTag(name string) error
+}
+
+// FolderStore manages the folder tree and its trash
+type FolderStore interface {
+	GetFolders(trashed bool) ([]structs.Folder, error)
+	GetFolder(id int) (*structs.Folder, error)
+	CreateFolder(folder structs.Folder) (int, error)
+	UpdateFolder(id int, folder structs.Folder) error
+	TrashFolder(id int) error
+	RestoreFolder(id int) error
+	PurgeFolder(id int) error
+}
+
+// Store is everything the vault keeps
+type Store interface {
+	CredentialStore
+	TagStore
+	FolderStore
+	Close() error
+}
@@ -0,0 +1,72 @@
+package store_test
+
+import (
+	"database/sql"
+	"errors"
+	"passvault/db"
+	"passvault/response"
+	"passvault/store"
+	"passvault/store/storetest"
+	"passvault/structs"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLite(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		conn, err := db.Init(filepath.Join(t.TempDir(), "vault.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.MigrateUp(conn, db.MigrateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		return store.NewSQLite(func() *sql.DB { return conn })
+	})
+}
+
+func TestMemory(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return store.NewMemory()
+	})
+}
+
+func TestFile(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		s, err := store.OpenFile(filepath.Join(t.TempDir(), "vault.json.enc"), "correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+func TestFileReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.json.enc")
+	s, err := store.OpenFile(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := s.CreateCredential(structs.Credential{Name: "mail", Username: "user", Password: "password", Tags: []string{"work"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	if _, err := store.OpenFile(path, "wrong horse"); !errors.Is(err, response.ErrInvalidPassphrase) {
+		t.Fatalf("OpenFile with the wrong passphrase = %v, want ErrInvalidPassphrase", err)
+	}
+
+	s, err = store.OpenFile(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	cred, err := s.GetCredential(id)
+	if err != nil {
+		t.Fatalf("GetCredential after reopening: %v", err)
+	}
+	if cred.Password != "password" || len(cred.Tags) != 1 {
+		t.Fatalf("credential = %+v", cred)
+	}
+}
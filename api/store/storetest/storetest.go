@@ -0,0 +1,659 @@
+// Package storetest is the conformance suite every store.Store
+// implementation has to pass. Call Run from a test in the package of the
+// implementation.
+package storetest
+
+import (
+	"errors"
+	"passvault/response"
+	"passvault/store"
+	"passvault/structs"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Run runs the conformance suite. newStore must return an empty store, it
+// is called once for every subtest.
+func Run(t *testing.T, newStore func(t *testing.T) store.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s store.Store)
+	}{
+		{"CredentialCRUD", testCredentialCRUD},
+		{"CredentialDefaults", testCredentialDefaults},
+		{"CustomFields", testCustomFields},
+		{"TouchCredential", testTouchCredential},
+		{"ListPagination", testListPagination},
+		{"ListFilters", testListFilters},
+		{"SearchCredentials", testSearchCredentials},
+		{"Tags", testTags},
+		{"Folders", testFolders},
+		{"FolderTrash", testFolderTrash},
+		{"CredentialTrash", testCredentialTrash},
+		{"Transactions", testTransactions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStore(t)
+			t.Cleanup(func() { s.Close() })
+			tt.fn(t, s)
+		})
+	}
+}
+
+// create stores a credential and fails the test if that doesn't work
+func create(t *testing.T, s store.Store, cred structs.Credential) int {
+	t.Helper()
+	id, err := s.CreateCredential(cred)
+	if err != nil {
+		t.Fatalf("CreateCredential(%q): %v", cred.Name, err)
+	}
+	return id
+}
+
+// createFolder stores a folder and fails the test if that doesn't work
+func createFolder(t *testing.T, s store.Store, name string, parentID *int) int {
+	t.Helper()
+	id, err := s.CreateFolder(structs.Folder{Name: name, ParentID: parentID})
+	if err != nil {
+		t.Fatalf("CreateFolder(%q): %v", name, err)
+	}
+	return id
+}
+
+func get(t *testing.T, s store.Store, id int) *structs.Credential {
+	t.Helper()
+	cred, err := s.GetCredential(id)
+	if err != nil {
+		t.Fatalf("GetCredential(%d): %v", id, err)
+	}
+	return cred
+}
+
+// listIDs lists every matching credential, following cursors, and returns their IDs in order
+func listIDs(t *testing.T, s store.Store, opts structs.ListOptions) []int {
+	t.Helper()
+	var ids []int
+	for pages := 0; ; pages++ {
+		if pages > 100 {
+			t.Fatal("pagination doesn't end")
+		}
+		page, err := s.ListCredentials(opts)
+		if err != nil {
+			t.Fatalf("ListCredentials: %v", err)
+		}
+		for _, cred := range page.Credentials {
+			ids = append(ids, cred.ID)
+		}
+		if page.NextCursor == "" {
+			return ids
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+func expectErr(t *testing.T, err, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Fatalf("got error %v, want %v", err, want)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func testCredentialCRUD(t *testing.T, s store.Store) {
+	id := create(t, s, structs.Credential{
+		Name:        "Mail",
+		Username:    "john@example.com",
+		Password:    "securepassword123",
+		ItemType:    structs.ItemTypeLogin,
+		Description: "My email account",
+		Tags:        []string{" work ", "personal", "work", ""},
+	})
+
+	cred := get(t, s, id)
+	if cred.ID != id || cred.Name != "Mail" || cred.Username != "john@example.com" ||
+		cred.Password != "securepassword123" || cred.Description != "My email account" {
+		t.Fatalf("stored credential doesn't match: %+v", cred)
+	}
+	if !slices.Equal(cred.Tags, []string{"personal", "work"}) {
+		t.Fatalf("tags should be trimmed, deduplicated and sorted, got %q", cred.Tags)
+	}
+	if cred.CreatedAt.IsZero() || cred.UpdatedAt.IsZero() || cred.LastUsedAt != nil || cred.DeletedAt != nil {
+		t.Fatalf("unexpected timestamps: %+v", cred)
+	}
+	if cred.Version != 1 {
+		t.Fatalf("version of a new credential = %d, want 1", cred.Version)
+	}
+
+	err := s.UpdateCredential(id, structs.Credential{
+		Name:     "Mail",
+		Username: "jane@example.com",
+		Password: "anotherpassword",
+		Tags:     []string{"mail"},
+	})
+	if err != nil {
+		t.Fatalf("UpdateCredential: %v", err)
+	}
+	updated := get(t, s, id)
+	if updated.Username != "jane@example.com" || updated.Password != "anotherpassword" || updated.Description != "" {
+		t.Fatalf("credential not updated: %+v", updated)
+	}
+	if !slices.Equal(updated.Tags, []string{"mail"}) {
+		t.Fatalf("tags not replaced, got %q", updated.Tags)
+	}
+	if !updated.CreatedAt.Equal(cred.CreatedAt) || updated.UpdatedAt.Before(cred.UpdatedAt) {
+		t.Fatalf("update should keep created_at and move updated_at: %+v", updated)
+	}
+	// Every update counts, even one landing in the same instant
+	if err := s.UpdateCredential(id, *updated); err != nil {
+		t.Fatalf("UpdateCredential: %v", err)
+	}
+	if updated = get(t, s, id); updated.Version != 3 {
+		t.Fatalf("version after two updates = %d, want 3", updated.Version)
+	}
+	if err := s.TouchCredential(id); err != nil {
+		t.Fatalf("TouchCredential: %v", err)
+	}
+	if touched := get(t, s, id); touched.Version != updated.Version {
+		t.Fatalf("touching changed the version to %d", touched.Version)
+	}
+
+	// Unused tags disappear with the credentials using them
+	tags, err := s.GetTags()
+	if err != nil {
+		t.Fatalf("GetTags: %v", err)
+	}
+	if len(tags) != 1 || tags[0] != (structs.Tag{Name: "mail", Count: 1}) {
+		t.Fatalf("unexpected tags %+v", tags)
+	}
+
+	if err := s.DeleteCredential(id); err != nil {
+		t.Fatalf("DeleteCredential: %v", err)
+	}
+	_, err = s.GetCredential(id)
+	expectErr(t, err, response.ErrCredentialNotFound)
+	expectErr(t, s.DeleteCredential(id), response.ErrCredentialNotFound)
+	expectErr(t, s.UpdateCredential(id, structs.Credential{Username: "x", Password: "y"}), response.ErrCredentialNotFound)
+	expectErr(t, s.TouchCredential(id), response.ErrCredentialNotFound)
+
+	if tags, _ := s.GetTags(); len(tags) != 0 {
+		t.Fatalf("tags should be pruned, got %+v", tags)
+	}
+}
+
+func testCredentialDefaults(t *testing.T, s store.Store) {
+	id := create(t, s, structs.Credential{Username: "john", Password: "secret"})
+	cred := get(t, s, id)
+	if cred.Name != "john" || cred.ItemType != structs.ItemTypeLogin {
+		t.Fatalf("defaults not filled in: %+v", cred)
+	}
+	if cred.Tags == nil || len(cred.Tags) != 0 {
+		t.Fatalf("tags should be an empty slice, got %#v", cred.Tags)
+	}
+
+	_, err := s.CreateCredential(structs.Credential{Username: "john", Password: "secret", FolderID: ptr(999)})
+	expectErr(t, err, response.ErrFolderNotFound)
+	expectErr(t, s.UpdateCredential(id, structs.Credential{Username: "john", Password: "secret", FolderID: ptr(999)}), response.ErrFolderNotFound)
+}
+
+func testCustomFields(t *testing.T, s store.Store) {
+	fields := []structs.CustomField{{Name: "PIN", Value: "1234", Hidden: true}, {Name: "Account", Value: "42"}}
+	attachments := []structs.Attachment{{Name: "recovery.txt", ContentType: "text/plain", Data: []byte("codes")}}
+	id := create(t, s, structs.Credential{
+		Username:    "john",
+		Password:    "secret",
+		URLs:        []string{"https://example.com", " "},
+		TOTP:        "JBSWY3DPEHPK3PXP",
+		Fields:      fields,
+		Attachments: attachments,
+	})
+
+	cred := get(t, s, id)
+	if !slices.Equal(cred.URLs, []string{"https://example.com"}) || cred.TOTP != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("blank URLs should be dropped and the TOTP secret kept, got %q %q", cred.URLs, cred.TOTP)
+	}
+	if !slices.Equal(cred.Fields, fields) {
+		t.Fatalf("fields not stored, got %+v", cred.Fields)
+	}
+	if len(cred.Attachments) != 1 || cred.Attachments[0].Name != "recovery.txt" ||
+		cred.Attachments[0].ContentType != "text/plain" || string(cred.Attachments[0].Data) != "codes" {
+		t.Fatalf("attachments not stored, got %+v", cred.Attachments)
+	}
+
+	if err := s.UpdateCredential(id, structs.Credential{Username: "john", Password: "secret"}); err != nil {
+		t.Fatalf("UpdateCredential: %v", err)
+	}
+	cred = get(t, s, id)
+	if cred.Fields == nil || len(cred.Fields) != 0 || cred.Attachments == nil || len(cred.Attachments) != 0 ||
+		cred.URLs == nil || len(cred.URLs) != 0 || cred.TOTP != "" {
+		t.Fatalf("fields, attachments and URLs should be cleared to empty slices, got %+v", cred)
+	}
+}
+
+func testTouchCredential(t *testing.T, s store.Store) {
+	id := create(t, s, structs.Credential{Username: "john", Password: "secret"})
+	before := get(t, s, id)
+
+	if err := s.TouchCredential(id); err != nil {
+		t.Fatalf("TouchCredential: %v", err)
+	}
+	cred := get(t, s, id)
+	if cred.LastUsedAt == nil {
+		t.Fatal("last_used_at not set")
+	}
+	if !cred.UpdatedAt.Equal(before.UpdatedAt) {
+		t.Fatal("touching a credential shouldn't change updated_at")
+	}
+}
+
+func testListPagination(t *testing.T, s store.Store) {
+	names := []string{"delta", "Alpha", "charlie", "Echo", "bravo", "alpha", "golf"}
+	ids := make([]int, len(names))
+	for i, name := range names {
+		ids[i] = create(t, s, structs.Credential{Name: name, Username: "user", Password: "secret"})
+	}
+
+	// Case insensitive by name, ties broken by ID
+	byName := []int{ids[1], ids[5], ids[4], ids[2], ids[0], ids[3], ids[6]}
+	byNameDesc := slices.Clone(byName)
+	slices.Reverse(byNameDesc)
+	byCreatedDesc := slices.Clone(ids)
+	slices.Reverse(byCreatedDesc)
+
+	tests := []struct {
+		sortBy, order string
+		want          []int
+	}{
+		{structs.SortByName, structs.SortAsc, byName},
+		{structs.SortByName, structs.SortDesc, byNameDesc},
+		{structs.SortByCreated, structs.SortAsc, ids},
+		{structs.SortByCreated, structs.SortDesc, byCreatedDesc},
+		{"", "", byCreatedDesc},
+	}
+	for _, tt := range tests {
+		for _, limit := range []int{1, 3, 7, 50} {
+			got := listIDs(t, s, structs.ListOptions{SortBy: tt.sortBy, SortOrder: tt.order, Limit: limit})
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("sort %q %q limit %d: got %v, want %v", tt.sortBy, tt.order, limit, got, tt.want)
+			}
+		}
+	}
+
+	page, err := s.ListCredentials(structs.ListOptions{Limit: 2})
+	if err != nil {
+		t.Fatalf("ListCredentials: %v", err)
+	}
+	if page.TotalCount != len(names) || len(page.Credentials) != 2 || page.NextCursor == "" {
+		t.Fatalf("unexpected first page: total %d, %d credentials, cursor %q", page.TotalCount, len(page.Credentials), page.NextCursor)
+	}
+
+	// A cursor only works for the sort it was issued for
+	_, err = s.ListCredentials(structs.ListOptions{Cursor: page.NextCursor, SortBy: structs.SortByName})
+	expectErr(t, err, response.ErrInvalidCursor)
+	_, err = s.ListCredentials(structs.ListOptions{Cursor: "not a cursor"})
+	expectErr(t, err, response.ErrInvalidCursor)
+
+	// Credentials that were never used sort as the oldest
+	if err := s.TouchCredential(ids[3]); err != nil {
+		t.Fatalf("TouchCredential: %v", err)
+	}
+	got := listIDs(t, s, structs.ListOptions{SortBy: structs.SortByLastUsed, SortOrder: structs.SortDesc, Limit: 2})
+	if len(got) != len(names) || got[0] != ids[3] {
+		t.Fatalf("last used first: got %v", got)
+	}
+}
+
+func testListFilters(t *testing.T, s store.Store) {
+	work := createFolder(t, s, "Work", nil)
+	clients := createFolder(t, s, "Clients", &work)
+
+	mail := create(t, s, structs.Credential{Name: "mail", Username: "u", Password: "p", Tags: []string{"personal", "email"}})
+	vpn := create(t, s, structs.Credential{Name: "vpn", Username: "u", Password: "p", Tags: []string{"work"}, FolderID: &work})
+	acme := create(t, s, structs.Credential{Name: "acme", Username: "u", Password: "p", Tags: []string{"work", "email"}, FolderID: &clients})
+	note := create(t, s, structs.Credential{Name: "note", Username: "u", Password: "p", ItemType: structs.ItemTypeSecureNote})
+
+	tests := []struct {
+		name string
+		opts structs.ListOptions
+		want []int
+	}{
+		{"all", structs.ListOptions{}, []int{acme, mail, note, vpn}},
+		{"any tag", structs.ListOptions{Tags: []string{"email", "work"}}, []int{acme, mail, vpn}},
+		{"all tags", structs.ListOptions{Tags: []string{"email", "work"}, TagMatch: structs.TagMatchAll}, []int{acme}},
+		{"item type", structs.ListOptions{ItemType: structs.ItemTypeSecureNote}, []int{note}},
+		{"no folder", structs.ListOptions{FolderID: ptr(0)}, []int{mail, note}},
+		{"folder", structs.ListOptions{FolderID: &work}, []int{vpn}},
+		{"subfolders", structs.ListOptions{FolderID: &work, IncludeSubfolders: true}, []int{acme, vpn}},
+	}
+	for _, tt := range tests {
+		tt.opts.SortBy = structs.SortByName
+		tt.opts.SortOrder = structs.SortAsc
+		if got := listIDs(t, s, tt.opts); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Folder paths are filled in
+	page, err := s.ListCredentials(structs.ListOptions{FolderID: &clients})
+	if err != nil {
+		t.Fatalf("ListCredentials: %v", err)
+	}
+	if len(page.Credentials) != 1 || page.Credentials[0].FolderPath != "Work/Clients" {
+		t.Fatalf("unexpected folder path in %+v", page.Credentials)
+	}
+
+	// Time ranges have an inclusive lower and an exclusive upper bound
+	created := get(t, s, mail).CreatedAt
+	got := listIDs(t, s, structs.ListOptions{CreatedAfter: &created, CreatedBefore: ptr(created.Add(time.Second)), SortBy: structs.SortByName})
+	if !slices.Contains(got, mail) {
+		t.Fatalf("created range should include %d, got %v", mail, got)
+	}
+	if got := listIDs(t, s, structs.ListOptions{CreatedBefore: &created}); slices.Contains(got, mail) {
+		t.Fatalf("created_before should exclude %d, got %v", mail, got)
+	}
+}
+
+func testSearchCredentials(t *testing.T, s store.Store) {
+	gitlab := create(t, s, structs.Credential{Name: "GitLab", Username: "john", Password: "p"})
+	git := create(t, s, structs.Credential{Name: "git", Username: "john", Password: "p"})
+	forge := create(t, s, structs.Credential{Name: "Forge", Username: "john", Password: "p", Description: "self hosted git"})
+	tagged := create(t, s, structs.Credential{Name: "Builds", Username: "ci", Password: "p", Tags: []string{"gitops"}})
+	create(t, s, structs.Credential{Name: "Mail", Username: "john", Password: "p"})
+
+	results, err := s.SearchCredentials("GIT", 10)
+	if err != nil {
+		t.Fatalf("SearchCredentials: %v", err)
+	}
+	var got []int
+	for _, cred := range results {
+		got = append(got, cred.ID)
+	}
+	want := []int{git, gitlab, tagged, forge}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	if results, _ := s.SearchCredentials("git", 2); len(results) != 2 {
+		t.Fatalf("limit not applied, got %d results", len(results))
+	}
+	if results, _ := s.SearchCredentials("100%", 10); len(results) != 0 {
+		t.Fatalf("wildcards should match literally, got %+v", results)
+	}
+}
+
+func testTags(t *testing.T, s store.Store) {
+	a := create(t, s, structs.Credential{Username: "a", Password: "p", Tags: []string{"work", "mail"}})
+	b := create(t, s, structs.Credential{Username: "b", Password: "p", Tags: []string{"job"}})
+	create(t, s, structs.Credential{Username: "c", Password: "p", Tags: []string{"mail"}})
+
+	tags, err := s.GetTags()
+	if err != nil {
+		t.Fatalf("GetTags: %v", err)
+	}
+	want := []structs.Tag{{Name: "job", Count: 1}, {Name: "mail", Count: 2}, {Name: "work", Count: 1}}
+	if !slices.Equal(tags, want) {
+		t.Fatalf("got %+v, want %+v", tags, want)
+	}
+
+	expectErr(t, s.RenameTag("missing", "other"), response.ErrTagNotFound)
+	expectErr(t, s.RenameTag("work", "mail"), response.ErrTagExists)
+	expectErr(t, s.RenameTag("work", "  "), response.ErrInvalidTag)
+
+	before := get(t, s, a).UpdatedAt
+	if err := s.RenameTag("work", "office"); err != nil {
+		t.Fatalf("RenameTag: %v", err)
+	}
+	cred := get(t, s, a)
+	if !slices.Equal(cred.Tags, []string{"mail", "office"}) || cred.UpdatedAt.Before(before) {
+		t.Fatalf("tag not renamed: %+v", cred)
+	}
+
+	// A failed merge changes nothing
+	expectErr(t, s.MergeTags([]string{"job", "missing"}, "office"), response.ErrTagNotFound)
+	if cred := get(t, s, b); !slices.Equal(cred.Tags, []string{"job"}) {
+		t.Fatalf("failed merge changed tags: %q", cred.Tags)
+	}
+
+	if err := s.MergeTags([]string{"job", "office"}, "career"); err != nil {
+		t.Fatalf("MergeTags: %v", err)
+	}
+	if cred := get(t, s, a); !slices.Equal(cred.Tags, []string{"career", "mail"}) {
+		t.Fatalf("tags not merged: %q", cred.Tags)
+	}
+	if cred := get(t, s, b); !slices.Equal(cred.Tags, []string{"career"}) {
+		t.Fatalf("tags not merged: %q", cred.Tags)
+	}
+
+	expectErr(t, s.DeleteTag("missing"), response.ErrTagNotFound)
+	if err := s.DeleteTag("mail"); err != nil {
+		t.Fatalf("DeleteTag: %v", err)
+	}
+	tags, _ = s.GetTags()
+	want = []structs.Tag{{Name: "career", Count: 2}}
+	if !slices.Equal(tags, want) {
+		t.Fatalf("got %+v, want %+v", tags, want)
+	}
+}
+
+func testFolders(t *testing.T, s store.Store) {
+	work := createFolder(t, s, " Work ", nil)
+	clients := createFolder(t, s, "Clients", &work)
+	acme := createFolder(t, s, "Acme", &clients)
+
+	folder, err := s.GetFolder(acme)
+	if err != nil {
+		t.Fatalf("GetFolder: %v", err)
+	}
+	if folder.Name != "Acme" || folder.Path != "Work/Clients/Acme" || folder.ParentID == nil || *folder.ParentID != clients {
+		t.Fatalf("unexpected folder %+v", folder)
+	}
+	_, err = s.GetFolder(999)
+	expectErr(t, err, response.ErrFolderNotFound)
+
+	_, err = s.CreateFolder(structs.Folder{Name: "Work"})
+	expectErr(t, err, response.ErrFolderExists)
+	_, err = s.CreateFolder(structs.Folder{Name: "a/b"})
+	expectErr(t, err, response.ErrInvalidFolderName)
+	_, err = s.CreateFolder(structs.Folder{Name: ""})
+	expectErr(t, err, response.ErrInvalidFolderName)
+	_, err = s.CreateFolder(structs.Folder{Name: ".."})
+	expectErr(t, err, response.ErrInvalidFolderName)
+	_, err = s.CreateFolder(structs.Folder{Name: "Orphan", ParentID: ptr(999)})
+	expectErr(t, err, response.ErrFolderNotFound)
+
+	// The same name is fine under another parent
+	createFolder(t, s, "Work", &clients)
+
+	expectErr(t, s.UpdateFolder(work, structs.Folder{Name: "Work", ParentID: &acme}), response.ErrFolderCycle)
+	expectErr(t, s.UpdateFolder(work, structs.Folder{Name: "Work", ParentID: &work}), response.ErrFolderCycle)
+
+	if err := s.UpdateFolder(acme, structs.Folder{Name: "Acme Corp"}); err != nil {
+		t.Fatalf("UpdateFolder: %v", err)
+	}
+	folders, err := s.GetFolders(false)
+	if err != nil {
+		t.Fatalf("GetFolders: %v", err)
+	}
+	var paths []string
+	for _, f := range folders {
+		paths = append(paths, f.Path)
+	}
+	want := []string{"Acme Corp", "Work/Clients", "Work", "Work/Clients/Work"}
+	if !slices.Equal(paths, want) {
+		t.Fatalf("got folders %q, want %q", paths, want)
+	}
+}
+
+func testFolderTrash(t *testing.T, s store.Store) {
+	work := createFolder(t, s, "Work", nil)
+	clients := createFolder(t, s, "Clients", &work)
+	vpn := create(t, s, structs.Credential{Name: "vpn", Username: "u", Password: "p", FolderID: &work, Tags: []string{"vpn"}})
+	acme := create(t, s, structs.Credential{Name: "acme", Username: "u", Password: "p", FolderID: &clients})
+	mail := create(t, s, structs.Credential{Name: "mail", Username: "u", Password: "p"})
+
+	expectErr(t, s.RestoreFolder(work), response.ErrFolderNotTrashed)
+	expectErr(t, s.PurgeFolder(work), response.ErrFolderNotTrashed)
+
+	if err := s.TrashFolder(work); err != nil {
+		t.Fatalf("TrashFolder: %v", err)
+	}
+	if got := listIDs(t, s, structs.ListOptions{SortBy: structs.SortByName, SortOrder: structs.SortAsc}); !slices.Equal(got, []int{mail}) {
+		t.Fatalf("trashed credentials still listed: %v", got)
+	}
+	if got := listIDs(t, s, structs.ListOptions{Trashed: true, SortBy: structs.SortByName, SortOrder: structs.SortAsc}); !slices.Equal(got, []int{acme, vpn}) {
+		t.Fatalf("trash should hold %v, got %v", []int{acme, vpn}, got)
+	}
+	if results, _ := s.SearchCredentials("vpn", 10); len(results) != 0 {
+		t.Fatalf("trashed credentials found by search: %+v", results)
+	}
+	if folders, _ := s.GetFolders(true); len(folders) != 2 {
+		t.Fatalf("expected 2 trashed folders, got %+v", folders)
+	}
+	expectErr(t, s.TrashFolder(work), response.ErrFolderNotFound)
+	_, err := s.CreateCredential(structs.Credential{Username: "u", Password: "p", FolderID: &work})
+	expectErr(t, err, response.ErrFolderNotFound)
+
+	// Restoring brings back everything trashed with the folder
+	if err := s.RestoreFolder(work); err != nil {
+		t.Fatalf("RestoreFolder: %v", err)
+	}
+	if got := listIDs(t, s, structs.ListOptions{SortBy: structs.SortByName, SortOrder: structs.SortAsc}); !slices.Equal(got, []int{acme, mail, vpn}) {
+		t.Fatalf("credentials not restored: %v", got)
+	}
+	if folders, _ := s.GetFolders(false); len(folders) != 2 {
+		t.Fatalf("folders not restored: %+v", folders)
+	}
+
+	// A restored subfolder whose parent is still trashed moves to the top
+	if err := s.TrashFolder(work); err != nil {
+		t.Fatalf("TrashFolder: %v", err)
+	}
+	if err := s.RestoreFolder(clients); err != nil {
+		t.Fatalf("RestoreFolder: %v", err)
+	}
+	if folder, _ := s.GetFolder(clients); folder.ParentID != nil || folder.Path != "Clients" {
+		t.Fatalf("restored folder should be at the top: %+v", folder)
+	}
+
+	if err := s.PurgeFolder(work); err != nil {
+		t.Fatalf("PurgeFolder: %v", err)
+	}
+	_, err = s.GetFolder(work)
+	expectErr(t, err, response.ErrFolderNotFound)
+	_, err = s.GetCredential(vpn)
+	expectErr(t, err, response.ErrCredentialNotFound)
+	if _, err := s.GetCredential(acme); err != nil {
+		t.Fatalf("credential in the restored subfolder should survive: %v", err)
+	}
+	if tags, _ := s.GetTags(); len(tags) != 0 {
+		t.Fatalf("tags of purged credentials should be pruned, got %+v", tags)
+	}
+}
+
+func testCredentialTrash(t *testing.T, s store.Store) {
+	work := createFolder(t, s, "Work", nil)
+	vpn := create(t, s, structs.Credential{Name: "vpn", Username: "u", Password: "p", FolderID: &work})
+	mail := create(t, s, structs.Credential{Name: "mail", Username: "u", Password: "p"})
+
+	expectErr(t, s.RestoreCredential(vpn), response.ErrCredentialNotTrashed)
+	if err := s.TrashCredential(vpn); err != nil {
+		t.Fatalf("TrashCredential: %v", err)
+	}
+	expectErr(t, s.TrashCredential(vpn), response.ErrCredentialNotFound)
+	expectErr(t, s.TrashCredential(0), response.ErrCredentialNotFound)
+	if got := listIDs(t, s, structs.ListOptions{}); !slices.Equal(got, []int{mail}) {
+		t.Fatalf("trashed credential still listed: %v", got)
+	}
+	if got := listIDs(t, s, structs.ListOptions{Trashed: true}); !slices.Equal(got, []int{vpn}) {
+		t.Fatalf("trash should hold %v, got %v", []int{vpn}, got)
+	}
+	if cred := get(t, s, vpn); cred.DeletedAt == nil || cred.Version != 1 {
+		t.Fatalf("trashed credential: %+v", cred)
+	}
+
+	if err := s.RestoreCredential(vpn); err != nil {
+		t.Fatalf("RestoreCredential: %v", err)
+	}
+	if cred := get(t, s, vpn); cred.DeletedAt != nil || cred.FolderID == nil || *cred.FolderID != work {
+		t.Fatalf("restored credential: %+v", cred)
+	}
+
+	// A credential whose folder is still trashed is restored at the top
+	if err := s.TrashCredential(vpn); err != nil {
+		t.Fatalf("TrashCredential: %v", err)
+	}
+	if err := s.TrashFolder(work); err != nil {
+		t.Fatalf("TrashFolder: %v", err)
+	}
+	if err := s.RestoreCredential(vpn); err != nil {
+		t.Fatalf("RestoreCredential: %v", err)
+	}
+	if cred := get(t, s, vpn); cred.DeletedAt != nil || cred.FolderID != nil {
+		t.Fatalf("credential should be restored at the top: %+v", cred)
+	}
+
+	// Deleting takes trashed credentials for good
+	if err := s.TrashCredential(mail); err != nil {
+		t.Fatalf("TrashCredential: %v", err)
+	}
+	if err := s.DeleteCredential(mail); err != nil {
+		t.Fatalf("DeleteCredential: %v", err)
+	}
+	expectErr(t, s.RestoreCredential(mail), response.ErrCredentialNotFound)
+}
+
+func testTransactions(t *testing.T, s store.Store) {
+	var committed int
+	err := s.WithTx(func(tx store.Store) error {
+		var err error
+		committed, err = tx.CreateCredential(structs.Credential{Username: "kept", Password: "p"})
+		if err != nil {
+			return err
+		}
+		// Nested transactions join the outer one
+		return tx.WithTx(func(tx store.Store) error {
+			return tx.TouchCredential(committed)
+		})
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	if cred := get(t, s, committed); cred.LastUsedAt == nil {
+		t.Fatal("changes of the nested transaction are missing")
+	}
+
+	errRollback := errors.New("roll back")
+	var discarded int
+	err = s.WithTx(func(tx store.Store) error {
+		var err error
+		if discarded, err = tx.CreateCredential(structs.Credential{Username: "gone", Password: "p", Tags: []string{"gone"}}); err != nil {
+			return err
+		}
+		if _, err := tx.CreateFolder(structs.Folder{Name: "Gone"}); err != nil {
+			return err
+		}
+		if err := tx.DeleteCredential(committed); err != nil {
+			return err
+		}
+		// The transaction sees its own changes
+		if _, err := tx.GetCredential(discarded); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	expectErr(t, err, errRollback)
+
+	_, err = s.GetCredential(discarded)
+	expectErr(t, err, response.ErrCredentialNotFound)
+	get(t, s, committed)
+	if folders, _ := s.GetFolders(false); len(folders) != 0 {
+		t.Fatalf("folder creation not rolled back: %+v", folders)
+	}
+	if tags, _ := s.GetTags(); len(tags) != 0 {
+		t.Fatalf("tags not rolled back: %+v", tags)
+	}
+}
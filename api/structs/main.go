@@ -4,12 +4,228 @@ import (
 	"time"
 )
 
+// Item types a credential can have
+const (
+	ItemTypeLogin      = "login"
+	ItemTypeSecureNote = "secure_note"
+	// Registry items hold the login of a container registry, whose address
+	// is their first URL
+	ItemTypeRegistry = "registry"
+	// Git items hold the login of a git remote, whose URLs name the
+	// repositories it is for
+	ItemTypeGit = "git"
+	// SSH key items hold an unencrypted private key in OpenSSH or PEM format
+	// as their password
+	ItemTypeSSHKey = "ssh_key"
+	// Secret items hold what an application keeps through the Secret
+	// Service, with the attributes it looks the secret up by as fields
+	ItemTypeSecret = "secret"
+)
+
+// ItemTypes lists every item type the vault accepts
+var ItemTypes = []string{ItemTypeLogin, ItemTypeSecureNote, ItemTypeRegistry, ItemTypeGit, ItemTypeSSHKey, ItemTypeSecret}
+
 type Credential struct {
-	ID          int       `json:"id"`
-	Username    string    `json:"username"`
-	Password    string    `json:"password"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Description string    `json:"description"`
-	Tags        []string  `json:"tags"`
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Username    string     `json:"username"`
+	Password    string     `json:"password"`
+	ItemType    string     `json:"item_type"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	Description string     `json:"description"`
+	Tags        []string   `json:"tags"`
+	FolderID    *int       `json:"folder_id"`
+	FolderPath  string     `json:"folder_path"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	// Version counts the changes of the credential, it is 1 when the
+	// credential is created and goes up with every update
+	Version int `json:"version"`
+	// URLs are the addresses the credential is used on
+	URLs []string `json:"urls"`
+	// TOTP is the secret of a time based one time password, either base32 or
+	// an otpauth:// URI
+	TOTP string `json:"totp"`
+	// Fields are extra named values such as security questions or PINs
+	Fields      []CustomField `json:"fields"`
+	Attachments []Attachment  `json:"attachments"`
+}
+
+// CustomField is an extra named value kept with a credential
+type CustomField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// Hidden fields hold secrets and are masked by clients like passwords
+	Hidden bool `json:"hidden"`
+}
+
+// Attachment is a small file kept with a credential, Data is base64 in JSON
+type Attachment struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+}
+
+// Folder groups credentials, folders nest through their parent
+type Folder struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	ParentID  *int       `json:"parent_id"`
+	Path      string     `json:"path"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Tag is a tag together with the number of credentials using it
+type Tag struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Sort fields for listing credentials
+const (
+	SortByName     = "name"
+	SortByCreated  = "created"
+	SortByUpdated  = "updated"
+	SortByLastUsed = "last_used"
+)
+
+// Sort orders for listing credentials
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// Tag match modes for listing credentials
+const (
+	TagMatchAny = "any"
+	TagMatchAll = "all"
+)
+
+// ListOptions controls pagination, sorting and filtering of the credential list
+type ListOptions struct {
+	Limit     int
+	Cursor    string
+	SortBy    string
+	SortOrder string
+	Tags      []string
+	TagMatch  string
+	ItemType  string
+	// FolderID limits the list to one folder, 0 selects credentials without a folder
+	FolderID          *int
+	IncludeSubfolders bool
+	Trashed           bool
+	CreatedAfter      *time.Time
+	CreatedBefore     *time.Time
+	UpdatedAfter      *time.Time
+	UpdatedBefore     *time.Time
+}
+
+// CredentialPage is a single page of the credential list
+type CredentialPage struct {
+	Credentials []Credential `json:"credentials"`
+	NextCursor  string       `json:"next_cursor"`
+	TotalCount  int          `json:"total_count"`
+}
+
+// Backup describes a database snapshot in the backup directory
+type Backup struct {
+	Name          string    `json:"name"`
+	CreatedAt     time.Time `json:"created_at"`
+	Size          int64     `json:"size"`
+	SHA256        string    `json:"sha256"`
+	Encrypted     bool      `json:"encrypted"`
+	SchemaVersion int       `json:"schema_version"`
+}
+
+// BackupVerification is the outcome of checking a backup
+type BackupVerification struct {
+	Name          string `json:"name"`
+	Valid         bool   `json:"valid"`
+	SchemaVersion int    `json:"schema_version"`
+	Error         string `json:"error,omitempty"`
+}
+
+// RestoreResult describes a completed restore
+type RestoreResult struct {
+	Name string `json:"name"`
+	// SchemaVersion is the version of the restored database after migrating it
+	SchemaVersion int `json:"schema_version"`
+	// RollbackPath is where the replaced database was kept
+	RollbackPath string `json:"rollback_path"`
+}
+
+// Import modes, deciding what happens to credentials that already exist
+const (
+	// ImportModeMerge overwrites existing credentials with the imported ones
+	ImportModeMerge = "merge"
+	// ImportModeSkipDuplicates leaves existing credentials untouched
+	ImportModeSkipDuplicates = "skip_duplicates"
+	// ImportModeReplace empties the vault before importing
+	ImportModeReplace = "replace"
+)
+
+// ImportModes lists every import mode
+var ImportModes = []string{ImportModeMerge, ImportModeSkipDuplicates, ImportModeReplace}
+
+// Actions an import takes for a single credential
+const (
+	ImportActionCreate = "create"
+	ImportActionUpdate = "update"
+	ImportActionSkip   = "skip"
+)
+
+// ImportItem is what an import did, or would do, with one credential
+type ImportItem struct {
+	// Row is where the credential was found in the imported file, when the
+	// format has rows
+	Row        int    `json:"row,omitempty"`
+	Name       string `json:"name"`
+	Username   string `json:"username"`
+	FolderPath string `json:"folder_path"`
+	Action     string `json:"action"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// ImportResult summarises an import. For a dry run it describes what the
+// import would have done, nothing was changed.
+type ImportResult struct {
+	Mode           string       `json:"mode"`
+	DryRun         bool         `json:"dry_run"`
+	Created        int          `json:"created"`
+	Updated        int          `json:"updated"`
+	Skipped        int          `json:"skipped"`
+	Deleted        int          `json:"deleted"`
+	FoldersCreated int          `json:"folders_created"`
+	Items          []ImportItem `json:"items"`
+	// Warnings are about data that couldn't be carried over completely
+	Warnings []ImportWarning `json:"warnings"`
+}
+
+// ImportWarning reports something an import couldn't carry over, like a
+// field PassVault has no place for
+type ImportWarning struct {
+	Row     int    `json:"row,omitempty"`
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+// PassSyncResult summarises an export or a mirror run into a pass password store
+type PassSyncResult struct {
+	Dir string `json:"dir"`
+	// Written entries were encrypted anew, unchanged ones were left alone
+	Written   int `json:"written"`
+	Unchanged int `json:"unchanged"`
+	// Removed entries were in the mirror but no longer in the vault
+	Removed  int             `json:"removed"`
+	Warnings []ImportWarning `json:"warnings"`
+}
+
+// Session is a login to the vault, the token goes in the Authorization
+// header as a bearer token
+type Session struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
@@ -0,0 +1,108 @@
+// Package totp generates time based one time passwords (RFC 6238) from the
+// secrets credentials keep, a base32 secret or an otpauth:// URI.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"passvault/response"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Key is a parsed TOTP secret with the parameters codes are generated with
+type Key struct {
+	Secret    []byte
+	Digits    int
+	Period    time.Duration
+	Algorithm string
+}
+
+// Parse reads a base32 secret or an otpauth:// URI. Parameters the URI
+// leaves out take the defaults authenticator apps use: six digits, thirty
+// seconds and SHA1.
+func Parse(secret string) (*Key, error) {
+	key := &Key{Digits: 6, Period: 30 * time.Second, Algorithm: "SHA1"}
+	secret = strings.TrimSpace(secret)
+	if strings.HasPrefix(strings.ToLower(secret), "otpauth://") {
+		uri, err := url.Parse(secret)
+		if err != nil {
+			return nil, response.ErrInvalidTOTP
+		}
+		query := uri.Query()
+		secret = query.Get("secret")
+		if value := query.Get("digits"); value != "" {
+			digits, err := strconv.Atoi(value)
+			if err != nil || digits < 6 || digits > 10 {
+				return nil, fmt.Errorf("%w: unsupported number of digits %q", response.ErrInvalidTOTP, value)
+			}
+			key.Digits = digits
+		}
+		if value := query.Get("period"); value != "" {
+			period, err := strconv.Atoi(value)
+			if err != nil || period < 1 {
+				return nil, fmt.Errorf("%w: unsupported period %q", response.ErrInvalidTOTP, value)
+			}
+			key.Period = time.Duration(period) * time.Second
+		}
+		if value := query.Get("algorithm"); value != "" {
+			key.Algorithm = strings.ToUpper(value)
+		}
+	}
+	if key.hash() == nil {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", response.ErrInvalidTOTP, key.Algorithm)
+	}
+
+	secret = strings.TrimRight(strings.ToUpper(strings.ReplaceAll(secret, " ", "")), "=")
+	data, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil || len(data) == 0 {
+		return nil, response.ErrInvalidTOTP
+	}
+	key.Secret = data
+	return key, nil
+}
+
+// hash returns the HMAC hash of the key's algorithm, nil when it has none
+func (k *Key) hash() func() hash.Hash {
+	switch k.Algorithm {
+	case "SHA1":
+		return sha1.New
+	case "SHA256":
+		return sha256.New
+	case "SHA512":
+		return sha512.New
+	}
+	return nil
+}
+
+// Code returns the code valid at t
+func (k *Key) Code(t time.Time) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/int64(k.Period/time.Second)))
+	mac := hmac.New(k.hash(), k.Secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	value := uint64(binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff)
+	mod := uint64(1)
+	for range k.Digits {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", k.Digits, value%mod)
+}
+
+// Remaining returns how long the code valid at t stays valid
+func (k *Key) Remaining(t time.Time) time.Duration {
+	period := int64(k.Period / time.Second)
+	return time.Duration(period-t.Unix()%period) * time.Second
+}
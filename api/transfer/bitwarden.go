@@ -0,0 +1,220 @@
+package transfer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"passvault/structs"
+	"slices"
+	"strings"
+)
+
+// Bitwarden item types
+const (
+	bitwardenLogin      = 1
+	bitwardenSecureNote = 2
+	bitwardenCard       = 3
+	bitwardenIdentity   = 4
+	bitwardenSSHKey     = 5
+)
+
+// Bitwarden custom field types
+const (
+	bitwardenFieldText    = 0
+	bitwardenFieldHidden  = 1
+	bitwardenFieldBoolean = 2
+	bitwardenFieldLinked  = 3
+)
+
+// bitwardenHidden are the card, identity and SSH key properties kept as
+// hidden fields
+var bitwardenHidden = []string{"number", "code", "ssn", "passportNumber", "licenseNumber", "privateKey"}
+
+type bitwardenExport struct {
+	Encrypted bool `json:"encrypted"`
+	Folders   []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"folders"`
+	Items []bitwardenItem `json:"items"`
+}
+
+type bitwardenItem struct {
+	Type     int     `json:"type"`
+	Name     string  `json:"name"`
+	Notes    *string `json:"notes"`
+	FolderID *string `json:"folderId"`
+	Favorite bool    `json:"favorite"`
+	Fields   []struct {
+		Name  string  `json:"name"`
+		Value *string `json:"value"`
+		Type  int     `json:"type"`
+	} `json:"fields"`
+	Login *struct {
+		URIs []struct {
+			URI string `json:"uri"`
+		} `json:"uris"`
+		Username *string          `json:"username"`
+		Password *string          `json:"password"`
+		TOTP     *string          `json:"totp"`
+		Passkeys []map[string]any `json:"fido2Credentials"`
+	} `json:"login"`
+	Card     map[string]any `json:"card"`
+	Identity map[string]any `json:"identity"`
+	SSHKey   map[string]any `json:"sshKey"`
+}
+
+// ParseBitwardenJSON reads an unencrypted Bitwarden JSON export. Cards,
+// identities and SSH keys become secure notes with their details in custom
+// fields. Folder names nest through slashes, as they do in Bitwarden.
+func ParseBitwardenJSON(data []byte) (*Payload, error) {
+	var export bitwardenExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, err
+	}
+	if export.Encrypted {
+		return nil, errors.New("encrypted Bitwarden exports can't be read, export as unencrypted JSON")
+	}
+
+	folders := map[string]string{}
+	for _, folder := range export.Folders {
+		folders[folder.ID] = folder.Name
+	}
+
+	payload := newPayload()
+	for i, item := range export.Items {
+		row := i + 1
+		cred := structs.Credential{
+			Name:        item.Name,
+			ItemType:    structs.ItemTypeSecureNote,
+			Description: deref(item.Notes),
+		}
+		if item.FolderID != nil {
+			cred.FolderPath = folders[*item.FolderID]
+		}
+		if item.Favorite {
+			cred.Tags = []string{"favorite"}
+		}
+
+		switch item.Type {
+		case bitwardenLogin:
+			cred.ItemType = structs.ItemTypeLogin
+			if login := item.Login; login != nil {
+				cred.Username = deref(login.Username)
+				cred.Password = deref(login.Password)
+				cred.TOTP = deref(login.TOTP)
+				for _, uri := range login.URIs {
+					cred.URLs = append(cred.URLs, nonEmpty(uri.URI)...)
+				}
+				if len(login.Passkeys) > 0 {
+					payload.warn(row, item.Name, "passkeys can't be imported")
+				}
+			}
+		case bitwardenSecureNote:
+		case bitwardenCard:
+			cred.Fields = bitwardenProperties(item.Card)
+			payload.warn(row, item.Name, "card imported as a secure note")
+		case bitwardenIdentity:
+			cred.Fields = bitwardenProperties(item.Identity)
+			payload.warn(row, item.Name, "identity imported as a secure note")
+		case bitwardenSSHKey:
+			cred.Fields = bitwardenProperties(item.SSHKey)
+			payload.warn(row, item.Name, "SSH key imported as a secure note")
+		default:
+			payload.skip(row, item.Name, fmt.Sprintf("unknown Bitwarden item type %d", item.Type))
+			continue
+		}
+
+		for _, field := range item.Fields {
+			switch field.Type {
+			case bitwardenFieldText, bitwardenFieldBoolean:
+				cred.Fields = append(cred.Fields, structs.CustomField{Name: field.Name, Value: deref(field.Value)})
+			case bitwardenFieldHidden:
+				cred.Fields = append(cred.Fields, structs.CustomField{Name: field.Name, Value: deref(field.Value), Hidden: true})
+			default:
+				payload.warn(row, item.Name, "linked field %q can't be imported", field.Name)
+			}
+		}
+
+		payload.add(cred, row)
+	}
+	return payload, nil
+}
+
+// bitwardenProperties turns the details of a card, identity or SSH key into
+// custom fields, in a stable order
+func bitwardenProperties(properties map[string]any) []structs.CustomField {
+	keys := make([]string, 0, len(properties))
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	fields := []structs.CustomField{}
+	for _, key := range keys {
+		value, ok := properties[key].(string)
+		if !ok || value == "" {
+			continue
+		}
+		fields = append(fields, structs.CustomField{Name: key, Value: value, Hidden: slices.Contains(bitwardenHidden, key)})
+	}
+	return fields
+}
+
+// ParseBitwardenCSV reads a Bitwarden CSV export. It only holds logins and
+// secure notes, custom fields are stored one per line as "name: value".
+func ParseBitwardenCSV(data []byte) (*Payload, error) {
+	records, err := readCSV(data, "folder", "type", "name", "login_username", "login_password")
+	if err != nil {
+		return nil, err
+	}
+
+	payload := newPayload()
+	for _, record := range records {
+		name := record.get("name")
+		cred := structs.Credential{
+			Name:        name,
+			Description: record.get("notes"),
+			FolderPath:  strings.TrimSpace(record.get("folder")),
+		}
+		if record.get("favorite") == "1" {
+			cred.Tags = []string{"favorite"}
+		}
+
+		switch record.get("type") {
+		case "login":
+			cred.ItemType = structs.ItemTypeLogin
+			cred.Username = record.get("login_username")
+			cred.Password = record.get("login_password")
+			cred.TOTP = strings.TrimSpace(record.get("login_totp"))
+			cred.URLs = nonEmpty(strings.Split(record.get("login_uri"), ",")...)
+		case "note":
+			cred.ItemType = structs.ItemTypeSecureNote
+		default:
+			payload.skip(record.line, name, fmt.Sprintf("unknown Bitwarden item type %q", record.get("type")))
+			continue
+		}
+
+		for _, line := range strings.Split(record.get("fields"), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			fieldName, value, ok := strings.Cut(line, ": ")
+			if !ok {
+				payload.warn(record.line, name, "custom field %q has no value", line)
+			}
+			cred.Fields = append(cred.Fields, structs.CustomField{Name: strings.TrimSpace(fieldName), Value: value})
+		}
+
+		payload.add(cred, record.line)
+	}
+	return payload, nil
+}
+
+// deref returns the value of an optional string, empty when it is missing
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,72 @@
+package transfer
+
+import (
+	"passvault/structs"
+	"strings"
+)
+
+// ParseChrome reads the password CSV exported by Chrome and Edge, with the
+// columns name, url, username, password and optionally note
+func ParseChrome(data []byte) (*Payload, error) {
+	records, err := readCSV(data, "name", "url", "username", "password")
+	if err != nil {
+		return nil, err
+	}
+
+	payload := newPayload()
+	for _, record := range records {
+		name := strings.TrimSpace(record.get("name"))
+		if name == "" {
+			name = hostName(record.get("url"))
+		}
+		payload.add(structs.Credential{
+			Name:        name,
+			Username:    record.get("username"),
+			Password:    record.get("password"),
+			ItemType:    structs.ItemTypeLogin,
+			Description: record.get("note"),
+			URLs:        nonEmpty(record.get("url")),
+		}, record.line)
+	}
+	return payload, nil
+}
+
+// ParseFirefox reads the logins CSV exported by Firefox. Credentials are named
+// after the host they are used on, HTTP authentication realms are kept as a
+// custom field.
+func ParseFirefox(data []byte) (*Payload, error) {
+	records, err := readCSV(data, "url", "username", "password")
+	if err != nil {
+		return nil, err
+	}
+
+	payload := newPayload()
+	for _, record := range records {
+		rawURL := record.get("url")
+		name := hostName(rawURL)
+		if name == "" {
+			name = strings.TrimSpace(rawURL)
+		}
+		// The Firefox account used for sync is stored as a login too
+		if strings.HasPrefix(rawURL, "chrome://") {
+			payload.skip(record.line, name, "Firefox internal login")
+			continue
+		}
+
+		cred := structs.Credential{
+			Name:     name,
+			Username: record.get("username"),
+			Password: record.get("password"),
+			ItemType: structs.ItemTypeLogin,
+			URLs:     nonEmpty(rawURL),
+		}
+		if realm := strings.TrimSpace(record.get("httprealm")); realm != "" {
+			cred.Fields = append(cred.Fields, structs.CustomField{Name: "HTTP realm", Value: realm})
+		}
+		if action := strings.TrimSpace(record.get("formactionorigin")); action != "" && action != rawURL {
+			cred.URLs = append(cred.URLs, action)
+		}
+		payload.add(cred, record.line)
+	}
+	return payload, nil
+}
@@ -0,0 +1,139 @@
+// Package transfer moves whole vaults in and out of PassVault. Exports are
+// self describing JSON files encrypted under an export password, imports
+// merge them back into a store.
+package transfer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"passvault/crypt"
+	"passvault/response"
+	"passvault/store"
+	"passvault/structs"
+	"time"
+)
+
+const (
+	// Format identifies PassVault export files
+	Format = "passvault-export"
+	// FormatVersion is bumped whenever the layout of the payload changes
+	FormatVersion = 1
+	// MaxFileSize is the largest export file accepted, and the most an
+	// archive may unpack to. Attachments make up most of it.
+	MaxFileSize = 64 << 20
+)
+
+// File is the outer layer of an export file. Only the format and the time of
+// the export are readable without the export password, Encryption holds the
+// sealed payload together with the KDF parameters of its key.
+type File struct {
+	Format     string          `json:"format"`
+	Version    int             `json:"version"`
+	ExportedAt time.Time       `json:"exported_at"`
+	Encryption json.RawMessage `json:"encryption"`
+}
+
+// Payload is the decrypted content of an export file. Tags are listed for
+// reference, credentials carry their own. Credentials point at folders by ID
+// and by path, folders by the ID of their parent.
+type Payload struct {
+	Folders     []structs.Folder     `json:"folders"`
+	Tags        []string             `json:"tags"`
+	Credentials []structs.Credential `json:"credentials"`
+
+	// The parsers for other password managers also report where each
+	// credential came from and what they had to leave behind. None of it is
+	// exported.
+	Rows     []int                   `json:"-"`
+	Skipped  []structs.ImportItem    `json:"-"`
+	Warnings []structs.ImportWarning `json:"-"`
+}
+
+// Export writes every live credential and folder in the store into an export
+// file encrypted under password. The trash is not exported.
+func Export(s store.Store, password string) ([]byte, error) {
+	sealer, err := crypt.NewSealer(password)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := Collect(s)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := sealer.Seal(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(File{
+		Format:     Format,
+		Version:    FormatVersion,
+		ExportedAt: time.Now().UTC(),
+		Encryption: sealed,
+	}, "", "  ")
+}
+
+// Collect reads every live credential and folder, and the tags in use, in
+// one transaction so an export is consistent
+func Collect(s store.Store) (*Payload, error) {
+	payload := &Payload{Folders: []structs.Folder{}, Tags: []string{}, Credentials: []structs.Credential{}}
+	err := s.WithTx(func(tx store.Store) error {
+		folders, err := tx.GetFolders(false)
+		if err != nil {
+			return err
+		}
+		payload.Folders = folders
+
+		tags, err := tx.GetTags()
+		if err != nil {
+			return err
+		}
+		for _, tag := range tags {
+			payload.Tags = append(payload.Tags, tag.Name)
+		}
+
+		payload.Credentials, err = listAll(tx, false)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// Decrypt opens an export file. A wrong password is reported as
+// response.ErrInvalidPassphrase, anything that isn't a readable export file
+// as response.ErrInvalidExport.
+func Decrypt(data []byte, password string) (*Payload, error) {
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, response.WrapError(err, response.ErrInvalidExport)
+	}
+	if file.Format != Format {
+		return nil, response.WrapError(fmt.Errorf("unknown format %q", file.Format), response.ErrInvalidExport)
+	}
+	if file.Version < 1 || file.Version > FormatVersion {
+		return nil, response.WrapError(fmt.Errorf("unsupported version %d", file.Version), response.ErrInvalidExport)
+	}
+
+	plaintext, _, err := crypt.Open(password, file.Encryption)
+	if err != nil {
+		if errors.Is(err, response.ErrInvalidPassphrase) {
+			return nil, err
+		}
+		return nil, response.WrapError(err, response.ErrInvalidExport)
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(plaintext, &payload); err != nil {
+		return nil, response.WrapError(err, response.ErrInvalidExport)
+	}
+	return &payload, nil
+}
@@ -0,0 +1,176 @@
+package transfer
+
+import (
+	"encoding/json"
+	"errors"
+	"passvault/response"
+	"passvault/store"
+	"passvault/structs"
+	"slices"
+	"testing"
+)
+
+// newVault returns a memory store with a folder tree and two credentials
+func newVault(t *testing.T) store.Store {
+	t.Helper()
+	s := store.NewMemory()
+	work, err := s.CreateFolder(structs.Folder{Name: "Work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateFolder(structs.Folder{Name: "Empty", ParentID: &work}); err != nil {
+		t.Fatal(err)
+	}
+	creds := []structs.Credential{
+		{Name: "mail", Username: "user", Password: "password1", Tags: []string{"email"}, FolderID: &work},
+		{Name: "bank", Username: "user", Password: "password2", Fields: []structs.CustomField{{Name: "PIN", Value: "1234", Hidden: true}}},
+	}
+	for _, cred := range creds {
+		if _, err := s.CreateCredential(cred); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+// summary lists the credentials of a store as folder path, name and password
+func summary(t *testing.T, s store.Store) []string {
+	t.Helper()
+	creds, err := listAll(s, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, cred := range creds {
+		out = append(out, cred.FolderPath+"|"+cred.Name+"|"+cred.Password)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func TestExportDecrypt(t *testing.T) {
+	data, err := Export(newVault(t), "export password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	if file.Format != Format || file.Version != FormatVersion {
+		t.Fatalf("file = %+v", file)
+	}
+
+	payload, err := Decrypt(data, "export password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.Credentials) != 2 || len(payload.Folders) != 2 || !slices.Equal(payload.Tags, []string{"email"}) {
+		t.Fatalf("payload = %+v", payload)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		password string
+		want     error
+	}{
+		{"wrong password", data, "other password", response.ErrInvalidPassphrase},
+		{"not JSON", []byte("export"), "export password", response.ErrInvalidExport},
+		{"other format", []byte(`{"format":"keepass","version":1}`), "export password", response.ErrInvalidExport},
+		{"newer version", []byte(`{"format":"passvault-export","version":2}`), "export password", response.ErrInvalidExport},
+		{"no envelope", []byte(`{"format":"passvault-export","version":1,"encryption":{}}`), "export password", response.ErrInvalidExport},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decrypt(tt.data, tt.password); !errors.Is(err, tt.want) {
+				t.Fatalf("Decrypt = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportModes(t *testing.T) {
+	source := newVault(t)
+	payload, err := Collect(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The export changes the password of mail and brings a new credential
+	for i := range payload.Credentials {
+		if payload.Credentials[i].Name == "mail" {
+			payload.Credentials[i].Password = "changed1"
+		}
+	}
+	payload.Credentials = append(payload.Credentials,
+		structs.Credential{Name: "wifi", Username: "guest", Password: "password3"},
+		structs.Credential{Name: "broken", Username: "x", Password: "short"},
+	)
+
+	tests := []struct {
+		mode   string
+		dryRun bool
+		want   []string
+		counts [4]int // created, updated, skipped, deleted
+	}{
+		{
+			mode:   structs.ImportModeMerge,
+			want:   []string{"Work|mail|changed1", "|bank|password2", "|old|password9", "|wifi|password3"},
+			counts: [4]int{1, 2, 1, 0},
+		},
+		{
+			mode:   structs.ImportModeSkipDuplicates,
+			want:   []string{"Work|mail|password1", "|bank|password2", "|old|password9", "|wifi|password3"},
+			counts: [4]int{1, 0, 3, 0},
+		},
+		{
+			mode:   structs.ImportModeReplace,
+			want:   []string{"Work|mail|changed1", "|bank|password2", "|wifi|password3"},
+			counts: [4]int{3, 0, 1, 3},
+		},
+		{
+			mode:   structs.ImportModeMerge,
+			dryRun: true,
+			want:   []string{"Work|mail|password1", "|bank|password2", "|old|password9"},
+			counts: [4]int{1, 2, 1, 0},
+		},
+	}
+	for _, tt := range tests {
+		name := tt.mode
+		if tt.dryRun {
+			name += " dry run"
+		}
+		t.Run(name, func(t *testing.T) {
+			target := newVault(t)
+			if _, err := target.CreateCredential(structs.Credential{Name: "old", Username: "user", Password: "password9"}); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := Import(target, payload, ImportOptions{Mode: tt.mode, DryRun: tt.dryRun})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := [4]int{result.Created, result.Updated, result.Skipped, result.Deleted}
+			if got != tt.counts {
+				t.Errorf("created, updated, skipped, deleted = %v, want %v", got, tt.counts)
+			}
+			want := slices.Sorted(slices.Values(tt.want))
+			if got := summary(t, target); !slices.Equal(got, want) {
+				t.Errorf("vault = %q, want %q", got, want)
+			}
+
+			folders, err := target.GetFolders(false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(folders) != 2 {
+				t.Errorf("folders = %+v, want Work and Work/Empty once", folders)
+			}
+		})
+	}
+
+	if _, err := Import(store.NewMemory(), payload, ImportOptions{Mode: "overwrite"}); !errors.Is(err, response.ErrInvalidImportMode) {
+		t.Fatalf("Import with an unknown mode = %v", err)
+	}
+}
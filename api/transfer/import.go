@@ -0,0 +1,353 @@
+package transfer
+
+import (
+	"errors"
+	"passvault/db"
+	"passvault/response"
+	"passvault/store"
+	"passvault/structs"
+	"passvault/validate"
+	"slices"
+	"strings"
+)
+
+// errDryRun rolls back the transaction of a dry run
+var errDryRun = errors.New("dry run")
+
+// ImportOptions controls an import
+type ImportOptions struct {
+	// Mode is one of structs.ImportModes, merge when empty
+	Mode string
+	// DryRun works out what the import would do without changing anything
+	DryRun bool
+}
+
+// folderKey identifies a live folder by its parent, 0 for the top level, and name
+type folderKey struct {
+	parent int
+	name   string
+}
+
+// credentialKey identifies a credential for duplicate detection. Two
+// credentials are the same when they share a folder, name and username.
+type credentialKey struct {
+	folder   int
+	name     string
+	username string
+}
+
+// importer applies a payload inside a single transaction
+type importer struct {
+	tx        store.Store
+	mode      string
+	result    *structs.ImportResult
+	validator *validate.ValidateCredential
+	folders   map[folderKey]int
+	// exported maps the folder IDs in the payload onto folders in the store
+	exported    map[int]int
+	credentials map[credentialKey]int
+}
+
+// Import applies a payload to the store in a single transaction, either all
+// of it goes in or nothing does. Credentials that fail validation are skipped
+// and reported in the result. Folders are matched by path and created when
+// missing.
+func Import(s store.Store, payload *Payload, opts ImportOptions) (*structs.ImportResult, error) {
+	if opts.Mode == "" {
+		opts.Mode = structs.ImportModeMerge
+	}
+	if !slices.Contains(structs.ImportModes, opts.Mode) {
+		return nil, response.ErrInvalidImportMode
+	}
+
+	result := &structs.ImportResult{
+		Mode:     opts.Mode,
+		DryRun:   opts.DryRun,
+		Items:    []structs.ImportItem{},
+		Warnings: append([]structs.ImportWarning{}, payload.Warnings...),
+	}
+	err := s.WithTx(func(tx store.Store) error {
+		im := &importer{
+			tx:          tx,
+			mode:        opts.Mode,
+			result:      result,
+			validator:   validate.NewValidateCredential(),
+			folders:     map[folderKey]int{},
+			exported:    map[int]int{},
+			credentials: map[credentialKey]int{},
+		}
+		if err := im.run(payload); err != nil {
+			return err
+		}
+		if opts.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (im *importer) run(payload *Payload) error {
+	if im.mode == structs.ImportModeReplace {
+		if err := im.clear(); err != nil {
+			return err
+		}
+	}
+	if err := im.load(); err != nil {
+		return err
+	}
+
+	// Folders first, so empty folders come along too
+	byID := make(map[int]structs.Folder, len(payload.Folders))
+	for _, folder := range payload.Folders {
+		byID[folder.ID] = folder
+	}
+	for _, folder := range payload.Folders {
+		if _, err := im.exportedFolder(byID, folder.ID, map[int]bool{}); err != nil {
+			return err
+		}
+	}
+
+	for _, item := range payload.Skipped {
+		im.skip(item, item.Reason)
+	}
+	for i, cred := range payload.Credentials {
+		row := 0
+		if i < len(payload.Rows) {
+			row = payload.Rows[i]
+		}
+		if err := im.credential(cred, row); err != nil {
+			return err
+		}
+	}
+
+	// Entries the parser skipped go back where they were in the file
+	slices.SortStableFunc(im.result.Items, func(a, b structs.ImportItem) int {
+		return a.Row - b.Row
+	})
+	return nil
+}
+
+// clear empties the vault, trash included
+func (im *importer) clear() error {
+	for _, trashed := range []bool{false, true} {
+		creds, err := listAll(im.tx, trashed)
+		if err != nil {
+			return err
+		}
+		for _, cred := range creds {
+			if err := im.tx.DeleteCredential(cred.ID); err != nil {
+				return err
+			}
+			im.result.Deleted++
+		}
+	}
+
+	// Only trashed folders can be purged, trash the live top level first.
+	// Purging a folder takes its subfolders with it.
+	live, err := im.tx.GetFolders(false)
+	if err != nil {
+		return err
+	}
+	for _, folder := range live {
+		if folder.ParentID == nil {
+			if err := im.tx.TrashFolder(folder.ID); err != nil {
+				return err
+			}
+		}
+	}
+	trashed, err := im.tx.GetFolders(true)
+	if err != nil {
+		return err
+	}
+	for _, folder := range trashed {
+		if folder.ParentID == nil {
+			if err := im.tx.PurgeFolder(folder.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// load indexes the live folders and credentials already in the store
+func (im *importer) load() error {
+	folders, err := im.tx.GetFolders(false)
+	if err != nil {
+		return err
+	}
+	for _, folder := range folders {
+		im.folders[folderKey{parent: folderID(folder.ParentID), name: folder.Name}] = folder.ID
+	}
+
+	creds, err := listAll(im.tx, false)
+	if err != nil {
+		return err
+	}
+	for _, cred := range creds {
+		im.credentials[keyOf(cred, folderID(cred.FolderID))] = cred.ID
+	}
+	return nil
+}
+
+// folder returns the live folder with a name under parent, creating it when
+// it doesn't exist yet
+func (im *importer) folder(parent int, name string) (int, error) {
+	name = strings.TrimSpace(name)
+	if id, ok := im.folders[folderKey{parent: parent, name: name}]; ok {
+		return id, nil
+	}
+
+	folder := structs.Folder{Name: name}
+	if parent != 0 {
+		folder.ParentID = &parent
+	}
+	id, err := im.tx.CreateFolder(folder)
+	if err != nil {
+		return 0, err
+	}
+	im.folders[folderKey{parent: parent, name: name}] = id
+	im.result.FoldersCreated++
+	return id, nil
+}
+
+// exportedFolder maps a folder from the payload onto the store, mapping its
+// parents first. Parents missing from the payload, or a parent loop, put the
+// folder at the top level.
+func (im *importer) exportedFolder(byID map[int]structs.Folder, id int, visiting map[int]bool) (int, error) {
+	if mapped, ok := im.exported[id]; ok {
+		return mapped, nil
+	}
+	folder := byID[id]
+	visiting[id] = true
+
+	parent := 0
+	if folder.ParentID != nil {
+		if _, ok := byID[*folder.ParentID]; ok && !visiting[*folder.ParentID] {
+			var err error
+			if parent, err = im.exportedFolder(byID, *folder.ParentID, visiting); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	mapped, err := im.folder(parent, folder.Name)
+	if err != nil {
+		return 0, err
+	}
+	im.exported[id] = mapped
+	return mapped, nil
+}
+
+// folderPath returns the live folder at a slash separated path, creating
+// every folder along it that doesn't exist yet. The empty path is the top
+// level.
+func (im *importer) folderPath(path string) (int, error) {
+	parent := 0
+	for _, name := range strings.Split(path, "/") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		var err error
+		if parent, err = im.folder(parent, name); err != nil {
+			return 0, err
+		}
+	}
+	return parent, nil
+}
+
+// credential imports a single credential found at row of the imported file
+func (im *importer) credential(cred structs.Credential, row int) error {
+	if cred.Name == "" {
+		cred.Name = cred.Username
+	}
+	item := structs.ImportItem{Row: row, Name: cred.Name, Username: cred.Username, FolderPath: cred.FolderPath}
+
+	if err := im.validator.Validate(cred); err != nil {
+		im.skip(item, err.Error())
+		return nil
+	}
+
+	// Folders from the payload win over paths, paths come from other managers
+	folder, ok := im.exported[folderID(cred.FolderID)]
+	if cred.FolderID == nil || !ok {
+		var err error
+		if folder, err = im.folderPath(cred.FolderPath); err != nil {
+			return err
+		}
+	}
+	cred.FolderID = nil
+	if folder != 0 {
+		cred.FolderID = &folder
+	}
+
+	key := keyOf(cred, folder)
+	if id, ok := im.credentials[key]; ok {
+		if im.mode == structs.ImportModeSkipDuplicates {
+			im.skip(item, "a credential with this name and username already exists in the folder")
+			return nil
+		}
+		if err := im.tx.UpdateCredential(id, cred); err != nil {
+			return err
+		}
+		item.Action = structs.ImportActionUpdate
+		im.result.Updated++
+		im.result.Items = append(im.result.Items, item)
+		return nil
+	}
+
+	id, err := im.tx.CreateCredential(cred)
+	if err != nil {
+		return err
+	}
+	im.credentials[key] = id
+	item.Action = structs.ImportActionCreate
+	im.result.Created++
+	im.result.Items = append(im.result.Items, item)
+	return nil
+}
+
+// skip records a credential that wasn't imported
+func (im *importer) skip(item structs.ImportItem, reason string) {
+	item.Action = structs.ImportActionSkip
+	item.Reason = reason
+	im.result.Skipped++
+	im.result.Items = append(im.result.Items, item)
+}
+
+// listAll returns every live or every trashed credential in the store
+func listAll(s store.Store, trashed bool) ([]structs.Credential, error) {
+	creds := []structs.Credential{}
+	opts := structs.ListOptions{Limit: db.MaxListLimit, SortBy: structs.SortByCreated, SortOrder: structs.SortAsc, Trashed: trashed}
+	for {
+		page, err := s.ListCredentials(opts)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, page.Credentials...)
+		if page.NextCursor == "" {
+			return creds, nil
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+// keyOf returns the duplicate detection key of a credential in a folder
+func keyOf(cred structs.Credential, folder int) credentialKey {
+	name := cred.Name
+	if name == "" {
+		name = cred.Username
+	}
+	return credentialKey{folder: folder, name: name, username: cred.Username}
+}
+
+// folderID returns the ID of an optional folder, 0 for none
+func folderID(id *int) int {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
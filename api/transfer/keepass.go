@@ -0,0 +1,254 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"passvault/kdbx"
+	"passvault/response"
+	"passvault/store"
+	"passvault/structs"
+	"path/filepath"
+	"strings"
+)
+
+// Entry strings KeePass clients use beyond the standard ones
+const (
+	// keepassOTP holds an otpauth:// URI, as KeePassXC writes it
+	keepassOTP = "otp"
+	// keepassTOTPSeed holds a base32 secret, as KeeTrayTOTP writes it
+	keepassTOTPSeed = "TOTP Seed"
+	// keepassURL prefixes additional URLs, as Keepass2Android writes them
+	keepassURL = "KP2A_URL"
+)
+
+// keepassReader turns the groups and entries of a KeePass database into a payload
+type keepassReader struct {
+	payload    *Payload
+	recycleBin kdbx.UUID
+	row        int
+}
+
+// ParseKeePass reads a KDBX 4 database protected by password. Groups become
+// folders, standard strings map onto credential fields and any other string
+// becomes a custom field. The recycle bin is left out, and so is the history
+// of entries as credentials don't keep one.
+func ParseKeePass(data []byte, password string) (*Payload, error) {
+	db, err := kdbx.Read(data, password)
+	if err != nil {
+		if errors.Is(err, response.ErrInvalidPassphrase) {
+			return nil, err
+		}
+		return nil, response.WrapError(err, response.ErrInvalidExport)
+	}
+
+	r := keepassReader{payload: newPayload(), recycleBin: db.RecycleBin}
+	// Entries of the root group are at the top level, its groups are top level folders
+	r.group(&db.Root, nil, "")
+	return r.payload, nil
+}
+
+// group adds the entries of a group to the folder parent and its subgroups as
+// folders below it
+func (r *keepassReader) group(g *kdbx.Group, parent *int, path string) {
+	for i := range g.Entries {
+		r.entry(&g.Entries[i], parent, path)
+	}
+
+	for i := range g.Groups {
+		child := &g.Groups[i]
+		if child.UUID != (kdbx.UUID{}) && child.UUID == r.recycleBin {
+			r.skipAll(child)
+			continue
+		}
+
+		folder := structs.Folder{ID: len(r.payload.Folders) + 1, Name: child.Name, ParentID: parent}
+		r.payload.Folders = append(r.payload.Folders, folder)
+		childPath := child.Name
+		if path != "" {
+			childPath = path + "/" + child.Name
+		}
+		r.group(child, &folder.ID, childPath)
+	}
+}
+
+// skipAll reports every entry of a group and its subgroups as skipped
+func (r *keepassReader) skipAll(g *kdbx.Group) {
+	for i := range g.Entries {
+		r.row++
+		r.payload.skip(r.row, g.Entries[i].Get(kdbx.KeyTitle), "in the KeePass recycle bin")
+	}
+	for i := range g.Groups {
+		r.skipAll(&g.Groups[i])
+	}
+}
+
+// entry adds a single entry as a credential in folder
+func (r *keepassReader) entry(e *kdbx.Entry, folder *int, path string) {
+	r.row++
+	cred := structs.Credential{
+		ItemType:   structs.ItemTypeLogin,
+		Tags:       e.Tags,
+		FolderID:   folder,
+		FolderPath: path,
+		URLs:       []string{},
+	}
+
+	for _, s := range e.Strings {
+		switch {
+		case s.Key == kdbx.KeyTitle:
+			cred.Name = s.Value
+		case s.Key == kdbx.KeyUserName:
+			cred.Username = s.Value
+		case s.Key == kdbx.KeyPassword:
+			cred.Password = s.Value
+		case s.Key == kdbx.KeyNotes:
+			cred.Description = s.Value
+		case s.Key == kdbx.KeyURL || strings.HasPrefix(s.Key, keepassURL):
+			cred.URLs = append(cred.URLs, nonEmpty(s.Value)...)
+		case (s.Key == keepassOTP || s.Key == keepassTOTPSeed) && cred.TOTP == "":
+			cred.TOTP = strings.TrimSpace(s.Value)
+		default:
+			cred.Fields = append(cred.Fields, structs.CustomField{Name: s.Key, Value: s.Value, Hidden: s.Protected})
+		}
+	}
+	if cred.Username == "" && cred.Password == "" {
+		cred.ItemType = structs.ItemTypeSecureNote
+	}
+
+	for _, binary := range e.Binaries {
+		contentType := mime.TypeByExtension(filepath.Ext(binary.Name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		cred.Attachments = append(cred.Attachments, structs.Attachment{Name: binary.Name, ContentType: contentType, Data: binary.Data})
+	}
+
+	if len(e.History) > 0 {
+		r.payload.warn(r.row, cred.Name, "%d earlier versions can't be imported", len(e.History))
+	}
+	if e.Times.Expires != nil {
+		r.payload.warn(r.row, cred.Name, "the expiry date can't be imported")
+	}
+	r.payload.add(cred, r.row)
+}
+
+// ExportKeePass writes every live credential and folder in the store into a
+// KDBX 4 database protected by password. Folders become groups below a root
+// group, the trash is not exported.
+func ExportKeePass(s store.Store, password string, opts kdbx.Options) ([]byte, error) {
+	if password == "" {
+		return nil, fmt.Errorf("%w: a passphrase is required", response.ErrInvalidPassphrase)
+	}
+	payload, err := Collect(s)
+	if err != nil {
+		return nil, err
+	}
+
+	children := map[int][]structs.Folder{}
+	exists := map[int]bool{}
+	for _, folder := range payload.Folders {
+		exists[folder.ID] = true
+	}
+	for _, folder := range payload.Folders {
+		parent := folderID(folder.ParentID)
+		if !exists[parent] {
+			parent = 0
+		}
+		children[parent] = append(children[parent], folder)
+	}
+	entries := map[int][]kdbx.Entry{}
+	for _, cred := range payload.Credentials {
+		folder := folderID(cred.FolderID)
+		if !exists[folder] {
+			folder = 0
+		}
+		entries[folder] = append(entries[folder], keepassEntry(cred))
+	}
+
+	var build func(id int, name string) kdbx.Group
+	build = func(id int, name string) kdbx.Group {
+		group := kdbx.Group{UUID: kdbx.NewUUID(), Name: name, Entries: entries[id]}
+		for _, folder := range children[id] {
+			child := build(folder.ID, folder.Name)
+			child.Times = kdbx.Times{Created: folder.CreatedAt, Modified: folder.UpdatedAt, Accessed: folder.UpdatedAt}
+			group.Groups = append(group.Groups, child)
+		}
+		return group
+	}
+
+	db := &kdbx.Database{Name: "PassVault", Root: build(0, "PassVault")}
+	data, err := kdbx.Write(db, password, opts)
+	if err != nil {
+		return nil, response.WrapError(err, response.ErrInvalidExport)
+	}
+	return data, nil
+}
+
+// keepassEntry maps a credential onto a KeePass entry. Additional URLs and
+// the TOTP secret use the strings KeePass plugins and clients understand.
+func keepassEntry(cred structs.Credential) kdbx.Entry {
+	entry := kdbx.Entry{
+		UUID: kdbx.NewUUID(),
+		Tags: cred.Tags,
+		Times: kdbx.Times{
+			Created:  cred.CreatedAt,
+			Modified: cred.UpdatedAt,
+			Accessed: cred.UpdatedAt,
+		},
+	}
+	if cred.LastUsedAt != nil {
+		entry.Times.Accessed = *cred.LastUsedAt
+	}
+
+	used := map[string]bool{}
+	add := func(key, value string, protected bool) {
+		// Keys are unique within an entry, clashing custom fields are numbered
+		unique := key
+		for i := 2; used[unique]; i++ {
+			unique = fmt.Sprintf("%s (%d)", key, i)
+		}
+		used[unique] = true
+		entry.Strings = append(entry.Strings, kdbx.String{Key: unique, Value: value, Protected: protected})
+	}
+
+	add(kdbx.KeyTitle, cred.Name, false)
+	add(kdbx.KeyUserName, cred.Username, false)
+	add(kdbx.KeyPassword, cred.Password, true)
+	add(kdbx.KeyNotes, cred.Description, false)
+	var first string
+	if len(cred.URLs) > 0 {
+		first = cred.URLs[0]
+	}
+	add(kdbx.KeyURL, first, false)
+	for i, u := range cred.URLs[min(1, len(cred.URLs)):] {
+		key := keepassURL
+		if i > 0 {
+			key = fmt.Sprintf("%s_%d", keepassURL, i)
+		}
+		add(key, u, false)
+	}
+	if cred.TOTP != "" {
+		totp := cred.TOTP
+		if !strings.HasPrefix(strings.ToLower(totp), "otpauth://") {
+			totp = "otpauth://totp/" + url.PathEscape(cred.Name) + "?secret=" + url.QueryEscape(strings.ReplaceAll(totp, " ", ""))
+		}
+		add(keepassOTP, totp, true)
+	}
+	for _, field := range cred.Fields {
+		add(field.Name, field.Value, field.Hidden)
+	}
+
+	names := map[string]bool{}
+	for _, attachment := range cred.Attachments {
+		name := attachment.Name
+		ext := filepath.Ext(name)
+		for i := 2; names[name]; i++ {
+			name = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(attachment.Name, ext), i, ext)
+		}
+		names[name] = true
+		entry.Binaries = append(entry.Binaries, kdbx.Binary{Name: name, Data: attachment.Data})
+	}
+	return entry
+}
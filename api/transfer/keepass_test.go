@@ -0,0 +1,50 @@
+package transfer
+
+import (
+	"errors"
+	"passvault/kdbx"
+	"passvault/response"
+	"passvault/structs"
+	"slices"
+	"testing"
+)
+
+func TestKeePassRoundTrip(t *testing.T) {
+	data, err := ExportKeePass(newVault(t), "master password", kdbx.Options{KDF: kdbx.KDFAES})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Parse(SourceKeePass, data, "wrong password"); !errors.Is(err, response.ErrInvalidPassphrase) {
+		t.Fatalf("Parse with the wrong password = %v", err)
+	}
+
+	payload, err := Parse(SourceKeePass, data, "master password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := newVault(t)
+	result, err := Import(target, payload, ImportOptions{Mode: structs.ImportModeReplace})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Created != 2 || result.Skipped != 0 {
+		t.Fatalf("result = %+v", result)
+	}
+
+	want := []string{"Work|mail|password1", "|bank|password2"}
+	if got := summary(t, target); !slices.Equal(got, slices.Sorted(slices.Values(want))) {
+		t.Fatalf("vault = %q, want %q", got, want)
+	}
+	creds, err := listAll(target, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cred := range creds {
+		if cred.Name == "bank" && (len(cred.Fields) != 1 || cred.Fields[0].Name != "PIN" || !cred.Fields[0].Hidden) {
+			t.Errorf("bank fields = %+v", cred.Fields)
+		}
+		if cred.Name == "mail" && !slices.Equal(cred.Tags, []string{"email"}) {
+			t.Errorf("mail tags = %q", cred.Tags)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package transfer
+
+import (
+	"passvault/structs"
+	"strings"
+)
+
+const (
+	// lastPassNoteURL marks secure notes in a LastPass export
+	lastPassNoteURL = "http://sn"
+	// lastPassGroupURL marks rows that only create an empty folder
+	lastPassGroupURL = "http://group"
+)
+
+// lastPassHidden are the typed note template fields kept as hidden fields
+var lastPassHidden = map[string]bool{
+	"Password":       true,
+	"Number":         true,
+	"Security Code":  true,
+	"PIN":            true,
+	"Account Number": true,
+	"Routing Number": true,
+	"Private Key":    true,
+	"Passphrase":     true,
+	"License Key":    true,
+	"Key":            true,
+}
+
+// ParseLastPass reads a LastPass CSV export with the columns url, username,
+// password, totp, extra, name, grouping and fav. Secure notes written from a
+// template such as a credit card or server keep their details as custom
+// fields. Subfolders are separated by backslashes in LastPass.
+func ParseLastPass(data []byte) (*Payload, error) {
+	records, err := readCSV(data, "url", "username", "password", "extra", "name", "grouping")
+	if err != nil {
+		return nil, err
+	}
+
+	payload := newPayload()
+	for _, record := range records {
+		rawURL := strings.TrimSpace(record.get("url"))
+		if rawURL == lastPassGroupURL {
+			continue
+		}
+
+		name := strings.TrimSpace(record.get("name"))
+		if name == "" {
+			name = hostName(rawURL)
+		}
+		cred := structs.Credential{
+			Name:       name,
+			ItemType:   structs.ItemTypeLogin,
+			FolderPath: strings.ReplaceAll(strings.TrimSpace(record.get("grouping")), `\`, "/"),
+			URLs:       []string{},
+		}
+		if record.get("fav") == "1" {
+			cred.Tags = []string{"favorite"}
+		}
+
+		if rawURL == lastPassNoteURL {
+			cred.ItemType = structs.ItemTypeSecureNote
+			cred.Description, cred.Fields = lastPassNote(record.get("extra"))
+		} else {
+			cred.Username = record.get("username")
+			cred.Password = record.get("password")
+			cred.TOTP = strings.TrimSpace(record.get("totp"))
+			cred.Description = record.get("extra")
+			cred.URLs = nonEmpty(rawURL)
+		}
+
+		payload.add(cred, record.line)
+	}
+	return payload, nil
+}
+
+// lastPassNote splits the text of a secure note into its notes and the
+// fields of its template. Template notes start with a NoteType line followed
+// by one "name:value" line per field, values spanning lines continue without
+// a name. Notes come last and run to the end.
+func lastPassNote(extra string) (string, []structs.CustomField) {
+	lines := strings.Split(strings.ReplaceAll(extra, "\r\n", "\n"), "\n")
+	if !strings.HasPrefix(lines[0], "NoteType:") {
+		return extra, nil
+	}
+
+	fields := []structs.CustomField{}
+	// continues is the field lines without a name belong to, -1 when they are dropped
+	continues := -1
+	for i, line := range lines[1:] {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			if continues >= 0 {
+				fields[continues].Value += "\n" + line
+			}
+			continue
+		}
+		if name == "Notes" {
+			return strings.Join(append([]string{value}, lines[i+2:]...), "\n"), fields
+		}
+		continues = -1
+		// Language only records the locale of the template
+		if name == "Language" || strings.TrimSpace(value) == "" {
+			continue
+		}
+		continues = len(fields)
+		fields = append(fields, structs.CustomField{Name: name, Value: value, Hidden: lastPassHidden[name]})
+	}
+	return "", fields
+}
@@ -0,0 +1,56 @@
+package transfer
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseLastPass(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		want []string
+	}{
+		{
+			name: "logins and folders",
+			csv: "url,username,password,totp,extra,name,grouping,fav\n" +
+				"https://mail.example,user,secret123,JBSWY3DPEHPK3PXP,note,mail,Work\\Mail,1\n" +
+				"https://bank.example/login,user,pin12345,,,,,0\n" +
+				"http://group,,,,,Empty,Work\\Empty,0\n",
+			want: []string{
+				`2 login "Work/Mail" "mail"/"user"/"secret123" urls=https://mail.example tags=favorite totp=JBSWY3DPEHPK3PXP notes="note"`,
+				`3 login "" "bank.example"/"user"/"pin12345" urls=https://bank.example/login`,
+			},
+		},
+		{
+			name: "plain secure note",
+			csv: "url,username,password,extra,name,grouping\n" +
+				"http://sn,,,\"first\nsecond\",diary,\n",
+			want: []string{`2 secure_note "" "diary"/""/"" notes="first\nsecond"`},
+		},
+		{
+			name: "template secure note",
+			csv: "url,username,password,extra,name,grouping\n" +
+				"http://sn,,,\"NoteType:Server\nLanguage:en-US\nHostname:db.example\nUsername:root\nPassword:hunter22\nPrivate Key:line1\nline2\nEmpty:\nNotes:backed up\nnightly\",db,Servers\n",
+			want: []string{`2 secure_note "Servers" "db"/""/"" Hostname=db.example Username=root Password=hunter22* Private Key=line1` + "\n" + `line2* notes="backed up\nnightly"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := ParseLastPass([]byte(tt.csv))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describe(payload); !slices.Equal(got, tt.want) {
+				t.Fatalf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestParseLastPassMissingColumns(t *testing.T) {
+	if _, err := ParseLastPass([]byte("url,username,password\nhttps://a.example,user,secret123\n")); err == nil {
+		t.Fatal("ParseLastPass accepted an export without the extra, name and grouping columns")
+	}
+}
@@ -0,0 +1,392 @@
+package transfer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"passvault/structs"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 1Password item categories
+const (
+	onePasswordLogin      = "001"
+	onePasswordSecureNote = "003"
+	onePasswordPassword   = "005"
+	onePasswordDocument   = "006"
+)
+
+// onePasswordCategories names the categories imported as secure notes
+var onePasswordCategories = map[string]string{
+	"002": "credit card",
+	"004": "identity",
+	"100": "software license",
+	"101": "bank account",
+	"102": "database",
+	"103": "driver license",
+	"104": "outdoor license",
+	"105": "membership",
+	"106": "passport",
+	"107": "reward program",
+	"108": "social security number",
+	"109": "wireless router",
+	"110": "server",
+	"111": "email account",
+	"112": "API credential",
+	"113": "medical record",
+	"114": "SSH key",
+	"115": "crypto wallet",
+}
+
+type onePasswordExport struct {
+	Accounts []struct {
+		Vaults []struct {
+			Attrs struct {
+				Name string `json:"name"`
+			} `json:"attrs"`
+			Items []onePasswordItem `json:"items"`
+		} `json:"vaults"`
+	} `json:"accounts"`
+}
+
+type onePasswordItem struct {
+	FavIndex     int    `json:"favIndex"`
+	State        string `json:"state"`
+	CategoryUUID string `json:"categoryUuid"`
+	Details      struct {
+		LoginFields []struct {
+			Value       string `json:"value"`
+			Name        string `json:"name"`
+			FieldType   string `json:"fieldType"`
+			Designation string `json:"designation"`
+		} `json:"loginFields"`
+		NotesPlain string `json:"notesPlain"`
+		// Password is the password of items in the password category
+		Password string `json:"password"`
+		Sections []struct {
+			Title  string `json:"title"`
+			Fields []struct {
+				Title string                     `json:"title"`
+				ID    string                     `json:"id"`
+				Value map[string]json.RawMessage `json:"value"`
+			} `json:"fields"`
+		} `json:"sections"`
+		PasswordHistory    []json.RawMessage `json:"passwordHistory"`
+		DocumentAttributes *onePasswordFile  `json:"documentAttributes"`
+		Passkey            json.RawMessage   `json:"passkey"`
+	} `json:"details"`
+	Overview struct {
+		Title string `json:"title"`
+		URL   string `json:"url"`
+		URLs  []struct {
+			URL string `json:"url"`
+		} `json:"urls"`
+		Tags []string `json:"tags"`
+	} `json:"overview"`
+}
+
+type onePasswordFile struct {
+	FileName   string `json:"fileName"`
+	DocumentID string `json:"documentId"`
+}
+
+// Archives are unpacked with bounds, so a small upload can't expand into
+// gigabytes. Attachments above the size the vault accepts are left out.
+const (
+	maxAttachmentSize = 1 << 20
+	maxArchiveSize    = MaxFileSize
+)
+
+var errArchiveTooLarge = fmt.Errorf("the archive unpacks to more than %d MiB", maxArchiveSize>>20)
+
+// Parse1PUX reads a 1Password .1pux export, a zip archive holding the items
+// in export.data and attached files below files/. Vaults become folders.
+// Categories other than logins, passwords, secure notes and documents become
+// secure notes with their details in custom fields. Only the files items
+// refer to are read.
+func Parse1PUX(data []byte) (*Payload, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not a 1PUX archive: %w", err)
+	}
+
+	budget := int64(maxArchiveSize)
+	var export onePasswordExport
+	found := false
+	for _, file := range archive.File {
+		if file.Name != "export.data" {
+			continue
+		}
+		content, err := readZipFile(file, budget)
+		if err != nil {
+			return nil, err
+		}
+		budget -= int64(len(content))
+		if err := json.Unmarshal(content, &export); err != nil {
+			return nil, err
+		}
+		found = true
+		break
+	}
+	if !found {
+		return nil, errors.New("export.data is missing from the archive")
+	}
+
+	referenced := map[string]bool{}
+	for _, account := range export.Accounts {
+		for _, vault := range account.Vaults {
+			for _, item := range vault.Items {
+				for _, file := range item.files() {
+					referenced[file.DocumentID] = true
+				}
+			}
+		}
+	}
+
+	files := map[string][]byte{}
+	oversized := map[string]bool{}
+	for _, file := range archive.File {
+		if !strings.HasPrefix(file.Name, "files/") || file.FileInfo().IsDir() {
+			continue
+		}
+		// Files are stored as files/<document ID>__<file name>
+		id, _, _ := strings.Cut(path.Base(file.Name), "__")
+		if !referenced[id] {
+			continue
+		}
+		content, err := readZipFile(file, min(budget, maxAttachmentSize))
+		// Past the attachment size the file is left out, past what is left
+		// of the budget the whole archive is refused
+		if errors.Is(err, errArchiveTooLarge) && budget > maxAttachmentSize {
+			oversized[id] = true
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		budget -= int64(len(content))
+		files[id] = content
+	}
+
+	payload := newPayload()
+	row := 0
+	for _, account := range export.Accounts {
+		for _, vault := range account.Vaults {
+			for _, item := range vault.Items {
+				row++
+				onePasswordCredential(payload, item, vault.Attrs.Name, files, oversized, row)
+			}
+		}
+	}
+	return payload, nil
+}
+
+// files returns every file an item refers to, in its sections and as a document
+func (item *onePasswordItem) files() []onePasswordFile {
+	var files []onePasswordFile
+	for _, section := range item.Details.Sections {
+		for _, field := range section.Fields {
+			var file onePasswordFile
+			if raw, ok := field.Value["file"]; ok && json.Unmarshal(raw, &file) == nil {
+				files = append(files, file)
+			}
+		}
+	}
+	if document := item.Details.DocumentAttributes; document != nil {
+		files = append(files, *document)
+	}
+	return files
+}
+
+// onePasswordCredential adds a single item of the vault named folder
+func onePasswordCredential(payload *Payload, item onePasswordItem, folder string, files map[string][]byte, oversized map[string]bool, row int) {
+	name := item.Overview.Title
+	cred := structs.Credential{
+		Name:        name,
+		ItemType:    structs.ItemTypeSecureNote,
+		Description: item.Details.NotesPlain,
+		FolderPath:  folder,
+		Tags:        item.Overview.Tags,
+		URLs:        nonEmpty(item.Overview.URL),
+	}
+	if item.FavIndex > 0 {
+		cred.Tags = append(cred.Tags, "favorite")
+	}
+	if item.State == "archived" {
+		cred.Tags = append(cred.Tags, "archived")
+	}
+	for _, u := range item.Overview.URLs {
+		if u.URL != item.Overview.URL {
+			cred.URLs = append(cred.URLs, nonEmpty(u.URL)...)
+		}
+	}
+
+	switch category := item.CategoryUUID; category {
+	case onePasswordLogin, onePasswordPassword:
+		cred.ItemType = structs.ItemTypeLogin
+		cred.Password = item.Details.Password
+	case onePasswordSecureNote:
+	case onePasswordDocument:
+		if item.Details.DocumentAttributes == nil {
+			payload.skip(row, name, "document without a file")
+			return
+		}
+	default:
+		label, ok := onePasswordCategories[category]
+		if !ok {
+			payload.skip(row, name, fmt.Sprintf("unknown 1Password category %q", category))
+			return
+		}
+		payload.warn(row, name, "%s imported as a secure note", label)
+	}
+
+	for _, field := range item.Details.LoginFields {
+		switch {
+		case field.Designation == "username" && cred.Username == "":
+			cred.Username = field.Value
+		case field.Designation == "password" && cred.Password == "":
+			cred.Password = field.Value
+		case field.Value != "" && field.FieldType != "B" && field.FieldType != "I":
+			// Buttons and submit inputs of the saved form carry no data
+			cred.Fields = append(cred.Fields, structs.CustomField{Name: field.Name, Value: field.Value, Hidden: field.FieldType == "P"})
+		}
+	}
+
+	for _, section := range item.Details.Sections {
+		for _, field := range section.Fields {
+			title := field.Title
+			if title == "" {
+				title = field.ID
+			}
+			if section.Title != "" {
+				title = section.Title + ": " + title
+			}
+			for kind, raw := range field.Value {
+				if kind == "file" {
+					var file onePasswordFile
+					if json.Unmarshal(raw, &file) == nil {
+						cred.Attachments = append(cred.Attachments, onePasswordAttachment(payload, file, files, oversized, row, name)...)
+					}
+					continue
+				}
+				value, hidden, ok := onePasswordValue(kind, raw)
+				if !ok {
+					payload.warn(row, name, "field %q of type %s can't be imported", title, kind)
+					continue
+				}
+				if value == "" {
+					continue
+				}
+				if kind == "totp" && cred.TOTP == "" {
+					cred.TOTP = value
+					continue
+				}
+				cred.Fields = append(cred.Fields, structs.CustomField{Name: title, Value: value, Hidden: hidden})
+			}
+		}
+	}
+
+	if document := item.Details.DocumentAttributes; document != nil {
+		cred.Attachments = append(cred.Attachments, onePasswordAttachment(payload, *document, files, oversized, row, name)...)
+	}
+	if len(item.Details.PasswordHistory) > 0 {
+		payload.warn(row, name, "%d earlier passwords can't be imported", len(item.Details.PasswordHistory))
+	}
+	if len(item.Details.Passkey) > 0 && string(item.Details.Passkey) != "null" {
+		payload.warn(row, name, "passkeys can't be imported")
+	}
+
+	payload.add(cred, row)
+}
+
+// onePasswordAttachment looks up an attached file in the archive
+func onePasswordAttachment(payload *Payload, file onePasswordFile, files map[string][]byte, oversized map[string]bool, row int, name string) []structs.Attachment {
+	if oversized[file.DocumentID] {
+		payload.warn(row, name, "attachment %q is larger than %d MiB and can't be imported", file.FileName, maxAttachmentSize>>20)
+		return nil
+	}
+	data, ok := files[file.DocumentID]
+	if !ok {
+		payload.warn(row, name, "attachment %q is missing from the archive", file.FileName)
+		return nil
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(file.FileName))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return []structs.Attachment{{Name: file.FileName, ContentType: contentType, Data: data}}
+}
+
+// onePasswordValue returns a section field value as text. Concealed values,
+// card numbers and SSH keys are hidden.
+func onePasswordValue(kind string, raw json.RawMessage) (string, bool, bool) {
+	switch kind {
+	case "string", "url", "phone", "menu", "gender", "creditCardType", "reference", "totp":
+		var value string
+		return value, false, json.Unmarshal(raw, &value) == nil
+	case "concealed", "creditCardNumber":
+		var value string
+		return value, true, json.Unmarshal(raw, &value) == nil
+	case "email":
+		var value struct {
+			Address string `json:"email_address"`
+		}
+		return value.Address, false, json.Unmarshal(raw, &value) == nil
+	case "date":
+		var value int64
+		if json.Unmarshal(raw, &value) != nil {
+			return "", false, false
+		}
+		return time.Unix(value, 0).UTC().Format(time.DateOnly), false, true
+	case "monthYear":
+		// Stored as a number like 202512
+		var value int
+		if json.Unmarshal(raw, &value) != nil {
+			return "", false, false
+		}
+		return fmt.Sprintf("%02d/%d", value%100, value/100), false, true
+	case "address":
+		var value struct {
+			Street  string `json:"street"`
+			City    string `json:"city"`
+			State   string `json:"state"`
+			Zip     string `json:"zip"`
+			Country string `json:"country"`
+		}
+		if json.Unmarshal(raw, &value) != nil {
+			return "", false, false
+		}
+		return strings.Join(nonEmpty(value.Street, value.City, value.State, value.Zip, value.Country), ", "), false, true
+	case "sshKey":
+		var value struct {
+			PrivateKey string `json:"privateKey"`
+		}
+		return value.PrivateKey, true, json.Unmarshal(raw, &value) == nil
+	}
+	return "", false, false
+}
+
+// readZipFile reads a file of a zip archive, failing with errArchiveTooLarge
+// when it unpacks to more than limit bytes
+func readZipFile(file *zip.File, limit int64) ([]byte, error) {
+	r, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, errArchiveTooLarge
+	}
+	return data, nil
+}
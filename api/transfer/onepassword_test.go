@@ -0,0 +1,132 @@
+package transfer
+
+import (
+	"archive/zip"
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// onePasswordData is an export.data with a login, a document, a server and
+// an item of an unknown category
+const onePasswordData = `{"accounts": [{"vaults": [{"attrs": {"name": "Private"}, "items": [
+	{"favIndex": 1, "categoryUuid": "001",
+		"details": {
+			"loginFields": [
+				{"value": "user", "name": "email", "fieldType": "E", "designation": "username"},
+				{"value": "secret123", "name": "password", "fieldType": "P", "designation": "password"},
+				{"value": "", "name": "submit", "fieldType": "B"}
+			],
+			"sections": [{"title": "Extra", "fields": [
+				{"title": "one-time password", "value": {"totp": "JBSWY3DPEHPK3PXP"}},
+				{"title": "recovery", "value": {"concealed": "abc-def"}},
+				{"title": "scan", "value": {"file": {"fileName": "scan.pdf", "documentId": "big"}}}
+			]}],
+			"passwordHistory": [{"value": "old"}]
+		},
+		"overview": {"title": "mail", "url": "https://mail.example", "urls": [{"url": "https://mail.example"}, {"url": "https://alt.example"}], "tags": ["email"]}},
+	{"categoryUuid": "006", "state": "archived",
+		"details": {"documentAttributes": {"fileName": "notes.txt", "documentId": "doc1"}},
+		"overview": {"title": "notes"}},
+	{"categoryUuid": "110",
+		"details": {"sections": [{"title": "", "fields": [
+			{"title": "expires", "value": {"monthYear": 202512}},
+			{"id": "address", "value": {"address": {"street": "1 Main St", "city": "Springfield", "country": "us"}}}
+		]}]},
+		"overview": {"title": "server"}},
+	{"categoryUuid": "999", "overview": {"title": "future"}}
+]}]}]}`
+
+// zipOf builds a zip archive of the given files, in order
+func zipOf(t *testing.T, files ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, file := range files {
+		w, err := zw.Create(file[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(file[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParse1PUX(t *testing.T) {
+	data := zipOf(t,
+		[2]string{"export.attributes", `{"version": 3}`},
+		[2]string{"export.data", onePasswordData},
+		[2]string{"files/doc1__notes.txt", "hello"},
+		// Too large to import, the item comes without it
+		[2]string{"files/big__scan.pdf", strings.Repeat("x", maxAttachmentSize+1)},
+		// Nothing refers to it, so it is never unpacked
+		[2]string{"files/unused__bomb.bin", strings.Repeat("\x00", maxArchiveSize+1)},
+	)
+	payload, err := Parse(Source1Password, data, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`1 login "Private" "mail"/"user"/"secret123" urls=https://mail.example,https://alt.example Extra: recovery=abc-def* tags=email,favorite totp=JBSWY3DPEHPK3PXP`,
+		`2 secure_note "Private" "notes"/""/"" tags=archived`,
+		`3 secure_note "Private" "server"/""/"" expires=12/2025 address=1 Main St, Springfield, us`,
+		`skip 4 future: unknown 1Password category "999"`,
+		`warn 1 mail: attachment "scan.pdf" is larger than 1 MiB and can't be imported`,
+		`warn 1 mail: 1 earlier passwords can't be imported`,
+		`warn 3 server: server imported as a secure note`,
+	}
+	if got := describe(payload); !slices.Equal(got, want) {
+		t.Fatalf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	notes := payload.Credentials[1]
+	if len(notes.Attachments) != 1 || string(notes.Attachments[0].Data) != "hello" || notes.Attachments[0].ContentType != "text/plain; charset=utf-8" {
+		t.Fatalf("attachments = %+v", notes.Attachments)
+	}
+}
+
+func TestParse1PUXBounds(t *testing.T) {
+	// Attachments of up to 1 MiB each, referenced by one item
+	manyFiles := func(count int) []byte {
+		fields := make([]string, count)
+		files := [][2]string{}
+		for i := range count {
+			id := "doc" + strings.Repeat("x", i)
+			fields[i] = `{"title": "f", "value": {"file": {"fileName": "f.bin", "documentId": "` + id + `"}}}`
+			files = append(files, [2]string{"files/" + id + "__f.bin", strings.Repeat("\x00", maxAttachmentSize)})
+		}
+		exportData := `{"accounts": [{"vaults": [{"attrs": {"name": "V"}, "items": [
+			{"categoryUuid": "003", "details": {"sections": [{"fields": [` + strings.Join(fields, ",") + `]}]}, "overview": {"title": "n"}}
+		]}]}]}`
+		return zipOf(t, append([][2]string{{"export.data", exportData}}, files...)...)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		ok   bool
+	}{
+		{"within the budget", manyFiles(3), true},
+		{"past the budget", manyFiles(maxArchiveSize/maxAttachmentSize + 1), false},
+		{"export.data too large", zipOf(t, [2]string{"export.data", strings.Repeat(" ", maxArchiveSize+1)}), false},
+		{"no export.data", zipOf(t, [2]string{"files/a__b", "c"}), false},
+		{"not a zip", []byte("1pux"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse1PUX(tt.data)
+			if tt.ok && err != nil {
+				t.Fatal(err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("Parse1PUX succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package transfer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"passvault/response"
+	"passvault/structs"
+	"strings"
+)
+
+// Sources an import can read
+const (
+	SourcePassVault     = "passvault"
+	SourceKeePass       = "kdbx"
+	SourceChrome        = "chrome"
+	SourceFirefox       = "firefox"
+	SourceBitwardenJSON = "bitwarden_json"
+	SourceBitwardenCSV  = "bitwarden_csv"
+	Source1Password     = "1pux"
+	SourceLastPass      = "lastpass"
+)
+
+// Parser reads the unencrypted export of another password manager
+type Parser func(data []byte) (*Payload, error)
+
+// Parsers maps every source other than PassVault and KeePass onto its parser
+var Parsers = map[string]Parser{
+	SourceChrome:        ParseChrome,
+	SourceFirefox:       ParseFirefox,
+	SourceBitwardenJSON: ParseBitwardenJSON,
+	SourceBitwardenCSV:  ParseBitwardenCSV,
+	Source1Password:     Parse1PUX,
+	SourceLastPass:      ParseLastPass,
+}
+
+// Parse reads an export file from a source, PassVault when source is empty.
+// PassVault exports and KeePass databases are decrypted with password, the
+// exports of other password managers are read as they are. Files that can't be read are
+// reported as response.ErrInvalidExport.
+func Parse(source string, data []byte, password string) (*Payload, error) {
+	if source == "" || source == SourcePassVault {
+		return Decrypt(data, password)
+	}
+	if source == SourceKeePass {
+		return ParseKeePass(data, password)
+	}
+	parse, ok := Parsers[source]
+	if !ok {
+		return nil, response.ErrInvalidImportSource
+	}
+
+	payload, err := parse(data)
+	if err != nil {
+		return nil, response.WrapError(err, response.ErrInvalidExport)
+	}
+	return payload, nil
+}
+
+// newPayload returns an empty payload for a parser to fill
+func newPayload() *Payload {
+	return &Payload{
+		Folders:     []structs.Folder{},
+		Tags:        []string{},
+		Credentials: []structs.Credential{},
+		Rows:        []int{},
+		Skipped:     []structs.ImportItem{},
+		Warnings:    []structs.ImportWarning{},
+	}
+}
+
+// add appends a credential found at row
+func (p *Payload) add(cred structs.Credential, row int) {
+	p.Credentials = append(p.Credentials, cred)
+	p.Rows = append(p.Rows, row)
+}
+
+// skip records an entry at row the parser can't import
+func (p *Payload) skip(row int, name, reason string) {
+	p.Skipped = append(p.Skipped, structs.ImportItem{Row: row, Name: name, Reason: reason})
+}
+
+// warn records data of the entry at row that is only imported in part
+func (p *Payload) warn(row int, name, format string, args ...any) {
+	p.Warnings = append(p.Warnings, structs.ImportWarning{Row: row, Name: name, Message: fmt.Sprintf(format, args...)})
+}
+
+// csvRecord is a row of a CSV export
+type csvRecord struct {
+	line   int
+	values map[string]string
+}
+
+// get returns the value of a column, empty when the row doesn't have it
+func (r csvRecord) get(column string) string {
+	return r.values[column]
+}
+
+// readCSV reads a CSV file with a header row. Columns are looked up by their
+// lowercased name, the required ones have to be in the header. Empty rows
+// are left out.
+func readCSV(data []byte, required ...string) ([]csvRecord, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]string, len(header))
+	present := map[string]bool{}
+	for i, column := range header {
+		columns[i] = strings.ToLower(strings.TrimSpace(column))
+		present[columns[i]] = true
+	}
+	for _, column := range required {
+		if !present[column] {
+			return nil, fmt.Errorf("missing column %q", column)
+		}
+	}
+
+	var records []csvRecord
+	for {
+		fields, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		record := csvRecord{line: line, values: map[string]string{}}
+		empty := true
+		for i, value := range fields {
+			if i < len(columns) {
+				record.values[columns[i]] = value
+			}
+			empty = empty && strings.TrimSpace(value) == ""
+		}
+		if !empty {
+			records = append(records, record)
+		}
+	}
+}
+
+// hostName returns the host of a URL without its port, empty if there is none
+func hostName(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// nonEmpty returns the values that aren't blank
+func nonEmpty(values ...string) []string {
+	result := []string{}
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			result = append(result, strings.TrimSpace(value))
+		}
+	}
+	return result
+}
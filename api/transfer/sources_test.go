@@ -0,0 +1,177 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"passvault/response"
+	"passvault/structs"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// describe summarises what a parser found, one line per credential, skipped
+// entry and warning
+func describe(p *Payload) []string {
+	var out []string
+	for i, cred := range p.Credentials {
+		line := fmt.Sprintf("%d %s %q %q/%q/%q", p.Rows[i], cred.ItemType, cred.FolderPath, cred.Name, cred.Username, cred.Password)
+		if len(cred.URLs) > 0 {
+			line += " urls=" + strings.Join(cred.URLs, ",")
+		}
+		for _, field := range cred.Fields {
+			line += fmt.Sprintf(" %s=%s", field.Name, field.Value)
+			if field.Hidden {
+				line += "*"
+			}
+		}
+		if len(cred.Tags) > 0 {
+			line += " tags=" + strings.Join(cred.Tags, ",")
+		}
+		if cred.TOTP != "" {
+			line += " totp=" + cred.TOTP
+		}
+		if cred.Description != "" {
+			line += fmt.Sprintf(" notes=%q", cred.Description)
+		}
+		out = append(out, line)
+	}
+	for _, item := range p.Skipped {
+		out = append(out, fmt.Sprintf("skip %d %s: %s", item.Row, item.Name, item.Reason))
+	}
+	for _, warning := range p.Warnings {
+		out = append(out, fmt.Sprintf("warn %d %s: %s", warning.Row, warning.Name, warning.Message))
+	}
+	return out
+}
+
+func TestParsers(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		data   string
+		want   []string
+	}{
+		{
+			name:   "chrome",
+			source: SourceChrome,
+			data: "\ufeffname,url,username,password,note\n" +
+				"GitHub,https://github.com/login,octo,hunter22,work account\n" +
+				",https://example.com:8443/x,me,secret123,\n" +
+				",,,,\n",
+			want: []string{
+				`2 login "" "GitHub"/"octo"/"hunter22" urls=https://github.com/login notes="work account"`,
+				`3 login "" "example.com"/"me"/"secret123" urls=https://example.com:8443/x`,
+			},
+		},
+		{
+			name:   "firefox",
+			source: SourceFirefox,
+			data: `"url","username","password","httpRealm","formActionOrigin","guid"
+"https://accounts.example.org","me","secret123",,"https://login.example.org","{1}"
+"https://router.lan","admin","admin123","Router","","{2}"
+"chrome://FirefoxAccounts","me","sync","","","{3}"
+`,
+			want: []string{
+				`2 login "" "accounts.example.org"/"me"/"secret123" urls=https://accounts.example.org,https://login.example.org`,
+				`3 login "" "router.lan"/"admin"/"admin123" urls=https://router.lan HTTP realm=Router`,
+				`skip 4 FirefoxAccounts: Firefox internal login`,
+			},
+		},
+		{
+			name:   "bitwarden json",
+			source: SourceBitwardenJSON,
+			data: `{
+				"encrypted": false,
+				"folders": [{"id": "f1", "name": "Work/Servers"}],
+				"items": [
+					{"type": 1, "name": "db", "folderId": "f1", "favorite": true,
+						"login": {"username": "root", "password": "toor1234", "totp": "JBSWY3DPEHPK3PXP",
+							"uris": [{"uri": "https://db.example"}, {"uri": ""}], "fido2Credentials": [{}]},
+						"fields": [{"name": "port", "value": "5432", "type": 0}, {"name": "pin", "value": "1234", "type": 1}, {"name": "link", "type": 3}]},
+					{"type": 2, "name": "wifi", "notes": "code 42"},
+					{"type": 3, "name": "visa", "card": {"number": "4111", "brand": "Visa", "expYear": null}},
+					{"type": 9, "name": "future"}
+				]
+			}`,
+			want: []string{
+				`1 login "Work/Servers" "db"/"root"/"toor1234" urls=https://db.example port=5432 pin=1234* tags=favorite totp=JBSWY3DPEHPK3PXP`,
+				`2 secure_note "" "wifi"/""/"" notes="code 42"`,
+				`3 secure_note "" "visa"/""/"" brand=Visa number=4111*`,
+				`skip 4 future: unknown Bitwarden item type 9`,
+				`warn 1 db: passkeys can't be imported`,
+				`warn 1 db: linked field "link" can't be imported`,
+				`warn 3 visa: card imported as a secure note`,
+			},
+		},
+		{
+			name:   "bitwarden csv",
+			source: SourceBitwardenCSV,
+			data: "folder,favorite,type,name,notes,fields,reprompt,login_uri,login_username,login_password,login_totp\n" +
+				"Work,1,login,mail,,\"pin: 1234\nbroken\",0,\"https://a.example,https://b.example\",me,secret123, JBSWY3DP \n" +
+				",,note,wifi,code 42,,0,,,,\n" +
+				",,card,visa,,,0,,,,\n",
+			want: []string{
+				`2 login "Work" "mail"/"me"/"secret123" urls=https://a.example,https://b.example pin=1234 broken= tags=favorite totp=JBSWY3DP`,
+				`4 secure_note "" "wifi"/""/"" notes="code 42"`,
+				`skip 5 visa: unknown Bitwarden item type "card"`,
+				`warn 2 mail: custom field "broken" has no value`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := Parse(tt.source, []byte(tt.data), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describe(payload); !slices.Equal(got, tt.want) {
+				t.Fatalf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestParseRefusals(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		data   string
+		want   error
+	}{
+		{"unknown source", "dashlane", "", response.ErrInvalidImportSource},
+		{"empty csv", SourceChrome, "", response.ErrInvalidExport},
+		{"missing column", SourceChrome, "name,url,username\n", response.ErrInvalidExport},
+		{"encrypted bitwarden", SourceBitwardenJSON, `{"encrypted": true}`, response.ErrInvalidExport},
+		{"not json", SourceBitwardenJSON, `{`, response.ErrInvalidExport},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.source, []byte(tt.data), ""); !errors.Is(err, tt.want) {
+				t.Fatalf("Parse = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportParsedRows(t *testing.T) {
+	data := "name,url,username,password\n" +
+		"short,https://a.example,user,abc\n" +
+		"good,https://b.example,user,secret123\n"
+	payload, err := Parse(SourceChrome, []byte(data), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := newVault(t)
+	result, err := Import(target, payload, ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Created != 1 || result.Skipped != 1 {
+		t.Fatalf("result = %+v", result)
+	}
+	// Items are reported by the row they came from
+	if result.Items[0].Row != 2 || result.Items[0].Action != structs.ImportActionSkip || result.Items[1].Row != 3 {
+		t.Fatalf("items = %+v", result.Items)
+	}
+}
@@ -0,0 +1,253 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"passvault/response"
+	"passvault/structs"
+	"passvault/validate"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Fields of the editor form, in the order they are shown
+const (
+	fieldName = iota
+	fieldType
+	fieldUsername
+	fieldPassword
+	fieldURLs
+	fieldTags
+	fieldFolder
+	fieldTOTP
+	fieldDescription
+	fieldCount
+)
+
+var fieldLabels = [fieldCount]string{
+	fieldName:        "Name",
+	fieldType:        "Type",
+	fieldUsername:    "Username",
+	fieldPassword:    "Password",
+	fieldURLs:        "URLs",
+	fieldTags:        "Tags",
+	fieldFolder:      "Folder",
+	fieldTOTP:        "TOTP secret",
+	fieldDescription: "Description",
+}
+
+// editor is the form a credential is added or changed in. Custom fields and
+// attachments aren't shown, they are kept as they are.
+type editor struct {
+	cred   structs.Credential
+	inputs [fieldCount]textinput.Model
+	// shown is what every input held when the form opened. The inputs hold a
+	// single line, so a value spanning lines, like an SSH key, is shown
+	// flattened and only replaced once its input is edited.
+	shown [fieldCount]string
+	// multiline marks the fields whose value spans lines
+	multiline [fieldCount]bool
+	focus     int
+	folders   []structs.Folder
+	err       error
+}
+
+// saved is sent when the editor has a valid credential to store
+type saved struct {
+	cred structs.Credential
+}
+
+// newEditor opens the form on a credential, a zero one adds a new credential
+func newEditor(cred structs.Credential, folders []structs.Folder) *editor {
+	if cred.ItemType == "" {
+		cred.ItemType = structs.ItemTypeLogin
+	}
+	e := &editor{cred: cred, folders: folders}
+	values := [fieldCount]string{
+		fieldName:        cred.Name,
+		fieldType:        cred.ItemType,
+		fieldUsername:    cred.Username,
+		fieldPassword:    cred.Password,
+		fieldURLs:        strings.Join(cred.URLs, ", "),
+		fieldTags:        strings.Join(cred.Tags, ", "),
+		fieldFolder:      cred.FolderPath,
+		fieldTOTP:        cred.TOTP,
+		fieldDescription: cred.Description,
+	}
+	for i := range e.inputs {
+		input := textinput.New()
+		input.Prompt = ""
+		input.Width = 48
+		input.SetValue(values[i])
+		e.inputs[i] = input
+		e.shown[i] = input.Value()
+		e.multiline[i] = strings.Contains(values[i], "\n")
+	}
+	e.inputs[fieldPassword].EchoMode = textinput.EchoPassword
+	e.inputs[fieldURLs].Placeholder = "comma separated"
+	e.inputs[fieldTags].Placeholder = "comma separated"
+	e.inputs[fieldFolder].Placeholder = "path like Work/Servers"
+	e.inputs[fieldType].Placeholder = strings.Join(structs.ItemTypes, ", ")
+	e.inputs[fieldName].Focus()
+	return e
+}
+
+// setPassword puts a generated password in the form
+func (e *editor) setPassword(password string) {
+	e.inputs[fieldPassword].SetValue(password)
+}
+
+func (e *editor) move(delta int) {
+	e.inputs[e.focus].Blur()
+	e.focus = (e.focus + delta + fieldCount) % fieldCount
+	e.inputs[e.focus].Focus()
+}
+
+func (e *editor) update(msg tea.Msg) tea.Cmd {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "esc":
+			return func() tea.Msg { return closed{} }
+		case "tab", "down":
+			e.move(1)
+			return nil
+		case "shift+tab", "up":
+			e.move(-1)
+			return nil
+		case "ctrl+r":
+			if e.inputs[fieldPassword].EchoMode == textinput.EchoPassword {
+				e.inputs[fieldPassword].EchoMode = textinput.EchoNormal
+			} else {
+				e.inputs[fieldPassword].EchoMode = textinput.EchoPassword
+			}
+			return nil
+		case "enter":
+			if e.focus < fieldCount-1 {
+				e.move(1)
+				return nil
+			}
+			return e.save()
+		case "ctrl+s":
+			return e.save()
+		}
+	}
+	var cmd tea.Cmd
+	e.inputs[e.focus], cmd = e.inputs[e.focus].Update(msg)
+	return cmd
+}
+
+// save checks the form and hands the credential over to be stored
+func (e *editor) save() tea.Cmd {
+	cred, err := e.credential()
+	if err == nil {
+		err = explain(cred, validate.NewValidateCredential().Validate(cred))
+	}
+	if e.err = err; err != nil {
+		return nil
+	}
+	return func() tea.Msg { return saved{cred} }
+}
+
+// explain spells out the limits a credential failed validation on. Registry
+// and git items, SSH keys and secrets have limits of their own.
+func explain(cred structs.Credential, err error) error {
+	limits := validate.NewValidateCredential()
+	own := slices.Contains([]string{structs.ItemTypeRegistry, structs.ItemTypeGit, structs.ItemTypeSSHKey, structs.ItemTypeSecret}, cred.ItemType)
+	switch {
+	case own && (errors.Is(err, response.ErrInvalidPassword) || errors.Is(err, response.ErrInvalidUsername)):
+		return err
+	case errors.Is(err, response.ErrInvalidPassword):
+		return fmt.Errorf("%w, it takes %d to %d characters", err, limits.PasswordMinLength, limits.PasswordMaxLength)
+	case errors.Is(err, response.ErrInvalidUsername):
+		return fmt.Errorf("%w, it takes %d to %d characters", err, limits.UsernameMinLength, limits.UsernameMaxLength)
+	case errors.Is(err, response.ErrInvalidItemType):
+		return fmt.Errorf("%w, use %s", err, strings.Join(structs.ItemTypes, ", "))
+	}
+	return err
+}
+
+// edited reports whether the input of a field was changed
+func (e *editor) edited(field int) bool {
+	return e.inputs[field].Value() != e.shown[field]
+}
+
+// credential returns the credential the form describes. Fields that weren't
+// edited keep the value of the credential as it is.
+func (e *editor) credential() (structs.Credential, error) {
+	cred := e.cred
+	value := func(field int) string { return strings.TrimSpace(e.inputs[field].Value()) }
+	for field, dest := range map[int]*string{
+		fieldName:        &cred.Name,
+		fieldType:        &cred.ItemType,
+		fieldUsername:    &cred.Username,
+		fieldTOTP:        &cred.TOTP,
+		fieldDescription: &cred.Description,
+	} {
+		if e.edited(field) {
+			*dest = value(field)
+		}
+	}
+	if e.edited(fieldPassword) {
+		cred.Password = e.inputs[fieldPassword].Value()
+	}
+	if e.edited(fieldURLs) {
+		cred.URLs = splitList(value(fieldURLs))
+	}
+	if e.edited(fieldTags) {
+		cred.Tags = splitList(value(fieldTags))
+	}
+	if !e.edited(fieldFolder) {
+		return cred, nil
+	}
+
+	cred.FolderID, cred.FolderPath = nil, strings.Trim(value(fieldFolder), "/")
+	if cred.FolderPath != "" {
+		for _, folder := range e.folders {
+			if strings.EqualFold(folder.Path, cred.FolderPath) {
+				cred.FolderID = &folder.ID
+			}
+		}
+		if cred.FolderID == nil {
+			return cred, fmt.Errorf("no folder %q", cred.FolderPath)
+		}
+	}
+	return cred, nil
+}
+
+// splitList splits a comma separated list, leaving out empty entries
+func splitList(s string) []string {
+	var list []string
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+func (e *editor) view() string {
+	var b strings.Builder
+	title := "Edit " + e.cred.Name
+	if e.cred.ID == 0 {
+		title = "New credential"
+	}
+	b.WriteString(titleStyle.Render(title) + "\n\n")
+	for i, input := range e.inputs {
+		label := labelStyle.Render(fieldLabels[i])
+		if i == e.focus {
+			label = focusStyle.Render(fieldLabels[i])
+		}
+		b.WriteString(label + " " + input.View() + "\n")
+		if i == e.focus && e.multiline[i] && !e.edited(i) {
+			b.WriteString(helpStyle.Render("  spans lines, it is kept unless you change it") + "\n")
+		}
+	}
+	if e.err != nil {
+		b.WriteString("\n" + errorStyle.Render(e.err.Error()) + "\n")
+	}
+	b.WriteString("\n" + helpStyle.Render("tab/↑/↓ move • ctrl+g generate • ctrl+r show password • ctrl+s save • esc cancel"))
+	return dialogStyle.Render(b.String())
+}
@@ -0,0 +1,88 @@
+package tui
+
+import (
+	"fmt"
+	"passvault/passgen"
+	"passvault/validate"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// generator is the password generator dialog. Its lengths are kept within
+// what the validator accepts for a password.
+type generator struct {
+	opts     passgen.Options
+	password string
+	err      error
+}
+
+// generated is sent when a generated password is taken
+type generated struct {
+	password string
+}
+
+// closed is sent when a dialog is left without taking anything
+type closed struct{}
+
+func newGenerator() *generator {
+	g := &generator{opts: passgen.Options{Length: passgen.DefaultLength}}
+	g.generate()
+	return g
+}
+
+func (g *generator) generate() {
+	g.password, g.err = passgen.Generate(g.opts)
+}
+
+func (g *generator) update(msg tea.KeyMsg) tea.Cmd {
+	limits := validate.NewValidateCredential()
+	switch msg.String() {
+	case "esc", "q":
+		return func() tea.Msg { return closed{} }
+	case "enter":
+		if g.err != nil {
+			return nil
+		}
+		password := g.password
+		return func() tea.Msg { return generated{password} }
+	case "left", "-", "h":
+		g.opts.Length = max(g.opts.Length-1, limits.PasswordMinLength)
+	case "right", "+", "l":
+		g.opts.Length = min(g.opts.Length+1, limits.PasswordMaxLength)
+	case "u":
+		g.opts.NoUpper = !g.opts.NoUpper
+	case "d":
+		g.opts.NoDigits = !g.opts.NoDigits
+	case "s":
+		g.opts.NoSymbols = !g.opts.NoSymbols
+	case "r", " ":
+	default:
+		return nil
+	}
+	g.generate()
+	return nil
+}
+
+func (g *generator) view() string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("Generate a password") + "\n\n")
+	if g.err != nil {
+		b.WriteString(errorStyle.Render(g.err.Error()) + "\n\n")
+	} else {
+		b.WriteString(secretStyle.Render(g.password) + "\n\n")
+	}
+	fmt.Fprintf(&b, "%s %d\n", labelStyle.Render("Length"), g.opts.Length)
+	fmt.Fprintf(&b, "%s %s\n", labelStyle.Render("Upper case"), checkbox(!g.opts.NoUpper))
+	fmt.Fprintf(&b, "%s %s\n", labelStyle.Render("Digits"), checkbox(!g.opts.NoDigits))
+	fmt.Fprintf(&b, "%s %s\n", labelStyle.Render("Symbols"), checkbox(!g.opts.NoSymbols))
+	b.WriteString("\n" + helpStyle.Render("←/→ length • u upper • d digits • s symbols • r again • enter use • esc close"))
+	return dialogStyle.Render(b.String())
+}
+
+func checkbox(on bool) string {
+	if on {
+		return "[x]"
+	}
+	return "[ ]"
+}
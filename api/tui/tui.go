@@ -0,0 +1,520 @@
+// Package tui is a terminal interface to the vault, for when the web UI is
+// out of reach, over SSH for one
+package tui
+
+import (
+	"fmt"
+	"passvault/structs"
+	"passvault/totp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	titleStyle    = lipgloss.NewStyle().Bold(true)
+	labelStyle    = lipgloss.NewStyle().Width(12).Foreground(lipgloss.Color("8"))
+	focusStyle    = labelStyle.Foreground(lipgloss.Color("12")).Bold(true)
+	selectedStyle = lipgloss.NewStyle().Reverse(true)
+	secretStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+	errorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	helpStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	paneStyle     = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1)
+	dialogStyle   = paneStyle.BorderForeground(lipgloss.Color("12"))
+)
+
+// mask stands in for a secret that isn't revealed
+const mask = "••••••••"
+
+// States of the interface, the list unless a dialog is open
+const (
+	stateList = iota
+	stateSearch
+	stateTags
+	stateEdit
+	stateGenerate
+	stateDelete
+)
+
+// loaded is sent when the vault has been read
+type loaded struct {
+	credentials []structs.Credential
+	tags        []structs.Tag
+	folders     []structs.Folder
+	err         error
+}
+
+// done is sent when a change to the vault is finished
+type done struct {
+	status string
+	err    error
+}
+
+// tick redraws the TOTP code every second
+type tick time.Time
+
+// Model is the state of the interface
+type Model struct {
+	vault  Vault
+	source string
+
+	credentials []structs.Credential
+	tags        []structs.Tag
+	folders     []structs.Folder
+	// visible are the credentials the search and tag filter let through
+	visible []structs.Credential
+
+	state     int
+	cursor    int
+	search    textinput.Model
+	tag       string
+	tagCursor int
+	reveal    bool
+	editor    *editor
+	generator *generator
+	status    string
+	err       error
+
+	width, height int
+}
+
+// Run reads the vault and opens the interface on it, until it is quit.
+// source names the vault in the header. Failing to read the vault returns
+// before the terminal is taken over.
+func Run(vault Vault, source string) error {
+	m := &Model{vault: vault, source: source}
+	m.search = textinput.New()
+	m.search.Prompt = "/ "
+	m.search.Placeholder = "search"
+
+	msg := m.load()().(loaded)
+	if msg.err != nil {
+		return msg.err
+	}
+	m.apply(msg)
+	_, err := tea.NewProgram(m, tea.WithAltScreen()).Run()
+	return err
+}
+
+// load reads the credentials, tags and folders of the vault
+func (m *Model) load() tea.Cmd {
+	return func() tea.Msg {
+		var msg loaded
+		if msg.credentials, msg.err = m.vault.Credentials(); msg.err != nil {
+			return msg
+		}
+		if msg.tags, msg.err = m.vault.Tags(); msg.err != nil {
+			return msg
+		}
+		msg.folders, msg.err = m.vault.Folders()
+		return msg
+	}
+}
+
+// apply takes in a fresh read of the vault, keeping the selection
+func (m *Model) apply(msg loaded) {
+	if msg.err != nil {
+		m.err = msg.err
+		return
+	}
+	selected := 0
+	if cred := m.selected(); cred != nil {
+		selected = cred.ID
+	}
+	m.credentials, m.tags, m.folders = msg.credentials, msg.tags, msg.folders
+	slices.SortFunc(m.credentials, func(a, b structs.Credential) int {
+		return strings.Compare(strings.ToLower(fullName(a)), strings.ToLower(fullName(b)))
+	})
+	if !slices.ContainsFunc(m.tags, func(t structs.Tag) bool { return t.Name == m.tag }) {
+		m.tag = ""
+	}
+	m.filter()
+	if i := slices.IndexFunc(m.visible, func(c structs.Credential) bool { return c.ID == selected }); i >= 0 {
+		m.cursor = i
+	}
+}
+
+// filter picks the credentials matching every word of the search and the
+// tag filter
+func (m *Model) filter() {
+	words := strings.Fields(strings.ToLower(m.search.Value()))
+	m.visible = m.visible[:0]
+	for _, cred := range m.credentials {
+		if m.tag != "" && !slices.Contains(cred.Tags, m.tag) {
+			continue
+		}
+		text := strings.ToLower(strings.Join(slices.Concat([]string{fullName(cred), cred.Username, cred.Description}, cred.URLs, cred.Tags), " "))
+		if !slices.ContainsFunc(words, func(word string) bool { return !strings.Contains(text, word) }) {
+			m.visible = append(m.visible, cred)
+		}
+	}
+	m.cursor = max(min(m.cursor, len(m.visible)-1), 0)
+}
+
+// selected returns the credential under the cursor, nil in an empty list
+func (m *Model) selected() *structs.Credential {
+	if m.cursor < len(m.visible) {
+		return &m.visible[m.cursor]
+	}
+	return nil
+}
+
+// change runs a change to the vault, reading it again afterwards
+func (m *Model) change(status string, fn func() error) tea.Cmd {
+	return func() tea.Msg {
+		return done{status, fn()}
+	}
+}
+
+func tickEvery() tea.Cmd {
+	return tea.Every(time.Second, func(t time.Time) tea.Msg { return tick(t) })
+}
+
+func (m *Model) Init() tea.Cmd {
+	return tickEvery()
+}
+
+func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.search.Width = max(m.width-4, 10)
+		return m, nil
+	case tick:
+		return m, tickEvery()
+	case loaded:
+		m.apply(msg)
+		return m, nil
+	case done:
+		if msg.err != nil {
+			// A refused save leaves the form open to be fixed
+			if m.editor != nil {
+				m.editor.err = msg.err
+				m.state = stateEdit
+				return m, nil
+			}
+			m.err = msg.err
+			return m, nil
+		}
+		m.editor, m.state, m.status, m.err = nil, stateList, msg.status, nil
+		return m, m.load()
+	case saved:
+		cred := msg.cred
+		if cred.ID == 0 {
+			return m, m.change("Added "+cred.Name, func() error {
+				_, err := m.vault.Create(cred)
+				return err
+			})
+		}
+		return m, m.change("Saved "+cred.Name, func() error { return m.vault.Update(cred.ID, cred) })
+	case generated:
+		m.generator = nil
+		if m.editor == nil {
+			m.editor = newEditor(structs.Credential{}, m.folders)
+		}
+		m.editor.setPassword(msg.password)
+		m.state = stateEdit
+		return m, nil
+	case closed:
+		if m.state == stateGenerate && m.editor != nil {
+			m.generator, m.state = nil, stateEdit
+			return m, nil
+		}
+		m.editor, m.generator, m.state = nil, nil, stateList
+		return m, nil
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		return m, m.key(msg)
+	}
+
+	if m.state == stateEdit {
+		return m, m.editor.update(msg)
+	}
+	return m, nil
+}
+
+// key handles a key press in the current state
+func (m *Model) key(msg tea.KeyMsg) tea.Cmd {
+	switch m.state {
+	case stateEdit:
+		if msg.String() == "ctrl+g" {
+			m.generator, m.state = newGenerator(), stateGenerate
+			return nil
+		}
+		return m.editor.update(msg)
+	case stateGenerate:
+		return m.generator.update(msg)
+	case stateSearch:
+		return m.searchKey(msg)
+	case stateTags:
+		m.tagKey(msg)
+		return nil
+	case stateDelete:
+		cred := m.selected()
+		m.state = stateList
+		if msg.String() != "y" || cred == nil {
+			m.status = ""
+			return nil
+		}
+		id := cred.ID
+		return m.change("Deleted "+cred.Name, func() error { return m.vault.Delete(id) })
+	}
+
+	m.status, m.err = "", nil
+	switch msg.String() {
+	case "q":
+		return tea.Quit
+	case "esc":
+		m.search.SetValue("")
+		m.tag = ""
+		m.filter()
+	case "up", "k":
+		m.moveCursor(-1)
+	case "down", "j":
+		m.moveCursor(1)
+	case "pgup":
+		m.moveCursor(-m.listHeight())
+	case "pgdown":
+		m.moveCursor(m.listHeight())
+	case "home":
+		m.moveCursor(-len(m.visible))
+	case "end":
+		m.moveCursor(len(m.visible))
+	case "/":
+		m.state = stateSearch
+		return m.search.Focus()
+	case "r", " ":
+		m.reveal = !m.reveal
+	case "t":
+		m.state, m.tagCursor = stateTags, 0
+		if i := slices.IndexFunc(m.tags, func(t structs.Tag) bool { return t.Name == m.tag }); i >= 0 {
+			m.tagCursor = i + 1
+		}
+	case "n":
+		m.editor, m.state = newEditor(structs.Credential{}, m.folders), stateEdit
+	case "e", "enter":
+		if cred := m.selected(); cred != nil {
+			m.editor, m.state = newEditor(*cred, m.folders), stateEdit
+		}
+	case "d", "delete":
+		if cred := m.selected(); cred != nil {
+			m.state, m.status = stateDelete, fmt.Sprintf("Delete %s? y/n", fullName(*cred))
+		}
+	case "g":
+		m.generator, m.state = newGenerator(), stateGenerate
+	case "R":
+		m.status = "Reloaded"
+		return m.load()
+	}
+	return nil
+}
+
+// moveCursor moves the selection, hiding the secrets of the one left
+func (m *Model) moveCursor(delta int) {
+	cursor := max(min(m.cursor+delta, len(m.visible)-1), 0)
+	if cursor != m.cursor {
+		m.cursor, m.reveal = cursor, false
+	}
+}
+
+// searchKey handles a key press while typing a search, the list follows
+// every key
+func (m *Model) searchKey(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc":
+		m.search.SetValue("")
+		fallthrough
+	case "enter":
+		m.search.Blur()
+		m.state = stateList
+		m.filter()
+		return nil
+	case "up", "down":
+		m.moveCursor(map[string]int{"up": -1, "down": 1}[msg.String()])
+		return nil
+	}
+	var cmd tea.Cmd
+	m.search, cmd = m.search.Update(msg)
+	m.filter()
+	return cmd
+}
+
+// tagKey handles a key press in the tag filter dialog, whose first entry
+// drops the filter
+func (m *Model) tagKey(msg tea.KeyMsg) {
+	switch msg.String() {
+	case "up", "k":
+		m.tagCursor = max(m.tagCursor-1, 0)
+	case "down", "j":
+		m.tagCursor = min(m.tagCursor+1, len(m.tags))
+	case "enter":
+		m.tag = ""
+		if m.tagCursor > 0 {
+			m.tag = m.tags[m.tagCursor-1].Name
+		}
+		m.state, m.cursor = stateList, 0
+		m.filter()
+	case "esc", "q", "t":
+		m.state = stateList
+	}
+}
+
+// listHeight is the number of rows the list has room for
+func (m *Model) listHeight() int {
+	// The header, the search line, the footer and the pane borders
+	return max(m.height-6, 1)
+}
+
+func (m *Model) View() string {
+	if m.width == 0 {
+		return ""
+	}
+	switch m.state {
+	case stateEdit:
+		return m.place(m.editor.view())
+	case stateGenerate:
+		return m.place(m.generator.view())
+	case stateTags:
+		return m.place(m.tagView())
+	}
+
+	header := titleStyle.Render("PassVault") + " " + m.source
+	count := fmt.Sprintf("%d of %d", len(m.visible), len(m.credentials))
+	if m.tag != "" {
+		count += " tagged " + m.tag
+	}
+	header += strings.Repeat(" ", max(m.width-lipgloss.Width(header)-len(count), 1)) + count
+
+	listWidth := max(m.width*2/5, 24)
+	detailWidth := max(m.width-listWidth, 24)
+	height := m.listHeight()
+	list := paneStyle.Width(listWidth - 2).Height(height).MaxHeight(height + 2).Render(m.listView(listWidth-4, height))
+	detail := paneStyle.Width(detailWidth - 2).Height(height).MaxHeight(height + 2).Render(m.detailView(detailWidth - 4))
+
+	footer := helpStyle.Render("/ search • t tags • esc clear • r reveal • n new • e edit • d delete • g generate • R reload • q quit")
+	switch {
+	case m.err != nil:
+		footer = errorStyle.Render(m.err.Error())
+	case m.status != "":
+		footer = m.status
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, header, m.search.View(), lipgloss.JoinHorizontal(lipgloss.Top, list, detail), footer)
+}
+
+// place centres a dialog on the screen
+func (m *Model) place(dialog string) string {
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, dialog)
+}
+
+// listView renders the rows of the list around the cursor
+func (m *Model) listView(width, height int) string {
+	if len(m.visible) == 0 {
+		return helpStyle.Render("No credentials")
+	}
+	start := max(min(m.cursor-height/2, len(m.visible)-height), 0)
+	end := min(start+height, len(m.visible))
+	rows := make([]string, 0, end-start)
+	row := lipgloss.NewStyle().Width(width).MaxWidth(width)
+	for i := start; i < end; i++ {
+		cred := m.visible[i]
+		if i == m.cursor {
+			rows = append(rows, selectedStyle.Inherit(row).Render(strings.TrimSpace(fullName(cred)+"  "+cred.Username)))
+			continue
+		}
+		text := fullName(cred)
+		if cred.Username != "" {
+			text += helpStyle.Render("  " + cred.Username)
+		}
+		rows = append(rows, row.Render(text))
+	}
+	return strings.Join(rows, "\n")
+}
+
+// detailView renders the selected credential, its secrets masked unless
+// they are revealed
+func (m *Model) detailView(width int) string {
+	cred := m.selected()
+	if cred == nil {
+		return ""
+	}
+	secret := func(value string) string {
+		if value == "" {
+			return ""
+		}
+		if !m.reveal {
+			return mask
+		}
+		return secretStyle.Render(value)
+	}
+
+	var b strings.Builder
+	line := func(label, value string) {
+		if value != "" {
+			b.WriteString(labelStyle.Render(label) + " " + value + "\n")
+		}
+	}
+	b.WriteString(titleStyle.Render(cred.Name) + "\n\n")
+	line("Type", cred.ItemType)
+	line("Username", cred.Username)
+	line("Password", secret(cred.Password))
+	if cred.TOTP != "" {
+		if key, err := totp.Parse(cred.TOTP); err != nil {
+			line("TOTP", errorStyle.Render(err.Error()))
+		} else {
+			now := time.Now()
+			line("TOTP", fmt.Sprintf("%s (%ds)", secret(key.Code(now)), int(key.Remaining(now).Seconds())))
+		}
+	}
+	for _, url := range cred.URLs {
+		line("URL", url)
+	}
+	line("Folder", cred.FolderPath)
+	line("Tags", strings.Join(cred.Tags, ", "))
+	for _, field := range cred.Fields {
+		value := field.Value
+		if field.Hidden {
+			value = secret(value)
+		}
+		line(field.Name, value)
+	}
+	for _, attachment := range cred.Attachments {
+		line("Attachment", fmt.Sprintf("%s (%d bytes)", attachment.Name, len(attachment.Data)))
+	}
+	line("Updated", cred.UpdatedAt.Local().Format(time.DateTime))
+	if cred.Description != "" {
+		b.WriteString("\n" + cred.Description + "\n")
+	}
+	return lipgloss.NewStyle().Width(width).Render(b.String())
+}
+
+// tagView renders the tag filter dialog
+func (m *Model) tagView() string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("Filter by tag") + "\n\n")
+	entries := []string{"All credentials"}
+	for _, tag := range m.tags {
+		entries = append(entries, fmt.Sprintf("%s (%d)", tag.Name, tag.Count))
+	}
+	for i, entry := range entries {
+		if i == m.tagCursor {
+			entry = selectedStyle.Render(entry)
+		}
+		b.WriteString(entry + "\n")
+	}
+	b.WriteString("\n" + helpStyle.Render("↑/↓ move • enter pick • esc close"))
+	return dialogStyle.Render(b.String())
+}
+
+// fullName returns the folder path and name of a credential
+func fullName(cred structs.Credential) string {
+	if cred.FolderPath == "" {
+		return cred.Name
+	}
+	return cred.FolderPath + "/" + cred.Name
+}
@@ -0,0 +1,159 @@
+package tui
+
+import (
+	"passvault/store"
+	"passvault/structs"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// newTestModel opens the interface on a memory vault holding creds
+func newTestModel(t *testing.T, creds ...structs.Credential) *Model {
+	t.Helper()
+	s := store.NewMemory()
+	for _, cred := range creds {
+		if _, err := s.CreateCredential(cred); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := &Model{vault: LocalVault(s), search: textinput.New(), width: 120, height: 40}
+	m.apply(m.load()().(loaded))
+	if m.err != nil {
+		t.Fatal(m.err)
+	}
+	return m
+}
+
+// press sends keys to the model and runs the commands they return until
+// the model settles, like the program would
+func press(m *Model, keys ...string) {
+	for _, key := range keys {
+		msg := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)}
+		switch key {
+		case "enter":
+			msg = tea.KeyMsg{Type: tea.KeyEnter}
+		case "esc":
+			msg = tea.KeyMsg{Type: tea.KeyEsc}
+		case "tab":
+			msg = tea.KeyMsg{Type: tea.KeyTab}
+		case "ctrl+s":
+			msg = tea.KeyMsg{Type: tea.KeyCtrlS}
+		case "ctrl+g":
+			msg = tea.KeyMsg{Type: tea.KeyCtrlG}
+		}
+		settle(m, msg)
+	}
+}
+
+// settle updates the model with msg and the messages of the commands that
+// follow. Commands that wait, like the cursor blinking, are dropped.
+func settle(m *Model, msg tea.Msg) {
+	_, cmd := m.Update(msg)
+	for cmd != nil {
+		result := make(chan tea.Msg, 1)
+		go func() { result <- cmd() }()
+		select {
+		case next := <-result:
+			if next == nil {
+				return
+			}
+			_, cmd = m.Update(next)
+		case <-time.After(20 * time.Millisecond):
+			return
+		}
+	}
+}
+
+// names lists the full names of the visible credentials
+func names(m *Model) []string {
+	var out []string
+	for _, cred := range m.visible {
+		out = append(out, fullName(cred))
+	}
+	return out
+}
+
+func TestModelFilter(t *testing.T) {
+	m := newTestModel(t,
+		structs.Credential{Name: "mail", Username: "user", Password: "password1", Tags: []string{"email"}},
+		structs.Credential{Name: "Bank", Username: "user", Password: "password2", Description: "savings"},
+		structs.Credential{Name: "chat", Username: "someone", Password: "password3", Tags: []string{"email", "work"}},
+	)
+	if got := names(m); !slices.Equal(got, []string{"Bank", "chat", "mail"}) {
+		t.Fatalf("list = %q", got)
+	}
+
+	tests := []struct {
+		name string
+		keys []string
+		want []string
+	}{
+		{"search", []string{"/", "s", "a", "v", "enter"}, []string{"Bank"}},
+		{"every word", []string{"/", "u", "s", "e", "r", " ", "m", "a", "enter"}, []string{"mail"}},
+		{"search dropped", []string{"/", "x", "esc"}, []string{"Bank", "chat", "mail"}},
+		{"tag", []string{"t", "j", "j", "enter"}, []string{"chat"}},
+		{"tag and search", []string{"t", "j", "enter", "/", "u", "s", "e", "r", "enter"}, []string{"mail"}},
+		{"filters dropped", []string{"t", "j", "enter", "esc"}, []string{"Bank", "chat", "mail"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			press(m, "esc")
+			press(m, tt.keys...)
+			if got := names(m); !slices.Equal(got, tt.want) {
+				t.Fatalf("list = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModelChanges(t *testing.T) {
+	m := newTestModel(t, structs.Credential{Name: "mail", Username: "user", Password: "password1\nsecond line", Description: "a\nb"})
+
+	// Saving without edits keeps what the inputs can't show
+	press(m, "e", "ctrl+s")
+	if m.err != nil || m.state != stateList || m.status != "Saved mail" {
+		t.Fatalf("after saving: state %d, status %q, err %v", m.state, m.status, m.err)
+	}
+	if cred := m.selected(); cred.Password != "password1\nsecond line" || cred.Description != "a\nb" {
+		t.Fatalf("saved %+v", cred)
+	}
+
+	// A refused save leaves the form open
+	press(m, "n", "b", "a", "d", "ctrl+s")
+	if m.state != stateEdit || m.editor.err == nil {
+		t.Fatalf("a new credential without a password was saved: state %d", m.state)
+	}
+	press(m, "tab", "tab", "u", "s", "e", "r", "ctrl+g", "enter", "ctrl+s")
+	if m.state != stateList || m.status != "Added bad" {
+		t.Fatalf("after adding: state %d, status %q, err %v", m.state, m.status, m.err)
+	}
+	if got := names(m); !slices.Equal(got, []string{"bad", "mail"}) {
+		t.Fatalf("list = %q", got)
+	}
+	if password := m.visible[0].Password; len(password) < 8 || strings.ContainsAny(password, "\n ") {
+		t.Fatalf("generated password %q", password)
+	}
+
+	press(m, "d", "n")
+	if len(m.visible) != 2 {
+		t.Fatal("a declined delete removed the credential")
+	}
+	// The selection stayed on mail while the list changed
+	press(m, "k", "d", "y")
+	if got := names(m); !slices.Equal(got, []string{"mail"}) || m.status != "Deleted bad" {
+		t.Fatalf("list after deleting = %q, status %q", got, m.status)
+	}
+
+	if view := m.View(); !strings.Contains(view, "mail") || strings.Contains(view, "password1") {
+		t.Fatalf("the view shows a masked password or misses the credential:\n%s", view)
+	}
+	press(m, "r")
+	if !strings.Contains(m.View(), "password1") {
+		t.Fatal("the revealed password isn't shown")
+	}
+}
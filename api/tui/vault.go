@@ -0,0 +1,98 @@
+package tui
+
+import (
+	"passvault/client"
+	"passvault/db"
+	"passvault/store"
+	"passvault/structs"
+)
+
+// Vault is what the TUI browses and edits, either a store opened on this
+// machine or a server reached over its API
+type Vault interface {
+	// Credentials returns every live credential
+	Credentials() ([]structs.Credential, error)
+	Tags() ([]structs.Tag, error)
+	Folders() ([]structs.Folder, error)
+	Create(cred structs.Credential) (int, error)
+	Update(id int, cred structs.Credential) error
+	Delete(id int) error
+}
+
+// LocalVault browses a store opened on this machine
+func LocalVault(s store.Store) Vault {
+	return localVault{s}
+}
+
+type localVault struct {
+	store store.Store
+}
+
+func (v localVault) Credentials() ([]structs.Credential, error) {
+	var credentials []structs.Credential
+	opts := structs.ListOptions{Limit: db.MaxListLimit}
+	for {
+		page, err := v.store.ListCredentials(opts)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, page.Credentials...)
+		if page.NextCursor == "" {
+			return credentials, nil
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+func (v localVault) Tags() ([]structs.Tag, error) {
+	return v.store.GetTags()
+}
+
+func (v localVault) Folders() ([]structs.Folder, error) {
+	return v.store.GetFolders(false)
+}
+
+func (v localVault) Create(cred structs.Credential) (int, error) {
+	return v.store.CreateCredential(cred)
+}
+
+func (v localVault) Update(id int, cred structs.Credential) error {
+	return v.store.UpdateCredential(id, cred)
+}
+
+func (v localVault) Delete(id int) error {
+	return v.store.DeleteCredential(id)
+}
+
+// RemoteVault browses the vault of a server
+func RemoteVault(c *client.Client) Vault {
+	return remoteVault{c}
+}
+
+type remoteVault struct {
+	client *client.Client
+}
+
+func (v remoteVault) Credentials() ([]structs.Credential, error) {
+	return v.client.AllCredentials(nil)
+}
+
+func (v remoteVault) Tags() ([]structs.Tag, error) {
+	return v.client.GetTags()
+}
+
+func (v remoteVault) Folders() ([]structs.Folder, error) {
+	return v.client.GetFolders()
+}
+
+func (v remoteVault) Create(cred structs.Credential) (int, error) {
+	return v.client.CreateCredential(cred)
+}
+
+func (v remoteVault) Update(id int, cred structs.Credential) error {
+	return v.client.UpdateCredential(id, cred)
+}
+
+func (v remoteVault) Delete(id int) error {
+	return v.client.DeleteCredential(id)
+}
@@ -0,0 +1,283 @@
+// Package urlmatch finds the credentials to fill in on a page by their URLs.
+// Every credential picks how its URLs match in its match field. Hosts are
+// compared in their ASCII form, so internationalized names match whether
+// they were saved in Unicode or punycode, and base domains come from the
+// Public Suffix List embedded in golang.org/x/net/publicsuffix.
+package urlmatch
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"passvault/structs"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// Field is the custom field a credential picks its strategy with
+const Field = "match"
+
+// Strategies a credential matches pages with
+const (
+	// Domain matches pages on the base domain of a URL and its subdomains,
+	// accounts.example.com for example.com. It is the default.
+	Domain = "domain"
+	// Host matches pages on the host and port of a URL
+	Host = "host"
+	// StartsWith matches pages whose URL starts with a URL
+	StartsWith = "starts_with"
+	// Regex takes the URLs for regular expressions the whole URL of a page
+	// has to match. They are anchored at both ends, so an expression for
+	// https://example.com/ doesn't match https://example.com.evil.test/ or
+	// a page carrying it in its query.
+	Regex = "regex"
+	// Never keeps the credential from matching any page
+	Never = "never"
+)
+
+// Strategies lists every strategy
+var Strategies = []string{Domain, Host, StartsWith, Regex, Never}
+
+// Scores of matches, better matches score higher
+const (
+	// ScoreDomain is a page on the base domain of a URL, on another host
+	ScoreDomain = 1
+	// ScoreHost is a page on the host of a URL
+	ScoreHost = 2
+	// ScoreURL is a page starting with a URL or matching its regular
+	// expression
+	ScoreURL = 3
+)
+
+// noMatch is the score of a URL not matching a page
+const noMatch = 0
+
+// Match is a credential matching a page
+type Match struct {
+	structs.Credential
+	// MatchedURL is the URL of the credential that matched best
+	MatchedURL string `json:"matched_url"`
+	Strategy   string `json:"strategy"`
+	Score      int    `json:"score"`
+}
+
+// Strategy returns the strategy a credential picked, Domain when it has no
+// match field
+func Strategy(cred structs.Credential) string {
+	for _, field := range cred.Fields {
+		if strings.EqualFold(field.Name, Field) {
+			if strategy := strings.ToLower(strings.TrimSpace(field.Value)); strategy != "" {
+				return strategy
+			}
+		}
+	}
+	return Domain
+}
+
+// Validate checks the strategy of a credential, and that its URLs are
+// regular expressions when it matches by them
+func Validate(cred structs.Credential) error {
+	strategy := Strategy(cred)
+	if !slices.Contains(Strategies, strategy) {
+		return fmt.Errorf("unknown match strategy %q, use one of %s", strategy, strings.Join(Strategies, ", "))
+	}
+	if strategy == Regex {
+		for _, raw := range cred.URLs {
+			if _, err := compileRegex(raw); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ParsePage parses the URL of a page to match against, which needs a
+// scheme and a host
+func ParsePage(raw string) (*url.URL, error) {
+	if !strings.Contains(raw, "://") {
+		return nil, errors.New("must be an absolute URL")
+	}
+	page, _, err := parse(raw)
+	return page, err
+}
+
+// Find returns the credentials matching a page parsed with ParsePage, best
+// first. Of the ones matching by URL the longer URLs come first, equally
+// good matches are ordered by when they were used last.
+func Find(credentials []structs.Credential, page *url.URL) []Match {
+	matches := []Match{}
+	for _, cred := range credentials {
+		strategy := Strategy(cred)
+		if strategy == Never {
+			continue
+		}
+		best := Match{Credential: cred, Strategy: strategy}
+		for _, raw := range cred.URLs {
+			score := scoreURL(strategy, raw, page)
+			if score > best.Score || (score == ScoreURL && best.Score == ScoreURL && len(raw) > len(best.MatchedURL)) {
+				best.MatchedURL, best.Score = raw, score
+			}
+		}
+		if best.Score != noMatch {
+			matches = append(matches, best)
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b Match) int {
+		return cmp.Or(
+			cmp.Compare(b.Score, a.Score),
+			cmp.Compare(urlLength(b), urlLength(a)),
+			compareLastUsed(a.Credential, b.Credential),
+			strings.Compare(a.Name, b.Name),
+		)
+	})
+	return matches
+}
+
+// urlLength is the length of the URL a credential matched by, which tells
+// how specific it is, 0 for matches by host or domain
+func urlLength(m Match) int {
+	if m.Score != ScoreURL {
+		return 0
+	}
+	return len(m.MatchedURL)
+}
+
+// compareLastUsed orders credentials by when they were used, the one used
+// last first and never used ones at the end
+func compareLastUsed(a, b structs.Credential) int {
+	switch {
+	case a.LastUsedAt == nil && b.LastUsedAt == nil:
+		return 0
+	case a.LastUsedAt == nil:
+		return 1
+	case b.LastUsedAt == nil:
+		return -1
+	}
+	return b.LastUsedAt.Compare(*a.LastUsedAt)
+}
+
+// scoreURL scores a URL of a credential for a page
+func scoreURL(strategy, raw string, page *url.URL) int {
+	if strategy == Regex {
+		re, err := compileRegex(raw)
+		if err != nil || !re.MatchString(page.String()) {
+			return noMatch
+		}
+		return ScoreURL
+	}
+
+	u, schemeless, err := parse(raw)
+	if err != nil {
+		return noMatch
+	}
+	// A URL without a scheme matches either, one with http pages upgraded
+	// to https. Passwords for https pages are never filled in over http.
+	if schemeless || (u.Scheme == "http" && page.Scheme == "https") {
+		u.Scheme = page.Scheme
+	}
+	if u.Scheme != page.Scheme {
+		return noMatch
+	}
+
+	switch strategy {
+	case StartsWith:
+		// Parsed URLs have a path, so a host never is the prefix of another
+		if strings.HasPrefix(page.String(), u.String()) {
+			return ScoreURL
+		}
+	case Host:
+		if u.Host == page.Host {
+			return ScoreHost
+		}
+	case Domain:
+		// Only a URL naming a port restricts the port
+		if u.Port() != "" && u.Port() != page.Port() {
+			return noMatch
+		}
+		if u.Hostname() == page.Hostname() {
+			return ScoreHost
+		}
+		if baseDomain(u.Hostname()) == baseDomain(page.Hostname()) {
+			return ScoreDomain
+		}
+	}
+	return noMatch
+}
+
+// compileRegex compiles a URL of a credential matching by Regex, anchored
+// so it has to match the whole URL of a page. The expression is checked on
+// its own first, so one like a)|(b can't break out of the group.
+func compileRegex(raw string) (*regexp.Regexp, error) {
+	if _, err := regexp.Compile(raw); err != nil {
+		return nil, err
+	}
+	return regexp.Compile("^(?:" + raw + ")$")
+}
+
+// parse parses and normalizes a URL: the scheme and host in lower case, the
+// host in ASCII, without the default port of the scheme, and a path of at
+// least /. A URL without a scheme is taken for https, and reported.
+func parse(raw string) (u *url.URL, schemeless bool, err error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw, schemeless = "https://"+raw, true
+	}
+	u, err = url.Parse(raw)
+	if err != nil {
+		return nil, false, err
+	}
+	if u.Hostname() == "" {
+		return nil, false, errors.New("must have a host")
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := asciiHost(u.Hostname())
+	port := u.Port()
+	if (u.Scheme == "https" && port == "443") || (u.Scheme == "http" && port == "80") {
+		port = ""
+	}
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.User, u.Fragment, u.RawFragment = nil, "", ""
+	return u, schemeless, nil
+}
+
+// asciiHost returns a host in lower case ASCII, with internationalized
+// names in punycode. Names IDNA refuses are kept as they are.
+func asciiHost(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		return ascii
+	}
+	return host
+}
+
+// baseDomain returns the registrable domain of a host, the host itself for
+// IP addresses and names without a public suffix
+func baseDomain(host string) string {
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	if domain, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return domain
+	}
+	return host
+}
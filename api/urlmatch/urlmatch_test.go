@@ -0,0 +1,133 @@
+package urlmatch
+
+import (
+	"passvault/structs"
+	"testing"
+	"time"
+)
+
+func TestScoreURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		url      string
+		page     string
+		want     int
+	}{
+		{"domain on the host", Domain, "https://example.com", "https://example.com/login", ScoreHost},
+		{"domain on a subdomain", Domain, "https://example.com", "https://accounts.example.com/", ScoreDomain},
+		{"domain on a public suffix", Domain, "https://a.github.io", "https://b.github.io/", noMatch},
+		{"domain without a scheme", Domain, "example.com", "http://example.com/", ScoreHost},
+		{"domain http upgraded", Domain, "http://example.com", "https://example.com/", ScoreHost},
+		{"domain https never downgraded", Domain, "https://example.com", "http://example.com/", noMatch},
+		{"domain port", Domain, "https://example.com:8443", "https://example.com/", noMatch},
+		{"domain punycode", Domain, "https://bücher.de", "https://xn--bcher-kva.de/", ScoreHost},
+		{"host", Host, "https://example.com", "https://example.com/", ScoreHost},
+		{"host on a subdomain", Host, "https://example.com", "https://accounts.example.com/", noMatch},
+		{"host default port", Host, "https://example.com:443", "https://example.com/", ScoreHost},
+		{"starts with", StartsWith, "https://example.com/app", "https://example.com/app/login", ScoreURL},
+		{"starts with another path", StartsWith, "https://example.com/app", "https://example.com/other", noMatch},
+		{"starts with another host", StartsWith, "https://example.com", "https://example.com.evil.test/", noMatch},
+		{"regex", Regex, `https://example\.com/.*`, "https://example.com/login", ScoreURL},
+		{"regex alternatives", Regex, `https://a\.example\.com/|https://b\.example\.com/`, "https://b.example.com/", ScoreURL},
+		{"regex anchored at the start", Regex, `example\.com/`, "https://evil.test/?next=https://example.com/", noMatch},
+		{"regex anchored at the end", Regex, `https://example\.com`, "https://example.com.evil.test/", noMatch},
+		{"regex host only", Regex, `https://example\.com`, "https://example.com/", noMatch},
+		{"regex invalid", Regex, `https://(`, "https://example.com/", noMatch},
+		{"regex breaking out", Regex, `x)|(.*`, "https://example.com/", noMatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := ParsePage(tt.page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := scoreURL(tt.strategy, tt.url, page); got != tt.want {
+				t.Fatalf("scoreURL(%s, %q, %q) = %d, want %d", tt.strategy, tt.url, page, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		cred  structs.Credential
+		valid bool
+	}{
+		{"default", structs.Credential{URLs: []string{"not a regex ("}}, true},
+		{"strategy in any case", structs.Credential{Fields: []structs.CustomField{{Name: "Match", Value: " Host "}}}, true},
+		{"unknown strategy", structs.Credential{Fields: []structs.CustomField{{Name: Field, Value: "exact"}}}, false},
+		{"regex", structs.Credential{URLs: []string{`https://example\.com/.*`}, Fields: []structs.CustomField{{Name: Field, Value: Regex}}}, true},
+		{"invalid regex", structs.Credential{URLs: []string{`https://(`}, Fields: []structs.CustomField{{Name: Field, Value: Regex}}}, false},
+		{"regex breaking out", structs.Credential{URLs: []string{`x)|(.*`}, Fields: []structs.CustomField{{Name: Field, Value: Regex}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.cred); (err == nil) != tt.valid {
+				t.Fatalf("Validate = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestParsePage(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+		err  bool
+	}{
+		{raw: "HTTPS://User:pw@Example.COM:443#top", want: "https://example.com/"},
+		{raw: "http://example.com:8080/a?b=c", want: "http://example.com:8080/a?b=c"},
+		{raw: "https://[::1]:443/", want: "https://[::1]/"},
+		{raw: "example.com", err: true},
+		{raw: "file:///etc/passwd", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			page, err := ParsePage(tt.raw)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("ParsePage = %v, want an error", page)
+				}
+				return
+			}
+			if err != nil || page.String() != tt.want {
+				t.Fatalf("ParsePage = %v, %v, want %s", page, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	used := time.Now()
+	regex := []structs.CustomField{{Name: Field, Value: Regex}}
+	credentials := []structs.Credential{
+		{Name: "domain", URLs: []string{"https://example.com"}},
+		{Name: "subdomain", URLs: []string{"https://accounts.example.com"}},
+		{Name: "host used", URLs: []string{"https://app.example.com"}, LastUsedAt: &used},
+		{Name: "host", URLs: []string{"https://app.example.com"}},
+		{Name: "prefix", URLs: []string{"https://app.example.com/"}, Fields: []structs.CustomField{{Name: Field, Value: StartsWith}}},
+		{Name: "longer prefix", URLs: []string{"https://app.example.com/login"}, Fields: []structs.CustomField{{Name: Field, Value: StartsWith}}},
+		{Name: "regex", URLs: []string{`https://app\.example\.com/.*`}, Fields: regex},
+		{Name: "unanchored regex", URLs: []string{`app\.example\.com`}, Fields: regex},
+		{Name: "never", URLs: []string{"https://app.example.com"}, Fields: []structs.CustomField{{Name: Field, Value: Never}}},
+		{Name: "other", URLs: []string{"https://other.test"}},
+	}
+	page, err := ParsePage("https://app.example.com/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The regex is as long as the longer prefix, the tie goes by name
+	want := []string{"longer prefix", "regex", "prefix", "host used", "host", "domain", "subdomain"}
+	matches := Find(credentials, page)
+	if len(matches) != len(want) {
+		t.Fatalf("Find = %d matches, want %d", len(matches), len(want))
+	}
+	for i, m := range matches {
+		if m.Name != want[i] {
+			t.Fatalf("match %d = %s (%s, %d), want %s", i, m.Name, m.MatchedURL, m.Score, want[i])
+		}
+	}
+}
@@ -1,8 +1,16 @@
 package validate
 
 import (
+	"encoding/base32"
+	"fmt"
+	"net/url"
 	"passvault/response"
 	"passvault/structs"
+	"passvault/urlmatch"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
 )
 
 // ValidateCredential checks if the provided credential is valid.
@@ -11,6 +19,7 @@ type ValidateCredential struct {
 	PasswordMaxLength int `json:"password_max_length"`
 	UsernameMinLength int `json:"username_min_length"`
 	UsernameMaxLength int `json:"username_max_length"`
+	AttachmentMaxSize int `json:"attachment_max_size"`
 }
 
 func NewValidateCredential() *ValidateCredential {
@@ -19,17 +28,95 @@ func NewValidateCredential() *ValidateCredential {
 		PasswordMaxLength: 64,
 		UsernameMinLength: 3,
 		UsernameMaxLength: 32,
+		AttachmentMaxSize: 1 << 20,
 	}
 }
 
+// Registry and git items keep whatever login a server hands out: tokens and
+// service account keys running far longer than passwords, under usernames
+// as short as a single character
+const (
+	registryPasswordMaxLength = 16 << 10
+	registryUsernameMaxLength = 255
+)
+
+// sshKeyMaxLength fits the private key of a 16384 bit RSA key
+const sshKeyMaxLength = 16 << 10
+
+// secretMaxLength is how long the text secrets of applications may be,
+// binary ones are kept as attachments
+const secretMaxLength = 64 << 10
+
 // Validate checks if the credential meets the validation criteria.
 func (v *ValidateCredential) Validate(cred structs.Credential) error {
-	if len(cred.Password) < v.PasswordMinLength || len(cred.Password) > v.PasswordMaxLength {
+	passwordMin, passwordMax := v.PasswordMinLength, v.PasswordMaxLength
+	usernameMin, usernameMax := v.UsernameMinLength, v.UsernameMaxLength
+	switch cred.ItemType {
+	case structs.ItemTypeRegistry, structs.ItemTypeGit:
+		passwordMin, passwordMax = min(passwordMin, 1), max(passwordMax, registryPasswordMaxLength)
+		usernameMin, usernameMax = min(usernameMin, 1), max(usernameMax, registryUsernameMaxLength)
+	case structs.ItemTypeSSHKey:
+		// The password holds the private key, a username is up to the user
+		passwordMax, usernameMin = max(passwordMax, sshKeyMaxLength), 0
+	case structs.ItemTypeSecret:
+		// Applications store whatever they have, an empty secret included
+		passwordMin, passwordMax, usernameMin = 0, max(passwordMax, secretMaxLength), 0
+	}
+	// Secure notes may leave out the username and password
+	note := cred.ItemType == structs.ItemTypeSecureNote
+	if (!note || cred.Password != "") && (len(cred.Password) < passwordMin || len(cred.Password) > passwordMax) {
 		return response.ErrInvalidPassword
 	}
-	if len(cred.Username) < v.UsernameMinLength || len(cred.Username) > v.UsernameMaxLength {
+	if (!note || cred.Username != "") && (len(cred.Username) < usernameMin || len(cred.Username) > usernameMax) {
 		return response.ErrInvalidUsername
 	}
+	if cred.ItemType != "" && !slices.Contains(structs.ItemTypes, cred.ItemType) {
+		return response.ErrInvalidItemType
+	}
+	if cred.ItemType == structs.ItemTypeSSHKey && !validSSHKey(cred.Password) {
+		return response.ErrInvalidSSHKey
+	}
+	if cred.TOTP != "" && !validTOTP(cred.TOTP) {
+		return response.ErrInvalidTOTP
+	}
+	for _, field := range cred.Fields {
+		if strings.TrimSpace(field.Name) == "" {
+			return response.ErrInvalidField
+		}
+	}
+	// The fields of secrets are attributes of an application, whatever
+	// their names
+	if cred.ItemType != structs.ItemTypeSecret {
+		if err := urlmatch.Validate(cred); err != nil {
+			return fmt.Errorf("%w: %w", response.ErrInvalidMatch, err)
+		}
+	}
+	for _, attachment := range cred.Attachments {
+		if strings.TrimSpace(attachment.Name) == "" || len(attachment.Data) > v.AttachmentMaxSize {
+			return response.ErrInvalidAttachment
+		}
+	}
 	return nil
 }
 
+// validTOTP reports whether a TOTP secret is base32, or an otpauth:// URI
+// carrying a base32 secret
+func validTOTP(secret string) bool {
+	if strings.HasPrefix(secret, "otpauth://") {
+		uri, err := url.Parse(secret)
+		if err != nil {
+			return false
+		}
+		secret = uri.Query().Get("secret")
+	}
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	_, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+	return secret != "" && err == nil
+}
+
+// validSSHKey reports whether key is a private key ssh can use without a
+// passphrase
+func validSSHKey(key string) bool {
+	_, err := ssh.ParseRawPrivateKey([]byte(key))
+	return err == nil
+}
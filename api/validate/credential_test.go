@@ -0,0 +1,37 @@
+package validate
+
+import (
+	"errors"
+	"passvault/response"
+	"passvault/structs"
+	"strings"
+	"testing"
+)
+
+func TestValidateLimits(t *testing.T) {
+	token := strings.Repeat("t", 200)
+	tests := []struct {
+		name string
+		cred structs.Credential
+		want error
+	}{
+		{"login", structs.Credential{Name: "a", Username: "dev", Password: "hunter22"}, nil},
+		{"login token", structs.Credential{Name: "a", Username: "dev", Password: token}, response.ErrInvalidPassword},
+		{"login short username", structs.Credential{Name: "a", Username: "x", Password: "hunter22"}, response.ErrInvalidUsername},
+		{"git token", structs.Credential{Name: "a", Username: "x", Password: token, ItemType: structs.ItemTypeGit}, nil},
+		{"git without password", structs.Credential{Name: "a", Username: "x", ItemType: structs.ItemTypeGit}, response.ErrInvalidPassword},
+		{"git too long", structs.Credential{Name: "a", Username: "x", Password: strings.Repeat("t", registryPasswordMaxLength+1), ItemType: structs.ItemTypeGit}, response.ErrInvalidPassword},
+		{"registry token", structs.Credential{Name: "a", Username: "x", Password: token, ItemType: structs.ItemTypeRegistry}, nil},
+		{"registry without username", structs.Credential{Name: "a", Password: token, ItemType: structs.ItemTypeRegistry}, response.ErrInvalidUsername},
+		{"secure note", structs.Credential{Name: "a", ItemType: structs.ItemTypeSecureNote}, nil},
+		{"secret", structs.Credential{Name: "a", ItemType: structs.ItemTypeSecret}, nil},
+		{"unknown type", structs.Credential{Name: "a", Username: "dev", Password: "hunter22", ItemType: "card"}, response.ErrInvalidItemType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NewValidateCredential().Validate(tt.cred); !errors.Is(err, tt.want) {
+				t.Fatalf("Validate = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
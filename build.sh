@@ -21,13 +21,14 @@ rm -rf api/static
 cp -r ui/build api/static
 rm -rf ui/build
 
-# Copy database to static directory for embedding
-echo "Copying database for embedding..."
+# Copy database to static directory for embedding. It is only used as the
+# template for new vaults, the running vault lives in the data directory.
+echo "Copying database template for embedding..."
 if [ -f "api/credentials.sqlite" ]; then
     cp api/credentials.sqlite api/static/
-    echo "Database embedded successfully"
+    echo "Database template embedded successfully"
 else
-    echo "Warning: credentials.sqlite not found - app will create a new database"
+    echo "Warning: credentials.sqlite not found - new vaults will start empty"
 fi
 
 # Build the Go binary
@@ -36,4 +37,4 @@ cd api
 go build -o passvault
 
 echo "Build complete! Binary: api/passvault"
-echo "The UI and database are now embedded in the binary."
+echo "The UI and database template are now embedded in the binary."
@@ -5,26 +5,41 @@ type FetchResponse = {
   errors: string[];
 };
 
+// FetchCredentials follows next_cursor until the last page, so the list holds
+// every credential rather than only the first page
 export const FetchCredentials = async (): Promise<FetchResponse> => {
-  return fetch("http://localhost:8200/api/v1/credentials", {
-    method: "GET",
-    headers: {
-      "Content-Type": "application/json",
-    },
-  })
-    .then(async (response) => {
+  const credentials: Credential[] = [];
+  let cursor = "";
+  try {
+    do {
+      const params = new URLSearchParams({ limit: "500" });
+      if (cursor) {
+        params.set("cursor", cursor);
+      }
+      const response = await fetch(
+        `http://localhost:8200/api/v1/credentials?${params}`,
+        {
+          method: "GET",
+          headers: {
+            "Content-Type": "application/json",
+          },
+        }
+      );
       if (!response.ok) {
         throw new Error("Network response was not ok");
       }
-      return { credentials: await response.json(), errors: [] };
-    })
-    .catch((error) => {
-      console.error(
-        "There has been a problem with your fetch operation:",
-        error
-      );
-      return { credentials: [], errors: [error.message] };
-    });
+      const page = await response.json();
+      credentials.push(...page.credentials);
+      cursor = page.next_cursor ?? "";
+    } while (cursor);
+    return { credentials, errors: [] };
+  } catch (error) {
+    console.error("There has been a problem with your fetch operation:", error);
+    return {
+      credentials: [],
+      errors: [error instanceof Error ? error.message : String(error)],
+    };
+  }
 };
 
 export const SendCredentials = async (